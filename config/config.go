@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
 	"runtime"
 	"strings"
 
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
 )
 
 var defaultConf = []byte(`
@@ -16,16 +20,92 @@ core:
   address: "" # ip address to bind (default: any)
   port: "8088" # ignore this port number if auto_tls is enabled (listen 443).
   worker_num: 0 # default worker number is runtime.NumCPU()
+  ios_worker_num: 0 # dedicated iOS worker number, zero shares the worker_num pool
+  android_worker_num: 0 # dedicated Android worker number, zero shares the worker_num pool
+  min_workers: 1 # the least workers of worker_num pool when autoscale removes workers
+  max_workers: 0 # autoscale worker_num pool up to the number by queue depth, zero is disabled
+  scale_up_queue_depth: 100 # add workers when the queue depth stays at or over it for scale_up_interval
+  scale_up_interval: 10 # seconds
+  scale_down_interval: 60 # remove idle workers when the queue stays empty for the seconds
   queue_num: 0 # default queue number is 8192
+  queue_high_water_mark: 0 # reject push request with 503 when worker queue depth reaches it, zero is disabled
+  queue_full_policy: "reject" # block, reject or overflow to storage when worker queue is full
   max_notification: 100
+  max_tokens_per_notification: 100000 # max number of tokens of one notification, zero is no limit
+  dedup: false # drop duplicate tokens of notifications sharing the same payload in one request
   sync: false # set true if you need get error message from fail push notification in API response.
+  dry_run: false # set true to validate notifications without delivering to APNs or FCM.
+  validate_on_start: # check credentials of providers on start by APNs push to invalid token and FCM dry run message
+    enabled: false
+    fail: true # refuse to start if any credential is invalid, false only logs warning
+  tracing: # export spans of push requests and provider deliveries to OTLP/HTTP collector
+    enabled: false
+    endpoint: "http://localhost:4318/v1/traces"
+    service_name: "gorush"
   mode: "release"
   ssl: false
   cert_path: "cert.pem"
   key_path: "key.pem"
   cert_base64: ""
   key_base64: ""
-  http_proxy: "" # only working for FCM server
+  client_ca: "" # CA certificate to verify client certificate (mTLS) with ssl or auto_tls, empty is disabled
+  tls_min_version: "1.2" # minimum TLS version of ssl or auto_tls, 1.0, 1.1, 1.2 or 1.3
+  tls_cipher_suites: "" # comma separated cipher suites of TLS 1.2 and below, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, empty is default of Go
+  client_senders: {} # allowed client certificate common name and its iOS app profile, empty allows every client verified by client_ca
+  allowed_ips: "" # comma separated IPs or CIDRs allowed to call /api, empty allows all
+  denied_ips: "" # comma separated IPs or CIDRs denied from all routes, checked before the allowed lists
+  metric_allowed_ips: "" # comma separated IPs or CIDRs allowed to call metric_uri, empty allows all
+  health_allowed_ips: "" # comma separated IPs or CIDRs allowed to call health_uri and ready_uri, empty allows all
+  trusted_proxies: "" # comma separated IPs or CIDRs of proxies whose X-Forwarded-For is used as client IP of rate limit, logs and IP filter, empty trusts nothing
+  http_proxy: "" # proxy of outbound connections to APNs, FCM and web push, HTTP_PROXY env is used if empty
+  https_proxy: "" # proxy of HTTPS connections, default as http_proxy, HTTPS_PROXY env is used if both are empty
+  no_proxy: "" # comma separated hosts connected directly, NO_PROXY env is used if empty
+  feedback_url: "" # post delivery result of every token to this url, empty is disabled.
+  feedback_timeout: 10 # timeout in seconds of feedback request
+  feedback_max_retry: 0 # resend fail feedback request with exponential backoff from 1 second up to 30 seconds, default value zero is disabled
+  feedback_concurrency: 10 # max concurrent requests of feedback_url, at least 1
+  feedback_queue_num: 0 # buffer of pending feedback and callback requests, default value zero is queue_num
+  feedback_full_policy: "drop" # drop the new or drop_oldest pending request when the feedback buffer is full
+  callback_allowed_hosts: "" # comma separated hosts of notification callback_url, e.g. "hooks.example.com,.internal.example.com", empty allows any host
+  callback_concurrency: 10 # max concurrent requests of notification callback_url, at least 1
+  transform_script: "" # path of Lua script which defines transform(notification) to change every notification before it is sent
+  job_ttl: 3600 # seconds to keep status of async push job in storage
+  max_invalid_token: 10000 # max number of invalid tokens kept for /api/invalid-tokens, the least recently reported one is evicted, zero is disabled
+  shutdown_timeout: 30 # seconds to wait for draining worker queues on shutdown, left notifications are saved to storage
+  request_timeout: 0 # seconds of request before it is aborted with 503, default value zero is no timeout
+  max_body_size: 33554432 # max bytes of request body, larger body is rejected with 413, default value zero is no limit
+  max_connections: 0 # max concurrent http connections, more connections wait until one is closed, default value zero is no limit
+  rate_limit: 0 # requests per second of each client (basic auth username or client IP), default value zero is disabled
+  rate_limit_burst: 0 # max burst requests of each client, default value zero is same as rate_limit
+  http_compression: false # decompress gzip request body and compress response if client accepts gzip
+  h2c: false # serve HTTP/2 without TLS (h2c), can not be enabled with ssl or auto_tls
+  root_response: '{"text":"Welcome to notification server."}' # JSON body of root path, empty disables the root route
+  circuit_breaker: # fail notifications fast while push provider is down
+    failure_threshold: 0 # consecutive provider failures to open the circuit, default value zero is disabled
+    cooldown: 30 # seconds the open circuit rejects notifications before one probe is sent
+  dead_letter: # keep notifications failed after all retries for audit and replay
+    engine: "" # file, redis or storage (stat engine), empty is disabled
+    path: "dead-letter.json" # file of file engine
+    redis:
+      addr: "localhost:6379"
+      password: ""
+      db: 0
+      key: "gorush-dead-letter" # redis list of dead-letter notifications
+    max_size: 10000 # max number of notifications kept, the oldest one is evicted
+    ttl: 604800 # seconds to keep notification, default value zero never expires
+  schedule: # notifications with send_at are saved to stat storage and enqueued at that time
+    max_delay: 2592000 # max seconds of send_at in the future, zero disables scheduling
+  alert: # post Slack-compatible webhook when push failures of provider spike
+    url: "" # webhook url, empty is disabled
+    threshold: 0.5 # failure rate from 0 to 1 of provider over window to alert
+    window: 300 # seconds of rolling window of failure rate
+    cooldown: 1800 # seconds before the same provider is alerted again
+  response_format: # response of successful push
+    logs: true # include push logs, overridden by ?logs=false or ?logs=true query
+    request_id: false # include request_id of the request
+  idempotency: # replay response of request with the same Idempotency-Key header
+    enabled: false
+    ttl: 86400 # seconds the response is kept
   pid:
     enabled: false
     path: "gorush.pid"
@@ -47,11 +127,28 @@ api:
   sys_stat_uri: "/sys/stats"
   metric_uri: "/metrics"
   health_uri: "/healthz"
+  ready_uri: "/api/ready" # readiness of APNs and FCM connectivity, 503 if any provider is failing
+  hide_version: false # disable version API and X-GORUSH-VERSION header
+  disabled_routes: "" # comma separated routes to disable, e.g. "config,sys,metrics"
+  metrics_auth:
+    enabled: false # metrics route uses its own credentials instead of auth, only core.metric_allowed_ips applies if no credential is set
+    username: ""
+    password: ""
+    token: "" # bearer token of metrics route
 
 android:
   enabled: true
+  api_version: "v1" # v1 uses service account credential, legacy uses apikey
   apikey: "YOUR_API_KEY"
+  credential: "" # path of service account JSON of Firebase project
+  credential_json: "" # inline service account JSON
   max_retry: 0 # resend fail notification, default value zero is disabled
+  retry: # backoff retry of transient FCM errors (Unavailable or HTTP 5xx)
+    max_attempts: 0 # default value zero is disabled
+    base_delay: 500 # milliseconds of first retry delay, doubled on every attempt
+    max_delay: 30000 # milliseconds of max retry delay
+  max_payload_size: 4096 # max bytes of FCM data and notification payload, larger notification is rejected, zero is disabled
+  apps: {} # named Firebase projects with own apikey or credential, selected by "app" field of notification
 
 ios:
   enabled: false
@@ -63,14 +160,51 @@ ios:
   max_retry: 0 # resend fail notification, default value zero is disabled
   key_id: "" # KeyID from developer account (Certificates, Identifiers & Profiles -> Keys)
   team_id: "" # TeamID from developer account (View Account -> Membership)
+  topic: "" # bundle ID of default app, topic of notification must be it or it with .voip, .complication suffix. empty allows any topic
+  conn_pool_size: 1 # number of HTTP/2 connections to APNs, notifications are sent round-robin on healthy connections
+  health_check_interval: 30 # seconds between HTTP/2 ping of APNs connections, default value zero is disabled
+  keep_alive: 60 # seconds of TCP keep-alive period of APNs connections, zero is disabled
+  dial_timeout: 20 # seconds to connect APNs and finish TLS handshake, zero is unlimited
+  read_timeout: 60 # seconds to wait for the response of APNs, zero is unlimited
+  write_timeout: 0 # seconds a write to APNs connection can block before the connection is closed, zero is unlimited
+  idle_ping_interval: 0 # seconds without any frame from APNs before HTTP/2 ping keeps the connection warm, zero is disabled
+  max_payload_size: 4096 # max bytes of APNs payload, larger notification is rejected, zero is disabled
+  max_voip_payload_size: 5120 # max bytes of APNs VoIP payload, zero is disabled
+  image_key: "image" # custom payload key of the "image" URL of notification, read by Notification Service Extension
+  apps: {} # named app profiles with own key and topic, selected by "app" field of notification
+
+web:
+  enabled: false
+  vapid_public_key: "" # VAPID public key, generate the key pair by web push library
+  vapid_private_key: "" # VAPID private key
+  subject: "" # contact of push service, mailto address or https URL
+  max_retry: 0 # resend fail notification, default value zero is disabled
+
+huawei:
+  enabled: false
+  app_id: "" # app ID of AppGallery Connect project
+  app_secret: "" # app secret of AppGallery Connect project
+  max_retry: 0 # resend fail notification, default value zero is disabled
+
+sns:
+  enabled: false
+  region: "" # AWS region of platform applications, AWS_REGION env is used if empty
+  access_key_id: "" # AWS access key, empty uses env, shared credentials file, ECS or EC2 instance role
+  secret_access_key: ""
+  session_token: ""
+  max_retry: 0 # resend fail notification, default value zero is disabled
 
 log:
   format: "string" # string or json
-  access_log: "stdout" # stdout: output to console, or define log path like "log/access_log"
+  access_log: "stdout" # stdout or stderr: output to console, none: disabled, syslog: local syslog, syslog://host:514 or syslog+tcp://host:514: remote syslog, or define log path like "log/access_log"
   access_level: "debug"
-  error_log: "stderr" # stderr: output to console, or define log path like "log/error_log"
+  error_log: "stderr" # the same outputs as access_log, e.g. "syslog"
   error_level: "error"
   hide_token: true
+  rotate: # rotation of log files, zero is disabled
+    max_size: 0 # megabytes of log file before it is rotated
+    max_age: 0 # days to keep rotated log files
+    max_backups: 0 # max number of rotated log files
 
 stat:
   engine: "memory" # support memory, redis, boltdb, buntdb or leveldb
@@ -78,6 +212,8 @@ stat:
     addr: "localhost:6379"
     password: ""
     db: 0
+    prefix: "" # key prefix of counters, replicas of the same prefix share counters
+    pool_size: 10
   boltdb:
     path: "bolt.db"
     bucket: "gorush"
@@ -85,6 +221,40 @@ stat:
     path: "bunt.db"
   leveldb:
     path: "level.db"
+
+queue:
+  engine: "local" # local, redis or nats, the shared queue of redis or nats is consumed by all gorush instances
+  redis:
+    addr: "localhost:6379"
+    password: ""
+    db: 0
+    key: "gorush-queue" # redis list of pending notifications
+    consumer_num: 0 # default consumer number is same as core.worker_num
+    visibility_timeout: 60 # seconds before notification taken by crashed consumer is requeued
+  nats:
+    url: "nats://localhost:4222"
+    stream: "gorush" # JetStream stream of subject and dead_letter_subject, created if not exists
+    subject: "gorush.notifications"
+    dead_letter_subject: "gorush.dead" # notification reached max_deliver is moved to this subject
+    durable: "gorush" # durable consumer name shared by all gorush instances
+    consumer_num: 0 # default consumer number is same as core.worker_num
+    ack_wait: 60 # seconds before unacked notification is redelivered
+    max_deliver: 5 # max delivery attempts of notification, default value zero is unlimited
+
+inbound:
+  engine: "" # consume push requests of nats subject or redis list, empty is disabled
+  consumer_num: 0 # default consumer number is same as core.worker_num
+  nats:
+    url: "nats://localhost:4222"
+    subject: "gorush.requests"
+    queue: "gorush" # queue group of gorush instances, each request is consumed by one of them
+    result_subject: "" # publish the result of each request to subject, empty is disabled
+  redis:
+    addr: "localhost:6379"
+    password: ""
+    db: 0
+    key: "gorush-requests" # redis list of push requests, pushed by RPUSH
+    result_key: "" # push the result of each request to redis list, empty is disabled
 `)
 
 // ConfYaml is config structure.
@@ -93,30 +263,86 @@ type ConfYaml struct {
 	API     SectionAPI     `yaml:"api"`
 	Android SectionAndroid `yaml:"android"`
 	Ios     SectionIos     `yaml:"ios"`
+	Web     SectionWeb     `yaml:"web"`
+	Huawei  SectionHuawei  `yaml:"huawei"`
+	SNS     SectionSNS     `yaml:"sns"`
 	Log     SectionLog     `yaml:"log"`
 	Stat    SectionStat    `yaml:"stat"`
+	Queue   SectionQueue   `yaml:"queue"`
+	Inbound SectionInbound `yaml:"inbound"`
 	GRPC    SectionGRPC    `yaml:"grpc"`
 	Auth    SectionAuth    `yaml:"auth"`
 }
 
 // SectionCore is sub section of config.
 type SectionCore struct {
-	Enabled         bool           `yaml:"enabled"`
-	Address         string         `yaml:"address"`
-	Port            string         `yaml:"port"`
-	MaxNotification int64          `yaml:"max_notification"`
-	WorkerNum       int64          `yaml:"worker_num"`
-	QueueNum        int64          `yaml:"queue_num"`
-	Mode            string         `yaml:"mode"`
-	Sync            bool           `yaml:"sync"`
-	SSL             bool           `yaml:"ssl"`
-	CertPath        string         `yaml:"cert_path"`
-	KeyPath         string         `yaml:"key_path"`
-	CertBase64      string         `yaml:"cert_base64"`
-	KeyBase64       string         `yaml:"key_base64"`
-	HTTPProxy       string         `yaml:"http_proxy"`
-	PID             SectionPID     `yaml:"pid"`
-	AutoTLS         SectionAutoTLS `yaml:"auto_tls"`
+	Enabled            bool                   `yaml:"enabled"`
+	Address            string                 `yaml:"address"`
+	Port               string                 `yaml:"port"`
+	MaxNotification    int64                  `yaml:"max_notification"`
+	MaxTokens          int64                  `yaml:"max_tokens_per_notification"`
+	WorkerNum          int64                  `yaml:"worker_num"`
+	IosWorkerNum       int64                  `yaml:"ios_worker_num"`
+	AndroidWorkerNum   int64                  `yaml:"android_worker_num"`
+	MinWorkers         int64                  `yaml:"min_workers"`
+	MaxWorkers         int64                  `yaml:"max_workers"`
+	ScaleUpQueueDepth  int                    `yaml:"scale_up_queue_depth"`
+	ScaleUpInterval    int64                  `yaml:"scale_up_interval"`
+	ScaleDownInterval  int64                  `yaml:"scale_down_interval"`
+	QueueNum           int64                  `yaml:"queue_num"`
+	QueueHighWaterMark int                    `yaml:"queue_high_water_mark"`
+	QueueFullPolicy    string                 `yaml:"queue_full_policy"`
+	Mode               string                 `yaml:"mode"`
+	Sync               bool                   `yaml:"sync"`
+	Dedup              bool                   `yaml:"dedup"`
+	DryRun             bool                   `yaml:"dry_run"`
+	ValidateOnStart    SectionValidateOnStart `yaml:"validate_on_start"`
+	Tracing            SectionTracing         `yaml:"tracing"`
+	SSL                bool                   `yaml:"ssl"`
+	CertPath           string                 `yaml:"cert_path"`
+	KeyPath            string                 `yaml:"key_path"`
+	CertBase64         string                 `yaml:"cert_base64" redact:"true"`
+	KeyBase64          string                 `yaml:"key_base64" redact:"true"`
+	TLSMinVersion      string                 `yaml:"tls_min_version"`
+	TLSCipherSuites    string                 `yaml:"tls_cipher_suites"`
+	ClientCA           string                 `yaml:"client_ca"`
+	ClientSenders      map[string]string      `yaml:"client_senders"`
+	AllowedIPs         string                 `yaml:"allowed_ips"`
+	DeniedIPs          string                 `yaml:"denied_ips"`
+	MetricAllowedIPs   string                 `yaml:"metric_allowed_ips"`
+	HealthAllowedIPs   string                 `yaml:"health_allowed_ips"`
+	TrustedProxies     string                 `yaml:"trusted_proxies"`
+	HTTPProxy          string                 `yaml:"http_proxy" redact:"true"`
+	HTTPSProxy         string                 `yaml:"https_proxy" redact:"true"`
+	NoProxy            string                 `yaml:"no_proxy"`
+	FeedbackURL        string                 `yaml:"feedback_url" redact:"true"`
+	FeedbackTimeout    int64                  `yaml:"feedback_timeout"`
+	FeedbackMaxRetry   int                    `yaml:"feedback_max_retry"`
+	FeedbackNum        int                    `yaml:"feedback_concurrency"`
+	FeedbackQueueNum   int64                  `yaml:"feedback_queue_num"`
+	FeedbackFullPolicy string                 `yaml:"feedback_full_policy"`
+	CallbackHosts      string                 `yaml:"callback_allowed_hosts"`
+	CallbackNum        int                    `yaml:"callback_concurrency"`
+	TransformScript    string                 `yaml:"transform_script"`
+	JobTTL             int64                  `yaml:"job_ttl"`
+	MaxInvalidToken    int                    `yaml:"max_invalid_token"`
+	ShutdownTimeout    int64                  `yaml:"shutdown_timeout"`
+	RequestTimeout     int64                  `yaml:"request_timeout"`
+	MaxBodySize        int64                  `yaml:"max_body_size"`
+	MaxConnections     int                    `yaml:"max_connections"`
+	RateLimit          float64                `yaml:"rate_limit"`
+	RateLimitBurst     int                    `yaml:"rate_limit_burst"`
+	HTTPCompression    bool                   `yaml:"http_compression"`
+	H2C                bool                   `yaml:"h2c"`
+	RootResponse       string                 `yaml:"root_response"`
+	CircuitBreaker     SectionBreaker         `yaml:"circuit_breaker"`
+	DeadLetter         SectionDeadLetter      `yaml:"dead_letter"`
+	Schedule           SectionSchedule        `yaml:"schedule"`
+	Alert              SectionAlert           `yaml:"alert"`
+	ResponseFormat     SectionResponse        `yaml:"response_format"`
+	Idempotency        SectionIdempotency     `yaml:"idempotency"`
+	PID                SectionPID             `yaml:"pid"`
+	AutoTLS            SectionAutoTLS         `yaml:"auto_tls"`
 }
 
 // SectionAutoTLS support Let's Encrypt setting.
@@ -128,50 +354,157 @@ type SectionAutoTLS struct {
 
 // SectionAuth enables to set auth key read from request headers
 type SectionAuth struct {
-	Enabled  bool   `yaml:"enabled"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	Enabled  bool       `yaml:"enabled"`
+	Username string     `yaml:"username"`
+	Password string     `yaml:"password" redact:"true"`
+	JWT      SectionJWT `yaml:"jwt"`
+	// AllowRequestCredentials accepts APNs and FCM credentials of tenant in
+	// push request.
+	AllowRequestCredentials bool `yaml:"allow_request_credentials"`
+}
+
+// SectionJWT is bearer token auth of API.
+type SectionJWT struct {
+	Enabled   bool   `yaml:"enabled"`
+	Secret    string `yaml:"secret" redact:"true"`
+	PublicKey string `yaml:"public_key"`
+	Scope     string `yaml:"scope"`
 }
 
 // SectionAPI is sub section of config.
 type SectionAPI struct {
-	PushURI    string `yaml:"push_uri"`
-	StatGoURI  string `yaml:"stat_go_uri"`
-	StatAppURI string `yaml:"stat_app_uri"`
-	ConfigURI  string `yaml:"config_uri"`
-	SysStatURI string `yaml:"sys_stat_uri"`
-	MetricURI  string `yaml:"metric_uri"`
-	HealthURI  string `yaml:"health_uri"`
+	PushURI        string             `yaml:"push_uri"`
+	StatGoURI      string             `yaml:"stat_go_uri"`
+	StatAppURI     string             `yaml:"stat_app_uri"`
+	ConfigURI      string             `yaml:"config_uri"`
+	SysStatURI     string             `yaml:"sys_stat_uri"`
+	MetricURI      string             `yaml:"metric_uri"`
+	HealthURI      string             `yaml:"health_uri"`
+	ReadyURI       string             `yaml:"ready_uri"`
+	HideVersion    bool               `yaml:"hide_version"`
+	DisabledRoutes string             `yaml:"disabled_routes"`
+	MetricsAuth    SectionMetricsAuth `yaml:"metrics_auth"`
+}
+
+// SectionMetricsAuth is auth of metrics route instead of API auth.
+type SectionMetricsAuth struct {
+	Enabled  bool   `yaml:"enabled"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" redact:"true"`
+	Token    string `yaml:"token" redact:"true"`
 }
 
 // SectionAndroid is sub section of config.
 type SectionAndroid struct {
-	Enabled  bool   `yaml:"enabled"`
-	APIKey   string `yaml:"apikey"`
-	MaxRetry int    `yaml:"max_retry"`
+	Enabled        bool                `yaml:"enabled"`
+	APIVersion     string              `yaml:"api_version"`
+	APIKey         string              `yaml:"apikey" redact:"true"`
+	Credential     string              `yaml:"credential" redact:"true"`
+	CredentialJSON string              `yaml:"credential_json" redact:"true"`
+	MaxRetry       int                 `yaml:"max_retry"`
+	Retry          SectionAndroidRetry `yaml:"retry"`
+	MaxPayloadSize int                 `yaml:"max_payload_size"`
+
+	Apps map[string]SectionAndroidApp `yaml:"apps"`
+}
+
+// SectionAndroidApp is named Firebase project of config.
+type SectionAndroidApp struct {
+	APIVersion     string `yaml:"api_version"`
+	APIKey         string `yaml:"apikey" redact:"true"`
+	Credential     string `yaml:"credential" redact:"true"`
+	CredentialJSON string `yaml:"credential_json" redact:"true"`
+}
+
+// SectionAndroidRetry is sub section of config.
+type SectionAndroidRetry struct {
+	MaxAttempts int   `yaml:"max_attempts"`
+	BaseDelay   int64 `yaml:"base_delay"`
+	MaxDelay    int64 `yaml:"max_delay"`
 }
 
 // SectionIos is sub section of config.
 type SectionIos struct {
 	Enabled    bool   `yaml:"enabled"`
 	KeyPath    string `yaml:"key_path"`
-	KeyBase64  string `yaml:"key_base64"`
+	KeyBase64  string `yaml:"key_base64" redact:"true"`
 	KeyType    string `yaml:"key_type"`
-	Password   string `yaml:"password"`
+	Password   string `yaml:"password" redact:"true"`
 	Production bool   `yaml:"production"`
 	MaxRetry   int    `yaml:"max_retry"`
 	KeyID      string `yaml:"key_id"`
 	TeamID     string `yaml:"team_id"`
+	Topic      string `yaml:"topic"`
+
+	ConnPoolSize        int    `yaml:"conn_pool_size"`
+	HealthCheckInterval int64  `yaml:"health_check_interval"`
+	KeepAlive           int64  `yaml:"keep_alive"`
+	DialTimeout         int64  `yaml:"dial_timeout"`
+	ReadTimeout         int64  `yaml:"read_timeout"`
+	WriteTimeout        int64  `yaml:"write_timeout"`
+	IdlePingInterval    int64  `yaml:"idle_ping_interval"`
+	MaxPayloadSize      int    `yaml:"max_payload_size"`
+	MaxVoIPPayloadSize  int    `yaml:"max_voip_payload_size"`
+	ImageKey            string `yaml:"image_key"`
+
+	Apps map[string]SectionIosApp `yaml:"apps"`
+}
+
+// SectionIosApp is named iOS app profile of config.
+type SectionIosApp struct {
+	KeyPath    string `yaml:"key_path"`
+	KeyBase64  string `yaml:"key_base64" redact:"true"`
+	KeyType    string `yaml:"key_type"`
+	Password   string `yaml:"password" redact:"true"`
+	Production bool   `yaml:"production"`
+	KeyID      string `yaml:"key_id"`
+	TeamID     string `yaml:"team_id"`
+	Topic      string `yaml:"topic"`
+}
+
+// SectionWeb is sub section of config.
+type SectionWeb struct {
+	Enabled         bool   `yaml:"enabled"`
+	VAPIDPublicKey  string `yaml:"vapid_public_key"`
+	VAPIDPrivateKey string `yaml:"vapid_private_key" redact:"true"`
+	Subject         string `yaml:"subject"`
+	MaxRetry        int    `yaml:"max_retry"`
+}
+
+// SectionHuawei is sub section of config.
+type SectionHuawei struct {
+	Enabled   bool   `yaml:"enabled"`
+	AppID     string `yaml:"app_id"`
+	AppSecret string `yaml:"app_secret" redact:"true"`
+	MaxRetry  int    `yaml:"max_retry"`
+}
+
+// SectionSNS is sub section of config.
+type SectionSNS struct {
+	Enabled         bool   `yaml:"enabled"`
+	Region          string `yaml:"region"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" redact:"true"`
+	SessionToken    string `yaml:"session_token" redact:"true"`
+	MaxRetry        int    `yaml:"max_retry"`
 }
 
 // SectionLog is sub section of config.
 type SectionLog struct {
-	Format      string `yaml:"format"`
-	AccessLog   string `yaml:"access_log"`
-	AccessLevel string `yaml:"access_level"`
-	ErrorLog    string `yaml:"error_log"`
-	ErrorLevel  string `yaml:"error_level"`
-	HideToken   bool   `yaml:"hide_token"`
+	Format      string           `yaml:"format"`
+	AccessLog   string           `yaml:"access_log"`
+	AccessLevel string           `yaml:"access_level"`
+	ErrorLog    string           `yaml:"error_log"`
+	ErrorLevel  string           `yaml:"error_level"`
+	HideToken   bool             `yaml:"hide_token"`
+	Rotate      SectionLogRotate `yaml:"rotate"`
+}
+
+// SectionLogRotate is sub section of config.
+type SectionLogRotate struct {
+	MaxSize    int `yaml:"max_size"`
+	MaxAge     int `yaml:"max_age"`
+	MaxBackups int `yaml:"max_backups"`
 }
 
 // SectionStat is sub section of config.
@@ -186,8 +519,10 @@ type SectionStat struct {
 // SectionRedis is sub section of config.
 type SectionRedis struct {
 	Addr     string `yaml:"addr"`
-	Password string `yaml:"password"`
+	Password string `yaml:"password" redact:"true"`
 	DB       int    `yaml:"db"`
+	Prefix   string `yaml:"prefix"`
+	PoolSize int    `yaml:"pool_size"`
 }
 
 // SectionBoltDB is sub section of config.
@@ -206,6 +541,121 @@ type SectionLevelDB struct {
 	Path string `yaml:"path"`
 }
 
+// SectionQueue is sub section of config.
+type SectionQueue struct {
+	Engine string            `yaml:"engine"`
+	Redis  SectionQueueRedis `yaml:"redis"`
+	NATS   SectionQueueNATS  `yaml:"nats"`
+}
+
+// SectionQueueRedis is sub section of config.
+type SectionQueueRedis struct {
+	Addr              string `yaml:"addr"`
+	Password          string `yaml:"password" redact:"true"`
+	DB                int    `yaml:"db"`
+	Key               string `yaml:"key"`
+	ConsumerNum       int64  `yaml:"consumer_num"`
+	VisibilityTimeout int64  `yaml:"visibility_timeout"`
+}
+
+// SectionQueueNATS is sub section of config.
+type SectionQueueNATS struct {
+	URL               string `yaml:"url" redact:"true"`
+	Stream            string `yaml:"stream"`
+	Subject           string `yaml:"subject"`
+	DeadLetterSubject string `yaml:"dead_letter_subject"`
+	Durable           string `yaml:"durable"`
+	ConsumerNum       int64  `yaml:"consumer_num"`
+	AckWait           int64  `yaml:"ack_wait"`
+	MaxDeliver        int    `yaml:"max_deliver"`
+}
+
+// SectionInbound is the consumer of push requests from message queue.
+type SectionInbound struct {
+	Engine      string              `yaml:"engine"`
+	ConsumerNum int64               `yaml:"consumer_num"`
+	NATS        SectionInboundNATS  `yaml:"nats"`
+	Redis       SectionInboundRedis `yaml:"redis"`
+}
+
+// SectionInboundNATS is sub section of config.
+type SectionInboundNATS struct {
+	URL           string `yaml:"url" redact:"true"`
+	Subject       string `yaml:"subject"`
+	Queue         string `yaml:"queue"`
+	ResultSubject string `yaml:"result_subject"`
+}
+
+// SectionInboundRedis is sub section of config.
+type SectionInboundRedis struct {
+	Addr      string `yaml:"addr"`
+	Password  string `yaml:"password" redact:"true"`
+	DB        int    `yaml:"db"`
+	Key       string `yaml:"key"`
+	ResultKey string `yaml:"result_key"`
+}
+
+// SectionBreaker is circuit breaker of push providers.
+type SectionBreaker struct {
+	FailureThreshold int   `yaml:"failure_threshold"`
+	Cooldown         int64 `yaml:"cooldown"`
+}
+
+// SectionSchedule is delayed send of notifications.
+type SectionSchedule struct {
+	MaxDelay int64 `yaml:"max_delay"`
+}
+
+// SectionDeadLetter is sink of notifications failed after all retries.
+type SectionDeadLetter struct {
+	Engine  string                 `yaml:"engine"`
+	Path    string                 `yaml:"path"`
+	Redis   SectionDeadLetterRedis `yaml:"redis"`
+	MaxSize int                    `yaml:"max_size"`
+	TTL     int64                  `yaml:"ttl"`
+}
+
+// SectionDeadLetterRedis is sub section of config.
+type SectionDeadLetterRedis struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password" redact:"true"`
+	DB       int    `yaml:"db"`
+	Key      string `yaml:"key"`
+}
+
+// SectionAlert is webhook alert of sustained push failures.
+type SectionAlert struct {
+	URL       string  `yaml:"url" redact:"true"`
+	Threshold float64 `yaml:"threshold"`
+	Window    int64   `yaml:"window"`
+	Cooldown  int64   `yaml:"cooldown"`
+}
+
+// SectionResponse is response format of successful push.
+type SectionResponse struct {
+	Logs      bool `yaml:"logs"`
+	RequestID bool `yaml:"request_id"`
+}
+
+// SectionTracing is OTLP tracing of push requests.
+type SectionTracing struct {
+	Enabled     bool   `yaml:"enabled"`
+	Endpoint    string `yaml:"endpoint"`
+	ServiceName string `yaml:"service_name"`
+}
+
+// SectionValidateOnStart is credential check of providers on start.
+type SectionValidateOnStart struct {
+	Enabled bool `yaml:"enabled"`
+	Fail    bool `yaml:"fail"`
+}
+
+// SectionIdempotency is replay of request with the same idempotency key.
+type SectionIdempotency struct {
+	Enabled bool  `yaml:"enabled"`
+	TTL     int64 `yaml:"ttl"`
+}
+
 // SectionPID is sub section of config.
 type SectionPID struct {
 	Enabled  bool   `yaml:"enabled"`
@@ -219,6 +669,89 @@ type SectionGRPC struct {
 	Port    string `yaml:"port"`
 }
 
+// envPattern match ${VAR}, ${VAR:-default} and the escaped $${ in values
+// of config.
+var envPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replace the environment variables referenced in values of
+// config, comments and keys are not expanded.
+func expandEnv(content []byte) ([]byte, error) {
+	if !bytes.Contains(content, []byte("${")) {
+		return content, nil
+	}
+
+	var values interface{}
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, err
+	}
+
+	values, err := expandEnvValues(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(values)
+}
+
+// expandEnvValues expand the string values of parsed config recursively.
+func expandEnvValues(v interface{}) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case string:
+		return expandEnvValue(v)
+	case map[interface{}]interface{}:
+		for key, value := range v {
+			if v[key], err = expandEnvValues(value); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			if v[i], err = expandEnvValues(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return v, nil
+}
+
+// expandEnvValue replace the environment variables referenced in value, the
+// default value is used if the variable is unset or empty. $${ is a literal
+// ${, other $ are kept as is.
+func expandEnvValue(value string) (string, error) {
+	var err error
+	value = envPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+
+		match := envPattern.FindStringSubmatch(ref)
+		name, hasDefault := match[1], len(match[2]) > 0
+		env, ok := os.LookupEnv(name)
+		if env == "" && hasDefault {
+			return match[3]
+		}
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s of config is not set", name)
+		}
+
+		return env
+	})
+
+	return value, err
+}
+
+// readConfig expand the environment variables and read config.
+func readConfig(content []byte) error {
+	content, err := expandEnv(content)
+	if err != nil {
+		return err
+	}
+
+	return viper.ReadConfig(bytes.NewBuffer(content))
+}
+
 // LoadConf load config from file and read in environment variables that match
 func LoadConf(confPath string) (ConfYaml, error) {
 	var conf ConfYaml
@@ -235,7 +768,7 @@ func LoadConf(confPath string) (ConfYaml, error) {
 			return conf, err
 		}
 
-		if err := viper.ReadConfig(bytes.NewBuffer(content)); err != nil {
+		if err := readConfig(content); err != nil {
 			return conf, err
 		}
 	} else {
@@ -248,6 +781,13 @@ func LoadConf(confPath string) (ConfYaml, error) {
 		// If a config file is found, read it in.
 		if err := viper.ReadInConfig(); err == nil {
 			fmt.Println("Using config file:", viper.ConfigFileUsed())
+			content, err := ioutil.ReadFile(viper.ConfigFileUsed())
+			if err != nil {
+				return conf, err
+			}
+			if err := readConfig(content); err != nil {
+				return conf, err
+			}
 		} else {
 			// load default config
 			if err := viper.ReadConfig(bytes.NewBuffer(defaultConf)); err != nil {
@@ -261,16 +801,83 @@ func LoadConf(confPath string) (ConfYaml, error) {
 	conf.Core.Port = viper.GetString("core.port")
 	conf.Core.Enabled = viper.GetBool("core.enabled")
 	conf.Core.WorkerNum = int64(viper.GetInt("core.worker_num"))
+	conf.Core.IosWorkerNum = int64(viper.GetInt("core.ios_worker_num"))
+	conf.Core.AndroidWorkerNum = int64(viper.GetInt("core.android_worker_num"))
+	conf.Core.MinWorkers = int64(viper.GetInt("core.min_workers"))
+	conf.Core.MaxWorkers = int64(viper.GetInt("core.max_workers"))
+	conf.Core.ScaleUpQueueDepth = viper.GetInt("core.scale_up_queue_depth")
+	conf.Core.ScaleUpInterval = int64(viper.GetInt("core.scale_up_interval"))
+	conf.Core.ScaleDownInterval = int64(viper.GetInt("core.scale_down_interval"))
 	conf.Core.QueueNum = int64(viper.GetInt("core.queue_num"))
+	conf.Core.QueueHighWaterMark = viper.GetInt("core.queue_high_water_mark")
+	conf.Core.QueueFullPolicy = viper.GetString("core.queue_full_policy")
 	conf.Core.Mode = viper.GetString("core.mode")
 	conf.Core.Sync = viper.GetBool("core.sync")
+	conf.Core.Dedup = viper.GetBool("core.dedup")
+	conf.Core.DryRun = viper.GetBool("core.dry_run")
+	conf.Core.ValidateOnStart.Enabled = viper.GetBool("core.validate_on_start.enabled")
+	conf.Core.ValidateOnStart.Fail = viper.GetBool("core.validate_on_start.fail")
+	conf.Core.Tracing.Enabled = viper.GetBool("core.tracing.enabled")
+	conf.Core.Tracing.Endpoint = viper.GetString("core.tracing.endpoint")
+	conf.Core.Tracing.ServiceName = viper.GetString("core.tracing.service_name")
 	conf.Core.SSL = viper.GetBool("core.ssl")
 	conf.Core.CertPath = viper.GetString("core.cert_path")
 	conf.Core.KeyPath = viper.GetString("core.key_path")
 	conf.Core.CertBase64 = viper.GetString("core.cert_base64")
 	conf.Core.KeyBase64 = viper.GetString("core.key_base64")
+	conf.Core.TLSMinVersion = viper.GetString("core.tls_min_version")
+	conf.Core.TLSCipherSuites = viper.GetString("core.tls_cipher_suites")
+	conf.Core.ClientCA = viper.GetString("core.client_ca")
+	conf.Core.ClientSenders = viper.GetStringMapString("core.client_senders")
+	conf.Core.AllowedIPs = viper.GetString("core.allowed_ips")
+	conf.Core.DeniedIPs = viper.GetString("core.denied_ips")
+	conf.Core.MetricAllowedIPs = viper.GetString("core.metric_allowed_ips")
+	conf.Core.HealthAllowedIPs = viper.GetString("core.health_allowed_ips")
+	conf.Core.TrustedProxies = viper.GetString("core.trusted_proxies")
 	conf.Core.MaxNotification = int64(viper.GetInt("core.max_notification"))
+	conf.Core.MaxTokens = int64(viper.GetInt("core.max_tokens_per_notification"))
 	conf.Core.HTTPProxy = viper.GetString("core.http_proxy")
+	conf.Core.HTTPSProxy = viper.GetString("core.https_proxy")
+	conf.Core.NoProxy = viper.GetString("core.no_proxy")
+	conf.Core.FeedbackURL = viper.GetString("core.feedback_url")
+	conf.Core.FeedbackTimeout = int64(viper.GetInt("core.feedback_timeout"))
+	conf.Core.FeedbackMaxRetry = viper.GetInt("core.feedback_max_retry")
+	conf.Core.FeedbackNum = viper.GetInt("core.feedback_concurrency")
+	conf.Core.FeedbackQueueNum = int64(viper.GetInt("core.feedback_queue_num"))
+	conf.Core.FeedbackFullPolicy = viper.GetString("core.feedback_full_policy")
+	conf.Core.CallbackHosts = viper.GetString("core.callback_allowed_hosts")
+	conf.Core.CallbackNum = viper.GetInt("core.callback_concurrency")
+	conf.Core.TransformScript = viper.GetString("core.transform_script")
+	conf.Core.JobTTL = int64(viper.GetInt("core.job_ttl"))
+	conf.Core.MaxInvalidToken = viper.GetInt("core.max_invalid_token")
+	conf.Core.ShutdownTimeout = int64(viper.GetInt("core.shutdown_timeout"))
+	conf.Core.RequestTimeout = int64(viper.GetInt("core.request_timeout"))
+	conf.Core.MaxBodySize = int64(viper.GetInt("core.max_body_size"))
+	conf.Core.MaxConnections = viper.GetInt("core.max_connections")
+	conf.Core.RateLimit = viper.GetFloat64("core.rate_limit")
+	conf.Core.RateLimitBurst = viper.GetInt("core.rate_limit_burst")
+	conf.Core.HTTPCompression = viper.GetBool("core.http_compression")
+	conf.Core.H2C = viper.GetBool("core.h2c")
+	conf.Core.RootResponse = viper.GetString("core.root_response")
+	conf.Core.CircuitBreaker.FailureThreshold = viper.GetInt("core.circuit_breaker.failure_threshold")
+	conf.Core.CircuitBreaker.Cooldown = int64(viper.GetInt("core.circuit_breaker.cooldown"))
+	conf.Core.DeadLetter.Engine = viper.GetString("core.dead_letter.engine")
+	conf.Core.DeadLetter.Path = viper.GetString("core.dead_letter.path")
+	conf.Core.DeadLetter.Redis.Addr = viper.GetString("core.dead_letter.redis.addr")
+	conf.Core.DeadLetter.Redis.Password = viper.GetString("core.dead_letter.redis.password")
+	conf.Core.DeadLetter.Redis.DB = viper.GetInt("core.dead_letter.redis.db")
+	conf.Core.DeadLetter.Redis.Key = viper.GetString("core.dead_letter.redis.key")
+	conf.Core.DeadLetter.MaxSize = viper.GetInt("core.dead_letter.max_size")
+	conf.Core.DeadLetter.TTL = int64(viper.GetInt("core.dead_letter.ttl"))
+	conf.Core.Schedule.MaxDelay = int64(viper.GetInt("core.schedule.max_delay"))
+	conf.Core.Alert.URL = viper.GetString("core.alert.url")
+	conf.Core.Alert.Threshold = viper.GetFloat64("core.alert.threshold")
+	conf.Core.Alert.Window = int64(viper.GetInt("core.alert.window"))
+	conf.Core.Alert.Cooldown = int64(viper.GetInt("core.alert.cooldown"))
+	conf.Core.ResponseFormat.Logs = viper.GetBool("core.response_format.logs")
+	conf.Core.ResponseFormat.RequestID = viper.GetBool("core.response_format.request_id")
+	conf.Core.Idempotency.Enabled = viper.GetBool("core.idempotency.enabled")
+	conf.Core.Idempotency.TTL = int64(viper.GetInt("core.idempotency.ttl"))
 	conf.Core.PID.Enabled = viper.GetBool("core.pid.enabled")
 	conf.Core.PID.Path = viper.GetString("core.pid.path")
 	conf.Core.PID.Override = viper.GetBool("core.pid.override")
@@ -286,16 +893,50 @@ func LoadConf(confPath string) (ConfYaml, error) {
 	conf.API.SysStatURI = viper.GetString("api.sys_stat_uri")
 	conf.API.MetricURI = viper.GetString("api.metric_uri")
 	conf.API.HealthURI = viper.GetString("api.health_uri")
+	conf.API.ReadyURI = viper.GetString("api.ready_uri")
+	conf.API.HideVersion = viper.GetBool("api.hide_version")
+	conf.API.DisabledRoutes = viper.GetString("api.disabled_routes")
+	conf.API.MetricsAuth.Enabled = viper.GetBool("api.metrics_auth.enabled")
+	conf.API.MetricsAuth.Username = viper.GetString("api.metrics_auth.username")
+	conf.API.MetricsAuth.Password = viper.GetString("api.metrics_auth.password")
+	conf.API.MetricsAuth.Token = viper.GetString("api.metrics_auth.token")
 
 	// Android
 	conf.Android.Enabled = viper.GetBool("android.enabled")
+	conf.Android.APIVersion = viper.GetString("android.api_version")
 	conf.Android.APIKey = viper.GetString("android.apikey")
+	conf.Android.Credential = viper.GetString("android.credential")
+	conf.Android.CredentialJSON = viper.GetString("android.credential_json")
 	conf.Android.MaxRetry = viper.GetInt("android.max_retry")
+	conf.Android.Retry.MaxAttempts = viper.GetInt("android.retry.max_attempts")
+	conf.Android.Retry.BaseDelay = int64(viper.GetInt("android.retry.base_delay"))
+	conf.Android.Retry.MaxDelay = int64(viper.GetInt("android.retry.max_delay"))
+	conf.Android.MaxPayloadSize = viper.GetInt("android.max_payload_size")
+	conf.Android.Apps = make(map[string]SectionAndroidApp)
+	for name := range viper.GetStringMap("android.apps") {
+		key := "android.apps." + name + "."
+		app := SectionAndroidApp{
+			APIVersion:     viper.GetString(key + "api_version"),
+			APIKey:         viper.GetString(key + "apikey"),
+			Credential:     viper.GetString(key + "credential"),
+			CredentialJSON: viper.GetString(key + "credential_json"),
+		}
+		// default as api version of top level config.
+		if app.APIVersion == "" {
+			app.APIVersion = conf.Android.APIVersion
+		}
+		conf.Android.Apps[name] = app
+	}
 
 	// Auth
 	conf.Auth.Enabled = viper.GetBool("auth.enabled")
 	conf.Auth.Username = viper.GetString("auth.username")
 	conf.Auth.Password = viper.GetString("auth.password")
+	conf.Auth.JWT.Enabled = viper.GetBool("auth.jwt.enabled")
+	conf.Auth.JWT.Secret = viper.GetString("auth.jwt.secret")
+	conf.Auth.JWT.PublicKey = viper.GetString("auth.jwt.public_key")
+	conf.Auth.JWT.Scope = viper.GetString("auth.jwt.scope")
+	conf.Auth.AllowRequestCredentials = viper.GetBool("auth.allow_request_credentials")
 
 	// iOS
 	conf.Ios.Enabled = viper.GetBool("ios.enabled")
@@ -307,6 +948,52 @@ func LoadConf(confPath string) (ConfYaml, error) {
 	conf.Ios.MaxRetry = viper.GetInt("ios.max_retry")
 	conf.Ios.KeyID = viper.GetString("ios.key_id")
 	conf.Ios.TeamID = viper.GetString("ios.team_id")
+	conf.Ios.Topic = viper.GetString("ios.topic")
+	conf.Ios.ConnPoolSize = viper.GetInt("ios.conn_pool_size")
+	conf.Ios.HealthCheckInterval = int64(viper.GetInt("ios.health_check_interval"))
+	conf.Ios.KeepAlive = int64(viper.GetInt("ios.keep_alive"))
+	conf.Ios.DialTimeout = int64(viper.GetInt("ios.dial_timeout"))
+	conf.Ios.ReadTimeout = int64(viper.GetInt("ios.read_timeout"))
+	conf.Ios.WriteTimeout = int64(viper.GetInt("ios.write_timeout"))
+	conf.Ios.IdlePingInterval = int64(viper.GetInt("ios.idle_ping_interval"))
+	conf.Ios.MaxPayloadSize = viper.GetInt("ios.max_payload_size")
+	conf.Ios.MaxVoIPPayloadSize = viper.GetInt("ios.max_voip_payload_size")
+	conf.Ios.ImageKey = viper.GetString("ios.image_key")
+	conf.Ios.Apps = make(map[string]SectionIosApp)
+	for name := range viper.GetStringMap("ios.apps") {
+		key := "ios.apps." + name + "."
+		conf.Ios.Apps[name] = SectionIosApp{
+			KeyPath:    viper.GetString(key + "key_path"),
+			KeyBase64:  viper.GetString(key + "key_base64"),
+			KeyType:    viper.GetString(key + "key_type"),
+			Password:   viper.GetString(key + "password"),
+			Production: viper.GetBool(key + "production"),
+			KeyID:      viper.GetString(key + "key_id"),
+			TeamID:     viper.GetString(key + "team_id"),
+			Topic:      viper.GetString(key + "topic"),
+		}
+	}
+
+	// web
+	conf.Web.Enabled = viper.GetBool("web.enabled")
+	conf.Web.VAPIDPublicKey = viper.GetString("web.vapid_public_key")
+	conf.Web.VAPIDPrivateKey = viper.GetString("web.vapid_private_key")
+	conf.Web.Subject = viper.GetString("web.subject")
+	conf.Web.MaxRetry = viper.GetInt("web.max_retry")
+
+	// Huawei
+	conf.Huawei.Enabled = viper.GetBool("huawei.enabled")
+	conf.Huawei.AppID = viper.GetString("huawei.app_id")
+	conf.Huawei.AppSecret = viper.GetString("huawei.app_secret")
+	conf.Huawei.MaxRetry = viper.GetInt("huawei.max_retry")
+
+	// SNS
+	conf.SNS.Enabled = viper.GetBool("sns.enabled")
+	conf.SNS.Region = viper.GetString("sns.region")
+	conf.SNS.AccessKeyID = viper.GetString("sns.access_key_id")
+	conf.SNS.SecretAccessKey = viper.GetString("sns.secret_access_key")
+	conf.SNS.SessionToken = viper.GetString("sns.session_token")
+	conf.SNS.MaxRetry = viper.GetInt("sns.max_retry")
 
 	// log
 	conf.Log.Format = viper.GetString("log.format")
@@ -315,17 +1002,52 @@ func LoadConf(confPath string) (ConfYaml, error) {
 	conf.Log.ErrorLog = viper.GetString("log.error_log")
 	conf.Log.ErrorLevel = viper.GetString("log.error_level")
 	conf.Log.HideToken = viper.GetBool("log.hide_token")
+	conf.Log.Rotate.MaxSize = viper.GetInt("log.rotate.max_size")
+	conf.Log.Rotate.MaxAge = viper.GetInt("log.rotate.max_age")
+	conf.Log.Rotate.MaxBackups = viper.GetInt("log.rotate.max_backups")
 
 	// Stat Engine
 	conf.Stat.Engine = viper.GetString("stat.engine")
 	conf.Stat.Redis.Addr = viper.GetString("stat.redis.addr")
 	conf.Stat.Redis.Password = viper.GetString("stat.redis.password")
 	conf.Stat.Redis.DB = viper.GetInt("stat.redis.db")
+	conf.Stat.Redis.Prefix = viper.GetString("stat.redis.prefix")
+	conf.Stat.Redis.PoolSize = viper.GetInt("stat.redis.pool_size")
 	conf.Stat.BoltDB.Path = viper.GetString("stat.boltdb.path")
 	conf.Stat.BoltDB.Bucket = viper.GetString("stat.boltdb.bucket")
 	conf.Stat.BuntDB.Path = viper.GetString("stat.buntdb.path")
 	conf.Stat.LevelDB.Path = viper.GetString("stat.leveldb.path")
 
+	// Queue Engine
+	conf.Queue.Engine = viper.GetString("queue.engine")
+	conf.Queue.Redis.Addr = viper.GetString("queue.redis.addr")
+	conf.Queue.Redis.Password = viper.GetString("queue.redis.password")
+	conf.Queue.Redis.DB = viper.GetInt("queue.redis.db")
+	conf.Queue.Redis.Key = viper.GetString("queue.redis.key")
+	conf.Queue.Redis.ConsumerNum = int64(viper.GetInt("queue.redis.consumer_num"))
+	conf.Queue.Redis.VisibilityTimeout = int64(viper.GetInt("queue.redis.visibility_timeout"))
+	conf.Queue.NATS.URL = viper.GetString("queue.nats.url")
+	conf.Queue.NATS.Stream = viper.GetString("queue.nats.stream")
+	conf.Queue.NATS.Subject = viper.GetString("queue.nats.subject")
+	conf.Queue.NATS.DeadLetterSubject = viper.GetString("queue.nats.dead_letter_subject")
+	conf.Queue.NATS.Durable = viper.GetString("queue.nats.durable")
+	conf.Queue.NATS.ConsumerNum = int64(viper.GetInt("queue.nats.consumer_num"))
+	conf.Queue.NATS.AckWait = int64(viper.GetInt("queue.nats.ack_wait"))
+	conf.Queue.NATS.MaxDeliver = viper.GetInt("queue.nats.max_deliver")
+
+	// Inbound
+	conf.Inbound.Engine = viper.GetString("inbound.engine")
+	conf.Inbound.ConsumerNum = int64(viper.GetInt("inbound.consumer_num"))
+	conf.Inbound.NATS.URL = viper.GetString("inbound.nats.url")
+	conf.Inbound.NATS.Subject = viper.GetString("inbound.nats.subject")
+	conf.Inbound.NATS.Queue = viper.GetString("inbound.nats.queue")
+	conf.Inbound.NATS.ResultSubject = viper.GetString("inbound.nats.result_subject")
+	conf.Inbound.Redis.Addr = viper.GetString("inbound.redis.addr")
+	conf.Inbound.Redis.Password = viper.GetString("inbound.redis.password")
+	conf.Inbound.Redis.DB = viper.GetInt("inbound.redis.db")
+	conf.Inbound.Redis.Key = viper.GetString("inbound.redis.key")
+	conf.Inbound.Redis.ResultKey = viper.GetString("inbound.redis.result_key")
+
 	// gRPC Server
 	conf.GRPC.Enabled = viper.GetBool("grpc.enabled")
 	conf.GRPC.Port = viper.GetString("grpc.port")
@@ -334,9 +1056,82 @@ func LoadConf(confPath string) (ConfYaml, error) {
 		conf.Core.WorkerNum = int64(runtime.NumCPU())
 	}
 
+	if conf.Queue.Redis.ConsumerNum == int64(0) {
+		conf.Queue.Redis.ConsumerNum = conf.Core.WorkerNum
+	}
+
+	if conf.Queue.NATS.ConsumerNum == int64(0) {
+		conf.Queue.NATS.ConsumerNum = conf.Core.WorkerNum
+	}
+
+	if conf.Inbound.ConsumerNum == int64(0) {
+		conf.Inbound.ConsumerNum = conf.Core.WorkerNum
+	}
+
 	if conf.Core.QueueNum == int64(0) {
 		conf.Core.QueueNum = int64(8192)
 	}
 
 	return conf, nil
 }
+
+// Redacted is the value of secret in redacted config.
+const Redacted = "***REDACTED***"
+
+// Redact return the copy of config with the non-empty secrets replaced by
+// Redacted, the secret fields are tagged with `redact:"true"`.
+func Redact(conf ConfYaml) ConfYaml {
+	return redactValue(reflect.ValueOf(conf)).Interface().(ConfYaml)
+}
+
+// redactValue copy the value, maps and slices are copied as well so the
+// original config isn't changed.
+func redactValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+
+			if field.Tag.Get("redact") == "true" && field.Type.Kind() == reflect.String {
+				if v.Field(i).String() != "" {
+					copied.Field(i).SetString(Redacted)
+				}
+				continue
+			}
+
+			copied.Field(i).Set(redactValue(v.Field(i)))
+		}
+		return copied
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			copied.SetMapIndex(key, redactValue(v.MapIndex(key)))
+		}
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(redactValue(v.Index(i)))
+		}
+		return copied
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(redactValue(v.Elem()))
+		return copied
+	}
+
+	return v
+}
@@ -5,6 +5,7 @@ go 1.12
 require (
 	github.com/DataDog/zstd v1.4.0 // indirect
 	github.com/Sereal/Sereal v0.0.0-20190606082811-cf1bab6c7a3a // indirect
+	github.com/SherClockHolmes/webpush-go v1.1.0
 	github.com/apex/gateway v1.1.1
 	github.com/appleboy/com v0.0.1
 	github.com/appleboy/gin-status-api v1.0.2
@@ -22,6 +23,7 @@ require (
 	github.com/mattn/go-isatty v0.0.8
 	github.com/mitchellh/gox v1.0.1 // indirect
 	github.com/mitchellh/mapstructure v1.1.2
+	github.com/nats-io/nats.go v1.11.0
 	github.com/prometheus/client_golang v1.0.0
 	github.com/sideshow/apns2 v0.16.0
 	github.com/sirupsen/logrus v1.4.2
@@ -38,9 +40,11 @@ require (
 	github.com/tj/assert v0.0.0-20171129193455-018094318fb0 // indirect
 	github.com/ulikunitz/xz v0.5.6 // indirect
 	github.com/vmihailenco/msgpack v4.0.4+incompatible // indirect
-	golang.org/x/crypto v0.0.0-20190617133340-57b3e21c3d56
-	golang.org/x/net v0.0.0-20190613194153-d28f0bde5980
+	github.com/yuin/gopher-lua v0.0.0-20200816102855-ee81675732da
+	golang.org/x/crypto v0.0.0-20210314154223-e6e6c4f2bb5b
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58
 	google.golang.org/grpc v1.21.1
 	gopkg.in/redis.v5 v5.2.9
+	gopkg.in/yaml.v2 v2.2.2
 )
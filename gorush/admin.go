@@ -0,0 +1,140 @@
+package gorush
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recentErrorsSize is the number of latest push errors kept for admin status.
+const recentErrorsSize = 50
+
+// breakerStates is the name of circuit breaker state.
+var breakerStates = map[int]string{
+	breakerClosed:   "closed",
+	breakerOpen:     "open",
+	breakerHalfOpen: "half-open",
+}
+
+// AdminStatus is the diagnostic snapshot of queues, workers and providers.
+type AdminStatus struct {
+	Version         string                  `json:"version"`
+	Uptime          string                  `json:"uptime"`
+	UptimeSec       float64                 `json:"uptime_sec"`
+	InFlight        int64                   `json:"in_flight"`
+	Workers         map[string]WorkerStatus `json:"workers"`
+	Queue           map[string]int64        `json:"queue"`
+	CircuitBreakers map[string]string       `json:"circuit_breakers"`
+	Errors          []RecentError           `json:"errors"`
+}
+
+// WorkerStatus is the status of worker pool and its queue.
+type WorkerStatus struct {
+	Size          int   `json:"size"`
+	Busy          int64 `json:"busy"`
+	QueueDepth    int   `json:"queue_depth"`
+	QueueCapacity int   `json:"queue_capacity"`
+}
+
+// RecentError is the push log of failed push and when it failed.
+type RecentError struct {
+	Time time.Time `json:"time"`
+	LogPushEntry
+}
+
+// errorHistory keep the latest push errors.
+type errorHistory struct {
+	sync.Mutex
+	errors []RecentError
+}
+
+var recentErrors = &errorHistory{}
+
+// add record the push log of failed push, the oldest one is evicted.
+func (h *errorHistory) add(entry LogPushEntry) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.errors = append(h.errors, RecentError{Time: time.Now(), LogPushEntry: entry})
+	if len(h.errors) > recentErrorsSize {
+		h.errors = append(h.errors[:0], h.errors[len(h.errors)-recentErrorsSize:]...)
+	}
+}
+
+// latest return the push errors, the newest first.
+func (h *errorHistory) latest() []RecentError {
+	h.Lock()
+	defer h.Unlock()
+
+	entries := make([]RecentError, 0, len(h.errors))
+	for i := len(h.errors) - 1; i >= 0; i-- {
+		entries = append(entries, h.errors[i])
+	}
+
+	return entries
+}
+
+// workerStatus return the status of worker pool, nil pool isn't used.
+func workerStatus(p *workerPool, queue chan PushNotification) WorkerStatus {
+	return WorkerStatus{
+		Size:          p.size(),
+		Busy:          p.busyCount(),
+		QueueDepth:    len(queue),
+		QueueCapacity: cap(queue),
+	}
+}
+
+func adminStatusHandler(c *gin.Context) {
+	uptime := time.Since(Stats.Uptime)
+	status := AdminStatus{
+		Version:   GetVersion(),
+		Uptime:    uptime.String(),
+		UptimeSec: uptime.Seconds(),
+		InFlight:  atomic.LoadInt64(&inFlight),
+		Workers: map[string]WorkerStatus{
+			"common": workerStatus(commonWorkers, QueueNotification),
+		},
+		Queue:           map[string]int64{},
+		CircuitBreakers: map[string]string{},
+		Errors:          recentErrors.latest(),
+	}
+
+	// dedicated pools are only reported if they are used.
+	if iosWorkers != nil {
+		status.Workers["ios"] = workerStatus(iosWorkers, QueueIosNotification)
+	}
+	if androidWorkers != nil {
+		status.Workers["android"] = workerStatus(androidWorkers, QueueAndroidNotification)
+	}
+
+	for _, platform := range []int{PlatFormIos, PlatFormAndroid, PlatFormWeb, PlatFormHuawei, PlatFormSNS} {
+		status.Queue[typeForPlatForm(platform)] = queueDepth(platform)
+	}
+
+	for _, breaker := range breakers {
+		status.CircuitBreakers[breaker.name] = breakerStates[breaker.current()]
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// drainHandler switch server to draining for blue/green deploy, the health
+// and ready checks fail while workers process the queued notifications, then
+// the process exits like SIGTERM.
+func drainHandler(c *gin.Context) {
+	if startDrain() {
+		LogAccess.Info("Drain requested by admin API")
+		select {
+		case drainRequest <- struct{}{}:
+		default:
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+		"drain":   getDrainStatus(),
+	})
+}
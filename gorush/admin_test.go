@@ -0,0 +1,68 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorHistory(t *testing.T) {
+	h := &errorHistory{}
+	for i := 0; i < recentErrorsSize+10; i++ {
+		h.add(LogPushEntry{Line: i})
+	}
+
+	entries := h.latest()
+	assert.Equal(t, recentErrorsSize, len(entries))
+	assert.Equal(t, recentErrorsSize+9, entries[0].Line)
+	assert.Equal(t, 10, entries[recentErrorsSize-1].Line)
+}
+
+func TestAdminStatusHandler(t *testing.T) {
+	initTest()
+	PushConf.Core.IosWorkerNum = 2
+	PushConf.Log.HideToken = false
+	// no worker consumes the common queue.
+	InitWorkers(0, 10)
+	recentErrors = &errorHistory{}
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	// notifications of iOS are taken by its dedicated workers.
+	iosWorkers.resize(0)
+	assert.True(t, tryEnqueue(PushNotification{Platform: PlatFormIos}, queueForPlatform(PlatFormIos)))
+	assert.True(t, tryEnqueue(PushNotification{Platform: PlatFormAndroid}, queueForPlatform(PlatFormAndroid)))
+	assert.True(t, tryEnqueue(PushNotification{Platform: PlatFormAndroid}, queueForPlatform(PlatFormAndroid)))
+	LogPush(FailedPush, "aaaaa", PushNotification{Platform: PlatFormAndroid, Message: "Welcome"}, errors.New("InvalidRegistration"))
+
+	gofight.New().GET("/api/admin/status").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			var status AdminStatus
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &status))
+
+			assert.Equal(t, WorkerStatus{Size: 0, QueueDepth: 2, QueueCapacity: 10}, status.Workers["common"])
+			assert.Equal(t, WorkerStatus{Size: 0, QueueDepth: 1, QueueCapacity: 10}, status.Workers["ios"])
+			_, ok := status.Workers["android"]
+			assert.False(t, ok)
+			assert.Equal(t, map[string]int64{"ios": 1, "android": 2, "web": 0, "huawei": 0, "sns": 0}, status.Queue)
+			assert.Equal(t, map[string]string{"ios": "closed", "android": "closed", "web": "closed", "huawei": "closed", "sns": "closed"}, status.CircuitBreakers)
+			assert.Equal(t, 1, len(status.Errors))
+			assert.Equal(t, "aaaaa", status.Errors[0].Token)
+			assert.Equal(t, "InvalidRegistration", status.Errors[0].Error)
+			assert.True(t, status.UptimeSec > 0)
+		})
+
+	// notifications saved on shutdown leave the queue.
+	persistQueue()
+	assert.Equal(t, int64(0), queueDepth(PlatFormAndroid))
+	StatStorage.Del(QueueStorageKey)
+}
@@ -0,0 +1,266 @@
+package gorush
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertInterval is how often the failure rate of providers is checked.
+var alertInterval = 10 * time.Second
+
+const (
+	// alertTimeout is the timeout of webhook request.
+	alertTimeout = 10 * time.Second
+	// alertMaxReasons limit the distinct error reasons counted of provider,
+	// the rest are counted as other.
+	alertMaxReasons = 100
+	// alertTopReasons is the number of error reasons sent in alert.
+	alertTopReasons = 5
+)
+
+// AlertReason is the error reason of failed push and its count in window.
+type AlertReason struct {
+	Reason string `json:"reason"`
+	Count  int64  `json:"count"`
+}
+
+// FailureAlert is the Slack-compatible webhook payload of provider whose
+// failure rate is over threshold, Slack only shows the text.
+type FailureAlert struct {
+	Text        string        `json:"text"`
+	Provider    string        `json:"provider"`
+	FailureRate float64       `json:"failure_rate"`
+	Failures    int64         `json:"failures"`
+	Total       int64         `json:"total"`
+	Window      int64         `json:"window"`
+	Reasons     []AlertReason `json:"reasons"`
+}
+
+// alertCounts is the cumulative push results of provider.
+type alertCounts struct {
+	success int64
+	failure int64
+	reasons map[string]int64
+}
+
+type alertSample struct {
+	at     time.Time
+	counts map[int]alertCounts
+}
+
+// alerter compare push results of providers with the sample taken window
+// before, the success and error counts are read from stat storage.
+type alerter struct {
+	sync.Mutex
+	reasons   map[int]map[string]int64
+	samples   []alertSample
+	lastAlert map[int]time.Time
+}
+
+var alerts = newAlerter()
+
+func newAlerter() *alerter {
+	return &alerter{
+		reasons:   make(map[int]map[string]int64),
+		lastAlert: make(map[int]time.Time),
+	}
+}
+
+// InitAlert start checking the failure rate of providers if alert url is
+// configured.
+func InitAlert() {
+	if PushConf.Core.Alert.URL == "" {
+		return
+	}
+
+	LogAccess.Debug("alert url is ", PushConf.Core.Alert.URL)
+	go alerts.run()
+}
+
+func (a *alerter) run() {
+	client := &http.Client{
+		Timeout: alertTimeout,
+	}
+
+	ticker := time.NewTicker(alertInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, alert := range a.check(now) {
+			LogError.Error(alert.Text)
+			if err := postAlert(client, PushConf.Core.Alert.URL, alert); err != nil {
+				LogError.Error("alert error: " + err.Error())
+			}
+		}
+	}
+}
+
+// record count the error reason of failed push.
+func (a *alerter) record(platform int, errPush error) {
+	if PushConf.Core.Alert.URL == "" {
+		return
+	}
+
+	reason := "unknown"
+	if errPush != nil {
+		reason = errPush.Error()
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	reasons, ok := a.reasons[platform]
+	if !ok {
+		reasons = make(map[string]int64)
+		a.reasons[platform] = reasons
+	}
+	if _, ok := reasons[reason]; !ok && len(reasons) >= alertMaxReasons {
+		reason = "other"
+	}
+	reasons[reason]++
+}
+
+// sample take the push results of all providers, the lock must be held.
+func (a *alerter) sample(now time.Time) alertSample {
+	s := alertSample{
+		at: now,
+		counts: map[int]alertCounts{
+			PlatFormIos:     {success: StatStorage.GetIosSuccess(), failure: StatStorage.GetIosError()},
+			PlatFormAndroid: {success: StatStorage.GetAndroidSuccess(), failure: StatStorage.GetAndroidError()},
+			PlatFormWeb:     {success: StatStorage.GetWebSuccess(), failure: StatStorage.GetWebError()},
+			PlatFormHuawei:  {success: StatStorage.GetHuaweiSuccess(), failure: StatStorage.GetHuaweiError()},
+			PlatFormSNS:     {success: StatStorage.GetSNSSuccess(), failure: StatStorage.GetSNSError()},
+		},
+	}
+
+	for platform, counts := range s.counts {
+		counts.reasons = make(map[string]int64, len(a.reasons[platform]))
+		for reason, count := range a.reasons[platform] {
+			counts.reasons[reason] = count
+		}
+		s.counts[platform] = counts
+	}
+
+	return s
+}
+
+// check return the alerts of providers whose failure rate over window is
+// at or above threshold, the provider alerted in cooldown is skipped.
+func (a *alerter) check(now time.Time) []FailureAlert {
+	conf := PushConf.Core.Alert
+	window := time.Duration(conf.Window) * time.Second
+	cooldown := time.Duration(conf.Cooldown) * time.Second
+
+	a.Lock()
+	defer a.Unlock()
+
+	current := a.sample(now)
+	a.samples = append(a.samples, current)
+	// the latest sample taken window before is the base of window.
+	for len(a.samples) > 1 && !a.samples[1].at.After(now.Add(-window)) {
+		a.samples = a.samples[1:]
+	}
+	base := a.samples[0]
+
+	var alerts []FailureAlert
+	for _, platform := range []int{PlatFormIos, PlatFormAndroid, PlatFormWeb, PlatFormHuawei, PlatFormSNS} {
+		failures := current.counts[platform].failure - base.counts[platform].failure
+		total := failures + current.counts[platform].success - base.counts[platform].success
+		// nothing failed, or the stat storage is reset.
+		if failures <= 0 || total < failures {
+			continue
+		}
+
+		rate := float64(failures) / float64(total)
+		if rate < conf.Threshold {
+			continue
+		}
+
+		if last, ok := a.lastAlert[platform]; ok && now.Sub(last) < cooldown {
+			continue
+		}
+		a.lastAlert[platform] = now
+
+		alert := FailureAlert{
+			Provider:    typeForPlatForm(platform),
+			FailureRate: rate,
+			Failures:    failures,
+			Total:       total,
+			Window:      conf.Window,
+			Reasons:     topReasons(current.counts[platform].reasons, base.counts[platform].reasons),
+		}
+		alert.Text = alertText(alert, conf.Threshold)
+		alerts = append(alerts, alert)
+	}
+
+	return alerts
+}
+
+// topReasons return the most frequent error reasons since base.
+func topReasons(current, base map[string]int64) []AlertReason {
+	reasons := []AlertReason{}
+	for reason, count := range current {
+		if count -= base[reason]; count > 0 {
+			reasons = append(reasons, AlertReason{Reason: reason, Count: count})
+		}
+	}
+
+	sort.Slice(reasons, func(i, j int) bool {
+		if reasons[i].Count != reasons[j].Count {
+			return reasons[i].Count > reasons[j].Count
+		}
+		return reasons[i].Reason < reasons[j].Reason
+	})
+
+	if len(reasons) > alertTopReasons {
+		reasons = reasons[:alertTopReasons]
+	}
+
+	return reasons
+}
+
+func alertText(alert FailureAlert, threshold float64) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "gorush %s push failure rate is %.1f%% (%d of %d) in last %ds, threshold is %.1f%%.",
+		alert.Provider, alert.FailureRate*100, alert.Failures, alert.Total, alert.Window, threshold*100)
+
+	if len(alert.Reasons) > 0 {
+		text.WriteString("\nTop errors:")
+		for _, reason := range alert.Reasons {
+			fmt.Fprintf(&text, "\n• %s (%d)", reason.Reason, reason.Count)
+		}
+	}
+
+	return text.String()
+}
+
+func postAlert(client *http.Client, url string, alert FailureAlert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("alert webhook returned %d status code", resp.StatusCode)
+	}
+
+	return nil
+}
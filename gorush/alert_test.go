@@ -0,0 +1,97 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlerterCheck(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.Alert.URL = "http://localhost/alert"
+	PushConf.Core.Alert.Threshold = 0.5
+	PushConf.Core.Alert.Window = 60
+	PushConf.Core.Alert.Cooldown = 600
+	StatStorage.Reset()
+	defer StatStorage.Reset()
+
+	a := newAlerter()
+	now := time.Now()
+	assert.Empty(t, a.check(now))
+
+	// failure rate of android is 60%, iOS is 10%.
+	StatStorage.AddAndroidSuccess(4)
+	StatStorage.AddAndroidError(6)
+	StatStorage.AddIosSuccess(9)
+	StatStorage.AddIosError(1)
+	for i := 0; i < 6; i++ {
+		a.record(PlatFormAndroid, errors.New("Unavailable"))
+	}
+	a.record(PlatFormAndroid, nil)
+	a.record(PlatFormIos, errors.New("BadDeviceToken"))
+
+	alerts := a.check(now.Add(30 * time.Second))
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, "android", alerts[0].Provider)
+	assert.Equal(t, 0.6, alerts[0].FailureRate)
+	assert.Equal(t, int64(6), alerts[0].Failures)
+	assert.Equal(t, int64(10), alerts[0].Total)
+	assert.Equal(t, []AlertReason{{Reason: "Unavailable", Count: 6}, {Reason: "unknown", Count: 1}}, alerts[0].Reasons)
+	assert.Equal(t, "gorush android push failure rate is 60.0% (6 of 10) in last 60s, threshold is 50.0%.\nTop errors:\n• Unavailable (6)\n• unknown (1)", alerts[0].Text)
+
+	// the provider isn't alerted again in cooldown.
+	StatStorage.AddAndroidError(10)
+	assert.Empty(t, a.check(now.Add(60*time.Second)))
+
+	// failures before window are not counted.
+	PushConf.Core.Alert.Cooldown = 0
+	StatStorage.AddAndroidError(10)
+	StatStorage.AddAndroidSuccess(10)
+	alerts = a.check(now.Add(120 * time.Second))
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, int64(10), alerts[0].Failures)
+	assert.Equal(t, int64(20), alerts[0].Total)
+	assert.Empty(t, alerts[0].Reasons)
+
+	StatStorage.AddAndroidSuccess(10)
+	assert.Empty(t, a.check(now.Add(200*time.Second)))
+}
+
+func TestAlerterMaxReasons(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	a := newAlerter()
+
+	// nothing is recorded if alert is disabled.
+	a.record(PlatFormIos, errors.New("Unregistered"))
+	assert.Empty(t, a.reasons)
+
+	PushConf.Core.Alert.URL = "http://localhost/alert"
+	for i := 0; i < alertMaxReasons+10; i++ {
+		a.record(PlatFormIos, fmt.Errorf("error %d", i))
+	}
+	assert.Equal(t, alertMaxReasons+1, len(a.reasons[PlatFormIos]))
+	assert.Equal(t, int64(10), a.reasons[PlatFormIos]["other"])
+}
+
+func TestPostAlert(t *testing.T) {
+	var alert FailureAlert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&alert)
+	}))
+	defer server.Close()
+
+	client := &http.Client{}
+	assert.NoError(t, postAlert(client, server.URL, FailureAlert{Text: "failure", Provider: "ios"}))
+	assert.Equal(t, "failure", alert.Text)
+	assert.Equal(t, "ios", alert.Provider)
+
+	server.Config.Handler = http.NotFoundHandler()
+	assert.EqualError(t, postAlert(client, server.URL, FailureAlert{}), "alert webhook returned 404 status code")
+}
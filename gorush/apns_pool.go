@@ -0,0 +1,361 @@
+package gorush
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sideshow/apns2"
+	"golang.org/x/net/http2"
+)
+
+// apnsPingTimeout is the timeout of HTTP/2 ping frame ack of health check.
+const apnsPingTimeout = 5 * time.Second
+
+// apnsPushTypeKey is the request context key of apns-push-type header which
+// is not supported by apns2 client.
+type apnsPushTypeKey struct{}
+
+// withApnsPushType return the context which sets apns-push-type header of
+// the push request.
+func withApnsPushType(ctx context.Context, pushType string) context.Context {
+	return context.WithValue(ctx, apnsPushTypeKey{}, pushType)
+}
+
+// apnsTransport adds the headers of request context before sending to APNs.
+type apnsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *apnsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if pushType, ok := req.Context().Value(apnsPushTypeKey{}).(string); ok && pushType != "" {
+		// RoundTrip must not modify the request.
+		r := req.WithContext(req.Context())
+		r.Header = make(http.Header, len(req.Header)+1)
+		for k, v := range req.Header {
+			r.Header[k] = v
+		}
+		r.Header.Set("apns-push-type", pushType)
+		req = r
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// apnsConn holds the HTTP/2 connection of one client in APNs pool. It
+// implements http2.ClientConnPool, so the client always sends on its own
+// connection which can be health checked and recreated.
+type apnsConn struct {
+	transport *http2.Transport
+	lock      sync.Mutex
+	conns     map[string]*http2.ClientConn // key is host:port, nil if connection is dead
+	unhealthy int32
+}
+
+func (c *apnsConn) healthy() bool {
+	return atomic.LoadInt32(&c.unhealthy) == 0
+}
+
+func (c *apnsConn) setHealthy(healthy bool) {
+	if healthy {
+		atomic.StoreInt32(&c.unhealthy, 0)
+	} else {
+		atomic.StoreInt32(&c.unhealthy, 1)
+	}
+}
+
+// GetClientConn return the connection of addr, dial new one if it is closed.
+func (c *apnsConn) GetClientConn(req *http.Request, addr string) (*http2.ClientConn, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cc := c.conns[addr]; cc != nil && cc.CanTakeNewRequest() {
+		return cc, nil
+	}
+
+	cc, err := c.dial(addr)
+	if err != nil {
+		c.setHealthy(false)
+		return nil, err
+	}
+
+	c.conns[addr] = cc
+	c.setHealthy(true)
+
+	return cc, nil
+}
+
+// MarkDead remove the broken connection, it is recreated on next request
+// or health check.
+func (c *apnsConn) MarkDead(cc *http2.ClientConn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for addr, conn := range c.conns {
+		if conn == cc {
+			c.conns[addr] = nil
+		}
+	}
+}
+
+func (c *apnsConn) dial(addr string) (*http2.ClientConn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(tls.Config)
+	if c.transport.TLSClientConfig != nil {
+		cfg = c.transport.TLSClientConfig.Clone()
+	}
+	cfg.NextProtos = []string{http2.NextProtoTLS}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+
+	conn, err := dialAPNs("tcp", addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConn, ok := conn.(*tls.Conn); ok && tlsConn.ConnectionState().NegotiatedProtocol != http2.NextProtoTLS {
+		conn.Close()
+		return nil, errors.New("APNs server doesn't support HTTP/2")
+	}
+
+	if timeout := time.Duration(PushConf.Ios.WriteTimeout) * time.Second; timeout > 0 {
+		conn = &writeTimeoutConn{Conn: conn, timeout: timeout}
+	}
+
+	return c.transport.NewClientConn(conn)
+}
+
+// writeTimeoutConn fail the write which is blocked over timeout, then the
+// HTTP/2 connection is closed and dialed again.
+type writeTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *writeTimeoutConn) Write(p []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Write(p)
+}
+
+// ping send HTTP/2 ping on every connection, the connection without ack is
+// closed and recreated, so is the dead connection.
+func (c *apnsConn) ping(timeout time.Duration) {
+	c.lock.Lock()
+	conns := make(map[string]*http2.ClientConn, len(c.conns))
+	for addr, cc := range c.conns {
+		conns[addr] = cc
+	}
+	c.lock.Unlock()
+
+	for addr, cc := range conns {
+		if cc != nil {
+			err := c.check(cc, timeout)
+			if err == nil {
+				continue
+			}
+
+			LogError.Error("APNs connection health check error: " + err.Error())
+		}
+
+		if _, err := c.GetClientConn(nil, addr); err != nil {
+			LogError.Error("APNs reconnect error: " + err.Error())
+		}
+	}
+}
+
+// check send HTTP/2 ping on the connection, it is closed if ack isn't received.
+func (c *apnsConn) check(cc *http2.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := cc.Ping(ctx); err != nil {
+		c.setHealthy(false)
+		cc.Close()
+		c.MarkDead(cc)
+		return err
+	}
+
+	return nil
+}
+
+// ApnsClientPool is a pool of APNs clients, each client has own HTTP/2 connection.
+type ApnsClientPool struct {
+	clients []*apns2.Client
+	conns   []*apnsConn
+	next    uint32
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// newApnsPool create size clients with the credential and host of base client,
+// connections are health checked every interval if it is greater than zero.
+func newApnsPool(base *apns2.Client, size int, interval time.Duration) *ApnsClientPool {
+	if size < 1 {
+		size = 1
+	}
+
+	var tlsConfig *tls.Config
+	if t, ok := base.HTTPClient.Transport.(*http2.Transport); ok {
+		tlsConfig = t.TLSClientConfig
+	}
+
+	p := &ApnsClientPool{
+		stop: make(chan struct{}),
+	}
+
+	for i := 0; i < size; i++ {
+		transport := &http2.Transport{
+			TLSClientConfig: tlsConfig,
+			DialTLS:         dialAPNs,
+			// ping the connection without any frame read for the interval.
+			ReadIdleTimeout: time.Duration(PushConf.Ios.IdlePingInterval) * time.Second,
+			PingTimeout:     apnsPingTimeout,
+		}
+		conn := &apnsConn{
+			transport: transport,
+			conns:     make(map[string]*http2.ClientConn),
+		}
+		transport.ConnPool = conn
+
+		p.conns = append(p.conns, conn)
+		p.clients = append(p.clients, &apns2.Client{
+			Host:        base.Host,
+			Certificate: base.Certificate,
+			Token:       base.Token,
+			HTTPClient: &http.Client{
+				Transport: &apnsTransport{base: transport},
+				Timeout:   time.Duration(PushConf.Ios.ReadTimeout) * time.Second,
+			},
+		})
+	}
+
+	if interval > 0 {
+		go p.healthCheck(interval)
+	}
+
+	return p
+}
+
+// Client pick a healthy client of pool by round-robin.
+func (p *ApnsClientPool) Client() *apns2.Client {
+	n := uint32(len(p.clients))
+	start := atomic.AddUint32(&p.next, 1) - 1
+
+	for i := uint32(0); i < n; i++ {
+		idx := (start + i) % n
+		if p.conns[idx].healthy() {
+			return p.clients[idx]
+		}
+	}
+
+	// all connections are unhealthy, let the client try to reconnect.
+	return p.clients[start%n]
+}
+
+// Stats return the number of active and unhealthy connections.
+func (p *ApnsClientPool) Stats() (active, unhealthy int) {
+	for _, conn := range p.conns {
+		if conn.healthy() {
+			active++
+		} else {
+			unhealthy++
+		}
+	}
+
+	return active, unhealthy
+}
+
+// probe check if any connection of pool can reach APNs host, the connection
+// is dialed if there is none.
+func (p *ApnsClientPool) probe(host string, timeout time.Duration) error {
+	u, err := url.Parse(host)
+	if err != nil {
+		return err
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr += ":443"
+	}
+
+	for _, conn := range p.conns {
+		var cc *http2.ClientConn
+		if cc, err = conn.GetClientConn(nil, addr); err != nil {
+			continue
+		}
+		if err = conn.check(cc, timeout); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// apnsConnStats return the connection number of all APNs pools.
+func apnsConnStats() (active, unhealthy int) {
+	pools := []*ApnsClientPool{ApnsPool}
+	for _, pool := range ApnsPools {
+		pools = append(pools, pool)
+	}
+	for _, pool := range ApnsOtherPools {
+		pools = append(pools, pool)
+	}
+
+	for _, pool := range pools {
+		if pool == nil {
+			continue
+		}
+		a, u := pool.Stats()
+		active += a
+		unhealthy += u
+	}
+
+	return active, unhealthy
+}
+
+func (p *ApnsClientPool) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, conn := range p.conns {
+				conn.ping(apnsPingTimeout)
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Close stop health check and close all connections of pool.
+func (p *ApnsClientPool) Close() {
+	p.once.Do(func() {
+		close(p.stop)
+		for _, conn := range p.conns {
+			conn.lock.Lock()
+			for addr, cc := range conn.conns {
+				if cc != nil {
+					cc.Close()
+				}
+				delete(conn.conns, addr)
+			}
+			conn.lock.Unlock()
+		}
+	})
+}
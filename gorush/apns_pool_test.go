@@ -0,0 +1,210 @@
+package gorush
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/sideshow/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+// testApnsServer start HTTP/2 server as APNs, conns counts the new connections.
+func testApnsServer(t *testing.T) (server *httptest.Server, conns *int64, cleanup func()) {
+	conns = new(int64)
+	server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "HTTP/2.0", r.Proto)
+		// apns-id of request is echoed.
+		id := r.Header.Get("apns-id")
+		if id == "" {
+			id = "apns-id"
+		}
+		w.Header().Set("apns-id", id)
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(conns, 1)
+		}
+	}
+	server.EnableHTTP2 = true
+	server.StartTLS()
+
+	dial := dialTLS
+	dialTLS = func(dialer *net.Dialer, network, addr string, cfg *tls.Config) (*tls.Conn, error) {
+		cfg.InsecureSkipVerify = true
+		return tls.DialWithDialer(dialer, network, server.Listener.Addr().String(), cfg)
+	}
+
+	return server, conns, func() {
+		dialTLS = dial
+		server.Close()
+	}
+}
+
+func TestApnsPoolRoundRobin(t *testing.T) {
+	server, conns, cleanup := testApnsServer(t)
+	defer cleanup()
+
+	base := apns2.NewClient(tls.Certificate{})
+	base.Host = server.URL
+	pool := newApnsPool(base, 2, 0)
+	defer pool.Close()
+
+	assert.Equal(t, 2, len(pool.clients))
+	assert.NotEqual(t, pool.Client(), pool.Client())
+
+	for i := 0; i < 4; i++ {
+		res, err := pool.Client().Push(&apns2.Notification{DeviceToken: "aaaaa"})
+		assert.NoError(t, err)
+		assert.True(t, res.Sent())
+	}
+
+	// each client sends on own connection.
+	assert.Equal(t, int64(2), atomic.LoadInt64(conns))
+
+	active, unhealthy := pool.Stats()
+	assert.Equal(t, 2, active)
+	assert.Equal(t, 0, unhealthy)
+}
+
+func TestApnsPoolHealthCheck(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	server, conns, cleanup := testApnsServer(t)
+	defer cleanup()
+
+	base := apns2.NewClient(tls.Certificate{})
+	base.Host = server.URL
+	pool := newApnsPool(base, 2, 0)
+	defer pool.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err := pool.Client().Push(&apns2.Notification{DeviceToken: "aaaaa"})
+		assert.NoError(t, err)
+	}
+
+	// broken connections are recreated by health check.
+	server.CloseClientConnections()
+	for _, conn := range pool.conns {
+		conn.ping(time.Second)
+	}
+	assert.Equal(t, int64(4), atomic.LoadInt64(conns))
+	active, _ := pool.Stats()
+	assert.Equal(t, 2, active)
+
+	// connection is unhealthy if server is unreachable.
+	server.CloseClientConnections()
+	server.Close()
+	pool.conns[0].ping(time.Second)
+	active, unhealthy := pool.Stats()
+	assert.Equal(t, 1, active)
+	assert.Equal(t, 1, unhealthy)
+
+	// unhealthy client is skipped.
+	assert.Equal(t, pool.clients[1], pool.Client())
+	assert.Equal(t, pool.clients[1], pool.Client())
+
+	ApnsPool = pool
+	defer func() {
+		ApnsPool = nil
+	}()
+	active, unhealthy = apnsConnStats()
+	assert.Equal(t, 1, active)
+	assert.Equal(t, 1, unhealthy)
+}
+
+func TestPushToIOSDuration(t *testing.T) {
+	_, _, cleanup := testApnsServer(t)
+	defer cleanup()
+
+	PushConf, _ = config.LoadConf("")
+	ApnsPool = newApnsPool(apns2.NewClient(tls.Certificate{}), 1, 0)
+	defer func() {
+		ApnsPool.Close()
+		ApnsPool = nil
+	}()
+
+	success := pushDurationCount(t, "ios", "success")
+
+	isError := PushToIOS(PushNotification{
+		Platform: PlatFormIos,
+		Tokens:   []string{"aaaaa", "bbbbb"},
+		Message:  "Welcome",
+	})
+	assert.False(t, isError)
+	assert.Equal(t, success+2, pushDurationCount(t, "ios", "success"))
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestApnsTransportPushType(t *testing.T) {
+	var header http.Header
+	transport := &apnsTransport{base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		header = req.Header
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})}
+
+	req, _ := http.NewRequest("POST", "https://api.push.apple.com/3/device/aaaaa", nil)
+	_, err := transport.RoundTrip(req.WithContext(withApnsPushType(context.Background(), "background")))
+	assert.NoError(t, err)
+	assert.Equal(t, "background", header.Get("apns-push-type"))
+	assert.Empty(t, req.Header.Get("apns-push-type"))
+
+	// header is omitted.
+	_, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Empty(t, header.Get("apns-push-type"))
+}
+
+func TestApnsPoolNetConf(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	dialer := apnsDialer()
+	assert.Equal(t, 20*time.Second, dialer.Timeout)
+	assert.Equal(t, 60*time.Second, dialer.KeepAlive)
+
+	pool := newApnsPool(apns2.NewClient(tls.Certificate{}), 1, 0)
+	assert.Equal(t, 60*time.Second, pool.clients[0].HTTPClient.Timeout)
+	assert.Equal(t, time.Duration(0), pool.conns[0].transport.ReadIdleTimeout)
+	pool.Close()
+
+	PushConf.Ios.KeepAlive = 0
+	PushConf.Ios.ReadTimeout = 5
+	PushConf.Ios.IdlePingInterval = 15
+	assert.Equal(t, time.Duration(-1), apnsDialer().KeepAlive)
+	pool = newApnsPool(apns2.NewClient(tls.Certificate{}), 1, 0)
+	defer pool.Close()
+	assert.Equal(t, 5*time.Second, pool.clients[0].HTTPClient.Timeout)
+	assert.Equal(t, 15*time.Second, pool.conns[0].transport.ReadIdleTimeout)
+	assert.Equal(t, apnsPingTimeout, pool.conns[0].transport.PingTimeout)
+}
+
+func TestApnsWriteTimeout(t *testing.T) {
+	_, _, cleanup := testApnsServer(t)
+	defer cleanup()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Ios.WriteTimeout = 1
+	pool := newApnsPool(apns2.NewClient(tls.Certificate{}), 1, 0)
+	defer pool.Close()
+
+	res, err := pool.Client().Push(&apns2.Notification{DeviceToken: "aaaaa"})
+	assert.NoError(t, err)
+	assert.True(t, res.Sent())
+
+	// the write of blocked peer fails after timeout.
+	client, peer := net.Pipe()
+	defer peer.Close()
+	conn := &writeTimeoutConn{Conn: client, timeout: 10 * time.Millisecond}
+	_, err = conn.Write([]byte("ping"))
+	assert.Error(t, err)
+}
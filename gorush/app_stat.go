@@ -0,0 +1,139 @@
+package gorush
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AppStatus is push counters of named app profile.
+type AppStatus struct {
+	App          string  `json:"app"`
+	PushSuccess  int64   `json:"push_success"`
+	PushError    int64   `json:"push_error"`
+	InvalidToken int64   `json:"invalid_token"`
+	AvgLatency   float64 `json:"avg_latency"` // milliseconds
+}
+
+// appCounter is updated by workers atomically.
+type appCounter struct {
+	success      int64
+	failure      int64
+	invalid      int64
+	latencyCount int64
+	latencyTotal int64 // nanoseconds
+}
+
+// appStatStore keep counters of each app profile in memory.
+type appStatStore struct {
+	sync.RWMutex
+	counters map[string]*appCounter
+}
+
+var appStats = &appStatStore{counters: make(map[string]*appCounter)}
+
+// counter return the counter of app, nil for notification without app.
+func (s *appStatStore) counter(app string) *appCounter {
+	if app == "" {
+		return nil
+	}
+	app = strings.ToLower(app)
+
+	s.RLock()
+	c, ok := s.counters[app]
+	s.RUnlock()
+	if ok {
+		return c
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if c, ok = s.counters[app]; !ok {
+		c = &appCounter{}
+		s.counters[app] = c
+	}
+
+	return c
+}
+
+// add count push result of token for app.
+func (s *appStatStore) add(app, status string) {
+	c := s.counter(app)
+	if c == nil {
+		return
+	}
+
+	switch status {
+	case SucceededPush:
+		atomic.AddInt64(&c.success, 1)
+	case FailedPush:
+		atomic.AddInt64(&c.failure, 1)
+	case InvalidTokenPush:
+		atomic.AddInt64(&c.invalid, 1)
+	}
+}
+
+// observe record latency of provider request for app.
+func (s *appStatStore) observe(app string, duration time.Duration) {
+	c := s.counter(app)
+	if c == nil {
+		return
+	}
+
+	atomic.AddInt64(&c.latencyCount, 1)
+	atomic.AddInt64(&c.latencyTotal, int64(duration))
+}
+
+// status return the counters of app.
+func (s *appStatStore) status(app string) AppStatus {
+	app = strings.ToLower(app)
+	result := AppStatus{App: app}
+
+	s.RLock()
+	c, ok := s.counters[app]
+	s.RUnlock()
+	if !ok {
+		return result
+	}
+
+	result.PushSuccess = atomic.LoadInt64(&c.success)
+	result.PushError = atomic.LoadInt64(&c.failure)
+	result.InvalidToken = atomic.LoadInt64(&c.invalid)
+	if count := atomic.LoadInt64(&c.latencyCount); count > 0 {
+		total := time.Duration(atomic.LoadInt64(&c.latencyTotal))
+		result.AvgLatency = float64(total) / float64(count) / float64(time.Millisecond)
+	}
+
+	return result
+}
+
+// addPushResult record push result of token for async push job and app stats.
+func addPushResult(status string, req PushNotification) {
+	addJobResult(status, req)
+	appStats.add(req.App, status)
+}
+
+// appConfigured check the app is configured in iOS or android apps.
+func appConfigured(app string) bool {
+	if _, ok := iosApp(app); ok {
+		return true
+	}
+	_, ok := androidApp(app)
+
+	return ok
+}
+
+func appStatHandler(c *gin.Context) {
+	app := c.Param("app_id")
+	if !appConfigured(app) {
+		abortWithError(c, http.StatusNotFound, fmt.Sprintf("The app %s is not found.", app))
+		return
+	}
+
+	c.JSON(http.StatusOK, appStats.status(app))
+}
@@ -0,0 +1,72 @@
+package gorush
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/buger/jsonparser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppStatStore(t *testing.T) {
+	store := &appStatStore{counters: make(map[string]*appCounter)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.add("Billing", SucceededPush)
+			store.add("billing", FailedPush)
+			store.observe("billing", 10*time.Millisecond)
+		}()
+	}
+	wg.Wait()
+	store.add("billing", InvalidTokenPush)
+
+	// notification without app is only counted in the top level stats.
+	store.add("", SucceededPush)
+	store.observe("", time.Second)
+
+	status := store.status("BILLING")
+	assert.Equal(t, "billing", status.App)
+	assert.Equal(t, int64(10), status.PushSuccess)
+	assert.Equal(t, int64(10), status.PushError)
+	assert.Equal(t, int64(1), status.InvalidToken)
+	assert.Equal(t, float64(10), status.AvgLatency)
+	assert.Equal(t, 1, len(store.counters))
+
+	assert.Equal(t, AppStatus{App: "marketing"}, store.status("marketing"))
+}
+
+func TestAppStatHandler(t *testing.T) {
+	initTest()
+	PushConf.API.StatAppURI = "/stat/app"
+	PushConf.Android.Apps = map[string]config.SectionAndroidApp{"billing": {}}
+	defer func() {
+		appStats = &appStatStore{counters: make(map[string]*appCounter)}
+	}()
+
+	addPushResult(SucceededPush, PushNotification{Platform: PlatFormAndroid, App: "billing"})
+
+	r := gofight.New()
+
+	r.GET("/api/stat/app/billing").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := r.Body.Bytes()
+			success, _ := jsonparser.GetInt(data, "push_success")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, int64(1), success)
+		})
+
+	r.GET("/api/stat/app/unknown").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusNotFound, r.Code)
+		})
+}
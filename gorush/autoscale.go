@@ -0,0 +1,86 @@
+package gorush
+
+import (
+	"time"
+)
+
+// autoscaleInterval is how often the queue depth is checked.
+var autoscaleInterval = time.Second
+
+// autoscaler resize the worker_num pool between core.min_workers and
+// core.max_workers, the pool is doubled when queue depth stays high and
+// halved when queue stays empty with idle workers.
+type autoscaler struct {
+	highSince time.Time
+	idleSince time.Time
+}
+
+// InitAutoscale start resizing the common worker pool by queue depth if
+// core.max_workers is set, dedicated platform pools are not resized.
+func InitAutoscale() {
+	if PushConf.Core.MaxWorkers <= 0 {
+		return
+	}
+
+	LogAccess.Debug("autoscale worker number from ", PushConf.Core.MinWorkers, " to ", PushConf.Core.MaxWorkers)
+	go func() {
+		a := &autoscaler{}
+		ticker := time.NewTicker(autoscaleInterval)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			pool := commonWorkers
+			size := int64(pool.size())
+			target := a.target(now, size, pool.busyCount(), len(pool.queue))
+			if target != size {
+				LogAccess.Infof("autoscale worker number from %d to %d, queue depth is %d", size, target, len(pool.queue))
+				pool.resize(target)
+			}
+		}
+	}()
+}
+
+// target return the worker number of pool, it is changed once the queue
+// depth lasts for scale up or down interval.
+func (a *autoscaler) target(now time.Time, size, busy int64, depth int) int64 {
+	target := size
+	switch {
+	case depth >= PushConf.Core.ScaleUpQueueDepth:
+		a.idleSince = time.Time{}
+		if a.highSince.IsZero() {
+			a.highSince = now
+		}
+		if now.Sub(a.highSince) >= time.Duration(PushConf.Core.ScaleUpInterval)*time.Second {
+			a.highSince = now
+			target = size * 2
+		}
+	case depth == 0 && busy < size:
+		a.highSince = time.Time{}
+		if a.idleSince.IsZero() {
+			a.idleSince = now
+		}
+		if now.Sub(a.idleSince) >= time.Duration(PushConf.Core.ScaleDownInterval)*time.Second {
+			a.idleSince = now
+			// busy workers are kept, they finish the notification anyway.
+			target = size / 2
+			if target < busy {
+				target = busy
+			}
+		}
+	default:
+		a.highSince, a.idleSince = time.Time{}, time.Time{}
+	}
+
+	min, max := PushConf.Core.MinWorkers, PushConf.Core.MaxWorkers
+	if min < 1 {
+		min = 1
+	}
+	if target < min {
+		target = min
+	}
+	if target > max {
+		target = max
+	}
+
+	return target
+}
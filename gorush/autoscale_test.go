@@ -0,0 +1,62 @@
+package gorush
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoscaleTarget(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+	}()
+	PushConf.Core.MinWorkers = 2
+	PushConf.Core.MaxWorkers = 10
+	PushConf.Core.ScaleUpQueueDepth = 100
+	PushConf.Core.ScaleUpInterval = 10
+	PushConf.Core.ScaleDownInterval = 60
+
+	a := &autoscaler{}
+	now := time.Now()
+
+	// the queue depth must last for scale up interval.
+	assert.Equal(t, int64(4), a.target(now, 4, 4, 100))
+	assert.Equal(t, int64(4), a.target(now.Add(5*time.Second), 4, 4, 200))
+	assert.Equal(t, int64(8), a.target(now.Add(10*time.Second), 4, 4, 200))
+	assert.Equal(t, int64(10), a.target(now.Add(20*time.Second), 8, 8, 200))
+
+	// the drop of queue depth resets the interval.
+	assert.Equal(t, int64(8), a.target(now.Add(21*time.Second), 8, 8, 50))
+	assert.Equal(t, int64(8), a.target(now.Add(22*time.Second), 8, 8, 200))
+	assert.Equal(t, int64(8), a.target(now.Add(30*time.Second), 8, 8, 200))
+
+	// busy workers are kept when the queue is empty.
+	now = now.Add(time.Minute)
+	assert.Equal(t, int64(8), a.target(now, 8, 6, 0))
+	assert.Equal(t, int64(6), a.target(now.Add(time.Minute), 8, 6, 0))
+	assert.Equal(t, int64(3), a.target(now.Add(2*time.Minute), 6, 0, 0))
+	assert.Equal(t, int64(2), a.target(now.Add(3*time.Minute), 3, 0, 0))
+	assert.Equal(t, int64(2), a.target(now.Add(4*time.Minute), 2, 0, 0))
+
+	// the pool is kept between min and max workers.
+	assert.Equal(t, int64(10), a.target(now, 16, 16, 50))
+	assert.Equal(t, int64(2), a.target(now, 1, 1, 50))
+}
+
+func TestWorkersMetric(t *testing.T) {
+	initTest()
+	InitWorkers(3, 10)
+	defer InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+
+	r := gofight.New()
+	r.GET(PushConf.API.MetricURI).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Contains(t, r.Body.String(), `gorush_workers{pool="common"} 3`)
+			assert.NotContains(t, r.Body.String(), `gorush_workers{pool="ios"}`)
+		})
+}
@@ -0,0 +1,221 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// awsMetadataTimeout is the timeout of container and instance metadata
+// requests, the metadata services are only reachable on AWS.
+const awsMetadataTimeout = 2 * time.Second
+
+var (
+	// awsContainerEndpoint is the credentials endpoint of ECS task role.
+	awsContainerEndpoint = "http://169.254.170.2"
+	// awsMetadataEndpoint is the instance metadata service of EC2.
+	awsMetadataEndpoint = "http://169.254.169.254"
+)
+
+// envAWSCredentials read the access key from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func envAWSCredentials() awsCredentials {
+	return awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// loadAWSCredentials find the access key by the default provider chain of
+// AWS: environment variables, shared credentials file, ECS task role and EC2
+// instance role. The expiry is zero if the key never expires.
+func loadAWSCredentials() (awsCredentials, time.Time, error) {
+	if creds := envAWSCredentials(); creds.accessKeyID != "" && creds.secretAccessKey != "" {
+		return creds, time.Time{}, nil
+	}
+
+	creds, err := sharedAWSCredentials()
+	if err != nil {
+		return awsCredentials{}, time.Time{}, err
+	}
+	if creds.accessKeyID != "" && creds.secretAccessKey != "" {
+		return creds, time.Time{}, nil
+	}
+
+	client := &http.Client{Timeout: awsMetadataTimeout}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		req, err := http.NewRequest("GET", awsContainerEndpoint+uri, nil)
+		if err != nil {
+			return awsCredentials{}, time.Time{}, err
+		}
+		return fetchAWSRoleCredentials(client, req)
+	}
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		req, err := http.NewRequest("GET", uri, nil)
+		if err != nil {
+			return awsCredentials{}, time.Time{}, err
+		}
+		if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		return fetchAWSRoleCredentials(client, req)
+	}
+
+	if strings.ToLower(os.Getenv("AWS_EC2_METADATA_DISABLED")) != "true" {
+		return instanceAWSCredentials(client)
+	}
+
+	return awsCredentials{}, time.Time{}, errors.New("no AWS credentials found")
+}
+
+// sharedAWSCredentials read the profile of AWS_PROFILE, default profile if
+// empty, from the shared credentials file. The empty access key is returned
+// if the file doesn't exist.
+func sharedAWSCredentials() (awsCredentials, error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return awsCredentials{}, nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return awsCredentials{}, nil
+	}
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	var creds awsCredentials
+	section := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if section != profile || len(kv) != 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "aws_access_key_id":
+			creds.accessKeyID = value
+		case "aws_secret_access_key":
+			creds.secretAccessKey = value
+		case "aws_session_token":
+			creds.sessionToken = value
+		}
+	}
+
+	return creds, nil
+}
+
+// instanceAWSCredentials read the credentials of EC2 instance role by
+// IMDSv2 session token.
+func instanceAWSCredentials(client *http.Client) (awsCredentials, time.Time, error) {
+	req, err := http.NewRequest("PUT", awsMetadataEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := awsMetadata(client, req)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("no AWS credentials found, instance metadata: %v", err)
+	}
+
+	path := awsMetadataEndpoint + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequest("GET", path, nil)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	roles, err := awsMetadata(client, req)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("instance role: %v", err)
+	}
+	role := strings.TrimSpace(strings.Split(roles, "\n")[0])
+	if role == "" {
+		return awsCredentials{}, time.Time{}, errors.New("no instance role of EC2")
+	}
+
+	req, err = http.NewRequest("GET", path+role, nil)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+
+	return fetchAWSRoleCredentials(client, req)
+}
+
+// awsMetadata return the body of metadata request.
+func awsMetadata(client *http.Client, req *http.Request) (string, error) {
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%d error: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return string(body), nil
+}
+
+// fetchAWSRoleCredentials read the temporary credentials of role from ECS or
+// EC2 metadata.
+func fetchAWSRoleCredentials(client *http.Client, req *http.Request) (awsCredentials, time.Time, error) {
+	body, err := awsMetadata(client, req)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("role credentials: %v", err)
+	}
+
+	var role struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal([]byte(body), &role); err != nil {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("invalid role credentials: %v", err)
+	}
+
+	if role.AccessKeyID == "" || role.SecretAccessKey == "" {
+		return awsCredentials{}, time.Time{}, errors.New("role credentials: empty access key")
+	}
+
+	return awsCredentials{
+		accessKeyID:     role.AccessKeyID,
+		secretAccessKey: role.SecretAccessKey,
+		sessionToken:    role.Token,
+	}, role.Expiration, nil
+}
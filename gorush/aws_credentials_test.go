@@ -0,0 +1,107 @@
+package gorush
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedAWSCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorush")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "credentials")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`
+[default]
+aws_access_key_id = default-key
+aws_secret_access_key = default-secret
+
+# push profile
+[push]
+aws_access_key_id=push-key
+aws_secret_access_key=push-secret
+aws_session_token=push-token
+`), 0600))
+
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", path)
+	defer os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+
+	creds, expiry, err := loadAWSCredentials()
+	assert.NoError(t, err)
+	assert.True(t, expiry.IsZero())
+	assert.Equal(t, awsCredentials{accessKeyID: "default-key", secretAccessKey: "default-secret"}, creds)
+
+	os.Setenv("AWS_PROFILE", "push")
+	defer os.Unsetenv("AWS_PROFILE")
+	creds, _, err = loadAWSCredentials()
+	assert.NoError(t, err)
+	assert.Equal(t, awsCredentials{accessKeyID: "push-key", secretAccessKey: "push-secret", sessionToken: "push-token"}, creds)
+}
+
+func TestContainerAWSCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/credentials/task", r.URL.Path)
+		_, _ = w.Write([]byte(`{"AccessKeyId":"role-key","SecretAccessKey":"role-secret","Token":"role-token","Expiration":"2030-01-02T15:04:05Z"}`))
+	}))
+	defer server.Close()
+
+	endpoint := awsContainerEndpoint
+	awsContainerEndpoint = server.URL
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", "not-exists")
+	os.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "/v2/credentials/task")
+	defer func() {
+		awsContainerEndpoint = endpoint
+		os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+		os.Unsetenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+	}()
+
+	creds, expiry, err := loadAWSCredentials()
+	assert.NoError(t, err)
+	assert.Equal(t, awsCredentials{accessKeyID: "role-key", secretAccessKey: "role-secret", sessionToken: "role-token"}, creds)
+	assert.Equal(t, 2030, expiry.Year())
+}
+
+func TestInstanceAWSCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			assert.Equal(t, "PUT", r.Method)
+			_, _ = w.Write([]byte("session-token"))
+			return
+		}
+
+		assert.Equal(t, "session-token", r.Header.Get("X-aws-ec2-metadata-token"))
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			_, _ = w.Write([]byte("gorush-role"))
+		case "/latest/meta-data/iam/security-credentials/gorush-role":
+			_, _ = w.Write([]byte(`{"Code":"Success","AccessKeyId":"ec2-key","SecretAccessKey":"ec2-secret","Token":"ec2-token","Expiration":"2030-01-02T15:04:05Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	endpoint := awsMetadataEndpoint
+	awsMetadataEndpoint = server.URL
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", "not-exists")
+	defer func() {
+		awsMetadataEndpoint = endpoint
+		os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+	}()
+
+	creds, _, err := loadAWSCredentials()
+	assert.NoError(t, err)
+	assert.Equal(t, awsCredentials{accessKeyID: "ec2-key", secretAccessKey: "ec2-secret", sessionToken: "ec2-token"}, creds)
+
+	// no credentials outside of AWS.
+	os.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	defer os.Unsetenv("AWS_EC2_METADATA_DISABLED")
+	_, _, err = loadAWSCredentials()
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package gorush
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitedBody read request body up to the limit by http.MaxBytesReader, and
+// record whether the body is larger than the limit.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		b.exceeded = true
+	}
+
+	return n, err
+}
+
+// bodyTooLarge reports whether the request body is over core.max_body_size.
+func bodyTooLarge(c *gin.Context) bool {
+	body, ok := c.Request.Body.(*limitedBody)
+	return ok && body.exceeded
+}
+
+func abortWithBodyTooLarge(c *gin.Context, limit int64) {
+	abortWithError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body is over limit(%d bytes).", limit))
+}
+
+// BodyLimitMiddleware reject the request body larger than limit with 413, the
+// body is limited after it is decompressed, so it is never read into memory
+// beyond the limit.
+func BodyLimitMiddleware(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			abortWithBodyTooLarge(c, limit)
+			return
+		}
+
+		c.Request.Body = &limitedBody{
+			ReadCloser: http.MaxBytesReader(c.Writer, c.Request.Body, limit),
+			limit:      limit,
+		}
+		c.Next()
+	}
+}
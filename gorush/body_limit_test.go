@@ -0,0 +1,63 @@
+package gorush
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+	PushConf.Android.Enabled = true
+	PushConf.Core.MaxBodySize = 256
+	// no worker consumes the queue.
+	InitWorkers(0, 10)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	line := `{"tokens":["aaaaa"],"platform":2,"message":"Welcome"}`
+	large := `{"notifications":[` + strings.Repeat(line+",", 10) + line + `]}`
+
+	push := func(body, contentType string, chunked bool) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/push", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		routerEngine().ServeHTTP(w, req)
+		return w
+	}
+
+	// rejected by Content-Length before body is read.
+	w := push(large, "application/json", false)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.JSONEq(t, `{"code":413,"message":"Request body is over limit(256 bytes)."}`, w.Body.String())
+
+	// body of unknown length is stopped at the limit.
+	w = push(large, "application/json", true)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, 0, len(QueueNotification))
+
+	w = push(`{"notifications":[`+line+`]}`, "application/json", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, len(QueueNotification))
+	<-QueueNotification
+
+	w = push(strings.Repeat(line+"\n", 10), NDJSONContentType, false)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// the body of unknown length is rejected the same as JSON body, the
+	// lines before the limit are queued.
+	w = push(strings.Repeat(line+"\n", 10), NDJSONContentType, true)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "Request body is over limit")
+	assert.Equal(t, 4, len(QueueNotification))
+}
@@ -0,0 +1,113 @@
+package gorush
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errProviderUnavailable is the error of notification rejected by open circuit.
+var errProviderUnavailable = errors.New("provider_unavailable")
+
+// state of circuit breaker, the value is exposed as prometheus gauge.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stop sending to push provider after consecutive failures,
+// one probe is allowed after cooldown to check the provider is recovered.
+type circuitBreaker struct {
+	name     string
+	lock     sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// breakers of each push provider.
+var breakers = map[int]*circuitBreaker{
+	PlatFormIos:     {name: "ios"},
+	PlatFormAndroid: {name: "android"},
+	PlatFormWeb:     {name: "web"},
+	PlatFormHuawei:  {name: "huawei"},
+	PlatFormSNS:     {name: "sns"},
+}
+
+// allow reports whether the notification can be sent to provider, the
+// result must be recorded if it is allowed.
+func (b *circuitBreaker) allow() bool {
+	threshold := PushConf.Core.CircuitBreaker.FailureThreshold
+	if threshold <= 0 {
+		return true
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		cooldown := time.Duration(PushConf.Core.CircuitBreaker.Cooldown) * time.Second
+		if time.Since(b.openedAt) < cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		// only one probe is sent until the result is known.
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+
+	return true
+}
+
+// record the result of provider request, failure is the error of provider
+// itself, e.g. connection error or HTTP 5xx, not the rejected token.
+func (b *circuitBreaker) record(failure bool) {
+	threshold := PushConf.Core.CircuitBreaker.FailureThreshold
+	if threshold <= 0 {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.probing = false
+	if !failure {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= threshold {
+		if b.state != breakerOpen {
+			LogError.Errorf("%s circuit breaker is open after %d failures", b.name, b.failures)
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// current return the state of breaker.
+func (b *circuitBreaker) current() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.state
+}
+
+// failUnavailable fail the recipients without sending while the circuit of
+// provider is open, they are kept in dead letter for replay.
+func failUnavailable(req PushNotification, recipients []string, attempts int) {
+	for _, to := range recipients {
+		failToken(to, req, errProviderUnavailable)
+	}
+	addDeadLetter(req, recipients, errProviderUnavailable, attempts)
+}
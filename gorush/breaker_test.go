@@ -0,0 +1,100 @@
+package gorush
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	b := &circuitBreaker{name: "ios"}
+
+	// disabled by default.
+	for i := 0; i < 10; i++ {
+		b.record(true)
+	}
+	assert.True(t, b.allow())
+	assert.Equal(t, breakerClosed, b.current())
+
+	PushConf.Core.CircuitBreaker.FailureThreshold = 3
+	PushConf.Core.CircuitBreaker.Cooldown = 30
+
+	// success resets consecutive failures.
+	b.record(true)
+	b.record(true)
+	b.record(false)
+	b.record(true)
+	assert.Equal(t, breakerClosed, b.current())
+
+	b.record(true)
+	b.record(true)
+	assert.Equal(t, breakerOpen, b.current())
+	assert.False(t, b.allow())
+
+	// only one probe after cooldown.
+	b.openedAt = time.Now().Add(-31 * time.Second)
+	assert.True(t, b.allow())
+	assert.Equal(t, breakerHalfOpen, b.current())
+	assert.False(t, b.allow())
+
+	// failed probe opens the circuit again.
+	b.record(true)
+	assert.Equal(t, breakerOpen, b.current())
+	assert.False(t, b.allow())
+
+	b.openedAt = time.Now().Add(-31 * time.Second)
+	assert.True(t, b.allow())
+	b.record(false)
+	assert.Equal(t, breakerClosed, b.current())
+	assert.True(t, b.allow())
+}
+
+func TestPushToAndroidCircuitOpen(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.Sync = true
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	PushConf.Core.CircuitBreaker.FailureThreshold = 2
+	FCMClient, _ = fcm.NewClient(PushConf.Android.APIKey,
+		fcm.WithEndpoint(server.URL),
+		fcm.WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+	)
+	defer func() {
+		FCMClient = nil
+		breakers[PlatFormAndroid] = &circuitBreaker{name: "android"}
+	}()
+
+	req := PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+	}
+
+	assert.False(t, PushToAndroid(req))
+	assert.False(t, PushToAndroid(req))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Equal(t, breakerOpen, breakers[PlatFormAndroid].current())
+
+	// the open circuit fails fast without request.
+	var logs []LogPushEntry
+	req.log = &logs
+	assert.True(t, PushToAndroid(req))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Equal(t, 1, len(logs))
+	assert.Equal(t, "provider_unavailable", logs[0].Error)
+}
@@ -0,0 +1,217 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CallbackResult is delivery results of notification posted to its
+// callback_url when all tokens are sent, results are the same as feedback
+// including invalid token reports.
+type CallbackResult struct {
+	ID       string           `json:"notif_id,omitempty"`
+	Platform string           `json:"platform"`
+	Success  int              `json:"success"`
+	Failure  int              `json:"failure"`
+	Results  []FeedbackResult `json:"results"`
+}
+
+// notificationCallback collect the results of notification, it is shared by
+// copies of notification during retries and template rendering.
+type notificationCallback struct {
+	sync.Mutex
+	results []FeedbackResult
+}
+
+func (c *notificationCallback) add(result FeedbackResult) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.results = append(c.results, result)
+}
+
+type callbackJob struct {
+	url    string
+	result CallbackResult
+}
+
+// queueCallback is the pending callbacks, nil if callback is not initialized.
+var queueCallback chan callbackJob
+
+// InitCallback start core.callback_concurrency workers of notification callback.
+func InitCallback() {
+	queueCallback = make(chan callbackJob, feedbackQueueNum())
+	client := &http.Client{
+		Timeout:       time.Duration(PushConf.Core.FeedbackTimeout) * time.Second,
+		CheckRedirect: checkCallbackRedirect,
+	}
+
+	workers := PushConf.Core.CallbackNum
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go callbackWorker(client, queueCallback)
+	}
+}
+
+func callbackWorker(client *http.Client, queue chan callbackJob) {
+	for job := range queue {
+		err := dispatchCallback(client, job, PushConf.Core.FeedbackMaxRetry)
+		countFeedbackRequest("callback", err)
+		if err != nil {
+			LogError.Error("callback error: " + err.Error())
+		}
+	}
+}
+
+// checkCallbackRedirect refuse the redirect of callback request to the host
+// not in core.callback_allowed_hosts, so the allowed host can't redirect it
+// to internal address.
+func checkCallbackRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+
+	if (req.URL.Scheme != "http" && req.URL.Scheme != "https") || !callbackHostAllowed(req.URL.Hostname()) {
+		return fmt.Errorf("redirect of callback to %s is not allowed", req.URL.Host)
+	}
+
+	return nil
+}
+
+// dispatchCallback post the results to callback url, resend fail request up
+// to maxRetry times with exponential backoff.
+func dispatchCallback(client *http.Client, job callbackJob, maxRetry int) error {
+	payload, err := json.Marshal(job.result)
+	if err != nil {
+		return err
+	}
+
+	for retryCount := 0; ; retryCount++ {
+		err = postFeedback(client, job.url, payload)
+		if err == nil || retryCount >= maxRetry {
+			return err
+		}
+
+		LogError.Warn(fmt.Sprintf("resend callback request after %s: %s", feedbackBackoff(retryCount), err.Error()))
+		time.Sleep(feedbackBackoff(retryCount))
+	}
+}
+
+// startCallback collect results of notification which has callback url, the
+// copies of notification sent inside are collected by the same callback.
+// Return whether the notification starts a new callback.
+func startCallback(msg *PushNotification) bool {
+	if msg.CallbackURL == "" || msg.callback != nil {
+		return false
+	}
+
+	msg.callback = &notificationCallback{}
+
+	return true
+}
+
+// finishCallback queue the results of notification for callback workers.
+func finishCallback(msg PushNotification) {
+	msg.callback.Lock()
+	results := msg.callback.results
+	msg.callback.Unlock()
+
+	result := CallbackResult{
+		ID:       msg.ID,
+		Platform: typeForPlatForm(msg.Platform),
+		Results:  results,
+	}
+	for _, r := range results {
+		switch r.Type {
+		case SucceededPush:
+			result.Success++
+		case FailedPush:
+			result.Failure++
+		}
+	}
+
+	if queueCallback == nil {
+		LogError.Error("callback queue is not initialized")
+		return
+	}
+
+	if !enqueueCallback(queueCallback, callbackJob{url: msg.CallbackURL, result: result}) {
+		LogError.Error("callback queue max capacity reached")
+	}
+}
+
+// enqueueCallback add job to callback buffer by core.feedback_full_policy,
+// return false if the job is dropped.
+func enqueueCallback(queue chan callbackJob, job callbackJob) bool {
+	select {
+	case queue <- job:
+		return true
+	default:
+	}
+
+	if PushConf.Core.FeedbackFullPolicy == FeedbackFullDropOldest {
+		select {
+		case <-queue:
+			feedbackRequestCounter.WithLabelValues("callback", "dropped").Inc()
+		default:
+		}
+
+		select {
+		case queue <- job:
+			return true
+		default:
+		}
+	}
+
+	feedbackRequestCounter.WithLabelValues("callback", "dropped").Inc()
+
+	return false
+}
+
+// checkCallbackURL validate the callback url is http or https, and its host
+// is in core.callback_allowed_hosts if it is set to prevent SSRF.
+func checkCallbackURL(req PushNotification) error {
+	if req.CallbackURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(req.CallbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("the callback_url must be http or https URL")
+	}
+
+	if !callbackHostAllowed(u.Hostname()) {
+		return errors.New("the host of callback_url is not allowed")
+	}
+
+	return nil
+}
+
+// callbackHostAllowed reports whether host is one of allowed hosts, the
+// allowed host beginning with dot matches its subdomains.
+func callbackHostAllowed(host string) bool {
+	if PushConf.Core.CallbackHosts == "" {
+		return true
+	}
+
+	host = strings.ToLower(host)
+	for _, allowed := range strings.Split(PushConf.Core.CallbackHosts, ",") {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == "" {
+			continue
+		}
+		if host == allowed || (strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,156 @@
+package gorush
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCallbackURL(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+	}()
+	req := PushNotification{Platform: PlatFormAndroid}
+
+	for _, u := range []string{"", "http://hooks.example.com/result", "https://hooks.example.com:8443/result"} {
+		req.CallbackURL = u
+		assert.NoError(t, checkCallbackURL(req))
+	}
+
+	for _, u := range []string{"ftp://hooks.example.com/result", "file:///etc/passwd", "https:///result", "hooks.example.com/result"} {
+		req.CallbackURL = u
+		err := checkCallbackURL(req)
+		assert.Error(t, err)
+		assert.Equal(t, "the callback_url must be http or https URL", err.Error())
+	}
+
+	PushConf.Core.CallbackHosts = "hooks.example.com, .internal.example.com"
+	for _, u := range []string{"https://HOOKS.example.com/result", "http://a.internal.example.com/result"} {
+		req.CallbackURL = u
+		assert.NoError(t, checkCallbackURL(req))
+	}
+
+	for _, u := range []string{"http://169.254.169.254/latest/meta-data", "http://internal.example.com/result", "http://hooks.example.com.evil.com/"} {
+		req.CallbackURL = u
+		err := checkCallbackURL(req)
+		assert.Error(t, err)
+		assert.Equal(t, "the host of callback_url is not allowed", err.Error())
+	}
+}
+
+func TestCallbackRedirect(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.CallbackHosts = "127.0.0.1"
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+	}()
+
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("redirect to host not allowed is followed")
+	}))
+	defer internal.Close()
+
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(internal.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer allowed.Close()
+
+	client := &http.Client{CheckRedirect: checkCallbackRedirect}
+	err := dispatchCallback(client, callbackJob{url: allowed.URL}, 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not allowed")
+}
+
+func TestNotificationCallback(t *testing.T) {
+	cleanup := testSNSServer(t, func(arn string, message map[string]string) (int, string) {
+		if arn == snsAndroidEndpoint {
+			return http.StatusBadRequest, snsErrorResponse("EndpointDisabled", "Endpoint is disabled")
+		}
+		return http.StatusOK, snsPublished("message-id")
+	})
+	defer cleanup()
+
+	var attempts int
+	results := make(chan CallbackResult, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the failed callback is resent per core.feedback_max_retry.
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		var result CallbackResult
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&result))
+		results <- result
+	}))
+	defer callback.Close()
+	PushConf.Core.FeedbackMaxRetry = 1
+	InitCallback()
+	defer func() {
+		queueCallback = nil
+	}()
+
+	SendNotification(PushNotification{
+		ID:          "notif-1",
+		Platform:    PlatFormSNS,
+		Tokens:      []string{snsIOSEndpoint, snsAndroidEndpoint},
+		Message:     "Welcome",
+		CallbackURL: callback.URL,
+	})
+
+	select {
+	case result := <-results:
+		assert.Equal(t, "notif-1", result.ID)
+		assert.Equal(t, "sns", result.Platform)
+		assert.Equal(t, 1, result.Success)
+		assert.Equal(t, 1, result.Failure)
+		// the disabled endpoint is reported as invalid token as well.
+		types := map[string]string{}
+		for _, r := range result.Results {
+			types[r.Type] = r.Token
+		}
+		assert.Equal(t, 3, len(result.Results))
+		assert.Equal(t, snsIOSEndpoint, types[SucceededPush])
+		assert.Equal(t, snsAndroidEndpoint, types[FailedPush])
+		assert.Equal(t, snsAndroidEndpoint, types[InvalidTokenPush])
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback is not posted")
+	}
+}
+
+func TestInitCallbackZeroConcurrency(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+	}()
+
+	results := make(chan struct{}, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results <- struct{}{}
+	}))
+	defer callback.Close()
+
+	// callback_concurrency below 1 still runs one worker.
+	PushConf.Core.CallbackNum = 0
+	InitCallback()
+	defer func() {
+		queueCallback = nil
+	}()
+
+	assert.True(t, enqueueCallback(queueCallback, callbackJob{url: callback.URL}))
+
+	select {
+	case <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback is not posted")
+	}
+}
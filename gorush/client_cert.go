@@ -0,0 +1,108 @@
+package gorush
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientSenderKey is the context key of sender authenticated by client certificate.
+const clientSenderKey = "gorush-client-sender"
+
+// clientSender is the API client allowed by core.client_senders.
+type clientSender struct {
+	Name string // common name of client certificate
+	App  string // iOS app profile, empty is the default app
+}
+
+// setClientCA require the client certificate verified by core.client_ca.
+func setClientCA(config *tls.Config) error {
+	if PushConf.Core.ClientCA == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(PushConf.Core.ClientCA)
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return errors.New("no client CA certificate found in " + PushConf.Core.ClientCA)
+	}
+
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return nil
+}
+
+// clientCertName return the common name of verified client certificate.
+func clientCertName(c *gin.Context) string {
+	if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+
+	return c.Request.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+// ClientCertMiddleware allow the client certificate common name listed in
+// core.client_senders only.
+func ClientCertMiddleware() gin.HandlerFunc {
+	// keys of config are lower case.
+	senders := make(map[string]string, len(PushConf.Core.ClientSenders))
+	for name, app := range PushConf.Core.ClientSenders {
+		senders[strings.ToLower(name)] = app
+	}
+
+	return func(c *gin.Context) {
+		name := clientCertName(c)
+		if name == "" {
+			abortWithError(c, http.StatusUnauthorized, "Missing client certificate.")
+			return
+		}
+
+		app, ok := senders[strings.ToLower(name)]
+		if !ok {
+			abortWithError(c, http.StatusForbidden, fmt.Sprintf("Client certificate %s is not allowed.", name))
+			return
+		}
+
+		c.Set(clientSenderKey, &clientSender{Name: name, App: app})
+		c.Next()
+	}
+}
+
+// getClientSender return nil if the request is not restricted to a sender.
+func getClientSender(c *gin.Context) *clientSender {
+	if v, ok := c.Get(clientSenderKey); ok {
+		return v.(*clientSender)
+	}
+
+	return nil
+}
+
+// check bind iOS notification to the app profile of sender, the
+// notification can not use app profile of other senders.
+func (s *clientSender) check(req *PushNotification) error {
+	if s == nil || req.Platform != PlatFormIos {
+		return nil
+	}
+
+	if req.App == "" {
+		req.App = s.App
+		return nil
+	}
+
+	if !strings.EqualFold(req.App, s.App) {
+		return fmt.Errorf("the iOS app profile %s is not allowed for client %s", req.App, s.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package gorush
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// testClientCA write the CA certificate to file, clientCert issue client
+// certificate of the common name signed by the CA.
+func testClientCA(t *testing.T) (caPath string, clientCert func(name string) tls.Certificate, cleanup func()) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gorush test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+
+	file, err := ioutil.TempFile("", "gorush-client-ca")
+	assert.NoError(t, err)
+	_ = pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	file.Close()
+
+	clientCert = func(name string) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		cert := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+		assert.NoError(t, err)
+		leaf, _ := x509.ParseCertificate(der)
+
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	}
+
+	return file.Name(), clientCert, func() {
+		os.Remove(file.Name())
+	}
+}
+
+func TestSetClientCA(t *testing.T) {
+	caPath, _, cleanup := testClientCA(t)
+	defer cleanup()
+
+	PushConf, _ = config.LoadConf("")
+	tlsConfig := &tls.Config{}
+	assert.NoError(t, setClientCA(tlsConfig))
+	assert.Equal(t, tls.NoClientCert, tlsConfig.ClientAuth)
+
+	PushConf.Core.ClientCA = caPath
+	assert.NoError(t, setClientCA(tlsConfig))
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+
+	PushConf.Core.ClientCA = "../config/testdata/config.yml"
+	err := setClientCA(tlsConfig)
+	assert.Error(t, err)
+	assert.Equal(t, "no client CA certificate found in ../config/testdata/config.yml", err.Error())
+
+	PushConf.Core.ClientCA = "not-found.pem"
+	assert.Error(t, setClientCA(tlsConfig))
+}
+
+func TestClientCARequiresTLS(t *testing.T) {
+	initTest()
+	PushConf.Core.ClientCA = "ca.pem"
+
+	err := RunHTTPServer()
+	assert.Error(t, err)
+	assert.Equal(t, "client_ca requires ssl or auto_tls enabled", err.Error())
+}
+
+func TestClientCertServer(t *testing.T) {
+	caPath, clientCert, cleanup := testClientCA(t)
+	defer cleanup()
+
+	initTest()
+	PushConf.Core.ClientCA = caPath
+	PushConf.Core.ClientSenders = map[string]string{"billing": ""}
+
+	server := httptest.NewUnstartedServer(routerEngine())
+	server.TLS = &tls.Config{}
+	assert.NoError(t, setClientCA(server.TLS))
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:      server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+				Certificates: certs,
+			},
+		}}
+		return client.Get(server.URL + "/api/version")
+	}
+
+	// handshake fails without client certificate.
+	_, err := get()
+	assert.Error(t, err)
+
+	res, err := get(clientCert("Billing"))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = get(clientCert("marketing"))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestClientSenderApp(t *testing.T) {
+	_, clientCert, cleanup := testClientCA(t)
+	defer cleanup()
+
+	initTest()
+	PushConf.API.PushURI = "/push"
+	PushConf.Core.ClientCA = "ca.pem"
+	PushConf.Core.ClientSenders = map[string]string{"billing": "billing"}
+	PushConf.Ios.Apps = map[string]config.SectionIosApp{"billing": {}, "marketing": {}}
+
+	push := func(body string) int {
+		req := httptest.NewRequest("POST", "/api/push", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{clientCert("billing").Leaf}}
+		w := httptest.NewRecorder()
+		routerEngine().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, push(`{"notifications":[{"tokens":["aaaaa"],"platform":1,"message":"Welcome","app":"marketing"}]}`))
+	assert.Equal(t, http.StatusOK, push(`{"notifications":[{"tokens":["aaaaa"],"platform":1,"message":"Welcome","app":"Billing"}]}`))
+
+	sender := &clientSender{Name: "billing", App: "billing"}
+	notification := PushNotification{Platform: PlatFormIos}
+	assert.NoError(t, sender.check(&notification))
+	assert.Equal(t, "billing", notification.App)
+
+	notification = PushNotification{Platform: PlatFormAndroid, App: "marketing"}
+	assert.NoError(t, sender.check(&notification))
+
+	// request is not restricted without client senders.
+	sender = nil
+	notification = PushNotification{Platform: PlatFormIos, App: "marketing"}
+	assert.NoError(t, sender.check(&notification))
+}
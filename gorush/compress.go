@@ -0,0 +1,120 @@
+package gorush
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// gzipRequestBody decompress request body and close the original body.
+type gzipRequestBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipRequestBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// gzipResponseWriter compress response body, it starts on first write so the
+// response without body or encoded by handler is sent as it is.
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	writer   *gzip.Writer
+	identity bool
+}
+
+func (w *gzipResponseWriter) start() {
+	if w.writer != nil || w.identity {
+		return
+	}
+
+	if w.Header().Get("Content-Encoding") != "" || w.ResponseWriter.Written() {
+		w.identity = true
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Add("Vary", "Accept-Encoding")
+	// the length of compressed body is unknown until it is written.
+	w.Header().Del("Content-Length")
+
+	w.writer = gzipWriterPool.Get().(*gzip.Writer)
+	w.writer.Reset(w.ResponseWriter)
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	w.start()
+	if w.identity {
+		return w.ResponseWriter.Write(data)
+	}
+
+	return w.writer.Write(data)
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if w.writer != nil {
+		_ = w.writer.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.writer == nil {
+		return
+	}
+
+	_ = w.writer.Close()
+	w.writer.Reset(nil)
+	gzipWriterPool.Put(w.writer)
+	w.writer = nil
+}
+
+// CompressionMiddleware decompress gzip request body and compress response
+// if client accepts gzip encoding.
+func CompressionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") {
+			reader, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				LogAccess.Debug(err)
+				abortWithError(c, http.StatusBadRequest, "Invalid gzip request body.")
+				return
+			}
+
+			c.Request.Body = &gzipRequestBody{Reader: reader, body: c.Request.Body}
+			c.Request.Header.Del("Content-Encoding")
+			c.Request.Header.Del("Content-Length")
+			c.Request.ContentLength = -1
+		}
+
+		if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+			c.Next()
+			return
+		}
+
+		writer := &gzipResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			writer.close()
+			c.Writer = writer.ResponseWriter
+		}()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,103 @@
+package gorush
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/buger/jsonparser"
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipString(t *testing.T, s string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(s))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	return buf.String()
+}
+
+func gunzipBytes(t *testing.T, data []byte) []byte {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+
+	return body
+}
+
+func TestGzipRequestBody(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+	PushConf.Core.HTTPCompression = true
+	PushConf.Android.Enabled = true
+
+	body := `{"notifications":[{"tokens":["aaaaa"],"platform":2,"message":"Welcome"}]}`
+
+	r := gofight.New()
+	r.POST("/api/push").
+		SetHeader(gofight.H{"Content-Encoding": "gzip", "Content-Type": "application/json"}).
+		SetBody(gzipString(t, body)).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			counts, _ := jsonparser.GetInt(r.Body.Bytes(), "counts", "total")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, int64(1), counts)
+		})
+
+	gofight.New().POST("/api/push").
+		SetHeader(gofight.H{"Content-Encoding": "gzip", "Content-Type": "application/json"}).
+		SetBody(body).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+}
+
+func TestGzipResponse(t *testing.T) {
+	initTest()
+	PushConf.Core.HTTPCompression = true
+
+	size := Stats.Data().TotalResponseSize
+
+	r := gofight.New()
+	r.GET("/api/version").
+		SetHeader(gofight.H{"Accept-Encoding": "gzip"}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := r.Body.Bytes()
+			version, _ := jsonparser.GetString(gunzipBytes(t, data), "version")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, "gzip", r.HeaderMap.Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", r.HeaderMap.Get("Vary"))
+			assert.Equal(t, GetVersion(), version)
+			// stats count the compressed bytes.
+			assert.Equal(t, size+int64(len(data)), Stats.Data().TotalResponseSize)
+		})
+
+	// response without body is not encoded.
+	r.GET(PushConf.API.HealthURI).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, "", r.HeaderMap.Get("Content-Encoding"))
+			assert.Equal(t, 0, r.Body.Len())
+		})
+}
+
+func TestGzipDisabled(t *testing.T) {
+	initTest()
+
+	r := gofight.New()
+	r.GET("/api/version").
+		SetHeader(gofight.H{"Accept-Encoding": "gzip"}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			_, err := jsonparser.GetString(r.Body.Bytes(), "version")
+
+			assert.NoError(t, err)
+			assert.Equal(t, "", r.HeaderMap.Get("Content-Encoding"))
+		})
+}
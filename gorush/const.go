@@ -5,6 +5,14 @@ const (
 	PlatFormIos = iota + 1
 	// PlatFormAndroid constant is 2 for Android
 	PlatFormAndroid
+	// PlatFormWeb constant is 3 for Web Push
+	PlatFormWeb
+	// PlatFormAll constant is 4 for both iOS (ios_tokens) and Android (tokens)
+	PlatFormAll
+	// PlatFormHuawei constant is 5 for Huawei Push Kit
+	PlatFormHuawei
+	// PlatFormSNS constant is 6 for Amazon SNS platform endpoints
+	PlatFormSNS
 )
 
 const (
@@ -12,6 +20,35 @@ const (
 	SucceededPush = "succeeded-push"
 	// FailedPush is log block
 	FailedPush = "failed-push"
+	// DroppedPush is log block
+	DroppedPush = "dropped-push"
+	// DryRunPush is log block
+	DryRunPush = "dry-run-push"
+	// InvalidTokenPush is log block
+	InvalidTokenPush = "invalid-token"
+	// ExpiredSubscriptionPush is log block
+	ExpiredSubscriptionPush = "expired-subscription"
+	// DuplicatePush is log block
+	DuplicatePush = "duplicate-push"
+	// OverflowPush is log block
+	OverflowPush = "overflow-push"
+	// ScheduledPush is log block
+	ScheduledPush = "scheduled-push"
+	// ExpiredInQueuePush is log block
+	ExpiredInQueuePush = "expired-in-queue"
+)
+
+const (
+	// RequestIDHeader is header name of request id
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey is context key of request id
+	RequestIDKey = "request_id"
+	// IdempotencyKeyHeader is header name of idempotency key
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotencyKeyKey is context key of idempotency key
+	IdempotencyKeyKey = "idempotency_key"
+	// IdempotentReplayedHeader is header name of replayed response
+	IdempotentReplayedHeader = "Idempotent-Replayed"
 )
 
 // Stat variable for redis
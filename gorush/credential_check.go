@@ -0,0 +1,89 @@
+package gorush
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/sideshow/apns2"
+)
+
+// apnsProbeToken is the device token of credential check, APNs authenticates
+// the provider before the token is rejected as BadDeviceToken.
+var apnsProbeToken = strings.Repeat("0", 64)
+
+// probeAPNsAuth push to invalid device token to check certificate or token
+// credential of app, only 403 response of APNs means invalid credential.
+func probeAPNsAuth(pool *ApnsClientPool, app config.SectionIosApp) error {
+	if pool == nil {
+		return errAPNsNotInitialized
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readyProbeTimeout)
+	defer cancel()
+
+	res, err := pool.Client().PushWithContext(ctx, &apns2.Notification{
+		DeviceToken: apnsProbeToken,
+		Topic:       app.Topic,
+		Payload:     []byte(`{"aps":{}}`),
+	})
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("APNs rejected credential: %s", res.Reason)
+	}
+
+	return nil
+}
+
+// checkCredentials return the error of providers which credentials are
+// rejected, nil if all of them are valid.
+func checkCredentials() error {
+	status := runProbes(providerProbes(probeAPNsAuth))
+
+	var failed []string
+	for name, provider := range status {
+		if !provider.Healthy {
+			failed = append(failed, name+": "+provider.Error)
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+
+	return fmt.Errorf("provider credential check failed, %s", strings.Join(failed, "; "))
+}
+
+// ValidateOnStart initialize APNs and FCM clients and check credentials of
+// them by APNs push to invalid token and FCM dry run message, so invalid
+// credential is found on deploy instead of the first push. The error is
+// returned if core.validate_on_start.fail is set, or it is logged.
+func ValidateOnStart() error {
+	if err := InitAPNSClient(); err != nil {
+		return err
+	}
+
+	if err := InitFCM(); err != nil {
+		return err
+	}
+
+	err := checkCredentials()
+	if err == nil {
+		LogAccess.Info("provider credentials are valid")
+		return nil
+	}
+
+	if PushConf.Core.ValidateOnStart.Fail {
+		return err
+	}
+	LogError.Warn("WARNING: " + err.Error())
+
+	return nil
+}
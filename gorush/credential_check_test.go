@@ -0,0 +1,84 @@
+package gorush
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gorush/config"
+	"github.com/sideshow/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCredentials(t *testing.T) {
+	apnsCode, apnsReason := http.StatusBadRequest, apns2.ReasonBadDeviceToken
+	apnsServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/3/device/"+apnsProbeToken, r.URL.Path)
+		assert.Equal(t, "com.example.app", r.Header.Get("apns-topic"))
+		w.WriteHeader(apnsCode)
+		_, _ = w.Write([]byte(`{"reason":"` + apnsReason + `"}`))
+	}))
+	apnsServer.EnableHTTP2 = true
+	apnsServer.StartTLS()
+	defer apnsServer.Close()
+
+	dial := dialTLS
+	dialTLS = func(dialer *net.Dialer, network, addr string, cfg *tls.Config) (*tls.Conn, error) {
+		cfg.InsecureSkipVerify = true
+		return tls.DialWithDialer(dialer, network, apnsServer.Listener.Addr().String(), cfg)
+	}
+	defer func() {
+		dialTLS = dial
+	}()
+
+	fcmCode := http.StatusOK
+	fcmServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(fcmCode)
+		_, _ = w.Write([]byte(`{"message_id":1}`))
+	}))
+	defer fcmServer.Close()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Ios.Enabled = true
+	PushConf.Ios.Topic = "com.example.app"
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	FCMClient, _ = fcm.NewClient(PushConf.Android.APIKey,
+		fcm.WithEndpoint(fcmServer.URL),
+		fcm.WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+	)
+	ApnsPool = newApnsPool(apns2.NewClient(tls.Certificate{}), 1, 0)
+	defer func() {
+		ApnsPool.Close()
+		ApnsPool = nil
+		FCMClient = nil
+		PushConf, _ = config.LoadConf("")
+	}()
+
+	// invalid device token is rejected after credential is accepted.
+	assert.NoError(t, checkCredentials())
+
+	apnsCode, apnsReason = http.StatusForbidden, apns2.ReasonInvalidProviderToken
+	fcmCode = http.StatusUnauthorized
+	err := checkCredentials()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "provider credential check failed, android: ")
+	assert.Contains(t, err.Error(), "ios: APNs rejected credential: InvalidProviderToken")
+
+	// clients are initialized by config before the check.
+	PushConf.Android.Enabled = false
+	PushConf.Ios.KeyPath = "not-found.pem"
+	assert.Error(t, ValidateOnStart())
+	PushConf.Ios.KeyPath = "../certificate/certificate-valid.pem"
+	assert.EqualError(t, ValidateOnStart(), "provider credential check failed, ios: APNs rejected credential: InvalidProviderToken")
+	PushConf.Core.ValidateOnStart.Fail = false
+	assert.NoError(t, ValidateOnStart())
+
+	apnsCode, apnsReason = http.StatusBadRequest, apns2.ReasonBadDeviceToken
+	PushConf.Core.ValidateOnStart.Fail = true
+	assert.NoError(t, ValidateOnStart())
+}
@@ -0,0 +1,446 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gopkg.in/redis.v5"
+)
+
+// DeadLetterKey is key name of dead-letter notifications saved in storage.
+const DeadLetterKey = "gorush-dead-letter"
+
+// deadLetterFlushDelay batches the dead-letter notifications failed together
+// into one write of file or storage.
+const deadLetterFlushDelay = time.Second
+
+// DeadLetter is the notification failed after all retries, it is kept with
+// the error of last attempt for audit and replay.
+type DeadLetter struct {
+	ID           string           `json:"id"`
+	Notification PushNotification `json:"notification"`
+	Error        string           `json:"error"`
+	Attempts     int              `json:"attempts"`
+	Timestamp    int64            `json:"timestamp"`
+	raw          string
+}
+
+// DeadLetterFilter select the dead-letter notifications to replay, empty
+// field matches all.
+type DeadLetterFilter struct {
+	IDs      []string `json:"ids,omitempty"`
+	Platform int      `json:"platform,omitempty"`
+	App      string   `json:"app,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Since    int64    `json:"since,omitempty"`
+	Until    int64    `json:"until,omitempty"`
+	Limit    int      `json:"limit,omitempty"`
+}
+
+// match reports whether the dead-letter notification is selected by filter.
+func (f DeadLetterFilter) match(letter DeadLetter) bool {
+	if len(f.IDs) > 0 {
+		found := false
+		for _, id := range f.IDs {
+			if id == letter.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch {
+	case f.Platform != 0 && f.Platform != letter.Notification.Platform:
+		return false
+	case f.App != "" && !strings.EqualFold(f.App, letter.Notification.App):
+		return false
+	case f.Error != "" && !strings.Contains(letter.Error, f.Error):
+		return false
+	case f.Since > 0 && letter.Timestamp < f.Since:
+		return false
+	case f.Until > 0 && letter.Timestamp > f.Until:
+		return false
+	}
+
+	return true
+}
+
+// deadLetterStore keeps the dead-letter notifications of one engine, the
+// oldest one is evicted over max size and expired one is dropped.
+type deadLetterStore interface {
+	add(letter DeadLetter) error
+	// list return the notifications which are not expired, oldest first.
+	list() ([]DeadLetter, error)
+	remove(letters []DeadLetter) error
+}
+
+// deadLetters is nil if dead letter is disabled.
+var deadLetters deadLetterStore
+
+// InitDeadLetter create the dead-letter store of core.dead_letter.engine.
+func InitDeadLetter() error {
+	conf := PushConf.Core.DeadLetter
+	ttl := time.Duration(conf.TTL) * time.Second
+
+	switch conf.Engine {
+	case "":
+		deadLetters = nil
+	case "file":
+		path := conf.Path
+		deadLetters = newBlobDeadLetterStore(conf.MaxSize, ttl, func() ([]byte, error) {
+			data, err := ioutil.ReadFile(path)
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return data, err
+		}, func(data []byte) error {
+			// replace the file at once, so it is never half written.
+			if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+				return err
+			}
+			return os.Rename(path+".tmp", path)
+		})
+	case "storage":
+		deadLetters = newBlobDeadLetterStore(conf.MaxSize, ttl, func() ([]byte, error) {
+			return StatStorage.GetData(DeadLetterKey), nil
+		}, func(data []byte) error {
+			StatStorage.SetData(DeadLetterKey, data)
+			return nil
+		})
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     conf.Redis.Addr,
+			Password: conf.Redis.Password,
+			DB:       conf.Redis.DB,
+		})
+		if _, err := client.Ping().Result(); err != nil {
+			client.Close()
+			LogError.Error("dead letter error: " + err.Error())
+			return err
+		}
+		deadLetters = &redisDeadLetterStore{
+			client: client,
+			key:    conf.Redis.Key,
+			max:    conf.MaxSize,
+			ttl:    ttl,
+		}
+	default:
+		LogError.Error("dead letter error: can't find dead letter engine")
+		return errors.New("can't find dead letter engine")
+	}
+
+	if store, ok := deadLetters.(*blobDeadLetterStore); ok {
+		if err := store.load(); err != nil {
+			LogError.Error("load dead letter error: " + err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addDeadLetter keep the notification to the tokens which failed after all
+// retries, the whole notification is kept for topic and web push.
+func addDeadLetter(req PushNotification, tokens []string, errPush error, attempts int) {
+	// the credentials of request are not kept, so it can't be replayed.
+	if deadLetters == nil || errPush == nil || req.credential != "" {
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		LogError.Error("generate dead letter id error: " + err.Error())
+		return
+	}
+
+	if len(req.Tokens) > 0 {
+		req.Tokens = tokens
+	}
+
+	if err := deadLetters.add(DeadLetter{
+		ID:           id,
+		Notification: req,
+		Error:        errPush.Error(),
+		Attempts:     attempts,
+		Timestamp:    time.Now().Unix(),
+	}); err != nil {
+		req.errorLog().Error("save dead letter error: " + err.Error())
+	}
+}
+
+// deadLetterExpired reports whether the dead-letter notification is older than ttl.
+func deadLetterExpired(letter DeadLetter, ttl time.Duration, now time.Time) bool {
+	return ttl > 0 && letter.Timestamp < now.Add(-ttl).Unix()
+}
+
+// blobDeadLetterStore keeps the notifications in memory and saves all of them
+// as one JSON array to file or storage.
+type blobDeadLetterStore struct {
+	sync.Mutex
+	max      int
+	ttl      time.Duration
+	letters  []DeadLetter // oldest first
+	read     func() ([]byte, error)
+	write    func([]byte) error
+	flushing bool
+}
+
+func newBlobDeadLetterStore(max int, ttl time.Duration, read func() ([]byte, error), write func([]byte) error) *blobDeadLetterStore {
+	return &blobDeadLetterStore{
+		max:   max,
+		ttl:   ttl,
+		read:  read,
+		write: write,
+	}
+}
+
+// load read the notifications saved before restart.
+func (s *blobDeadLetterStore) load() error {
+	data, err := s.read()
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	return json.Unmarshal(data, &s.letters)
+}
+
+// prune drop the expired notifications and the oldest ones over max size.
+func (s *blobDeadLetterStore) prune() {
+	now := time.Now()
+	left := s.letters[:0]
+	for _, letter := range s.letters {
+		if !deadLetterExpired(letter, s.ttl, now) {
+			left = append(left, letter)
+		}
+	}
+	s.letters = left
+
+	if s.max > 0 && len(s.letters) > s.max {
+		s.letters = s.letters[len(s.letters)-s.max:]
+	}
+}
+
+func (s *blobDeadLetterStore) add(letter DeadLetter) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.letters = append(s.letters, letter)
+	s.prune()
+	s.schedule()
+
+	return nil
+}
+
+func (s *blobDeadLetterStore) list() ([]DeadLetter, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.prune()
+
+	return append([]DeadLetter{}, s.letters...), nil
+}
+
+func (s *blobDeadLetterStore) remove(letters []DeadLetter) error {
+	ids := make(map[string]bool, len(letters))
+	for _, letter := range letters {
+		ids[letter.ID] = true
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	left := s.letters[:0:0]
+	for _, letter := range s.letters {
+		if !ids[letter.ID] {
+			left = append(left, letter)
+		}
+	}
+	s.letters = left
+	s.schedule()
+
+	return nil
+}
+
+// schedule save the notifications after flush delay, the lock must be held.
+func (s *blobDeadLetterStore) schedule() {
+	if !s.flushing {
+		s.flushing = true
+		time.AfterFunc(deadLetterFlushDelay, s.flush)
+	}
+}
+
+// flush save all notifications.
+func (s *blobDeadLetterStore) flush() {
+	s.Lock()
+	s.flushing = false
+	data, err := json.Marshal(s.letters)
+	s.Unlock()
+
+	if err == nil {
+		err = s.write(data)
+	}
+
+	if err != nil {
+		LogError.Error("save dead letter error: " + err.Error())
+	}
+}
+
+// flushDeadLetters save the dead-letter notifications at once on shutdown.
+func flushDeadLetters() {
+	if store, ok := deadLetters.(*blobDeadLetterStore); ok {
+		store.flush()
+	}
+}
+
+// redisDeadLetterStore keeps the notifications in redis list shared by all
+// gorush instances, the newest one is at the head.
+type redisDeadLetterStore struct {
+	client *redis.Client
+	key    string
+	max    int
+	ttl    time.Duration
+}
+
+func (s *redisDeadLetterStore) add(letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.TxPipelined(func(pipe *redis.Pipeline) error {
+		pipe.LPush(s.key, data)
+		if s.max > 0 {
+			pipe.LTrim(s.key, 0, int64(s.max-1))
+		}
+		return nil
+	})
+
+	return err
+}
+
+func (s *redisDeadLetterStore) list() ([]DeadLetter, error) {
+	items, err := s.client.LRange(s.key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	letters := []DeadLetter{}
+	var expired []DeadLetter
+	for i := len(items) - 1; i >= 0; i-- {
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(items[i]), &letter); err != nil {
+			LogError.Error("redis dead letter drop malformed notification: " + err.Error())
+			s.client.LRem(s.key, 1, items[i])
+			continue
+		}
+		letter.raw = items[i]
+
+		if deadLetterExpired(letter, s.ttl, now) {
+			expired = append(expired, letter)
+			continue
+		}
+		letters = append(letters, letter)
+	}
+
+	if len(expired) > 0 {
+		if err := s.remove(expired); err != nil {
+			LogError.Error("redis dead letter expire error: " + err.Error())
+		}
+	}
+
+	return letters, nil
+}
+
+func (s *redisDeadLetterStore) remove(letters []DeadLetter) error {
+	_, err := s.client.TxPipelined(func(pipe *redis.Pipeline) error {
+		for _, letter := range letters {
+			pipe.LRem(s.key, 1, letter.raw)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// replayDeadLetters enqueue the matched notifications again and remove them
+// from store, the notification dropped by full queue is kept.
+func replayDeadLetters(filter DeadLetterFilter) (int, error) {
+	if deadLetters == nil {
+		return 0, nil
+	}
+
+	letters, err := deadLetters.list()
+	if err != nil {
+		return 0, err
+	}
+
+	var replayed []DeadLetter
+	for _, letter := range letters {
+		if filter.Limit > 0 && len(replayed) >= filter.Limit {
+			break
+		}
+		if !filter.match(letter) || !platformEnabled(letter.Notification.Platform) {
+			continue
+		}
+
+		notification := letter.Notification
+		if SharedQueue != nil {
+			if err := SharedQueue.Push(notification); err != nil {
+				LogError.Error("queue error: " + err.Error())
+				break
+			}
+		} else if !tryEnqueue(notification, queueForPlatform(notification.Platform)) {
+			// queue is full, the rest is kept for next replay.
+			LogError.Error("max capacity reached")
+			break
+		}
+
+		StatStorage.AddTotalCount(int64(len(notification.recipients())))
+		replayed = append(replayed, letter)
+	}
+
+	if len(replayed) == 0 {
+		return 0, nil
+	}
+
+	return len(replayed), deadLetters.remove(replayed)
+}
+
+func replayDeadLetterHandler(c *gin.Context) {
+	var filter DeadLetterFilter
+	// empty body replays all notifications.
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindWith(&filter, binding.JSON); err != nil && err != io.EOF {
+			abortWithError(c, http.StatusBadRequest, "Invalid filter of dead letter.")
+			return
+		}
+	}
+
+	replayed, err := replayDeadLetters(filter)
+	if err != nil {
+		LogError.Error("replay dead letter error: " + err.Error())
+		abortWithError(c, http.StatusInternalServerError, "Failed to replay dead letter.")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  "ok",
+		"replayed": replayed,
+	})
+}
@@ -0,0 +1,214 @@
+package gorush
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gofight/v2"
+	"github.com/appleboy/gorush/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterFilter(t *testing.T) {
+	letter := DeadLetter{
+		ID:           "1",
+		Notification: PushNotification{Platform: PlatFormIos, App: "demo"},
+		Error:        "provider_unavailable",
+		Timestamp:    100,
+	}
+
+	assert.True(t, DeadLetterFilter{}.match(letter))
+	assert.True(t, DeadLetterFilter{IDs: []string{"2", "1"}}.match(letter))
+	assert.False(t, DeadLetterFilter{IDs: []string{"2"}}.match(letter))
+	assert.True(t, DeadLetterFilter{Platform: PlatFormIos, App: "Demo"}.match(letter))
+	assert.False(t, DeadLetterFilter{Platform: PlatFormAndroid}.match(letter))
+	assert.False(t, DeadLetterFilter{App: "other"}.match(letter))
+	assert.True(t, DeadLetterFilter{Error: "unavailable"}.match(letter))
+	assert.False(t, DeadLetterFilter{Error: "Unregistered"}.match(letter))
+	assert.True(t, DeadLetterFilter{Since: 100, Until: 100}.match(letter))
+	assert.False(t, DeadLetterFilter{Since: 101}.match(letter))
+	assert.False(t, DeadLetterFilter{Until: 99}.match(letter))
+}
+
+func testDeadLetterStore(t *testing.T) {
+	now := time.Now().Unix()
+	assert.NoError(t, deadLetters.add(DeadLetter{ID: "1", Timestamp: now - 120}))
+	assert.NoError(t, deadLetters.add(DeadLetter{ID: "2", Timestamp: now}))
+	assert.NoError(t, deadLetters.add(DeadLetter{ID: "3", Timestamp: now}))
+	assert.NoError(t, deadLetters.add(DeadLetter{ID: "4", Timestamp: now}))
+
+	// the oldest one is evicted over max size.
+	letters, err := deadLetters.list()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(letters))
+	assert.Equal(t, "2", letters[0].ID)
+	assert.Equal(t, "4", letters[2].ID)
+
+	assert.NoError(t, deadLetters.remove(letters[1:2]))
+	letters, _ = deadLetters.list()
+	assert.Equal(t, 2, len(letters))
+	assert.Equal(t, "2", letters[0].ID)
+	assert.Equal(t, "4", letters[1].ID)
+
+	// expired one is dropped.
+	assert.NoError(t, deadLetters.add(DeadLetter{ID: "5", Timestamp: now - 120}))
+	letters, _ = deadLetters.list()
+	assert.Equal(t, 2, len(letters))
+	assert.Equal(t, "4", letters[1].ID)
+}
+
+func TestFileDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorush")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.DeadLetter.Engine = "file"
+	PushConf.Core.DeadLetter.Path = filepath.Join(dir, "dead-letter.json")
+	PushConf.Core.DeadLetter.MaxSize = 3
+	PushConf.Core.DeadLetter.TTL = 60
+	assert.NoError(t, InitDeadLetter())
+	defer func() {
+		deadLetters = nil
+	}()
+
+	testDeadLetterStore(t)
+	flushDeadLetters()
+
+	// reload from file.
+	assert.NoError(t, InitDeadLetter())
+	letters, err := deadLetters.list()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(letters))
+	assert.Equal(t, "2", letters[0].ID)
+
+	// malformed file.
+	assert.NoError(t, ioutil.WriteFile(PushConf.Core.DeadLetter.Path, []byte("{"), 0600))
+	assert.Error(t, InitDeadLetter())
+}
+
+func TestRedisDeadLetter(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.DeadLetter.Engine = "redis"
+	PushConf.Core.DeadLetter.Redis.Addr = "redis:6379"
+	PushConf.Core.DeadLetter.MaxSize = 3
+	PushConf.Core.DeadLetter.TTL = 60
+	// the other tests of package go on if redis isn't reachable.
+	require.NoError(t, InitDeadLetter())
+	store, ok := deadLetters.(*redisDeadLetterStore)
+	require.True(t, ok)
+	store.client.Del(store.key)
+	defer func() {
+		store.client.Del(store.key)
+		store.client.Close()
+		deadLetters = nil
+	}()
+
+	testDeadLetterStore(t)
+
+	PushConf.Core.DeadLetter.Redis.Addr = "redis:6370"
+	assert.Error(t, InitDeadLetter())
+}
+
+func TestInitDeadLetter(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	assert.NoError(t, InitDeadLetter())
+	assert.Nil(t, deadLetters)
+	addDeadLetter(PushNotification{}, nil, errors.New("error"), 1)
+
+	PushConf.Core.DeadLetter.Engine = "unknown"
+	assert.Error(t, InitDeadLetter())
+}
+
+func TestPushToAndroidDeadLetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"success":1,"failure":2,"results":[{"error":"MessageTooBig"},{"message_id":"1"},{"error":"NotRegistered"}]}`))
+	}))
+	defer server.Close()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	FCMClient, _ = fcm.NewClient(PushConf.Android.APIKey,
+		fcm.WithEndpoint(server.URL),
+		fcm.WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+	)
+	deadLetters = newBlobDeadLetterStore(10, 0, nil, func([]byte) error { return nil })
+	defer func() {
+		FCMClient = nil
+		deadLetters = nil
+	}()
+
+	req := PushNotification{
+		Tokens:   []string{"aaaaa", "bbbbb", "ccccc"},
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+	}
+	assert.True(t, PushToAndroid(req))
+
+	// only the token failed permanently is kept, not the invalid one.
+	letters, _ := deadLetters.list()
+	assert.Equal(t, 1, len(letters))
+	assert.Equal(t, []string{"aaaaa"}, letters[0].Notification.Tokens)
+	assert.Equal(t, "Welcome", letters[0].Notification.Message)
+	assert.Equal(t, fcm.ErrMessageTooBig.Error(), letters[0].Error)
+	assert.Equal(t, 1, letters[0].Attempts)
+}
+
+func TestReplayDeadLetterHandler(t *testing.T) {
+	initTest()
+	PushConf.Android.Enabled = true
+	PushConf.API.PushURI = "/push"
+	deadLetters = newBlobDeadLetterStore(10, 0, nil, func([]byte) error { return nil })
+	queue := QueueNotification
+	QueueNotification = make(chan PushNotification, 1)
+	defer func() {
+		QueueNotification = queue
+		deadLetters = nil
+	}()
+
+	now := time.Now().Unix()
+	_ = deadLetters.add(DeadLetter{ID: "1", Notification: PushNotification{Platform: PlatFormAndroid, Tokens: []string{"aaaaa"}}, Timestamp: now})
+	_ = deadLetters.add(DeadLetter{ID: "2", Notification: PushNotification{Platform: PlatFormIos, Tokens: []string{"bbbbb"}}, Timestamp: now})
+	_ = deadLetters.add(DeadLetter{ID: "3", Notification: PushNotification{Platform: PlatFormAndroid, Tokens: []string{"ccccc"}}, Timestamp: now})
+	_ = deadLetters.add(DeadLetter{ID: "4", Notification: PushNotification{Platform: PlatFormAndroid, Tokens: []string{"ddddd"}}, Timestamp: now})
+
+	r := gofight.New()
+	r.POST("/api/dead-letter/replay").
+		SetBody("{").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+
+	// the disabled platform is skipped, the rest is kept on full queue.
+	r = gofight.New()
+	r.POST("/api/dead-letter/replay").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.JSONEq(t, `{"success":"ok","replayed":1}`, r.Body.String())
+		})
+	assert.Equal(t, []string{"aaaaa"}, (<-QueueNotification).Tokens)
+
+	r.POST("/api/dead-letter/replay").
+		SetJSON(gofight.D{
+			"ids": []string{"4"},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.JSONEq(t, `{"success":"ok","replayed":1}`, r.Body.String())
+		})
+	assert.Equal(t, []string{"ddddd"}, (<-QueueNotification).Tokens)
+
+	letters, _ := deadLetters.list()
+	assert.Equal(t, 2, len(letters))
+	assert.Equal(t, "2", letters[0].ID)
+	assert.Equal(t, "3", letters[1].ID)
+}
@@ -0,0 +1,89 @@
+package gorush
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// tokenDedup find the duplicate tokens of one request. Tokens are only
+// duplicate in notifications sharing the same payload, so the token is
+// still sent to every different message.
+type tokenDedup struct {
+	payloads map[string]int
+	seen     map[string]struct{}
+}
+
+func newTokenDedup() *tokenDedup {
+	return &tokenDedup{
+		payloads: make(map[string]int),
+		seen:     make(map[string]struct{}),
+	}
+}
+
+// payloadID return the same id for notifications with the same payload.
+func (d *tokenDedup) payloadID(notification PushNotification) string {
+	notification.Tokens = nil
+	data, err := json.Marshal(notification)
+	if err != nil {
+		// never collapse the payload can't be compared.
+		return "error:" + strconv.Itoa(len(d.payloads))
+	}
+
+	id, ok := d.payloads[string(data)]
+	if !ok {
+		id = len(d.payloads)
+		d.payloads[string(data)] = id
+	}
+
+	return strconv.Itoa(id)
+}
+
+// apply remove the duplicate tokens of notification, the removed tokens are
+// added to log. Return false if no recipient is left.
+func (d *tokenDedup) apply(notification *PushNotification, log *[]LogPushEntry) bool {
+	if len(notification.Tokens) == 0 {
+		return true
+	}
+
+	prefix := strconv.Itoa(notification.Platform) + ":" + d.payloadID(*notification) + ":"
+	tokens := make([]string, 0, len(notification.Tokens))
+	for _, token := range notification.Tokens {
+		key := prefix + token
+		if _, ok := d.seen[key]; ok {
+			appendLog(log, getLogPushEntry(DuplicatePush, token, *notification, nil))
+			continue
+		}
+		d.seen[key] = struct{}{}
+		tokens = append(tokens, token)
+	}
+	notification.Tokens = tokens
+
+	return len(notification.recipients()) > 0
+}
+
+// dedupNotifications remove the duplicate tokens of request, notification
+// without recipient left is removed.
+func dedupNotifications(notifications []*PushNotification) ([]*PushNotification, []LogPushEntry) {
+	d := newTokenDedup()
+	log := []LogPushEntry{}
+	result := make([]*PushNotification, 0, len(notifications))
+	for _, notification := range notifications {
+		if d.apply(notification, &log) {
+			result = append(result, notification)
+		}
+	}
+
+	return result, log
+}
+
+// countDuplicates return the number of duplicate tokens in push logs.
+func countDuplicates(logs []LogPushEntry) int {
+	var duplicates int
+	for _, log := range logs {
+		if log.Type == DuplicatePush {
+			duplicates++
+		}
+	}
+
+	return duplicates
+}
@@ -0,0 +1,86 @@
+package gorush
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+// expiryIndex index the items saved in storage by the minute they expire, so
+// they are removed after expiry even if the server is restarted.
+type expiryIndex struct {
+	sync.Mutex
+	// prefix is key prefix of the items expiring in the minute, the unix
+	// minute is appended.
+	prefix string
+	// sweptKey is key name of the last unix minute whose items are removed.
+	sweptKey string
+	remove   func(item string)
+	// swept is the last minute whose items are removed, loaded from storage
+	// at first sweep.
+	swept  int64
+	loaded bool
+}
+
+func (x *expiryIndex) minuteKey(minute int64) string {
+	return x.prefix + strconv.FormatInt(minute, 10)
+}
+
+// add the item to the index of minute it expires in.
+func (x *expiryIndex) add(item string, expiresAt int64) {
+	x.Lock()
+	defer x.Unlock()
+
+	indexKey := x.minuteKey(expiresAt / 60)
+	var items []string
+	if data := StatStorage.GetData(indexKey); len(data) > 0 {
+		if err := json.Unmarshal(data, &items); err != nil {
+			LogError.Error("load expiry index error: " + err.Error())
+		}
+	}
+
+	data, err := json.Marshal(append(items, item))
+	if err != nil {
+		LogError.Error("save expiry index error: " + err.Error())
+		return
+	}
+	StatStorage.SetData(indexKey, data)
+}
+
+// sweep remove the items of the minutes passed since last sweep, the items
+// are removed up to one minute late.
+func (x *expiryIndex) sweep(now int64) {
+	x.Lock()
+	defer x.Unlock()
+
+	last := now/60 - 1
+	if !x.loaded {
+		x.swept = StatStorage.Get(x.sweptKey)
+		if x.swept == 0 {
+			x.swept = last
+		}
+		x.loaded = true
+	}
+	if x.swept >= last {
+		return
+	}
+
+	for minute := x.swept + 1; minute <= last; minute++ {
+		indexKey := x.minuteKey(minute)
+		data := StatStorage.GetData(indexKey)
+		if len(data) == 0 {
+			continue
+		}
+
+		var items []string
+		if err := json.Unmarshal(data, &items); err != nil {
+			LogError.Error("load expiry index error: " + err.Error())
+		}
+		for _, item := range items {
+			x.remove(item)
+		}
+		StatStorage.Del(indexKey)
+	}
+	x.swept = last
+	StatStorage.Set(x.sweptKey, last)
+}
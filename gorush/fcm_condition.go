@@ -0,0 +1,152 @@
+package gorush
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FCMConditionMaxTopics is max topics number of FCM condition expression.
+const FCMConditionMaxTopics = 5
+
+// fcmTopicPattern is the valid topic name of FCM.
+var fcmTopicPattern = regexp.MustCompile(`^[a-zA-Z0-9-_.~%]+$`)
+
+// checkFCMTopic validate the topic name without /topics/ prefix.
+func checkFCMTopic(topic string) error {
+	if !fcmTopicPattern.MatchString(topic) {
+		return fmt.Errorf("the topic %q must match [a-zA-Z0-9-_.~%%]+", topic)
+	}
+
+	return nil
+}
+
+// conditionParser parse FCM condition expression like
+// "'TopicA' in topics && ('TopicB' in topics || !('TopicC' in topics))".
+//
+//	expr   = term { "||" term }
+//	term   = factor { "&&" factor }
+//	factor = "!" factor | "(" expr ")" | topic "in" "topics"
+type conditionParser struct {
+	input  string
+	pos    int
+	topics int
+}
+
+// checkFCMCondition validate the syntax of FCM condition expression.
+func checkFCMCondition(condition string) error {
+	p := &conditionParser{input: condition}
+
+	if err := p.expr(); err != nil {
+		return fmt.Errorf("invalid condition: %s", err)
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return fmt.Errorf("invalid condition: unexpected %q at %d", p.input[p.pos:], p.pos)
+	}
+
+	if p.topics > FCMConditionMaxTopics {
+		return fmt.Errorf("invalid condition: at most %d topics are allowed", FCMConditionMaxTopics)
+	}
+
+	return nil
+}
+
+func (p *conditionParser) skipSpace() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// consume skip the token if it is next, return false otherwise.
+func (p *conditionParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+
+	return false
+}
+
+func (p *conditionParser) expr() error {
+	if err := p.term(); err != nil {
+		return err
+	}
+
+	for p.consume("||") {
+		if err := p.term(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *conditionParser) term() error {
+	if err := p.factor(); err != nil {
+		return err
+	}
+
+	for p.consume("&&") {
+		if err := p.factor(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *conditionParser) factor() error {
+	if p.consume("!") {
+		return p.factor()
+	}
+
+	if p.consume("(") {
+		if err := p.expr(); err != nil {
+			return err
+		}
+
+		if !p.consume(")") {
+			return fmt.Errorf("missing ) at %d", p.pos)
+		}
+
+		return nil
+	}
+
+	return p.topic()
+}
+
+// topic parse "'name' in topics".
+func (p *conditionParser) topic() error {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return errors.New("unexpected end of expression")
+	}
+
+	quote := p.input[p.pos]
+	if quote != '\'' && quote != '"' {
+		return fmt.Errorf("expected quoted topic at %d", p.pos)
+	}
+
+	end := strings.IndexByte(p.input[p.pos+1:], quote)
+	if end < 0 {
+		return fmt.Errorf("unterminated topic at %d", p.pos)
+	}
+
+	name := p.input[p.pos+1 : p.pos+1+end]
+	if err := checkFCMTopic(name); err != nil {
+		return err
+	}
+	p.pos += end + 2
+
+	if !p.consume("in ") || !p.consume("topics") {
+		return fmt.Errorf("expected 'in topics' at %d", p.pos)
+	}
+
+	p.topics++
+
+	return nil
+}
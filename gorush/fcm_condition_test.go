@@ -0,0 +1,48 @@
+package gorush
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFCMCondition(t *testing.T) {
+	valid := []string{
+		"'dogs' in topics",
+		"'dogs' in topics || 'cats' in topics",
+		"'TopicA' in topics && ('TopicB' in topics || 'TopicC' in topics)",
+		"!('TopicA' in topics) && \"TopicB\" in topics",
+		"'a' in topics && 'b' in topics && 'c' in topics && 'd' in topics && 'e' in topics",
+	}
+
+	for _, condition := range valid {
+		assert.NoError(t, checkFCMCondition(condition), condition)
+	}
+
+	invalid := map[string]string{
+		"":                                      "invalid condition: unexpected end of expression",
+		"('dogs' in topics":                     "invalid condition: missing ) at 17",
+		"'dogs' in topics)":                     "invalid condition: unexpected \")\" at 16",
+		"'dogs' in topics | 'cats' in topics":   "invalid condition: unexpected \"| 'cats' in topics\" at 17",
+		"'dogs' in topics and 'cats' in topics": "invalid condition: unexpected \"and 'cats' in topics\" at 17",
+		"'dogs'":                                "invalid condition: expected 'in topics' at 6",
+		"'dogs' in":                             "invalid condition: expected 'in topics' at 7",
+		"dogs in topics":                        "invalid condition: expected quoted topic at 0",
+		"'dogs in topics":                       "invalid condition: unterminated topic at 0",
+		"'do gs' in topics":                     "invalid condition: the topic \"do gs\" must match [a-zA-Z0-9-_.~%]+",
+		"'a' in topics || 'b' in topics || 'c' in topics || 'd' in topics || 'e' in topics || 'f' in topics": "invalid condition: at most 5 topics are allowed",
+	}
+
+	for condition, msg := range invalid {
+		err := checkFCMCondition(condition)
+		if assert.Error(t, err, condition) {
+			assert.Equal(t, msg, err.Error(), condition)
+		}
+	}
+}
+
+func TestCheckFCMTopic(t *testing.T) {
+	assert.NoError(t, checkFCMTopic("news-2019_v1.~%"))
+	assert.Error(t, checkFCMTopic(""))
+	assert.Error(t, checkFCMTopic("news/sport"))
+}
@@ -0,0 +1,574 @@
+package gorush
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gorush/config"
+)
+
+const (
+	// fcmV1Scope is the OAuth2 scope of FCM HTTP v1 API.
+	fcmV1Scope = "https://www.googleapis.com/auth/firebase.messaging"
+	// fcmV1Timeout is the timeout of FCM and token requests.
+	fcmV1Timeout = 30 * time.Second
+	// fcmV1Concurrency is the max number of messages sent at the same time,
+	// HTTP v1 API sends one message per registration token.
+	fcmV1Concurrency = 10
+	// fcmV1TokenExpiryDelta refresh the access token before it expires.
+	fcmV1TokenExpiryDelta = time.Minute
+)
+
+// fcmV1Endpoint is the base URL of FCM HTTP v1 API.
+var fcmV1Endpoint = "https://fcm.googleapis.com"
+
+// fcmV1ErrorCodes map the FCM error code of HTTP v1 API to the error of
+// legacy API, so both are handled in the same way.
+var fcmV1ErrorCodes = map[string]error{
+	"UNREGISTERED":           fcm.ErrNotRegistered,
+	"SENDER_ID_MISMATCH":     fcm.ErrMismatchSenderID,
+	"INVALID_ARGUMENT":       fcm.ErrInvalidParameters,
+	"QUOTA_EXCEEDED":         fcm.ErrDeviceMessageRateExceeded,
+	"THIRD_PARTY_AUTH_ERROR": fcm.ErrInvalidApnsCredential,
+	"UNAVAILABLE":            fcm.ErrUnavailable,
+	"INTERNAL":               fcm.ErrInternalServerError,
+}
+
+// fcmV1TransientError is the temporary error of FCM HTTP v1 API, it is
+// retried as the transient error of legacy API.
+type fcmV1TransientError struct {
+	msg     string
+	timeout bool
+}
+
+func (e fcmV1TransientError) Error() string   { return e.msg }
+func (e fcmV1TransientError) Temporary() bool { return true }
+func (e fcmV1TransientError) Timeout() bool   { return e.timeout }
+
+// fcmServiceAccount is the service account JSON of Firebase project.
+type fcmServiceAccount struct {
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// fcmTokenSource exchange the signed JWT of service account for OAuth2 access
+// token, the token is cached until it is about to expire.
+type fcmTokenSource struct {
+	sync.Mutex
+	account fcmServiceAccount
+	key     *rsa.PrivateKey
+	token   string
+	expiry  time.Time
+}
+
+// FCMv1Client send message with FCM HTTP v1 API.
+// https://firebase.google.com/docs/reference/fcm/rest/v1/projects.messages
+type FCMv1Client struct {
+	projectID string
+	client    *http.Client
+	token     *fcmTokenSource
+}
+
+// InitFCMv1Client use for initialize FCM HTTP v1 client with the service
+// account of android config.
+func InitFCMv1Client() (*FCMv1Client, error) {
+	if FCMv1 != nil {
+		return FCMv1, nil
+	}
+
+	data, err := fcmCredential(androidDefaultApp())
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newFCMv1Client(data)
+	if err != nil {
+		return nil, err
+	}
+	FCMv1 = client
+
+	return FCMv1, nil
+}
+
+// fcmCredential return the service account JSON of app, inline JSON is
+// prior to the file.
+func fcmCredential(app config.SectionAndroidApp) ([]byte, error) {
+	switch {
+	case app.CredentialJSON != "":
+		return []byte(app.CredentialJSON), nil
+	case app.Credential != "":
+		return ioutil.ReadFile(app.Credential)
+	}
+
+	return nil, errors.New("Missing Android credential")
+}
+
+// newFCMv1Client create FCM HTTP v1 client with service account JSON.
+func newFCMv1Client(credential []byte) (*FCMv1Client, error) {
+	var account fcmServiceAccount
+	if err := json.Unmarshal(credential, &account); err != nil {
+		return nil, fmt.Errorf("invalid Android credential: %s", err)
+	}
+
+	if account.ProjectID == "" || account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, errors.New("invalid Android credential: missing project_id, client_email or private_key")
+	}
+
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	key, err := parseRSAPrivateKey(account.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Android credential: %s", err)
+	}
+
+	return &FCMv1Client{
+		projectID: account.ProjectID,
+		client:    &http.Client{Timeout: fcmV1Timeout},
+		token: &fcmTokenSource{
+			account: account,
+			key:     key,
+		},
+	}, nil
+}
+
+// parseRSAPrivateKey parse PKCS#8 or PKCS#1 PEM private key.
+func parseRSAPrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("private key must be PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key must be RSA key")
+	}
+
+	return key, nil
+}
+
+// get return the cached access token, request new one if it expires.
+func (s *fcmTokenSource) get(client *http.Client) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.token != "" && time.Now().Add(fcmV1TokenExpiryDelta).Before(s.expiry) {
+		return s.token, nil
+	}
+
+	assertion, err := s.assertion()
+	if err != nil {
+		return "", err
+	}
+
+	res, err := client.PostForm(s.account.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", fcmV1TransientError{msg: err.Error(), timeout: true}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return "", fmt.Errorf("%d error: oauth2 token: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	if token.AccessToken == "" {
+		return "", errors.New("oauth2 token: empty access token")
+	}
+
+	s.token = token.AccessToken
+	s.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	return s.token, nil
+}
+
+// reset drop the cached access token, it is rejected by FCM.
+func (s *fcmTokenSource) reset() {
+	s.Lock()
+	s.token = ""
+	s.Unlock()
+}
+
+// assertion return the JWT signed by service account private key.
+func (s *fcmTokenSource) assertion() (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": s.account.PrivateKeyID,
+	})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   s.account.ClientEmail,
+		"scope": fcmV1Scope,
+		"aud":   s.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+type fcmV1Request struct {
+	ValidateOnly bool         `json:"validate_only,omitempty"`
+	Message      fcmV1Message `json:"message"`
+}
+
+type fcmV1Message struct {
+	Token        string             `json:"token,omitempty"`
+	Topic        string             `json:"topic,omitempty"`
+	Condition    string             `json:"condition,omitempty"`
+	Data         map[string]string  `json:"data,omitempty"`
+	Notification *fcmV1Notification `json:"notification,omitempty"`
+	Android      *fcmV1Android      `json:"android,omitempty"`
+	APNS         *fcmV1APNS         `json:"apns,omitempty"`
+	FCMOptions   *fcmV1FCMOptions   `json:"fcm_options,omitempty"`
+}
+
+type fcmV1FCMOptions struct {
+	AnalyticsLabel string `json:"analytics_label,omitempty"`
+}
+
+type fcmV1Notification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type fcmV1Android struct {
+	CollapseKey           string                    `json:"collapse_key,omitempty"`
+	Priority              string                    `json:"priority,omitempty"`
+	TTL                   string                    `json:"ttl,omitempty"`
+	RestrictedPackageName string                    `json:"restricted_package_name,omitempty"`
+	DirectBootOK          bool                      `json:"direct_boot_ok,omitempty"`
+	Notification          *fcmV1AndroidNotification `json:"notification,omitempty"`
+}
+
+type fcmV1AndroidNotification struct {
+	Title        string   `json:"title,omitempty"`
+	Body         string   `json:"body,omitempty"`
+	Icon         string   `json:"icon,omitempty"`
+	Color        string   `json:"color,omitempty"`
+	Sound        string   `json:"sound,omitempty"`
+	Tag          string   `json:"tag,omitempty"`
+	ClickAction  string   `json:"click_action,omitempty"`
+	BodyLocKey   string   `json:"body_loc_key,omitempty"`
+	BodyLocArgs  []string `json:"body_loc_args,omitempty"`
+	TitleLocKey  string   `json:"title_loc_key,omitempty"`
+	TitleLocArgs []string `json:"title_loc_args,omitempty"`
+	ChannelID    string   `json:"channel_id,omitempty"`
+}
+
+type fcmV1APNS struct {
+	Payload map[string]interface{} `json:"payload"`
+}
+
+type fcmV1Response struct {
+	Name  string `json:"name"`
+	Error struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Details []struct {
+			Type      string `json:"@type"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// newFCMv1Message convert the legacy message to HTTP v1 message, the target
+// is set by caller.
+func newFCMv1Message(msg *fcm.Message) fcmV1Message {
+	message := fcmV1Message{
+		Android: &fcmV1Android{
+			CollapseKey:           msg.CollapseKey,
+			RestrictedPackageName: msg.RestrictedPackageName,
+		},
+	}
+
+	switch msg.Priority {
+	case "high":
+		message.Android.Priority = "HIGH"
+	case "normal":
+		message.Android.Priority = "NORMAL"
+	}
+
+	if msg.TimeToLive != nil {
+		message.Android.TTL = fmt.Sprintf("%ds", *msg.TimeToLive)
+	}
+
+	// the values of data must be string.
+	if len(msg.Data) > 0 {
+		message.Data = make(map[string]string, len(msg.Data))
+		for k, v := range msg.Data {
+			if s, ok := v.(string); ok {
+				message.Data[k] = s
+				continue
+			}
+			b, _ := json.Marshal(v)
+			message.Data[k] = string(b)
+		}
+	}
+
+	if n := msg.Notification; n != nil && *n != (fcm.Notification{}) {
+		if n.Title != "" || n.Body != "" {
+			message.Notification = &fcmV1Notification{
+				Title: n.Title,
+				Body:  n.Body,
+			}
+		}
+		message.Android.Notification = &fcmV1AndroidNotification{
+			Icon:         n.Icon,
+			Color:        n.Color,
+			Sound:        n.Sound,
+			Tag:          n.Tag,
+			ClickAction:  n.ClickAction,
+			BodyLocKey:   n.BodyLocKey,
+			BodyLocArgs:  fcmV1LocArgs(n.BodyLocArgs),
+			TitleLocKey:  n.TitleLocKey,
+			TitleLocArgs: fcmV1LocArgs(n.TitleLocArgs),
+			ChannelID:    n.ChannelID,
+		}
+	}
+
+	// content_available and mutable_content are used by iOS app.
+	aps := map[string]interface{}{}
+	if msg.ContentAvailable {
+		aps["content-available"] = 1
+	}
+	if msg.MutableContent {
+		aps["mutable-content"] = 1
+	}
+	if msg.Notification != nil && msg.Notification.Badge != "" {
+		if badge, err := strconv.Atoi(msg.Notification.Badge); err == nil {
+			aps["badge"] = badge
+		}
+	}
+	if len(aps) > 0 {
+		message.APNS = &fcmV1APNS{Payload: map[string]interface{}{"aps": aps}}
+	}
+
+	return message
+}
+
+// fcmV1LocArgs convert the loc args of legacy API, which is JSON array or
+// single string, to string array.
+func fcmV1LocArgs(args string) []string {
+	if args == "" {
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal([]byte(args), &list); err == nil {
+		return list
+	}
+
+	return []string{args}
+}
+
+// FCMv1Options is the fields of HTTP v1 message which the legacy message
+// doesn't have.
+type FCMv1Options struct {
+	// DirectBootOK delivers the message before the device is unlocked.
+	DirectBootOK bool
+	// AnalyticsLabel is the label of message in FCM analytics.
+	AnalyticsLabel string
+}
+
+// Send the legacy message with HTTP v1 API. The message to multiple tokens is
+// sent one by one and the result of each token is returned as legacy API.
+// Error is returned if the request is rejected, e.g. invalid credential.
+func (c *FCMv1Client) Send(msg *fcm.Message) (*fcm.Response, error) {
+	return c.SendWithOptions(msg, FCMv1Options{})
+}
+
+// SendWithOptions send the legacy message with the options of HTTP v1 API.
+func (c *FCMv1Client) SendWithOptions(msg *fcm.Message, opts FCMv1Options) (*fcm.Response, error) {
+	message := newFCMv1Message(msg)
+	message.Android.DirectBootOK = opts.DirectBootOK
+	if opts.AnalyticsLabel != "" {
+		message.FCMOptions = &fcmV1FCMOptions{AnalyticsLabel: opts.AnalyticsLabel}
+	}
+
+	if len(msg.RegistrationIDs) == 0 {
+		switch {
+		case strings.HasPrefix(msg.To, "/topics/"):
+			message.Topic = strings.TrimPrefix(msg.To, "/topics/")
+		case msg.Condition != "":
+			message.Condition = msg.Condition
+		default:
+			message.Token = msg.To
+		}
+
+		name, result, err := c.send(message, msg.DryRun)
+		if err != nil {
+			return nil, err
+		}
+
+		res := &fcm.Response{}
+		if message.Token != "" {
+			res.Results = []fcm.Result{{MessageID: name, Error: result}}
+			countFCMv1Result(res, result)
+			return res, nil
+		}
+
+		// the message id of topic message is the number at the end of name.
+		res.Error = result
+		if result == nil {
+			res.MessageID, _ = strconv.ParseInt(name[strings.LastIndex(name, "/")+1:], 10, 64)
+		}
+
+		return res, nil
+	}
+
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		sendErr error
+		sem     = make(chan struct{}, fcmV1Concurrency)
+		res     = &fcm.Response{Results: make([]fcm.Result, len(msg.RegistrationIDs))}
+	)
+
+	for i, token := range msg.RegistrationIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, message fcmV1Message) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			name, result, err := c.send(message, msg.DryRun)
+			if err != nil {
+				lock.Lock()
+				sendErr = err
+				lock.Unlock()
+				return
+			}
+			res.Results[i] = fcm.Result{MessageID: name, Error: result}
+		}(i, withFCMv1Token(message, token))
+	}
+	wg.Wait()
+
+	if sendErr != nil {
+		return nil, sendErr
+	}
+
+	for _, result := range res.Results {
+		countFCMv1Result(res, result.Error)
+	}
+
+	return res, nil
+}
+
+func withFCMv1Token(message fcmV1Message, token string) fcmV1Message {
+	message.Token = token
+	return message
+}
+
+func countFCMv1Result(res *fcm.Response, result error) {
+	if result != nil {
+		res.Failure++
+	} else {
+		res.Success++
+	}
+}
+
+// send post message to FCM, return the name of message or the error of FCM
+// result. The err is returned if the request is failed.
+func (c *FCMv1Client) send(message fcmV1Message, validateOnly bool) (name string, result, err error) {
+	token, err := c.token.get(c.client)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := json.Marshal(fcmV1Request{
+		ValidateOnly: validateOnly,
+		Message:      message,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/projects/%s/messages:send", fcmV1Endpoint, c.projectID)
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", nil, fcmV1TransientError{msg: err.Error(), timeout: true}
+	}
+	defer res.Body.Close()
+
+	var body fcmV1Response
+	_ = json.NewDecoder(res.Body).Decode(&body)
+
+	if res.StatusCode == http.StatusOK {
+		return body.Name, nil, nil
+	}
+
+	for _, detail := range body.Error.Details {
+		if e, ok := fcmV1ErrorCodes[detail.ErrorCode]; ok {
+			return "", e, nil
+		}
+	}
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return "", fcmV1TransientError{msg: fmt.Sprintf("%d error: %s", res.StatusCode, res.Status)}, nil
+	}
+
+	if res.StatusCode == http.StatusUnauthorized {
+		c.token.reset()
+	}
+
+	return "", nil, fmt.Errorf("%d error: %s", res.StatusCode, res.Status)
+}
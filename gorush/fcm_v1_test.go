@@ -0,0 +1,278 @@
+package gorush
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// testFCMv1Server start FCM HTTP v1 and OAuth2 token server, the result of
+// message is returned by handler, tokens counts the access token requests.
+func testFCMv1Server(t *testing.T, handler func(message fcmV1Message) (int, string)) (credential []byte, tokens *int32, cleanup func()) {
+	tokens = new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.FormValue("grant_type"))
+			assert.Equal(t, 3, len(strings.Split(r.FormValue("assertion"), ".")))
+			atomic.AddInt32(tokens, 1)
+			_, _ = w.Write([]byte(`{"access_token":"access-token","expires_in":3600}`))
+			return
+		}
+
+		assert.Equal(t, "/v1/projects/gorush-test/messages:send", r.URL.Path)
+		assert.Equal(t, "Bearer access-token", r.Header.Get("Authorization"))
+
+		var req fcmV1Request
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &req))
+
+		code, res := handler(req.Message)
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(res))
+	}))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	credential, _ = json.Marshal(fcmServiceAccount{
+		ProjectID:   "gorush-test",
+		ClientEmail: "gorush@gorush-test.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		TokenURI:    server.URL + "/token",
+	})
+
+	endpoint := fcmV1Endpoint
+	fcmV1Endpoint = server.URL
+
+	return credential, tokens, func() {
+		fcmV1Endpoint = endpoint
+		server.Close()
+	}
+}
+
+func newTestFCMv1Client(t *testing.T, credential []byte) *FCMv1Client {
+	client, err := newFCMv1Client(credential)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	// http.DefaultTransport may be replaced by proxy test.
+	client.client = &http.Client{Transport: &http.Transport{}}
+
+	return client
+}
+
+func fcmV1Error(code int, status, errorCode string) (int, string) {
+	return code, fmt.Sprintf(`{"error":{"code":%d,"status":"%s","details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"%s"}]}}`, code, status, errorCode)
+}
+
+func TestNewFCMv1Client(t *testing.T) {
+	_, err := newFCMv1Client([]byte("{"))
+	assert.Error(t, err)
+
+	_, err = newFCMv1Client([]byte(`{"project_id":"gorush-test"}`))
+	assert.Error(t, err)
+	assert.Equal(t, "invalid Android credential: missing project_id, client_email or private_key", err.Error())
+
+	_, err = newFCMv1Client([]byte(`{"project_id":"gorush-test","client_email":"gorush","private_key":"key"}`))
+	assert.Error(t, err)
+	assert.Equal(t, "invalid Android credential: private key must be PEM encoded", err.Error())
+}
+
+func TestFCMv1Send(t *testing.T) {
+	credential, tokens, cleanup := testFCMv1Server(t, func(message fcmV1Message) (int, string) {
+		switch message.Token {
+		case "aaaaa":
+			return http.StatusOK, `{"name":"projects/gorush-test/messages/0:1"}`
+		case "bbbbb":
+			return fcmV1Error(http.StatusNotFound, "NOT_FOUND", "UNREGISTERED")
+		case "ccccc":
+			return fcmV1Error(http.StatusForbidden, "PERMISSION_DENIED", "SENDER_ID_MISMATCH")
+		}
+		return http.StatusServiceUnavailable, ""
+	})
+	defer cleanup()
+	client := newTestFCMv1Client(t, credential)
+
+	res, err := client.Send(&fcm.Message{
+		RegistrationIDs: []string{"aaaaa", "bbbbb", "ccccc", "ddddd"},
+		Notification:    &fcm.Notification{Body: "Welcome"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res.Success)
+	assert.Equal(t, 3, res.Failure)
+	assert.Equal(t, "projects/gorush-test/messages/0:1", res.Results[0].MessageID)
+	assert.Equal(t, fcm.ErrNotRegistered, res.Results[1].Error)
+	assert.Equal(t, fcm.ErrMismatchSenderID, res.Results[2].Error)
+	assert.True(t, isTransientFCMError(res.Results[3].Error))
+	assert.True(t, isInvalidTokenError(res.Results[1].Error))
+	assert.True(t, isInvalidTokenError(res.Results[2].Error))
+
+	// access token is cached.
+	assert.Equal(t, int32(1), atomic.LoadInt32(tokens))
+}
+
+func TestFCMv1SendTopic(t *testing.T) {
+	credential, tokens, cleanup := testFCMv1Server(t, func(message fcmV1Message) (int, string) {
+		if message.Topic == "news" {
+			return http.StatusOK, `{"name":"projects/gorush-test/messages/5439350016120392920"}`
+		}
+		return http.StatusUnauthorized, `{"error":{"code":401,"status":"UNAUTHENTICATED"}}`
+	})
+	defer cleanup()
+	client := newTestFCMv1Client(t, credential)
+
+	res, err := client.Send(&fcm.Message{To: "/topics/news"})
+	assert.NoError(t, err)
+	assert.Nil(t, res.Error)
+	assert.Equal(t, int64(5439350016120392920), res.MessageID)
+
+	// the request is rejected, access token is requested again.
+	_, err = client.Send(&fcm.Message{Condition: "'dogs' in topics"})
+	assert.Error(t, err)
+	assert.Equal(t, "401 error: 401 Unauthorized", err.Error())
+
+	_, _ = client.Send(&fcm.Message{To: "/topics/news"})
+	assert.Equal(t, int32(2), atomic.LoadInt32(tokens))
+}
+
+func TestNewFCMv1Message(t *testing.T) {
+	ttl := uint(60)
+	message := newFCMv1Message(&fcm.Message{
+		CollapseKey:      "1",
+		Priority:         "high",
+		TimeToLive:       &ttl,
+		ContentAvailable: true,
+		Data:             map[string]interface{}{"a": "1", "b": 2},
+		Notification: &fcm.Notification{
+			Title:       "Title",
+			Body:        "Welcome",
+			Color:       "#ffffff",
+			Badge:       "3",
+			BodyLocArgs: `["a", "b"]`,
+		},
+	})
+
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, message.Data)
+	assert.Equal(t, &fcmV1Notification{Title: "Title", Body: "Welcome"}, message.Notification)
+	assert.Equal(t, "1", message.Android.CollapseKey)
+	assert.Equal(t, "HIGH", message.Android.Priority)
+	assert.Equal(t, "60s", message.Android.TTL)
+	assert.Equal(t, "#ffffff", message.Android.Notification.Color)
+	assert.Equal(t, []string{"a", "b"}, message.Android.Notification.BodyLocArgs)
+	assert.Equal(t, map[string]interface{}{"content-available": 1, "badge": 3}, message.APNS.Payload["aps"])
+
+	// data message.
+	message = newFCMv1Message(&fcm.Message{Notification: &fcm.Notification{}})
+	assert.Nil(t, message.Notification)
+	assert.Nil(t, message.Android.Notification)
+	assert.Nil(t, message.APNS)
+}
+
+func TestPushToAndroidV1(t *testing.T) {
+	credential, _, cleanup := testFCMv1Server(t, func(message fcmV1Message) (int, string) {
+		assert.Equal(t, "Welcome", message.Notification.Body)
+		return http.StatusOK, `{"name":"projects/gorush-test/messages/0:1"}`
+	})
+	defer cleanup()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.CredentialJSON = string(credential)
+	assert.NoError(t, CheckPushConf())
+
+	FCMv1 = newTestFCMv1Client(t, credential)
+	defer func() {
+		FCMv1 = nil
+	}()
+
+	isError := PushToAndroid(PushNotification{
+		Platform: PlatFormAndroid,
+		Tokens:   []string{"aaaaa", "bbbbb"},
+		Message:  "Welcome",
+	})
+	assert.False(t, isError)
+}
+
+func TestPushToAndroidV1Options(t *testing.T) {
+	messages := make(chan fcmV1Message, 1)
+	credential, _, cleanup := testFCMv1Server(t, func(message fcmV1Message) (int, string) {
+		messages <- message
+		return http.StatusOK, `{"name":"projects/gorush-test/messages/0:1"}`
+	})
+	defer cleanup()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.CredentialJSON = string(credential)
+	assert.NoError(t, CheckPushConf())
+
+	FCMv1 = newTestFCMv1Client(t, credential)
+	defer func() {
+		FCMv1 = nil
+	}()
+
+	req := PushNotification{
+		Platform:       PlatFormAndroid,
+		Tokens:         []string{"aaaaa"},
+		Message:        "Welcome",
+		DirectBootOK:   true,
+		AnalyticsLabel: "spring_sale-2021",
+	}
+	assert.NoError(t, CheckMessage(req))
+	assert.False(t, PushToAndroid(req))
+
+	message := <-messages
+	assert.True(t, message.Android.DirectBootOK)
+	assert.Equal(t, &fcmV1FCMOptions{AnalyticsLabel: "spring_sale-2021"}, message.FCMOptions)
+
+	// the options are omitted by default.
+	data, _ := json.Marshal(newFCMv1Message(GetAndroidNotification(PushNotification{
+		Platform: PlatFormAndroid,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+	})))
+	assert.NotContains(t, string(data), "direct_boot_ok")
+	assert.NotContains(t, string(data), "fcm_options")
+}
+
+func TestCheckAnalyticsLabel(t *testing.T) {
+	req := PushNotification{Platform: PlatFormAndroid}
+	for _, label := range []string{"", "campaign", "a-b_c.d~e%20", strings.Repeat("a", 50)} {
+		req.AnalyticsLabel = label
+		assert.NoError(t, checkAnalyticsLabel(req))
+	}
+
+	for _, label := range []string{"spring sale", "campaign/1", strings.Repeat("a", 51)} {
+		req.AnalyticsLabel = label
+		assert.EqualError(t, checkAnalyticsLabel(req), "the analytics_label must match ^[a-zA-Z0-9-_.~%]{1,50}$")
+	}
+}
+
+func TestMissingAndroidCredential(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+
+	err := CheckPushConf()
+	assert.Error(t, err)
+	assert.Equal(t, "Missing Android credential", err.Error())
+
+	PushConf.Android.APIVersion = "v2"
+	err = CheckPushConf()
+	assert.Error(t, err)
+	assert.Equal(t, "Android api_version must be v1 or legacy", err.Error())
+
+	PushConf.Android.APIVersion = "v1"
+	PushConf.Android.Credential = "not-found.json"
+	_, err = InitFCMv1Client()
+	assert.Error(t, err)
+}
@@ -0,0 +1,213 @@
+package gorush
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// FeedbackResult is delivery result of single token posted to feedback url.
+type FeedbackResult struct {
+	ID        string `json:"notif_id,omitempty"`
+	Type      string `json:"type"`
+	Platform  string `json:"platform"`
+	Token     string `json:"token"`
+	Message   string `json:"message,omitempty"`
+	Error     string `json:"error,omitempty"`
+	ApnsID    string `json:"apns_id,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+	// UnregisteredAt is the unix time the token became invalid, e.g. APNs
+	// Unregistered.
+	UnregisteredAt int64 `json:"unregistered_at,omitempty"`
+}
+
+// feedback full policy of core.feedback_full_policy.
+const (
+	// FeedbackFullDrop drop the new request when feedback buffer is full.
+	FeedbackFullDrop = "drop"
+	// FeedbackFullDropOldest drop the oldest pending request to make room
+	// for the new one.
+	FeedbackFullDropOldest = "drop_oldest"
+)
+
+// InitFeedback check core.feedback_full_policy and start
+// core.feedback_concurrency feedback workers if feedback url is configured.
+func InitFeedback() error {
+	switch PushConf.Core.FeedbackFullPolicy {
+	case "", FeedbackFullDrop, FeedbackFullDropOldest:
+	default:
+		return fmt.Errorf("unknown feedback_full_policy %q, must be drop or drop_oldest", PushConf.Core.FeedbackFullPolicy)
+	}
+
+	if PushConf.Core.FeedbackURL == "" {
+		QueueFeedback = nil
+		return nil
+	}
+
+	LogAccess.Debug("feedback url is ", PushConf.Core.FeedbackURL)
+	QueueFeedback = make(chan FeedbackResult, feedbackQueueNum())
+	client := &http.Client{
+		Timeout: time.Duration(PushConf.Core.FeedbackTimeout) * time.Second,
+	}
+
+	workers := PushConf.Core.FeedbackNum
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go feedbackWorker(client, QueueFeedback)
+	}
+
+	return nil
+}
+
+// feedbackQueueNum return buffer size of feedback and callback requests,
+// default as core.queue_num.
+func feedbackQueueNum() int64 {
+	if PushConf.Core.FeedbackQueueNum > 0 {
+		return PushConf.Core.FeedbackQueueNum
+	}
+
+	return PushConf.Core.QueueNum
+}
+
+func feedbackWorker(client *http.Client, queue chan FeedbackResult) {
+	for result := range queue {
+		err := DispatchFeedback(client, PushConf.Core.FeedbackURL, result, PushConf.Core.FeedbackMaxRetry)
+		countFeedbackRequest("feedback", err)
+		if err != nil {
+			LogError.Error("feedback error: " + err.Error())
+		}
+	}
+}
+
+// enqueueFeedback add result to feedback buffer by core.feedback_full_policy,
+// return false if the result is dropped.
+func enqueueFeedback(queue chan FeedbackResult, result FeedbackResult) bool {
+	select {
+	case queue <- result:
+		return true
+	default:
+	}
+
+	if PushConf.Core.FeedbackFullPolicy == FeedbackFullDropOldest {
+		select {
+		case <-queue:
+			feedbackRequestCounter.WithLabelValues("feedback", "dropped").Inc()
+		default:
+		}
+
+		select {
+		case queue <- result:
+			return true
+		default:
+		}
+	}
+
+	feedbackRequestCounter.WithLabelValues("feedback", "dropped").Inc()
+
+	return false
+}
+
+// the delay before resending fail feedback request, doubled on every attempt
+// up to feedbackMaxRetryDelay.
+var (
+	feedbackRetryDelay    = time.Second
+	feedbackMaxRetryDelay = 30 * time.Second
+)
+
+// feedbackBackoff return the delay before next attempt of feedback request.
+func feedbackBackoff(attempt int) time.Duration {
+	delay := feedbackRetryDelay
+	for i := 0; i < attempt && delay < feedbackMaxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > feedbackMaxRetryDelay {
+		delay = feedbackMaxRetryDelay
+	}
+
+	return delay
+}
+
+// DispatchFeedback post delivery result to feedback url, resend fail request
+// up to maxRetry times with exponential backoff.
+func DispatchFeedback(client *http.Client, url string, result FeedbackResult, maxRetry int) error {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	for retryCount := 0; ; retryCount++ {
+		err = postFeedback(client, url, payload)
+		if err == nil || retryCount >= maxRetry {
+			return err
+		}
+
+		LogError.Warn(fmt.Sprintf("resend feedback request after %s: %s", feedbackBackoff(retryCount), err.Error()))
+		time.Sleep(feedbackBackoff(retryCount))
+	}
+}
+
+func postFeedback(client *http.Client, url string, payload []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("feedback server returned %d status code", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// addFeedback queue delivery result of token for feedback worker and add it
+// to callback of notification. providerID is the apns-id of APNs or message
+// id of FCM.
+func addFeedback(status, token string, req PushNotification, errPush error, providerID string) {
+	if QueueFeedback == nil && req.callback == nil {
+		return
+	}
+
+	result := FeedbackResult{
+		ID:       req.ID,
+		Type:     status,
+		Platform: typeForPlatForm(req.Platform),
+		Token:    token,
+		Message:  req.Message,
+	}
+
+	if errPush != nil {
+		result.Error = errPush.Error()
+		result.UnregisteredAt = unregisteredAt(errPush)
+	}
+
+	switch req.Platform {
+	case PlatFormIos:
+		result.ApnsID = providerID
+	case PlatFormAndroid:
+		result.MessageID = providerID
+	}
+
+	if req.callback != nil {
+		req.callback.add(result)
+	}
+
+	if QueueFeedback == nil {
+		return
+	}
+
+	if !enqueueFeedback(QueueFeedback, result) {
+		LogError.Error("feedback queue max capacity reached")
+	}
+}
@@ -0,0 +1,194 @@
+package gorush
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchFeedback(t *testing.T) {
+	var result FeedbackResult
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&result))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	err := DispatchFeedback(http.DefaultClient, ts.URL, FeedbackResult{
+		ID:     "1234",
+		Type:   SucceededPush,
+		Token:  "aaaaa",
+		ApnsID: "apns-id",
+	}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", result.ID)
+	assert.Equal(t, "aaaaa", result.Token)
+	assert.Equal(t, "apns-id", result.ApnsID)
+}
+
+func TestDispatchFeedbackRetry(t *testing.T) {
+	feedbackRetryDelay = 10 * time.Millisecond
+	defer func() {
+		feedbackRetryDelay = time.Second
+	}()
+
+	count := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	err := DispatchFeedback(http.DefaultClient, ts.URL, FeedbackResult{}, 2)
+	assert.Error(t, err)
+	assert.Equal(t, "feedback server returned 500 status code", err.Error())
+	assert.Equal(t, 3, count)
+	// wait 10ms and 20ms before the two resends.
+	assert.True(t, time.Since(start) >= 30*time.Millisecond)
+}
+
+func TestFeedbackBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, feedbackBackoff(0))
+	assert.Equal(t, 4*time.Second, feedbackBackoff(2))
+	assert.Equal(t, 30*time.Second, feedbackBackoff(10))
+}
+
+func TestAddFeedback(t *testing.T) {
+	received := make(chan FeedbackResult, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result FeedbackResult
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&result))
+		received <- result
+	}))
+	defer ts.Close()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.FeedbackURL = ts.URL
+	assert.NoError(t, InitFeedback())
+
+	req := PushNotification{
+		ID:       "notif-1",
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+	}
+	addFeedback(SucceededPush, "aaaaa", req, nil, "message-id")
+
+	select {
+	case result := <-received:
+		assert.Equal(t, "notif-1", result.ID)
+		assert.Equal(t, "android", result.Platform)
+		assert.Equal(t, "message-id", result.MessageID)
+		assert.Equal(t, "", result.ApnsID)
+	case <-time.After(time.Second):
+		t.Fatal("feedback not received")
+	}
+
+	PushConf, _ = config.LoadConf("")
+	assert.NoError(t, InitFeedback())
+	assert.Nil(t, QueueFeedback)
+}
+
+func TestInitFeedbackFullPolicy(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.FeedbackFullPolicy = "coalesce"
+	assert.EqualError(t, InitFeedback(), `unknown feedback_full_policy "coalesce", must be drop or drop_oldest`)
+
+	PushConf, _ = config.LoadConf("")
+	assert.NoError(t, InitFeedback())
+}
+
+func TestEnqueueFeedback(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	dropped := func() float64 {
+		return testutil.ToFloat64(feedbackRequestCounter.WithLabelValues("feedback", "dropped"))
+	}
+
+	// the new result is dropped by default.
+	queue := make(chan FeedbackResult, 2)
+	before := dropped()
+	assert.True(t, enqueueFeedback(queue, FeedbackResult{Token: "a"}))
+	assert.True(t, enqueueFeedback(queue, FeedbackResult{Token: "b"}))
+	assert.False(t, enqueueFeedback(queue, FeedbackResult{Token: "c"}))
+	assert.Equal(t, before+1, dropped())
+	assert.Equal(t, "a", (<-queue).Token)
+	assert.Equal(t, "b", (<-queue).Token)
+
+	// the oldest result makes room for the new one.
+	PushConf.Core.FeedbackFullPolicy = FeedbackFullDropOldest
+	before = dropped()
+	assert.True(t, enqueueFeedback(queue, FeedbackResult{Token: "a"}))
+	assert.True(t, enqueueFeedback(queue, FeedbackResult{Token: "b"}))
+	assert.True(t, enqueueFeedback(queue, FeedbackResult{Token: "c"}))
+	assert.Equal(t, before+1, dropped())
+	assert.Equal(t, "b", (<-queue).Token)
+	assert.Equal(t, "c", (<-queue).Token)
+
+	// nothing can be dropped from unbuffered queue without receiver.
+	assert.False(t, enqueueFeedback(make(chan FeedbackResult), FeedbackResult{}))
+}
+
+func TestFeedbackConcurrency(t *testing.T) {
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	release := make(chan struct{})
+	done := make(chan struct{}, 5)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+
+		<-release
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+		done <- struct{}{}
+	}))
+	defer ts.Close()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.FeedbackURL = ts.URL
+	PushConf.Core.FeedbackNum = 2
+	assert.NoError(t, InitFeedback())
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		assert.NoError(t, InitFeedback())
+	}()
+
+	for i := 0; i < 5; i++ {
+		addFeedback(SucceededPush, "aaaaa", PushNotification{Platform: PlatFormAndroid}, nil, "")
+	}
+
+	// the requests are blocked by server, so none of them is counted yet.
+	time.Sleep(100 * time.Millisecond)
+	success := testutil.ToFloat64(feedbackRequestCounter.WithLabelValues("feedback", "success"))
+	close(release)
+	for i := 0; i < 5; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("feedback not received")
+		}
+	}
+
+	lock.Lock()
+	assert.Equal(t, 2, maxRunning)
+	lock.Unlock()
+
+	// the counter is updated after the response is read.
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, success+5, testutil.ToFloat64(feedbackRequestCounter.WithLabelValues("feedback", "success")))
+}
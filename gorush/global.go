@@ -1,6 +1,8 @@
 package gorush
 
 import (
+	"net/http"
+
 	"github.com/appleboy/gorush/config"
 	"github.com/appleboy/gorush/storage"
 
@@ -14,10 +16,35 @@ var (
 	PushConf config.ConfYaml
 	// QueueNotification is chan type
 	QueueNotification chan PushNotification
-	// ApnsClient is apns client
+	// QueueIosNotification is chan type for dedicated iOS workers
+	QueueIosNotification chan PushNotification
+	// QueueAndroidNotification is chan type for dedicated Android workers
+	QueueAndroidNotification chan PushNotification
+	// SharedQueue is notification queue of redis or nats engine, nil if queue engine is local
+	SharedQueue Queue
+	// QueueFeedback is chan type of delivery result for feedback worker
+	QueueFeedback chan FeedbackResult
+	// ApnsClient is the first apns client of ApnsPool
 	ApnsClient *apns2.Client
+	// ApnsPool is apns client pool of top level iOS config
+	ApnsPool *ApnsClientPool
+	// ApnsPools is apns client pool of named app profiles
+	ApnsPools map[string]*ApnsClientPool
+	// ApnsOtherPools is apns client pool of the other APNs host than config for
+	// production override of notification, empty key is top level iOS config
+	ApnsOtherPools map[string]*ApnsClientPool
 	// FCMClient is apns client
 	FCMClient *fcm.Client
+	// FCMv1 is FCM HTTP v1 client
+	FCMv1 *FCMv1Client
+	// FCMClients is FCM client of named Firebase projects
+	FCMClients map[string]FCMSender
+	// HMS is Huawei Push Kit client
+	HMS *HMSClient
+	// SNS is Amazon SNS client
+	SNS *SNSClient
+	// WebClient is web push http client, default http client if nil
+	WebClient *http.Client
 	// LogAccess is log server request log
 	LogAccess *logrus.Logger
 	// LogError is log server error log
@@ -0,0 +1,197 @@
+package gorush
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyStorageKey is key prefix of responses saved by idempotency key.
+const IdempotencyStorageKey = "gorush-idempotency:"
+
+// IdempotencyExpireKey is key prefix of the storage keys of responses
+// expiring in the minute, the unix minute is appended.
+const IdempotencyExpireKey = "gorush-idempotency-expire:"
+
+// IdempotencySweptKey is key name of the last unix minute whose responses
+// are deleted, so the sweep goes on after restart.
+const IdempotencySweptKey = "gorush-idempotency-swept"
+
+// idempotentResponse is the response replayed for the same idempotency key.
+type idempotentResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+// captureWriter keep the response body written by handler.
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotentID return notif_id of notification in request with idempotency
+// key, so the retried request has the same notification IDs.
+func idempotentID(key string, index int) string {
+	return key + "-" + strconv.Itoa(index)
+}
+
+// idempotencyKeys record the keys in progress. The saved keys are indexed in
+// storage by the minute they expire, so they are deleted after ttl even if
+// the server is restarted.
+type idempotencyKeys struct {
+	sync.Mutex
+	pending map[string]struct{}
+	expiry  *expiryIndex
+}
+
+func newIdempotencyKeys() *idempotencyKeys {
+	return &idempotencyKeys{
+		pending: make(map[string]struct{}),
+		expiry: &expiryIndex{
+			prefix:   IdempotencyExpireKey,
+			sweptKey: IdempotencySweptKey,
+			remove: func(key string) {
+				StatStorage.Del(key)
+			},
+		},
+	}
+}
+
+var idempotency = newIdempotencyKeys()
+
+// start lock the key for request, return false if it is in progress.
+func (k *idempotencyKeys) start(key string) bool {
+	k.Lock()
+	defer k.Unlock()
+
+	if _, ok := k.pending[key]; ok {
+		return false
+	}
+	k.pending[key] = struct{}{}
+
+	return true
+}
+
+// done unlock the key, and add it to the index of its expiring minute if the
+// response is saved.
+func (k *idempotencyKeys) done(key string, expiresAt int64, saved bool) {
+	k.Lock()
+	delete(k.pending, key)
+	k.Unlock()
+
+	if saved {
+		k.expiry.add(key, expiresAt)
+	}
+}
+
+// expire delete the responses of the minutes passed since last sweep from
+// storage, the responses expire up to one minute late.
+func (k *idempotencyKeys) expire(now int64) {
+	k.expiry.sweep(now)
+}
+
+// idempotencyStorageKey return the storage key of idempotency key, it is
+// scoped by auth user and the API, so clients never share the responses.
+func idempotencyStorageKey(c *gin.Context, key string) string {
+	return IdempotencyStorageKey + rateLimitKey(c) + ":" + c.Request.Method + " " + c.Request.URL.Path + ":" + key
+}
+
+// loadIdempotentResponse return the saved response of key if it is not expired.
+func loadIdempotentResponse(key string, now int64) (idempotentResponse, bool) {
+	var res idempotentResponse
+	data := StatStorage.GetData(key)
+	if len(data) == 0 {
+		return res, false
+	}
+
+	if err := json.Unmarshal(data, &res); err != nil || res.ExpiresAt <= now {
+		return res, false
+	}
+
+	return res, true
+}
+
+// replayIdempotentResponse write the saved response and abort the request.
+func replayIdempotentResponse(c *gin.Context, res idempotentResponse) {
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Data(res.Status, res.ContentType, res.Body)
+	c.Abort()
+}
+
+// IdempotencyMiddleware replay the response of POST request with the same
+// Idempotency-Key header in core.idempotency.ttl, so retried request never
+// sends the notifications again. Server errors are not saved and can be
+// retried.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	ttl := PushConf.Core.Idempotency.TTL
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+
+		now := time.Now().Unix()
+		idempotency.expire(now)
+		storageKey := idempotencyStorageKey(c, key)
+
+		if res, ok := loadIdempotentResponse(storageKey, now); ok {
+			replayIdempotentResponse(c, res)
+			return
+		}
+
+		if !idempotency.start(storageKey) {
+			abortWithError(c, http.StatusConflict, "Request with the same idempotency key is in progress.")
+			return
+		}
+
+		// the first request may be done between the lookup and start.
+		if res, ok := loadIdempotentResponse(storageKey, now); ok {
+			idempotency.done(storageKey, 0, false)
+			replayIdempotentResponse(c, res)
+			return
+		}
+
+		c.Set(IdempotencyKeyKey, key)
+		w := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		expiresAt := now + ttl
+		saved := w.Status() < http.StatusInternalServerError
+		if saved {
+			data, err := json.Marshal(idempotentResponse{
+				Status:      w.Status(),
+				ContentType: w.Header().Get("Content-Type"),
+				Body:        w.body.Bytes(),
+				ExpiresAt:   expiresAt,
+			})
+			if err != nil {
+				LogError.Error("save idempotent response error: " + err.Error())
+				saved = false
+			} else {
+				StatStorage.SetData(storageKey, data)
+			}
+		}
+		idempotency.done(storageKey, expiresAt, saved)
+	}
+}
@@ -0,0 +1,132 @@
+package gorush
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/appleboy/gorush/storage/memory"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+	PushConf.Android.Enabled = true
+	PushConf.Core.Idempotency.Enabled = true
+	StatStorage = memory.New()
+	// no worker consumes the queue.
+	InitWorkers(0, 10)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	engine := routerEngine()
+	push := func(key, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, strings.NewReader(`{"notifications":[{"tokens":["aaaaa"],"platform":2,"message":"Welcome"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	first := push("retry-1", "/api/push")
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "", first.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 1, len(QueueNotification))
+
+	// the retried request is replayed without sending again.
+	second := push("retry-1", "/api/push")
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, "true", second.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, 1, len(QueueNotification))
+
+	// the key is scoped by API.
+	assert.Equal(t, http.StatusAccepted, push("retry-1", "/api/push/async").Code)
+
+	assert.Equal(t, http.StatusOK, push("retry-2", "/api/push").Code)
+
+	notification := <-QueueNotification
+	assert.Equal(t, "retry-1-0", notification.ID)
+}
+
+func TestIdempotencyServerError(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+	PushConf.Android.Enabled = true
+	PushConf.Core.Idempotency.Enabled = true
+	PushConf.Core.QueueHighWaterMark = 1
+	StatStorage = memory.New()
+	InitWorkers(0, 10)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+	QueueNotification <- PushNotification{Platform: PlatFormAndroid}
+
+	engine := routerEngine()
+	push := func() int {
+		req, _ := http.NewRequest("POST", "/api/push", strings.NewReader(`{"notifications":[{"tokens":["aaaaa"],"platform":2,"message":"Welcome"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, "overloaded")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// overloaded response isn't kept, so the request can be retried.
+	assert.Equal(t, http.StatusServiceUnavailable, push())
+	<-QueueNotification
+	assert.Equal(t, http.StatusOK, push())
+}
+
+func TestIdempotencyStorageKey(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("POST", "/api/push", nil)
+	c.Set(gin.AuthUserKey, "tenant-a")
+	keyA := idempotencyStorageKey(c, "retry-1")
+	c.Set(gin.AuthUserKey, "tenant-b")
+	keyB := idempotencyStorageKey(c, "retry-1")
+
+	assert.NotEqual(t, keyA, keyB)
+	assert.True(t, strings.HasPrefix(keyA, IdempotencyStorageKey))
+}
+
+func TestIdempotencyExpire(t *testing.T) {
+	StatStorage = memory.New()
+	keys := newIdempotencyKeys()
+	keys.expire(0)
+
+	assert.True(t, keys.start("a"))
+	assert.False(t, keys.start("a"))
+	StatStorage.SetData("a", []byte(`{"status":200,"expires_at":100}`))
+	keys.done("a", 100, true)
+	assert.True(t, keys.start("b"))
+	StatStorage.SetData("b", []byte(`{"status":200,"expires_at":200}`))
+	keys.done("b", 200, true)
+
+	_, ok := loadIdempotentResponse("a", 99)
+	assert.True(t, ok)
+	_, ok = loadIdempotentResponse("a", 100)
+	assert.False(t, ok)
+
+	// the keys are deleted after the minute they expire in.
+	keys.expire(119)
+	assert.NotEqual(t, 0, len(StatStorage.GetData("a")))
+	keys.expire(150)
+	assert.Equal(t, 0, len(StatStorage.GetData("a")))
+	assert.NotEqual(t, 0, len(StatStorage.GetData("b")))
+	assert.Equal(t, int64(1), StatStorage.Get(IdempotencySweptKey))
+
+	// the keys saved before restart are still deleted.
+	keys = newIdempotencyKeys()
+	keys.expire(300)
+	assert.Equal(t, 0, len(StatStorage.GetData("b")))
+	assert.Equal(t, 0, len(StatStorage.GetData(keys.expiry.minuteKey(3))))
+}
@@ -0,0 +1,97 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// InboundRequest is the push request consumed from inbound message queue, it
+// is the body of push API with optional id copied to the result.
+type InboundRequest struct {
+	ID string `json:"id,omitempty"`
+	RequestPush
+}
+
+// InboundResult is the result of inbound request published to result subject
+// or list, the logs have delivery results in sync mode.
+type InboundResult struct {
+	ID      string         `json:"id,omitempty"`
+	Success string         `json:"success,omitempty"`
+	Counts  int            `json:"counts"`
+	Logs    []LogPushEntry `json:"logs,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// resultPublisher publish the result of inbound request.
+type resultPublisher func(data []byte) error
+
+// InitInbound start consumers of push requests if inbound engine is nats or
+// redis, the requests are queued by the path of push API.
+func InitInbound() error {
+	LogAccess.Debug("Init Inbound Engine as ", PushConf.Inbound.Engine)
+
+	var err error
+	switch PushConf.Inbound.Engine {
+	case "":
+		return nil
+	case "nats":
+		err = initNATSInbound()
+	case "redis":
+		err = initRedisInbound()
+	default:
+		err = errors.New("can't find inbound engine")
+	}
+
+	if err != nil {
+		LogError.Error("inbound error: " + err.Error())
+	}
+
+	return err
+}
+
+// handleInbound queue the push request of message and return its result.
+func handleInbound(ctx context.Context, data []byte) InboundResult {
+	var req InboundRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return InboundResult{Error: "Invalid push request: " + err.Error()}
+	}
+
+	result := InboundResult{ID: req.ID}
+	switch {
+	case len(req.Notifications) == 0:
+		result.Error = "Notifications field is empty."
+	case req.Credentials != nil:
+		result.Error = "Request credentials are not allowed."
+	default:
+		counts, logs, err := queueRequest(ctx, req.RequestPush)
+		if err != nil {
+			result.Error = err.Error()
+			break
+		}
+		result.Success, result.Counts, result.Logs = "ok", counts, logs
+	}
+
+	return result
+}
+
+// consumeInbound queue the push request and publish the result if publish
+// isn't nil.
+func consumeInbound(ctx context.Context, data []byte, publish resultPublisher) {
+	result := handleInbound(ctx, data)
+	if result.Error != "" {
+		LogError.Error("inbound request error: " + result.Error)
+	}
+
+	if publish == nil {
+		return
+	}
+
+	b, err := json.Marshal(result)
+	if err == nil {
+		err = publish(b)
+	}
+	if err != nil {
+		LogError.Error("inbound result error: " + err.Error())
+	}
+}
@@ -0,0 +1,56 @@
+package gorush
+
+import (
+	"github.com/nats-io/nats.go"
+)
+
+// natsInboundBuffer is the number of pending requests of NATS subscription.
+const natsInboundBuffer = 64
+
+// initNATSInbound subscribe the subject in queue group, so each request is
+// consumed by one of gorush instances. The core NATS subscription delivers
+// request at most once, use JetStream to keep requests of offline consumer.
+func initNATSInbound() error {
+	conf := PushConf.Inbound.NATS
+	conn, err := nats.Connect(conf.URL)
+	if err != nil {
+		return err
+	}
+
+	msgs := make(chan *nats.Msg, natsInboundBuffer)
+	sub, err := conn.ChanQueueSubscribe(conf.Subject, conf.Queue, msgs)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	var publish resultPublisher
+	if conf.ResultSubject != "" {
+		publish = func(data []byte) error {
+			return conn.Publish(conf.ResultSubject, data)
+		}
+	}
+
+	ctx := workerCtx
+	LogAccess.Debug("nats inbound consumer number is ", PushConf.Inbound.ConsumerNum)
+	for i := int64(0); i < PushConf.Inbound.ConsumerNum; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-msgs:
+					consumeInbound(ctx, msg.Data, publish)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = sub.Unsubscribe()
+		conn.Close()
+	}()
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package gorush
+
+import (
+	"time"
+
+	"gopkg.in/redis.v5"
+)
+
+// redisInboundPopTimeout is how long consumer blocks on empty list before
+// checking whether workers are stopped.
+const redisInboundPopTimeout = time.Second
+
+// initRedisInbound start consumers taking push requests from the head of
+// redis list, producers append requests by RPUSH.
+func initRedisInbound() error {
+	conf := PushConf.Inbound.Redis
+	client := redis.NewClient(&redis.Options{
+		Addr:     conf.Addr,
+		Password: conf.Password,
+		DB:       conf.DB,
+	})
+	if _, err := client.Ping().Result(); err != nil {
+		client.Close()
+		return err
+	}
+
+	var publish resultPublisher
+	if conf.ResultKey != "" {
+		publish = func(data []byte) error {
+			return client.RPush(conf.ResultKey, data).Err()
+		}
+	}
+
+	ctx := workerCtx
+	LogAccess.Debug("redis inbound consumer number is ", PushConf.Inbound.ConsumerNum)
+	for i := int64(0); i < PushConf.Inbound.ConsumerNum; i++ {
+		go func() {
+			for ctx.Err() == nil {
+				values, err := client.BLPop(redisInboundPopTimeout, conf.Key).Result()
+				if err == redis.Nil {
+					continue
+				}
+				if err != nil {
+					LogError.Error("redis inbound error: " + err.Error())
+					select {
+					case <-ctx.Done():
+					case <-time.After(redisInboundPopTimeout):
+					}
+					continue
+				}
+
+				// the request taken during shutdown is put back for other instances.
+				if ctx.Err() != nil || isShuttingDown() {
+					if err := client.LPush(conf.Key, values[1]).Err(); err != nil {
+						LogError.Error("redis inbound release error: " + err.Error())
+					}
+					return
+				}
+
+				consumeInbound(ctx, []byte(values[1]), publish)
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		client.Close()
+	}()
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnknownInboundEngine(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Inbound.Engine = "kafka"
+
+	assert.Error(t, InitInbound())
+}
+
+func TestInboundConnectError(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Inbound.Engine = "nats"
+	PushConf.Inbound.NATS.URL = "nats://nats:4200"
+	assert.Error(t, InitInbound())
+
+	PushConf.Inbound.Engine = "redis"
+	PushConf.Inbound.Redis.Addr = "redis:6370"
+	assert.Error(t, InitInbound())
+}
+
+func TestHandleInbound(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	// no worker consumes the queue, dry run never enqueue.
+	InitWorkers(0, 1)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	result := handleInbound(context.Background(), []byte(`{"id":"1234","dry_run":true,"notifications":[{"tokens":["aaaaa","bbbbb"],"platform":2,"message":"Welcome"}]}`))
+	assert.Equal(t, "1234", result.ID)
+	assert.Equal(t, "ok", result.Success)
+	assert.Equal(t, 2, result.Counts)
+	assert.Equal(t, 2, len(result.Logs))
+	assert.Equal(t, DryRunPush, result.Logs[0].Type)
+	assert.Empty(t, result.Error)
+
+	result = handleInbound(context.Background(), []byte(`{"id":"1234","notifications":[]}`))
+	assert.Equal(t, "Notifications field is empty.", result.Error)
+
+	result = handleInbound(context.Background(), []byte(`{"notifications":[{"tokens":["aaaaa"],"platform":9,"message":"Welcome"}]}`))
+	assert.Contains(t, result.Error, "platform")
+
+	result = handleInbound(context.Background(), []byte(`{"notifications":`))
+	assert.Contains(t, result.Error, "Invalid push request")
+}
+
+func TestConsumeInboundResult(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+
+	var published []byte
+	consumeInbound(context.Background(), []byte(`{"id":"1234","notifications":[]}`), func(data []byte) error {
+		published = data
+		return nil
+	})
+
+	var result InboundResult
+	assert.NoError(t, json.Unmarshal(published, &result))
+	assert.Equal(t, "1234", result.ID)
+	assert.Equal(t, "Notifications field is empty.", result.Error)
+}
@@ -0,0 +1,294 @@
+package gorush
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InvalidTokenKey is key name of invalid tokens saved in storage.
+const InvalidTokenKey = "gorush-invalid-tokens"
+
+const (
+	// invalidTokenFlushDelay batches the invalid tokens reported together
+	// into one storage write.
+	invalidTokenFlushDelay = time.Second
+	// invalidTokenPageSize is the default number of tokens per page.
+	invalidTokenPageSize = 100
+	// invalidTokenMaxPageSize is the max number of tokens per page.
+	invalidTokenMaxPageSize = 1000
+)
+
+// InvalidToken is the device token rejected by provider permanently, it
+// should be removed from the database of app server. UnregisteredAt is the
+// time the token became invalid reported by provider, e.g. APNs Unregistered,
+// the token registered again after it is still valid.
+type InvalidToken struct {
+	Token          string `json:"token"`
+	Platform       string `json:"platform"`
+	Reason         string `json:"reason"`
+	Timestamp      int64  `json:"timestamp"`
+	UnregisteredAt int64  `json:"unregistered_at,omitempty"`
+}
+
+// unregisteredError is the error of token unregistered from device at the
+// time, e.g. the 410 response of APNs.
+type unregisteredError struct {
+	reason string
+	at     time.Time
+}
+
+func (e *unregisteredError) Error() string { return e.reason }
+
+// unregisteredAt return the unix time the token became invalid, zero if the
+// provider doesn't report it.
+func unregisteredAt(err error) int64 {
+	if e, ok := err.(*unregisteredError); ok && !e.at.IsZero() {
+		return e.at.Unix()
+	}
+
+	return 0
+}
+
+// invalidTokenStore keeps the reported invalid tokens in memory and saves
+// them to storage. The least recently reported token is evicted if the
+// number of tokens exceeds max.
+type invalidTokenStore struct {
+	sync.Mutex
+	max      int
+	order    *list.List // front is the most recently reported token
+	tokens   map[string]*list.Element
+	flushing bool
+}
+
+// invalidTokens is nil if max_invalid_token is zero.
+var invalidTokens *invalidTokenStore
+
+// InitInvalidTokens load the invalid tokens saved in storage.
+func InitInvalidTokens() {
+	if PushConf.Core.MaxInvalidToken <= 0 {
+		invalidTokens = nil
+		return
+	}
+
+	invalidTokens = newInvalidTokenStore(PushConf.Core.MaxInvalidToken)
+
+	data := StatStorage.GetData(InvalidTokenKey)
+	if len(data) == 0 {
+		return
+	}
+
+	var saved []InvalidToken
+	if err := json.Unmarshal(data, &saved); err != nil {
+		LogError.Error("load invalid tokens error: " + err.Error())
+		return
+	}
+
+	// saved from the most recent one.
+	for i := len(saved) - 1; i >= 0; i-- {
+		invalidTokens.put(saved[i])
+	}
+}
+
+func newInvalidTokenStore(max int) *invalidTokenStore {
+	return &invalidTokenStore{
+		max:    max,
+		order:  list.New(),
+		tokens: make(map[string]*list.Element),
+	}
+}
+
+func invalidTokenKey(platform, token string) string {
+	return platform + ":" + token
+}
+
+// put add or refresh the token without saving to storage.
+func (s *invalidTokenStore) put(token InvalidToken) {
+	key := invalidTokenKey(token.Platform, token.Token)
+	if e, ok := s.tokens[key]; ok {
+		e.Value = token
+		s.order.MoveToFront(e)
+		return
+	}
+
+	s.tokens[key] = s.order.PushFront(token)
+
+	for s.order.Len() > s.max {
+		oldest := s.order.Back()
+		t := oldest.Value.(InvalidToken)
+		delete(s.tokens, invalidTokenKey(t.Platform, t.Token))
+		s.order.Remove(oldest)
+	}
+}
+
+// add record the token, it is saved to storage after flush delay.
+func (s *invalidTokenStore) add(token InvalidToken) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.put(token)
+
+	if !s.flushing {
+		s.flushing = true
+		time.AfterFunc(invalidTokenFlushDelay, s.flush)
+	}
+}
+
+// list return the total number of tokens and one page of tokens from the
+// most recent one.
+func (s *invalidTokenStore) list(offset, limit int) (int, []InvalidToken) {
+	s.Lock()
+	defer s.Unlock()
+
+	tokens := []InvalidToken{}
+	i := 0
+	for e := s.order.Front(); e != nil && len(tokens) < limit; e = e.Next() {
+		if i >= offset {
+			tokens = append(tokens, e.Value.(InvalidToken))
+		}
+		i++
+	}
+
+	return s.order.Len(), tokens
+}
+
+// clear remove the tokens reported at or before the timestamp, all tokens
+// are removed if before is zero. It return the number of removed tokens.
+func (s *invalidTokenStore) clear(before int64) int {
+	s.Lock()
+	removed := 0
+	for e := s.order.Back(); e != nil; {
+		prev := e.Prev()
+		t := e.Value.(InvalidToken)
+		if before == 0 || t.Timestamp <= before {
+			delete(s.tokens, invalidTokenKey(t.Platform, t.Token))
+			s.order.Remove(e)
+			removed++
+		}
+		e = prev
+	}
+	s.Unlock()
+
+	s.flush()
+
+	return removed
+}
+
+// flush save all tokens to storage.
+func (s *invalidTokenStore) flush() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.flushing = false
+
+	tokens := make([]InvalidToken, 0, s.order.Len())
+	for e := s.order.Front(); e != nil; e = e.Next() {
+		tokens = append(tokens, e.Value.(InvalidToken))
+	}
+
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		LogError.Error("save invalid tokens error: " + err.Error())
+		return
+	}
+
+	StatStorage.SetData(InvalidTokenKey, data)
+}
+
+// flushInvalidTokens save the invalid tokens not saved yet on shutdown.
+func flushInvalidTokens() {
+	if invalidTokens != nil {
+		invalidTokens.flush()
+	}
+}
+
+// invalidateToken report the token which is rejected by provider permanently.
+func invalidateToken(to string, req PushNotification, errPush error) {
+	req.accessLog().Info(fmt.Sprintf("Invalid %s token: %s, error: %s", typeForPlatForm(req.Platform), to, errPush.Error()))
+	addFeedback(InvalidTokenPush, to, req, errPush, "")
+	appStats.add(req.App, InvalidTokenPush)
+	recordInvalidToken(to, req.Platform, errPush)
+}
+
+// recordInvalidToken keep the token for invalid tokens API.
+func recordInvalidToken(to string, platform int, errPush error) {
+	if invalidTokens == nil {
+		return
+	}
+
+	invalidTokens.add(InvalidToken{
+		Token:          to,
+		Platform:       typeForPlatForm(platform),
+		Reason:         errPush.Error(),
+		Timestamp:      time.Now().Unix(),
+		UnregisteredAt: unregisteredAt(errPush),
+	})
+}
+
+// queryInt return the non-negative integer of query, def if it is empty.
+func queryInt(c *gin.Context, key string, def int) (int, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return def, true
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+func invalidTokensHandler(c *gin.Context) {
+	offset, ok := queryInt(c, "offset", 0)
+	if !ok {
+		abortWithError(c, http.StatusBadRequest, "offset must be a non-negative integer")
+		return
+	}
+
+	limit, ok := queryInt(c, "limit", invalidTokenPageSize)
+	if !ok || limit == 0 {
+		abortWithError(c, http.StatusBadRequest, "limit must be a positive integer")
+		return
+	}
+	if limit > invalidTokenMaxPageSize {
+		limit = invalidTokenMaxPageSize
+	}
+
+	total, tokens := 0, []InvalidToken{}
+	if invalidTokens != nil {
+		total, tokens = invalidTokens.list(offset, limit)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":  total,
+		"offset": offset,
+		"limit":  limit,
+		"tokens": tokens,
+	})
+}
+
+func clearInvalidTokensHandler(c *gin.Context) {
+	before, err := strconv.ParseInt(c.DefaultQuery("before", "0"), 10, 64)
+	if err != nil || before < 0 {
+		abortWithError(c, http.StatusBadRequest, "before must be a unix timestamp")
+		return
+	}
+
+	removed := 0
+	if invalidTokens != nil {
+		removed = invalidTokens.clear(before)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+		"removed": removed,
+	})
+}
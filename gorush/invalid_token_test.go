@@ -0,0 +1,165 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gofight/v2"
+	"github.com/sideshow/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvalidTokenStore(t *testing.T) {
+	store := newInvalidTokenStore(2)
+
+	store.put(InvalidToken{Token: "aaaaa", Platform: "ios", Timestamp: 1})
+	store.put(InvalidToken{Token: "bbbbb", Platform: "ios", Timestamp: 2})
+	// the reported token becomes most recent.
+	store.put(InvalidToken{Token: "aaaaa", Platform: "ios", Timestamp: 3})
+	// least recently reported token is evicted.
+	store.put(InvalidToken{Token: "ccccc", Platform: "android", Timestamp: 4})
+
+	total, tokens := store.list(0, 10)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []InvalidToken{
+		{Token: "ccccc", Platform: "android", Timestamp: 4},
+		{Token: "aaaaa", Platform: "ios", Timestamp: 3},
+	}, tokens)
+
+	_, tokens = store.list(1, 10)
+	assert.Equal(t, "aaaaa", tokens[0].Token)
+	_, tokens = store.list(2, 10)
+	assert.Equal(t, 0, len(tokens))
+
+	assert.Equal(t, 1, store.clear(3))
+	total, _ = store.list(0, 10)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, 1, store.clear(0))
+}
+
+func TestInitInvalidTokens(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	StatStorage.Del(InvalidTokenKey)
+	InitInvalidTokens()
+	defer func() {
+		StatStorage.Del(InvalidTokenKey)
+		invalidTokens = nil
+	}()
+
+	invalidateToken("aaaaa", PushNotification{Platform: PlatFormAndroid}, fcm.ErrNotRegistered)
+	recordInvalidToken("https://push.example.com/1", PlatFormWeb, errWebSubscriptionExpired)
+	flushInvalidTokens()
+
+	// reload from storage.
+	InitInvalidTokens()
+	total, tokens := invalidTokens.list(0, 10)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "web", tokens[0].Platform)
+	assert.Equal(t, "aaaaa", tokens[1].Token)
+	assert.Equal(t, "android", tokens[1].Platform)
+	assert.Equal(t, fcm.ErrNotRegistered.Error(), tokens[1].Reason)
+
+	PushConf.Core.MaxInvalidToken = 0
+	InitInvalidTokens()
+	assert.Nil(t, invalidTokens)
+	recordInvalidToken("aaaaa", PlatFormIos, errors.New("Unregistered"))
+}
+
+func TestInvalidTokensHandler(t *testing.T) {
+	initTest()
+	invalidTokens = newInvalidTokenStore(10)
+	defer func() {
+		StatStorage.Del(InvalidTokenKey)
+		invalidTokens = nil
+	}()
+
+	now := time.Now().Unix()
+	invalidTokens.put(InvalidToken{Token: "aaaaa", Platform: "ios", Reason: "Unregistered", Timestamp: now - 10})
+	invalidTokens.put(InvalidToken{Token: "bbbbb", Platform: "android", Reason: "unregistered device", Timestamp: now})
+
+	r := gofight.New()
+	r.GET("/api/invalid-tokens?limit=1").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			var res struct {
+				Total  int            `json:"total"`
+				Limit  int            `json:"limit"`
+				Tokens []InvalidToken `json:"tokens"`
+			}
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &res))
+			assert.Equal(t, 2, res.Total)
+			assert.Equal(t, 1, res.Limit)
+			assert.Equal(t, []InvalidToken{{Token: "bbbbb", Platform: "android", Reason: "unregistered device", Timestamp: now}}, res.Tokens)
+		})
+
+	r.GET("/api/invalid-tokens?offset=-1").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+
+	r.DELETE("/api/invalid-tokens?before=abc").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+
+	// remove the tokens polled before.
+	r.DELETE("/api/invalid-tokens?before="+strconv.FormatInt(now-5, 10)).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.JSONEq(t, `{"success":"ok","removed":1}`, r.Body.String())
+		})
+
+	r.DELETE("/api/invalid-tokens").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.JSONEq(t, `{"success":"ok","removed":1}`, r.Body.String())
+		})
+
+	total, _ := invalidTokens.list(0, 10)
+	assert.Equal(t, 0, total)
+}
+
+func TestIsInvalidAPNsReason(t *testing.T) {
+	assert.True(t, isInvalidAPNsReason(apns2.ReasonUnregistered))
+	assert.True(t, isInvalidAPNsReason(apns2.ReasonBadDeviceToken))
+	assert.False(t, isInvalidAPNsReason(apns2.ReasonDeviceTokenNotForTopic))
+}
+
+func TestUnregisteredToken(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	invalidTokens = newInvalidTokenStore(10)
+	QueueFeedback = make(chan FeedbackResult, 2)
+	defer func() {
+		StatStorage.Del(InvalidTokenKey)
+		invalidTokens = nil
+		QueueFeedback = nil
+	}()
+
+	at := time.Unix(1600000000, 0)
+	res := &apns2.Response{StatusCode: 410, Reason: apns2.ReasonUnregistered}
+	res.Timestamp.Time = at
+	err := apnsError(res)
+	assert.Equal(t, apns2.ReasonUnregistered, err.Error())
+	assert.Equal(t, at.Unix(), unregisteredAt(err))
+
+	invalidateToken("aaaaa", PushNotification{Platform: PlatFormIos}, err)
+	_, tokens := invalidTokens.list(0, 10)
+	assert.Equal(t, at.Unix(), tokens[0].UnregisteredAt)
+	feedback := <-QueueFeedback
+	assert.Equal(t, InvalidTokenPush, feedback.Type)
+	assert.Equal(t, at.Unix(), feedback.UnregisteredAt)
+
+	// the time is unknown for the other errors.
+	err = apnsError(&apns2.Response{StatusCode: 400, Reason: apns2.ReasonBadDeviceToken})
+	assert.Equal(t, int64(0), unregisteredAt(err))
+	invalidateToken("bbbbb", PushNotification{Platform: PlatFormIos}, err)
+	_, tokens = invalidTokens.list(0, 10)
+	assert.Equal(t, int64(0), tokens[0].UnregisteredAt)
+	assert.Equal(t, int64(0), (<-QueueFeedback).UnregisteredAt)
+}
@@ -0,0 +1,152 @@
+package gorush
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseIPNets parse the comma separated IPs or CIDRs of config, the single
+// IP is the network of its own.
+func parseIPNets(list string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %s", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s", item)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// checkIPFilter validate the IP lists of config before server starts.
+func checkIPFilter() error {
+	lists := []struct {
+		name  string
+		value string
+	}{
+		{"core.allowed_ips", PushConf.Core.AllowedIPs},
+		{"core.denied_ips", PushConf.Core.DeniedIPs},
+		{"core.metric_allowed_ips", PushConf.Core.MetricAllowedIPs},
+		{"core.health_allowed_ips", PushConf.Core.HealthAllowedIPs},
+		{"core.trusted_proxies", PushConf.Core.TrustedProxies},
+	}
+
+	for _, list := range lists {
+		if _, err := parseIPNets(list.value); err != nil {
+			return fmt.Errorf("%s: %s", list.name, err)
+		}
+	}
+
+	return nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterClientIP return the IP of client, X-Forwarded-For is only used if the
+// request comes from trusted proxies. The addresses of header are walked from
+// the right and the first one not of trusted proxies is the client, so the
+// spoofed addresses added by client are ignored.
+func filterClientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(r.RemoteAddr)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(trusted, ip) {
+		return ip
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(trusted, hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// TrustedProxyMiddleware replace the remote address of request forwarded by
+// core.trusted_proxies with the client IP of X-Forwarded-For, so c.ClientIP()
+// of rate limiter, logs and IP filter is the real client.
+func TrustedProxyMiddleware() gin.HandlerFunc {
+	trusted, _ := parseIPNets(PushConf.Core.TrustedProxies)
+
+	return func(c *gin.Context) {
+		if ip := filterClientIP(c.Request, trusted); ip != nil {
+			_, port, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+			if err != nil {
+				port = "0"
+			}
+			c.Request.RemoteAddr = net.JoinHostPort(ip.String(), port)
+		}
+
+		c.Next()
+	}
+}
+
+// IPFilterMiddleware reject the client IP of core.denied_ips, or not in
+// allowed list if it isn't empty, with 403.
+func IPFilterMiddleware(allowed string) gin.HandlerFunc {
+	// the lists are validated by checkIPFilter before server starts.
+	allowedNets, _ := parseIPNets(allowed)
+	deniedNets, _ := parseIPNets(PushConf.Core.DeniedIPs)
+
+	return func(c *gin.Context) {
+		ip := net.ParseIP(c.ClientIP())
+		if (ip != nil && containsIP(deniedNets, ip)) ||
+			(len(allowedNets) > 0 && (ip == nil || !containsIP(allowedNets, ip))) {
+			abortWithError(c, http.StatusForbidden, "Client IP is not allowed.")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ipFilters return the middleware of allowed list if any IP list is set.
+func ipFilters(allowed string) []gin.HandlerFunc {
+	if allowed == "" && PushConf.Core.DeniedIPs == "" {
+		return nil
+	}
+
+	return []gin.HandlerFunc{IPFilterMiddleware(allowed)}
+}
@@ -0,0 +1,120 @@
+package gorush
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func ipFilterRequest(path, remoteAddr, forwardedFor string) int {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+
+	w := httptest.NewRecorder()
+	routerEngine().ServeHTTP(w, req)
+
+	return w.Code
+}
+
+func TestParseIPNets(t *testing.T) {
+	nets, err := parseIPNets("10.0.0.0/8, 192.168.1.1,::1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(nets))
+	assert.Equal(t, "192.168.1.1/32", nets[1].String())
+	assert.Equal(t, "::1/128", nets[2].String())
+
+	_, err = parseIPNets("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = parseIPNets("localhost")
+	assert.Error(t, err)
+}
+
+func TestCheckIPFilter(t *testing.T) {
+	initTest()
+	assert.NoError(t, checkIPFilter())
+
+	PushConf.Core.TrustedProxies = "10.0.0.1, proxy"
+	err := checkIPFilter()
+	assert.Error(t, err)
+	assert.Equal(t, "core.trusted_proxies: invalid IP proxy", err.Error())
+}
+
+func TestFilterClientIP(t *testing.T) {
+	trusted, _ := parseIPNets("10.0.0.0/8")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "10.1.1.1")
+	// the header of untrusted client is ignored.
+	assert.Equal(t, "192.0.2.1", filterClientIP(req, trusted).String())
+
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "10.1.1.1, 198.51.100.1, 10.0.0.2")
+	assert.Equal(t, "198.51.100.1", filterClientIP(req, trusted).String())
+
+	req.Header.Set("X-Forwarded-For", "10.0.0.3")
+	assert.Equal(t, "10.0.0.3", filterClientIP(req, trusted).String())
+
+	req.Header.Del("X-Forwarded-For")
+	assert.Equal(t, "10.0.0.1", filterClientIP(req, trusted).String())
+}
+
+func TestIPFilterMiddleware(t *testing.T) {
+	initTest()
+	PushConf.Core.AllowedIPs = "10.0.0.0/8"
+	PushConf.Core.DeniedIPs = "10.0.0.66"
+	PushConf.Core.TrustedProxies = "172.16.0.1"
+
+	assert.Equal(t, http.StatusOK, ipFilterRequest("/api/version", "10.1.2.3:1234", ""))
+	assert.Equal(t, http.StatusForbidden, ipFilterRequest("/api/version", "192.0.2.1:1234", ""))
+	assert.Equal(t, http.StatusForbidden, ipFilterRequest("/api/version", "10.0.0.66:1234", ""))
+	// client IP forwarded by trusted proxy.
+	assert.Equal(t, http.StatusOK, ipFilterRequest("/api/version", "172.16.0.1:1234", "10.1.2.3"))
+	assert.Equal(t, http.StatusForbidden, ipFilterRequest("/api/version", "172.16.0.1:1234", "192.0.2.1"))
+	assert.Equal(t, http.StatusForbidden, ipFilterRequest("/api/version", "192.0.2.1:1234", "10.1.2.3"))
+
+	// metrics and health have own allowed list.
+	assert.Equal(t, http.StatusOK, ipFilterRequest(PushConf.API.MetricURI, "192.0.2.1:1234", ""))
+	assert.Equal(t, http.StatusOK, ipFilterRequest(PushConf.API.HealthURI, "192.0.2.1:1234", ""))
+	assert.Equal(t, http.StatusForbidden, ipFilterRequest(PushConf.API.HealthURI, "10.0.0.66:1234", ""))
+
+	PushConf.Core.MetricAllowedIPs = "192.0.2.0/24"
+	PushConf.Core.HealthAllowedIPs = "198.51.100.1"
+	assert.Equal(t, http.StatusOK, ipFilterRequest(PushConf.API.MetricURI, "192.0.2.1:1234", ""))
+	assert.Equal(t, http.StatusForbidden, ipFilterRequest(PushConf.API.MetricURI, "10.1.2.3:1234", ""))
+	assert.Equal(t, http.StatusForbidden, ipFilterRequest(PushConf.API.HealthURI, "192.0.2.1:1234", ""))
+	assert.Equal(t, http.StatusOK, ipFilterRequest(PushConf.API.HealthURI, "198.51.100.1:1234", ""))
+}
+
+func TestTrustedProxyMiddleware(t *testing.T) {
+	initTest()
+
+	var clientIP string
+	handler := func(remoteAddr, forwardedFor string) {
+		r := routerEngine()
+		r.GET("/client-ip", func(c *gin.Context) {
+			clientIP = c.ClientIP()
+		})
+
+		req := httptest.NewRequest("GET", "/client-ip", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// nothing is trusted by default.
+	handler("172.16.0.1:1234", "198.51.100.1")
+	assert.Equal(t, "172.16.0.1", clientIP)
+
+	PushConf.Core.TrustedProxies = "172.16.0.0/12"
+	handler("172.16.0.1:1234", "198.51.100.1")
+	assert.Equal(t, "198.51.100.1", clientIP)
+	handler("192.0.2.1:1234", "198.51.100.1")
+	assert.Equal(t, "192.0.2.1", clientIP)
+}
@@ -0,0 +1,145 @@
+package gorush
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// JobKeyPrefix is key prefix of async push job in storage
+const JobKeyPrefix = "gorush-job-"
+
+// JobExpireKey is key prefix of the IDs of jobs expiring in the minute, the
+// unix minute is appended.
+const JobExpireKey = "gorush-job-expire:"
+
+// JobSweptKey is key name of the last unix minute whose jobs are removed.
+const JobSweptKey = "gorush-job-swept"
+
+// jobSweepInterval is how often the expired jobs are removed from storage.
+const jobSweepInterval = time.Minute
+
+// jobExpiry index the jobs by the minute they expire, so the jobs nobody
+// polls are removed after job_ttl as well.
+var jobExpiry = &expiryIndex{
+	prefix:   JobExpireKey,
+	sweptKey: JobSweptKey,
+	remove:   deleteJob,
+}
+
+// jobSweepStop stop the sweeper of last InitJobSweeper.
+var jobSweepStop chan struct{}
+
+var jobFields = []string{"created", "queued", "dropped", "sent", "failed"}
+
+// JobStatus is the progress of async push job.
+type JobStatus struct {
+	ID      string `json:"job_id"`
+	Created int64  `json:"created_at"`
+	Queued  int64  `json:"queued"`
+	Dropped int64  `json:"dropped"`
+	Sent    int64  `json:"sent"`
+	Failed  int64  `json:"failed"`
+}
+
+func jobKey(id, field string) string {
+	return JobKeyPrefix + id + "-" + field
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// createJob register new async push job in storage.
+func createJob(id string) {
+	for _, field := range jobFields[1:] {
+		StatStorage.Set(jobKey(id, field), 0)
+	}
+	now := time.Now().Unix()
+	StatStorage.Set(jobKey(id, "created"), now)
+	if PushConf.Core.JobTTL > 0 {
+		jobExpiry.add(id, now+PushConf.Core.JobTTL)
+	}
+}
+
+// InitJobSweeper start the sweeper removing expired jobs from storage.
+func InitJobSweeper() {
+	if jobSweepStop != nil {
+		close(jobSweepStop)
+	}
+	jobSweepStop = make(chan struct{})
+	go sweepJobs(jobSweepStop)
+}
+
+func sweepJobs(stop chan struct{}) {
+	ticker := time.NewTicker(jobSweepInterval)
+	defer ticker.Stop()
+
+	// the sweep goes on from the last minute swept before restart.
+	jobExpiry.sweep(time.Now().Unix())
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			jobExpiry.sweep(time.Now().Unix())
+		}
+	}
+}
+
+// deleteJob remove all keys of job from storage.
+func deleteJob(id string) {
+	for _, field := range jobFields {
+		StatStorage.Del(jobKey(id, field))
+	}
+}
+
+// getJob return status of job, the expired job is removed from storage.
+func getJob(id string) (JobStatus, bool) {
+	created := StatStorage.Get(jobKey(id, "created"))
+	if created == 0 {
+		return JobStatus{}, false
+	}
+
+	if PushConf.Core.JobTTL > 0 && time.Now().Unix()-created > PushConf.Core.JobTTL {
+		deleteJob(id)
+		return JobStatus{}, false
+	}
+
+	return JobStatus{
+		ID:      id,
+		Created: created,
+		Queued:  StatStorage.Get(jobKey(id, "queued")),
+		Dropped: StatStorage.Get(jobKey(id, "dropped")),
+		Sent:    StatStorage.Get(jobKey(id, "sent")),
+		Failed:  StatStorage.Get(jobKey(id, "failed")),
+	}, true
+}
+
+// runJob queue notifications of async push job and record queue result.
+func runJob(id string, req RequestPush) {
+	req.jobID = id
+	counts, logs := queueNotification(req)
+	dropped := countDropped(logs)
+	StatStorage.Add(jobKey(id, "queued"), int64(counts-dropped))
+	StatStorage.Add(jobKey(id, "dropped"), int64(dropped))
+}
+
+// addJobResult record push result of token for async push job.
+func addJobResult(status string, req PushNotification) {
+	if req.jobID == "" {
+		return
+	}
+
+	switch status {
+	case SucceededPush:
+		StatStorage.Add(jobKey(req.jobID, "sent"), 1)
+	case FailedPush:
+		StatStorage.Add(jobKey(req.jobID, "failed"), 1)
+	}
+}
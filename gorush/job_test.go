@@ -0,0 +1,153 @@
+package gorush
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/appleboy/gorush/storage/memory"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobStatus(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+
+	id, err := newJobID()
+	assert.NoError(t, err)
+	assert.Equal(t, 32, len(id))
+
+	_, ok := getJob(id)
+	assert.False(t, ok)
+
+	createJob(id)
+	addJobResult(SucceededPush, PushNotification{jobID: id})
+	addJobResult(SucceededPush, PushNotification{jobID: id})
+	addJobResult(FailedPush, PushNotification{jobID: id})
+	addJobResult(SucceededPush, PushNotification{})
+
+	job, ok := getJob(id)
+	assert.True(t, ok)
+	assert.Equal(t, id, job.ID)
+	assert.Equal(t, int64(2), job.Sent)
+	assert.Equal(t, int64(1), job.Failed)
+
+	// expired job is removed from storage.
+	StatStorage.Set(jobKey(id, "created"), time.Now().Unix()-PushConf.Core.JobTTL-1)
+	_, ok = getJob(id)
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), StatStorage.Get(jobKey(id, "sent")))
+}
+
+func TestSweepJobs(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.JobTTL = 60
+	StatStorage = memory.New()
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+	}()
+
+	now := time.Now().Unix()
+	jobExpiry.sweep(now)
+	createJob("never-polled")
+	assert.NotEqual(t, int64(0), StatStorage.Get(jobKey("never-polled", "created")))
+
+	jobExpiry.sweep(now + 30)
+	assert.NotEqual(t, int64(0), StatStorage.Get(jobKey("never-polled", "created")))
+
+	// the job is removed after job_ttl without polling its status.
+	jobExpiry.sweep(now + 180)
+	for _, field := range jobFields {
+		assert.Equal(t, int64(0), StatStorage.Get(jobKey("never-polled", field)))
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	// no worker consumes the queue.
+	InitWorkers(0, 1)
+
+	req := RequestPush{
+		Notifications: []PushNotification{
+			{
+				Tokens:   []string{"aaaaa", "bbbbb"},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+			},
+			{
+				Tokens:   []string{"ccccc"},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+			},
+		},
+	}
+
+	id, _ := newJobID()
+	createJob(id)
+	runJob(id, req)
+
+	job, ok := getJob(id)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), job.Queued)
+	assert.Equal(t, int64(1), job.Dropped)
+
+	notification := <-QueueNotification
+	assert.Equal(t, id, notification.jobID)
+
+	// restore default workers
+	PushConf, _ = config.LoadConf("")
+	InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+}
+
+func TestPushAsyncHandler(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+
+	r := gofight.New()
+
+	var id string
+	r.POST("/api/push/async").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"aaaaa"},
+					"platform": PlatFormIos,
+					"message":  "Welcome",
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			var data map[string]string
+			assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &data))
+			id = data["job_id"]
+
+			assert.Equal(t, http.StatusAccepted, r.Code)
+			assert.Equal(t, 32, len(id))
+		})
+
+	r.GET("/api/push/status/"+id).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			var job JobStatus
+			assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &job))
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, id, job.ID)
+		})
+
+	r.GET("/api/push/status/not-found").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusNotFound, r.Code)
+		})
+
+	r.POST("/api/push/async").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+}
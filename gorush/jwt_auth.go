@@ -0,0 +1,358 @@
+package gorush
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // register hash of HS256, RS256 and ES256
+	_ "crypto/sha512" // register hash of HS384, HS512, RS384, RS512, ES384 and ES512
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jwtHashes is the hash of JWT signing algorithm by key size suffix.
+var jwtHashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+// jwtVerifier verify the bearer token signed by shared secret (HS*) or by
+// private key of public key (RS* and ES*).
+type jwtVerifier struct {
+	secret []byte
+	key    crypto.PublicKey
+	scope  string
+}
+
+// errTokenExpired is the error of token after its exp claim.
+var errTokenExpired = errors.New("token is expired")
+
+// jwtAuth is nil if auth.jwt is disabled.
+var jwtAuth *jwtVerifier
+
+// InitJWTAuth load the secret and public key of auth.jwt.
+func InitJWTAuth() error {
+	conf := PushConf.Auth.JWT
+	if !conf.Enabled {
+		jwtAuth = nil
+		return nil
+	}
+
+	v := &jwtVerifier{scope: conf.Scope}
+	if conf.Secret != "" {
+		v.secret = []byte(conf.Secret)
+	}
+
+	if conf.PublicKey != "" {
+		data, err := ioutil.ReadFile(conf.PublicKey)
+		if err != nil {
+			return err
+		}
+		if v.key, err = parsePublicKey(data); err != nil {
+			return fmt.Errorf("parse public key of %s error: %v", conf.PublicKey, err)
+		}
+	}
+
+	if v.secret == nil && v.key == nil {
+		return errors.New("missing secret or public key of jwt auth")
+	}
+
+	jwtAuth = v
+
+	return nil
+}
+
+// parsePublicKey parse the RSA or ECDSA public key, or the key of certificate.
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var key crypto.PublicKey
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = cert.PublicKey
+	default:
+		var err error
+		if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	}
+
+	return nil, errors.New("public key isn't RSA or ECDSA")
+}
+
+// verify check the signature, exp, nbf and scope claim of token, the claims
+// are returned if token is valid.
+func (v *jwtVerifier) verify(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+
+	if err := v.verifySignature(header.Alg, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("missing exp claim")
+	}
+	if float64(now.Unix()) >= exp {
+		return nil, errTokenExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && float64(now.Unix()) < nbf {
+		return nil, errors.New("token is not valid yet")
+	}
+
+	if v.scope != "" && !hasScope(claims["scope"], v.scope) {
+		return nil, fmt.Errorf("missing %s scope", v.scope)
+	}
+
+	return claims, nil
+}
+
+func (v *jwtVerifier) verifySignature(alg, signed string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported %q algorithm", alg)
+	}
+	hash, ok := jwtHashes[alg[2:]]
+	if !ok {
+		return fmt.Errorf("unsupported %q algorithm", alg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "HS":
+		if v.secret == nil {
+			break
+		}
+		mac := hmac.New(hash.New, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case "RS":
+		key, ok := v.key.(*rsa.PublicKey)
+		if !ok {
+			break
+		}
+		if rsa.VerifyPKCS1v15(key, hash, digest, signature) != nil {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case "ES":
+		key, ok := v.key.(*ecdsa.PublicKey)
+		if !ok {
+			break
+		}
+		// signature is r and s of fixed size.
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported %q algorithm", alg)
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// hasScope reports whether the scope claim, space separated string or array
+// of strings, contains the scope.
+func hasScope(claim interface{}, scope string) bool {
+	var scopes []string
+	switch claim := claim.(type) {
+	case string:
+		scopes = strings.Fields(claim)
+	case []interface{}:
+		for _, s := range claim {
+			if s, ok := s.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bearerToken return the token of Authorization header with Bearer scheme.
+func bearerToken(c *gin.Context) (string, bool) {
+	auth := c.GetHeader("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return "", false
+	}
+
+	return strings.TrimSpace(auth[7:]), true
+}
+
+// countAuthFailure count the failed auth of request by reason, and log the
+// client IP for tracking brute force.
+func countAuthFailure(c *gin.Context, reason string) {
+	authFailureCounter.WithLabelValues(reason).Inc()
+	withRequestID(LogAccess, c.GetString(RequestIDKey)).Debugf("auth failure of %s from %s", reason, c.ClientIP())
+}
+
+// checkBasicAuth run basic auth and count the failure.
+func checkBasicAuth(c *gin.Context, basicAuth gin.HandlerFunc) {
+	basicAuth(c)
+	if c.IsAborted() {
+		// the reason doesn't tell whether the username exists.
+		reason := "invalid_credentials"
+		if c.GetHeader("Authorization") == "" {
+			reason = "missing_credentials"
+		}
+		countAuthFailure(c, reason)
+	}
+}
+
+// AuthMiddleware authenticate request by basic auth of auth.username or by
+// JWT bearer token of auth.jwt, either of them is accepted if both are enabled.
+func AuthMiddleware() gin.HandlerFunc {
+	var basicAuth gin.HandlerFunc
+	if PushConf.Auth.Enabled {
+		basicAuth = gin.BasicAuth(gin.Accounts{
+			PushConf.Auth.Username: PushConf.Auth.Password,
+		})
+	}
+	verifier := jwtAuth
+	jwtEnabled := PushConf.Auth.JWT.Enabled
+
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+		if !jwtEnabled || (!ok && basicAuth != nil) {
+			checkBasicAuth(c, basicAuth)
+			return
+		}
+
+		if verifier == nil {
+			// fail closed if jwt auth isn't initialized.
+			countAuthFailure(c, "jwt_not_initialized")
+			abortWithError(c, http.StatusUnauthorized, "Invalid bearer token: jwt auth is not initialized.")
+			return
+		}
+
+		claims, err := verifier.verify(token, time.Now())
+		if err != nil {
+			switch {
+			case !ok:
+				countAuthFailure(c, "missing_credentials")
+			case err == errTokenExpired:
+				countAuthFailure(c, "expired_token")
+			default:
+				countAuthFailure(c, "invalid_token")
+			}
+			withRequestID(LogAccess, c.GetString(RequestIDKey)).Debug("jwt auth error: " + err.Error())
+			c.Header("WWW-Authenticate", `Bearer realm="gorush"`)
+			abortWithError(c, http.StatusUnauthorized, "Invalid bearer token: "+err.Error()+".")
+			return
+		}
+
+		// rate limit is keyed by the subject as basic auth username.
+		if sub, ok := claims["sub"].(string); ok && sub != "" {
+			c.Set(gin.AuthUserKey, sub)
+		}
+	}
+}
+
+// MetricsAuthMiddleware authenticate metrics request by basic auth or bearer
+// token of api.metrics_auth instead of auth, either of them is accepted if
+// both are set. If none of them is set, only core.metric_allowed_ips limits
+// the metrics request.
+func MetricsAuthMiddleware() gin.HandlerFunc {
+	conf := PushConf.API.MetricsAuth
+	var basicAuth gin.HandlerFunc
+	if conf.Username != "" {
+		basicAuth = gin.BasicAuth(gin.Accounts{
+			conf.Username: conf.Password,
+		})
+	}
+
+	return func(c *gin.Context) {
+		if basicAuth == nil && conf.Token == "" {
+			return
+		}
+
+		token, ok := bearerToken(c)
+		if conf.Token == "" || (!ok && basicAuth != nil) {
+			checkBasicAuth(c, basicAuth)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(conf.Token)) != 1 {
+			reason := "invalid_token"
+			if !ok {
+				reason = "missing_credentials"
+			}
+			countAuthFailure(c, reason)
+			c.Header("WWW-Authenticate", `Bearer realm="gorush"`)
+			abortWithError(c, http.StatusUnauthorized, "Invalid bearer token.")
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package gorush
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/appleboy/gorush/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// signJWT sign the claims by HS256 secret, RS256 or ES256 private key.
+func signJWT(t *testing.T, alg string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	h := crypto.SHA256.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(crypto.SHA256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+		assert.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		assert.NoError(t, err)
+		// r and s are left padded to 32 bytes.
+		signature = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(signature[32-len(rb):32], rb)
+		copy(signature[64-len(sb):], sb)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// writePublicKey save the PKIX public key to temp file.
+func writePublicKey(t *testing.T, key interface{}) string {
+	data, err := x509.MarshalPKIXPublicKey(key)
+	assert.NoError(t, err)
+
+	file, err := ioutil.TempFile("", "gorush")
+	assert.NoError(t, err)
+	defer file.Close()
+	assert.NoError(t, pem.Encode(file, &pem.Block{Type: "PUBLIC KEY", Bytes: data}))
+
+	return file.Name()
+}
+
+func TestJWTVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Now()
+	claims := map[string]interface{}{"sub": "app", "exp": now.Add(time.Minute).Unix(), "scope": "push stat"}
+
+	v := &jwtVerifier{secret: []byte("secret"), key: &rsaKey.PublicKey, scope: "push"}
+	got, err := v.verify(signJWT(t, "HS256", []byte("secret"), claims), now)
+	assert.NoError(t, err)
+	assert.Equal(t, "app", got["sub"])
+	_, err = v.verify(signJWT(t, "RS256", rsaKey, claims), now)
+	assert.NoError(t, err)
+
+	_, err = v.verify(signJWT(t, "HS256", []byte("other"), claims), now)
+	assert.EqualError(t, err, "invalid token signature")
+	_, err = v.verify(signJWT(t, "ES256", ecKey, claims), now)
+	assert.EqualError(t, err, `unsupported "ES256" algorithm`)
+	_, err = v.verify(signJWT(t, "none", nil, claims), now)
+	assert.EqualError(t, err, `unsupported "none" algorithm`)
+	_, err = v.verify("abc", now)
+	assert.EqualError(t, err, "malformed token")
+
+	_, err = v.verify(signJWT(t, "HS256", []byte("secret"), claims), now.Add(time.Minute))
+	assert.EqualError(t, err, "token is expired")
+	_, err = v.verify(signJWT(t, "HS256", []byte("secret"), map[string]interface{}{"scope": "push"}), now)
+	assert.EqualError(t, err, "missing exp claim")
+	_, err = v.verify(signJWT(t, "HS256", []byte("secret"), map[string]interface{}{"exp": now.Add(time.Minute).Unix(), "nbf": now.Add(time.Second).Unix(), "scope": "push"}), now)
+	assert.EqualError(t, err, "token is not valid yet")
+	_, err = v.verify(signJWT(t, "HS256", []byte("secret"), map[string]interface{}{"exp": now.Add(time.Minute).Unix(), "scope": []string{"stat", "push"}}), now)
+	assert.NoError(t, err)
+	_, err = v.verify(signJWT(t, "HS256", []byte("secret"), map[string]interface{}{"exp": now.Add(time.Minute).Unix(), "scope": "stat"}), now)
+	assert.EqualError(t, err, "missing push scope")
+
+	// ECDSA public key from file.
+	path := writePublicKey(t, &ecKey.PublicKey)
+	defer os.Remove(path)
+	PushConf, _ = config.LoadConf("")
+	PushConf.Auth.JWT.Enabled = true
+	PushConf.Auth.JWT.PublicKey = path
+	assert.NoError(t, InitJWTAuth())
+	defer func() {
+		jwtAuth = nil
+	}()
+	_, err = jwtAuth.verify(signJWT(t, "ES256", ecKey, claims), now)
+	assert.NoError(t, err)
+	_, err = jwtAuth.verify(signJWT(t, "HS256", []byte("secret"), claims), now)
+	assert.EqualError(t, err, `unsupported "HS256" algorithm`)
+
+	PushConf.Auth.JWT.PublicKey = ""
+	assert.EqualError(t, InitJWTAuth(), "missing secret or public key of jwt auth")
+	PushConf.Auth.JWT.PublicKey = "../config/testdata/config.yml"
+	assert.Error(t, InitJWTAuth())
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	initTest()
+	PushConf.Auth.Enabled = true
+	PushConf.Auth.Username = "push"
+	PushConf.Auth.Password = "secret"
+	PushConf.Auth.JWT.Enabled = true
+	PushConf.Auth.JWT.Secret = "secret"
+	PushConf.Auth.JWT.Scope = "push"
+	assert.NoError(t, InitJWTAuth())
+	defer func() {
+		jwtAuth = nil
+	}()
+
+	token := signJWT(t, "HS256", []byte("secret"), map[string]interface{}{"exp": time.Now().Add(time.Minute).Unix(), "scope": "push"})
+	expired := signJWT(t, "HS256", []byte("secret"), map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix(), "scope": "push"})
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("push:secret"))
+
+	request := func(auth string) gofight.HTTPResponse {
+		var res gofight.HTTPResponse
+		gofight.New().GET("/api/version").
+			SetHeader(gofight.H{"Authorization": auth}).
+			Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+				res = r
+			})
+		return res
+	}
+
+	// both basic auth and jwt are accepted.
+	assert.Equal(t, http.StatusOK, request(basic).Code)
+	assert.Equal(t, http.StatusOK, request("Bearer "+token).Code)
+	assert.Equal(t, http.StatusUnauthorized, request("").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("Basic "+base64.StdEncoding.EncodeToString([]byte("push:push"))).Code)
+
+	res := request("Bearer " + expired)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, `Bearer realm="gorush"`, res.HeaderMap.Get("WWW-Authenticate"))
+	assert.JSONEq(t, `{"code":401,"message":"Invalid bearer token: token is expired."}`, res.Body.String())
+
+	// jwt only.
+	PushConf.Auth.Enabled = false
+	assert.Equal(t, http.StatusOK, request("Bearer "+token).Code)
+	assert.Equal(t, http.StatusUnauthorized, request(basic).Code)
+	assert.Equal(t, http.StatusUnauthorized, request("").Code)
+}
+
+func TestAuthFailureCounter(t *testing.T) {
+	initTest()
+	PushConf.Auth.Enabled = true
+	PushConf.Auth.Username = "push"
+	PushConf.Auth.Password = "secret"
+	PushConf.Auth.JWT.Enabled = true
+	PushConf.Auth.JWT.Secret = "secret"
+	assert.NoError(t, InitJWTAuth())
+	defer func() {
+		jwtAuth = nil
+	}()
+
+	expired := signJWT(t, "HS256", []byte("secret"), map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})
+	failures := func(reason string) float64 {
+		return testutil.ToFloat64(authFailureCounter.WithLabelValues(reason))
+	}
+	counts := map[string]float64{}
+	for _, reason := range []string{"missing_credentials", "invalid_credentials", "expired_token", "invalid_token"} {
+		counts[reason] = failures(reason)
+	}
+
+	r := gofight.New()
+	for _, auth := range []string{
+		"",
+		// unknown username and wrong password have the same reason.
+		"Basic " + base64.StdEncoding.EncodeToString([]byte("push:push")),
+		"Basic " + base64.StdEncoding.EncodeToString([]byte("admin:secret")),
+		"Bearer " + expired,
+		"Bearer invalid",
+		"Basic " + base64.StdEncoding.EncodeToString([]byte("push:secret")),
+	} {
+		r.GET("/api/version").
+			SetHeader(gofight.H{"Authorization": auth}).
+			Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {})
+	}
+
+	assert.Equal(t, counts["missing_credentials"]+1, failures("missing_credentials"))
+	assert.Equal(t, counts["invalid_credentials"]+2, failures("invalid_credentials"))
+	assert.Equal(t, counts["expired_token"]+1, failures("expired_token"))
+	assert.Equal(t, counts["invalid_token"]+1, failures("invalid_token"))
+
+	// the routes without auth are not counted.
+	r.GET(PushConf.API.HealthURI).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+	assert.Equal(t, counts["missing_credentials"]+1, failures("missing_credentials"))
+}
+
+func TestMetricsAuth(t *testing.T) {
+	initTest()
+	PushConf.Auth.Enabled = true
+	PushConf.Auth.Username = "push"
+	PushConf.Auth.Password = "secret"
+
+	push := "Basic " + base64.StdEncoding.EncodeToString([]byte("push:secret"))
+	scraper := "Basic " + base64.StdEncoding.EncodeToString([]byte("scraper:metrics"))
+	request := func(uri, auth string) int {
+		code := 0
+		gofight.New().GET(uri).
+			SetHeader(gofight.H{"Authorization": auth}).
+			Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+				code = r.Code
+			})
+		return code
+	}
+
+	// metrics shares the API auth by default.
+	assert.Equal(t, http.StatusOK, request(PushConf.API.MetricURI, push))
+	assert.Equal(t, http.StatusUnauthorized, request(PushConf.API.MetricURI, scraper))
+
+	// only the credentials of metrics_auth are accepted by metrics.
+	PushConf.API.MetricsAuth.Enabled = true
+	PushConf.API.MetricsAuth.Username = "scraper"
+	PushConf.API.MetricsAuth.Password = "metrics"
+	PushConf.API.MetricsAuth.Token = "scrape-token"
+	assert.Equal(t, http.StatusOK, request(PushConf.API.MetricURI, scraper))
+	assert.Equal(t, http.StatusOK, request(PushConf.API.MetricURI, "Bearer scrape-token"))
+	assert.Equal(t, http.StatusUnauthorized, request(PushConf.API.MetricURI, push))
+	assert.Equal(t, http.StatusUnauthorized, request(PushConf.API.MetricURI, "Bearer invalid"))
+	assert.Equal(t, http.StatusUnauthorized, request(PushConf.API.MetricURI, ""))
+	// the scraper can't push.
+	assert.Equal(t, http.StatusUnauthorized, request("/api/version", scraper))
+	assert.Equal(t, http.StatusOK, request("/api/version", push))
+
+	// token only.
+	PushConf.API.MetricsAuth.Username = ""
+	assert.Equal(t, http.StatusOK, request(PushConf.API.MetricURI, "Bearer scrape-token"))
+	assert.Equal(t, http.StatusUnauthorized, request(PushConf.API.MetricURI, scraper))
+
+	// without credentials, metrics is only limited by metric_allowed_ips.
+	PushConf.API.MetricsAuth.Token = ""
+	assert.Equal(t, http.StatusOK, request(PushConf.API.MetricURI, ""))
+	PushConf.Core.MetricAllowedIPs = "10.0.0.1"
+	assert.Equal(t, http.StatusForbidden, request(PushConf.API.MetricURI, ""))
+}
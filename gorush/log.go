@@ -1,11 +1,15 @@
 package gorush
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mattn/go-isatty"
@@ -30,15 +34,42 @@ type LogReq struct {
 	IP          string `json:"ip"`
 	ContentType string `json:"content_type"`
 	Agent       string `json:"agent"`
+	RequestID   string `json:"request_id,omitempty"`
+}
+
+// LogAccessEntry is http access log of json format
+type LogAccessEntry struct {
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Status    int     `json:"status"`
+	Latency   float64 `json:"latency_ms"`
+	ClientIP  string  `json:"client_ip"`
+	Size      int     `json:"size"`
+	RequestID string  `json:"request_id"`
 }
 
 // LogPushEntry is push response log
 type LogPushEntry struct {
-	Type     string `json:"type"`
-	Platform string `json:"platform"`
-	Token    string `json:"token"`
-	Message  string `json:"message"`
-	Error    string `json:"error"`
+	Type        string `json:"type"`
+	Platform    string `json:"platform"`
+	Token       string `json:"token"`
+	Message     string `json:"message"`
+	Error       string `json:"error"`
+	Outcome     string `json:"outcome,omitempty"`
+	PayloadSize int    `json:"payload_size,omitempty"`
+	Line        int    `json:"line,omitempty"`
+	RequestID   string `json:"request_id,omitempty"`
+	// ID is notif_id of notification, the results of iOS and Android
+	// notification of all platforms have the same id.
+	ID string `json:"notif_id,omitempty"`
+	// ApnsID is the apns-id returned by APNs, generated or echoed.
+	ApnsID string `json:"apns_id,omitempty"`
+	// StatusCode and Reason are the response of APNs, e.g. 400 and
+	// BadDeviceToken, so invalid token is told from invalid credential.
+	StatusCode int    `json:"status_code,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	// ScheduleID is the id of scheduled notification to cancel it.
+	ScheduleID string `json:"schedule_id,omitempty"`
 }
 
 var isTerm bool
@@ -56,14 +87,19 @@ func InitLog() error {
 	LogAccess = logrus.New()
 	LogError = logrus.New()
 
-	LogAccess.Formatter = &logrus.TextFormatter{
-		TimestampFormat: "2006/01/02 - 15:04:05",
-		FullTimestamp:   true,
-	}
+	if PushConf.Log.Format == "json" {
+		LogAccess.Formatter = &logrus.JSONFormatter{}
+		LogError.Formatter = &logrus.JSONFormatter{}
+	} else {
+		LogAccess.Formatter = &logrus.TextFormatter{
+			TimestampFormat: "2006/01/02 - 15:04:05",
+			FullTimestamp:   true,
+		}
 
-	LogError.Formatter = &logrus.TextFormatter{
-		TimestampFormat: "2006/01/02 - 15:04:05",
-		FullTimestamp:   true,
+		LogError.Formatter = &logrus.TextFormatter{
+			TimestampFormat: "2006/01/02 - 15:04:05",
+			FullTimestamp:   true,
+		}
 	}
 
 	// set logger
@@ -86,21 +122,29 @@ func InitLog() error {
 	return nil
 }
 
-// SetLogOut provide log stdout and stderr output
+// SetLogOut provide log stdout, stderr, syslog and file output, the file is
+// rotated by log.rotate config.
 func SetLogOut(log *logrus.Logger, outString string) error {
-	switch outString {
-	case "stdout":
+	switch {
+	case outString == "stdout":
 		log.Out = os.Stdout
-	case "stderr":
+	case outString == "stderr":
 		log.Out = os.Stderr
+	case outString == "none":
+		log.Out = ioutil.Discard
+	case outString == "syslog":
+		return setSyslogOut(log, "", "")
+	case strings.HasPrefix(outString, "syslog://"):
+		return setSyslogOut(log, "udp", strings.TrimPrefix(outString, "syslog://"))
+	case strings.HasPrefix(outString, "syslog+tcp://"):
+		return setSyslogOut(log, "tcp", strings.TrimPrefix(outString, "syslog+tcp://"))
 	default:
-		f, err := os.OpenFile(outString, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
-
+		w, err := newRotateWriter(outString, PushConf.Log.Rotate)
 		if err != nil {
 			return err
 		}
 
-		log.Out = f
+		log.Out = w
 	}
 
 	return nil
@@ -122,39 +166,39 @@ func SetLogLevel(log *logrus.Logger, levelString string) error {
 
 // LogRequest record http request
 func LogRequest(uri string, method string, ip string, contentType string, agent string) {
-	var output string
-	log := &LogReq{
+	logRequest(&LogReq{
 		URI:         uri,
 		Method:      method,
 		IP:          ip,
 		ContentType: contentType,
 		Agent:       agent,
-	}
+	})
+}
 
+func logRequest(log *LogReq) {
 	if PushConf.Log.Format == "json" {
-		logJSON, _ := json.Marshal(log)
-
-		output = string(logJSON)
-	} else {
-		var headerColor, resetColor string
+		LogAccess.WithFields(logFields(log)).Info("request")
+		return
+	}
 
-		if isTerm {
-			headerColor = magenta
-			resetColor = reset
-		}
+	var headerColor, resetColor string
 
-		// format is string
-		output = fmt.Sprintf("|%s header %s| %s %s %s %s %s",
-			headerColor, resetColor,
-			log.Method,
-			log.URI,
-			log.IP,
-			log.ContentType,
-			log.Agent,
-		)
+	if isTerm {
+		headerColor = magenta
+		resetColor = reset
 	}
 
-	LogAccess.Info(output)
+	// format is string
+	output := fmt.Sprintf("|%s header %s| %s %s %s %s %s",
+		headerColor, resetColor,
+		log.Method,
+		log.URI,
+		log.IP,
+		log.ContentType,
+		log.Agent,
+	)
+
+	withRequestID(LogAccess, log.RequestID).Info(output)
 }
 
 func colorForPlatForm(platform int) string {
@@ -163,6 +207,12 @@ func colorForPlatForm(platform int) string {
 		return blue
 	case PlatFormAndroid:
 		return yellow
+	case PlatFormWeb:
+		return magenta
+	case PlatFormHuawei:
+		return cyan
+	case PlatFormSNS:
+		return white
 	default:
 		return reset
 	}
@@ -174,6 +224,12 @@ func typeForPlatForm(platform int) string {
 		return "ios"
 	case PlatFormAndroid:
 		return "android"
+	case PlatFormWeb:
+		return "web"
+	case PlatFormHuawei:
+		return "huawei"
+	case PlatFormSNS:
+		return "sns"
 	default:
 		return ""
 	}
@@ -211,70 +267,177 @@ func getLogPushEntry(status, token string, req PushNotification, errPush error)
 	}
 
 	return LogPushEntry{
-		Type:     status,
-		Platform: plat,
-		Token:    token,
-		Message:  req.Message,
-		Error:    errMsg,
+		Type:      status,
+		Platform:  plat,
+		Token:     token,
+		Message:   req.Message,
+		Error:     errMsg,
+		RequestID: req.requestID,
+		ID:        req.ID,
 	}
 }
 
 // LogPush record user push request and server response.
 func LogPush(status, token string, req PushNotification, errPush error) {
+	logPush(req, getLogPushEntry(status, token, req, errPush), errPush)
+}
+
+// logPush write the push log entry by log format.
+func logPush(req PushNotification, log LogPushEntry, errPush error) {
 	var platColor, resetColor, output string
+	status := log.Type
+	countPushResult(req.Platform, status, errPush)
+	if status == FailedPush {
+		alerts.record(req.Platform, errPush)
+		recentErrors.add(log)
+	}
+
+	if PushConf.Log.Format == "json" {
+		fields := logFields(log)
+		switch status {
+		case SucceededPush:
+			LogAccess.WithFields(fields).Info("push")
+		case FailedPush:
+			LogError.WithFields(fields).Error("push")
+		}
+		return
+	}
 
 	if isTerm {
 		platColor = colorForPlatForm(req.Platform)
 		resetColor = reset
 	}
 
-	log := getLogPushEntry(status, token, req, errPush)
-
-	if PushConf.Log.Format == "json" {
-		logJSON, _ := json.Marshal(log)
+	var typeColor string
+	switch status {
+	case SucceededPush:
+		if isTerm {
+			typeColor = green
+		}
 
-		output = string(logJSON)
-	} else {
-		var typeColor string
-		switch status {
-		case SucceededPush:
-			if isTerm {
-				typeColor = green
-			}
-
-			output = fmt.Sprintf("|%s %s %s| %s%s%s [%s] %s",
-				typeColor, log.Type, resetColor,
-				platColor, log.Platform, resetColor,
-				log.Token,
-				log.Message,
-			)
-		case FailedPush:
-			if isTerm {
-				typeColor = red
-			}
-
-			output = fmt.Sprintf("|%s %s %s| %s%s%s [%s] | %s | Error Message: %s",
-				typeColor, log.Type, resetColor,
-				platColor, log.Platform, resetColor,
-				log.Token,
-				log.Message,
-				log.Error,
-			)
+		output = fmt.Sprintf("|%s %s %s| %s%s%s [%s] %s",
+			typeColor, log.Type, resetColor,
+			platColor, log.Platform, resetColor,
+			log.Token,
+			log.Message,
+		)
+	case FailedPush:
+		if isTerm {
+			typeColor = red
 		}
+
+		output = fmt.Sprintf("|%s %s %s| %s%s%s [%s] | %s | Error Message: %s",
+			typeColor, log.Type, resetColor,
+			platColor, log.Platform, resetColor,
+			log.Token,
+			log.Message,
+			log.Error,
+		)
+	}
+
+	if log.ApnsID != "" {
+		output += " | apns-id: " + log.ApnsID
+	}
+	if status == FailedPush && log.StatusCode != 0 {
+		output += fmt.Sprintf(" | status: %d reason: %s", log.StatusCode, log.Reason)
 	}
 
 	switch status {
 	case SucceededPush:
-		LogAccess.Info(output)
+		req.accessLog().Info(output)
 	case FailedPush:
-		LogError.Error(output)
+		req.errorLog().Error(output)
 	}
 }
 
+// withRequestID return the log entry with id of the request being handled,
+// so all lines of one request can be found by the id.
+func withRequestID(log *logrus.Logger, id string) *logrus.Entry {
+	entry := logrus.NewEntry(log)
+	if id != "" {
+		entry = entry.WithField(RequestIDKey, id)
+	}
+
+	return entry
+}
+
+// accessLog return the access log entry of notification.
+func (p *PushNotification) accessLog() *logrus.Entry {
+	return withRequestID(LogAccess, p.requestID)
+}
+
+// errorLog return the error log entry of notification.
+func (p *PushNotification) errorLog() *logrus.Entry {
+	return withRequestID(LogError, p.requestID)
+}
+
+// logFields convert log entry to structured fields of json log.
+func logFields(v interface{}) logrus.Fields {
+	fields := logrus.Fields{}
+	data, _ := json.Marshal(v)
+	_ = json.Unmarshal(data, &fields)
+
+	return fields
+}
+
 // LogMiddleware provide gin router handler.
 func LogMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		LogRequest(c.Request.URL.Path, c.Request.Method, c.ClientIP(), c.ContentType(), c.GetHeader("User-Agent"))
+		logRequest(&LogReq{
+			URI:         c.Request.URL.Path,
+			Method:      c.Request.Method,
+			IP:          c.ClientIP(),
+			ContentType: c.ContentType(),
+			Agent:       c.GetHeader("User-Agent"),
+			RequestID:   c.GetString(RequestIDKey),
+		})
 		c.Next()
 	}
 }
+
+// RequestIDMiddleware set the request id from X-Request-ID header, generate
+// new UUID if it is empty, and echo it in response header.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	// version 4 and variant bits of random UUID.
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// AccessLogMiddleware write access log of json format after request is served.
+func AccessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		c.Next()
+
+		LogAccess.WithFields(logFields(&LogAccessEntry{
+			Method:    c.Request.Method,
+			Path:      path,
+			Status:    c.Writer.Status(),
+			Latency:   float64(time.Since(start)) / float64(time.Millisecond),
+			ClientIP:  c.ClientIP(),
+			Size:      c.Writer.Size(),
+			RequestID: c.GetString(RequestIDKey),
+		})).Info("access")
+	}
+}
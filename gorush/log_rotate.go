@@ -0,0 +1,130 @@
+package gorush
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+)
+
+// rotateTimeFormat is the time of rotated log file name.
+const rotateTimeFormat = "20060102T150405.000"
+
+// rotateWriter append log to file, the file is renamed with the rotated time
+// when it exceeds max size. The rotated files older than max age or beyond
+// max backups are removed, zero is unlimited.
+type rotateWriter struct {
+	sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// newRotateWriter open the log file, it is never rotated if max size is zero.
+func newRotateWriter(path string, conf config.SectionLogRotate) (*rotateWriter, error) {
+	w := &rotateWriter{
+		path:       path,
+		maxSize:    int64(conf.MaxSize) * 1024 * 1024,
+		maxAge:     time.Duration(conf.MaxAge) * 24 * time.Hour,
+		maxBackups: conf.MaxBackups,
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *rotateWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.file, w.size = f, info.Size()
+
+	return nil
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+// rotate rename the log file and open a new one.
+func (w *rotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(w.path, w.backupName(time.Now())); err != nil {
+		return err
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.removeBackups()
+
+	return nil
+}
+
+// backupName return the name of rotated file, e.g. access-20200102T150405.000.log.
+func (w *rotateWriter) backupName(t time.Time) string {
+	ext := filepath.Ext(w.path)
+
+	return strings.TrimSuffix(w.path, ext) + "-" + t.Format(rotateTimeFormat) + ext
+}
+
+// removeBackups remove the rotated files beyond max backups or max age.
+func (w *rotateWriter) removeBackups() {
+	if w.maxBackups <= 0 && w.maxAge <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(w.path)
+	backups, err := filepath.Glob(strings.TrimSuffix(w.path, ext) + "-*" + ext)
+	if err != nil {
+		return
+	}
+
+	// the time of name is sorted from the most recent one.
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	cutoff := time.Now().Add(-w.maxAge)
+	for i, backup := range backups {
+		info, err := os.Stat(backup)
+		if err != nil {
+			continue
+		}
+
+		if (w.maxBackups > 0 && i >= w.maxBackups) || (w.maxAge > 0 && info.ModTime().Before(cutoff)) {
+			_ = os.Remove(backup)
+		}
+	}
+}
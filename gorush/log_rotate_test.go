@@ -0,0 +1,67 @@
+package gorush
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorush")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	w, err := newRotateWriter(path, config.SectionLogRotate{MaxSize: 1, MaxBackups: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024*1024), w.maxSize)
+	w.maxSize = 10
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		_, err = w.Write([]byte(line))
+		assert.NoError(t, err)
+		// the rotated files have different names.
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "line 4\n", string(data))
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "access-*.log"))
+	assert.Equal(t, 2, len(backups))
+	data, err = ioutil.ReadFile(backups[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "line 3\n", string(data))
+	assert.True(t, strings.HasSuffix(w.backupName(time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)), "access-20200102T150405.000.log"))
+}
+
+func TestRotateWriterMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorush")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "error.log")
+	old := filepath.Join(dir, "error-20200102T150405.000.log")
+	assert.NoError(t, ioutil.WriteFile(old, []byte("old\n"), 0644))
+	assert.NoError(t, os.Chtimes(old, time.Now().AddDate(0, 0, -2), time.Now().AddDate(0, 0, -2)))
+	assert.NoError(t, ioutil.WriteFile(path, []byte("line 1\n"), 0644))
+
+	w, err := newRotateWriter(path, config.SectionLogRotate{MaxAge: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), w.size)
+	w.maxSize = 10
+
+	_, err = w.Write([]byte("line 2\n"))
+	assert.NoError(t, err)
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "error-*.log"))
+	assert.Equal(t, 1, len(backups))
+	assert.NotEqual(t, old, backups[0])
+}
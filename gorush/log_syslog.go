@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package gorush
+
+import (
+	"io/ioutil"
+	"log/syslog"
+
+	"github.com/sirupsen/logrus"
+	lsyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+// setSyslogOut send log to syslog with the severity of log level, the local
+// syslog is used if network is empty.
+func setSyslogOut(log *logrus.Logger, network, addr string) error {
+	hook, err := lsyslog.NewSyslogHook(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, "gorush")
+	if err != nil {
+		return err
+	}
+
+	log.Hooks.Add(hook)
+	log.Out = ioutil.Discard
+
+	return nil
+}
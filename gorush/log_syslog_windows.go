@@ -0,0 +1,12 @@
+package gorush
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// setSyslogOut is not supported, there is no syslog on windows.
+func setSyslogOut(log *logrus.Logger, network, addr string) error {
+	return errors.New("syslog is not supported on windows")
+}
@@ -1,9 +1,21 @@
 package gorush
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/appleboy/gorush/config"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gofight/v2"
+	"github.com/buger/jsonparser"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -33,6 +45,15 @@ func TestSetLogOut(t *testing.T) {
 	// missing create logs folder.
 	err = SetLogOut(log, "logs/access.log")
 	assert.NotNil(t, err)
+
+	err = SetLogOut(log, "none")
+	assert.Nil(t, err)
+	assert.Equal(t, ioutil.Discard, log.Out)
+
+	// udp syslog doesn't connect to the server.
+	err = SetLogOut(log, "syslog://127.0.0.1:514")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(log.Hooks[logrus.ErrorLevel]))
 }
 
 func TestInitDefaultLog(t *testing.T) {
@@ -95,3 +116,132 @@ func TestHideToken(t *testing.T) {
 	assert.Equal(t, "**345678**", hideToken("1234567890", 2))
 	assert.Equal(t, "*****", hideToken("12345", 10))
 }
+
+func TestJSONAccessLog(t *testing.T) {
+	initTest()
+	PushConf.Log.Format = "json"
+	assert.Nil(t, InitLog())
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		_ = InitLog()
+	}()
+
+	var buf bytes.Buffer
+	LogAccess.Out = &buf
+
+	var id string
+	r := gofight.New()
+	r.GET("/api/version").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			id = r.HeaderMap.Get(RequestIDHeader)
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", id)
+		})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, id, entry["request_id"])
+
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "access", entry["msg"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/api/version", entry["path"])
+	assert.Equal(t, float64(http.StatusOK), entry["status"])
+	assert.Equal(t, id, entry["request_id"])
+	assert.Contains(t, entry, "latency_ms")
+	assert.Contains(t, entry, "client_ip")
+
+	// request id from client is kept.
+	gofight.New().GET("/api/version").
+		SetHeader(gofight.H{RequestIDHeader: "my-request-id"}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, "my-request-id", r.HeaderMap.Get(RequestIDHeader))
+		})
+}
+
+func TestJSONPushLog(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Log.Format = "json"
+	assert.Nil(t, InitLog())
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		_ = InitLog()
+	}()
+
+	var buf bytes.Buffer
+	LogError.Out = &buf
+
+	LogPush(FailedPush, "aaaaa", PushNotification{Platform: PlatFormAndroid, Message: "Welcome"}, errors.New("invalid token"))
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, FailedPush, entry["type"])
+	assert.Equal(t, "android", entry["platform"])
+	assert.Equal(t, "*****", entry["token"])
+	assert.Equal(t, "invalid token", entry["error"])
+}
+
+func TestStringAccessLog(t *testing.T) {
+	initTest()
+
+	gofight.New().GET("/api/version").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, 36, len(r.HeaderMap.Get(RequestIDHeader)))
+		})
+}
+
+func TestRequestIDPushLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"success":0,"failure":1,"results":[{"error":"MismatchSenderId"}]}`))
+	}))
+	defer server.Close()
+
+	initTest()
+	PushConf.Core.Sync = true
+	PushConf.API.PushURI = "/push"
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	FCMClient, _ = fcm.NewClient(PushConf.Android.APIKey,
+		fcm.WithEndpoint(server.URL),
+		fcm.WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+	)
+	defer func() {
+		FCMClient = nil
+		LogAccess.Out = os.Stdout
+		LogError.Out = os.Stdout
+	}()
+
+	var access, errs bytes.Buffer
+	LogAccess.Out = &access
+	LogError.Out = &errs
+
+	gofight.New().POST("/api/push").
+		SetHeader(gofight.H{RequestIDHeader: "campaign-42"}).
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"aaaaa"},
+					"platform": PlatFormAndroid,
+					"message":  "Welcome",
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, "campaign-42", r.HeaderMap.Get(RequestIDHeader))
+
+			id, _ := jsonparser.GetString(r.Body.Bytes(), "logs", "[0]", "request_id")
+			assert.Equal(t, "campaign-42", id)
+		})
+
+	assert.Contains(t, access.String(), "request_id=campaign-42")
+	assert.Contains(t, errs.String(), "request_id=campaign-42")
+	assert.Contains(t, errs.String(), "mismatched sender id")
+}
@@ -1,11 +1,250 @@
 package gorush
 
 import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/appleboy/go-fcm"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sideshow/apns2"
 )
 
 const namespace = "gorush_"
 
+// fcmRetryCounter counts retry attempts of transient FCM errors.
+var fcmRetryCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: namespace + "fcm_retry_total",
+		Help: "Number of FCM retry attempts",
+	},
+	[]string{"error"},
+)
+
+// rateLimitCounter counts requests rejected by rate limiter.
+var rateLimitCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: namespace + "rate_limit_rejected_total",
+		Help: "Number of requests rejected by rate limiter",
+	},
+)
+
+// authFailureCounter counts requests failed basic auth or JWT auth by reason.
+var authFailureCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: namespace + "auth_failures_total",
+		Help: "Number of requests failed auth by reason",
+	},
+	[]string{"reason"},
+)
+
+// expiredCounter counts recipients not sent since the notification is past
+// deadline_at when worker picks it up.
+var expiredCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: namespace + "expired_in_queue_total",
+		Help: "Number of recipients skipped by deadline of notification",
+	},
+	[]string{"platform"},
+)
+
+// feedbackRequestCounter counts feedback and callback requests by result,
+// which is success, failure or dropped when the buffer is full.
+var feedbackRequestCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: namespace + "feedback_requests_total",
+		Help: "Number of feedback and callback requests by result",
+	},
+	[]string{"kind", "result"},
+)
+
+// countFeedbackRequest count the result of feedback or callback request.
+func countFeedbackRequest(kind string, err error) {
+	if err != nil {
+		feedbackRequestCounter.WithLabelValues(kind, "failure").Inc()
+		return
+	}
+
+	feedbackRequestCounter.WithLabelValues(kind, "success").Inc()
+}
+
+// pushDuration measures time from worker picking up notification to provider
+// response, buckets are from 10ms to 10s.
+var pushDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    namespace + "push_duration_seconds",
+		Help:    "Duration from worker picking up notification to provider response",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	},
+	[]string{"platform", "outcome"},
+)
+
+// tokensPerNotification measures the number of recipients of each queued
+// notification, buckets are from 1 to 10000.
+var tokensPerNotification = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    namespace + "tokens_per_notification",
+		Help:    "Number of tokens targeted by each notification",
+		Buckets: []float64{1, 2, 5, 10, 50, 100, 500, 1000, 5000, 10000},
+	},
+	[]string{"platform"},
+)
+
+// pushSentCounter counts delivery results of each token by platform.
+var pushSentCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: namespace + "sent_total",
+		Help: "Number of push results by platform and status",
+	},
+	[]string{"platform", "status"},
+)
+
+// pushFailedCounter counts failed pushes by platform and normalized reason.
+var pushFailedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: namespace + "failed_total",
+		Help: "Number of failed pushes by platform and reason",
+	},
+	[]string{"platform", "reason"},
+)
+
+// enqueuedCounter counts notifications put into worker queues by platform.
+var enqueuedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: namespace + "notifications_enqueued_total",
+		Help: "Number of notifications put into worker queues",
+	},
+	[]string{"platform"},
+)
+
+// dequeuedCounter counts notifications taken from worker queues by platform.
+var dequeuedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: namespace + "notifications_dequeued_total",
+		Help: "Number of notifications taken from worker queues by workers",
+	},
+	[]string{"platform"},
+)
+
+// apnsReasons is the known error reasons of APNs response.
+var apnsReasons = map[string]bool{
+	apns2.ReasonBadCollapseID:               true,
+	apns2.ReasonBadDeviceToken:              true,
+	apns2.ReasonBadExpirationDate:           true,
+	apns2.ReasonBadMessageID:                true,
+	apns2.ReasonBadPriority:                 true,
+	apns2.ReasonBadTopic:                    true,
+	apns2.ReasonDeviceTokenNotForTopic:      true,
+	apns2.ReasonDuplicateHeaders:            true,
+	apns2.ReasonIdleTimeout:                 true,
+	apns2.ReasonMissingDeviceToken:          true,
+	apns2.ReasonMissingTopic:                true,
+	apns2.ReasonPayloadEmpty:                true,
+	apns2.ReasonTopicDisallowed:             true,
+	apns2.ReasonBadCertificate:              true,
+	apns2.ReasonBadCertificateEnvironment:   true,
+	apns2.ReasonExpiredProviderToken:        true,
+	apns2.ReasonForbidden:                   true,
+	apns2.ReasonInvalidProviderToken:        true,
+	apns2.ReasonMissingProviderToken:        true,
+	apns2.ReasonBadPath:                     true,
+	apns2.ReasonMethodNotAllowed:            true,
+	apns2.ReasonUnregistered:                true,
+	apns2.ReasonPayloadTooLarge:             true,
+	apns2.ReasonTooManyProviderTokenUpdates: true,
+	apns2.ReasonTooManyRequests:             true,
+	apns2.ReasonInternalServerError:         true,
+	apns2.ReasonServiceUnavailable:          true,
+	apns2.ReasonShutdown:                    true,
+}
+
+// fcmReasons is the error code of FCM errors.
+var fcmReasons = map[error]string{
+	fcm.ErrMissingRegistration:       "MissingRegistration",
+	fcm.ErrInvalidRegistration:       "InvalidRegistration",
+	fcm.ErrNotRegistered:             "NotRegistered",
+	fcm.ErrInvalidPackageName:        "InvalidPackageName",
+	fcm.ErrMismatchSenderID:          "MismatchSenderId",
+	fcm.ErrMessageTooBig:             "MessageTooBig",
+	fcm.ErrInvalidDataKey:            "InvalidDataKey",
+	fcm.ErrInvalidTTL:                "InvalidTtl",
+	fcm.ErrUnavailable:               "Unavailable",
+	fcm.ErrInternalServerError:       "InternalServerError",
+	fcm.ErrDeviceMessageRateExceeded: "DeviceMessageRateExceeded",
+	fcm.ErrTopicsMessageRateExceeded: "TopicsMessageRateExceeded",
+	fcm.ErrInvalidParameters:         "InvalidParameters",
+	fcm.ErrInvalidApnsCredential:     "InvalidApnsCredential",
+}
+
+// failureReason normalize the push error to provider error code, so label
+// cardinality is bounded, unknown error is counted as other.
+func failureReason(platform int, err error) string {
+	if err == errProviderUnavailable {
+		return "provider_unavailable"
+	}
+
+	switch platform {
+	case PlatFormIos:
+		if err != nil && apnsReasons[err.Error()] {
+			return err.Error()
+		}
+	case PlatFormAndroid:
+		if reason, ok := fcmReasons[err]; ok {
+			return reason
+		}
+	case PlatFormWeb:
+		if err == errWebSubscriptionExpired {
+			return "SubscriptionExpired"
+		}
+		if e, ok := err.(*webStatusError); ok {
+			if e.code >= 500 {
+				return "http_5xx"
+			}
+			return "http_4xx"
+		}
+	case PlatFormHuawei:
+		if err == errHMSInvalidToken {
+			return "InvalidToken"
+		}
+		if e, ok := err.(*hmsError); ok {
+			return e.code
+		}
+	case PlatFormSNS:
+		if e, ok := err.(*snsError); ok {
+			return e.code
+		}
+	}
+
+	if _, ok := err.(net.Error); ok {
+		return "connection_error"
+	}
+
+	return "other"
+}
+
+// countPushResult count the delivery result of one token.
+func countPushResult(platform int, status string, errPush error) {
+	switch status {
+	case SucceededPush:
+		pushSentCounter.WithLabelValues(typeForPlatForm(platform), "success").Inc()
+	case FailedPush:
+		pushSentCounter.WithLabelValues(typeForPlatForm(platform), "failure").Inc()
+		pushFailedCounter.WithLabelValues(typeForPlatForm(platform), failureReason(platform, errPush)).Inc()
+	}
+}
+
+// observePushDuration record the push duration since worker picked up notification.
+func observePushDuration(req PushNotification, start time.Time, isError bool) {
+	outcome := "success"
+	if isError {
+		outcome = "failure"
+	}
+
+	duration := time.Since(start)
+	pushDuration.WithLabelValues(typeForPlatForm(req.Platform), outcome).Observe(duration.Seconds())
+	appStats.observe(req.App, duration)
+}
+
 // Metrics implements the prometheus.Metrics interface and
 // exposes gorush metrics for prometheus
 type Metrics struct {
@@ -14,7 +253,18 @@ type Metrics struct {
 	IosError       *prometheus.Desc
 	AndroidSuccess *prometheus.Desc
 	AndroidError   *prometheus.Desc
+	WebSuccess     *prometheus.Desc
+	WebError       *prometheus.Desc
+	HuaweiSuccess  *prometheus.Desc
+	HuaweiError    *prometheus.Desc
+	SNSSuccess     *prometheus.Desc
+	SNSError       *prometheus.Desc
 	QueueUsage     *prometheus.Desc
+	QueueDepth     *prometheus.Desc
+	Workers        *prometheus.Desc
+	HTTPConns      *prometheus.Desc
+	ApnsConns      *prometheus.Desc
+	CircuitBreaker *prometheus.Desc
 }
 
 // NewMetrics returns a new Metrics with all prometheus.Desc initialized
@@ -46,11 +296,66 @@ func NewMetrics() Metrics {
 			"Number of android fail count",
 			nil, nil,
 		),
+		WebSuccess: prometheus.NewDesc(
+			namespace+"web_success",
+			"Number of web success count",
+			nil, nil,
+		),
+		WebError: prometheus.NewDesc(
+			namespace+"web_fail",
+			"Number of web fail count",
+			nil, nil,
+		),
+		HuaweiSuccess: prometheus.NewDesc(
+			namespace+"huawei_success",
+			"Number of huawei success count",
+			nil, nil,
+		),
+		HuaweiError: prometheus.NewDesc(
+			namespace+"huawei_fail",
+			"Number of huawei fail count",
+			nil, nil,
+		),
+		SNSSuccess: prometheus.NewDesc(
+			namespace+"sns_success",
+			"Number of sns success count",
+			nil, nil,
+		),
+		SNSError: prometheus.NewDesc(
+			namespace+"sns_fail",
+			"Number of sns fail count",
+			nil, nil,
+		),
 		QueueUsage: prometheus.NewDesc(
 			namespace+"queue_usage",
 			"Length of internal queue",
 			nil, nil,
 		),
+		QueueDepth: prometheus.NewDesc(
+			namespace+"queue_depth",
+			"Number of notifications waiting in worker queues",
+			nil, nil,
+		),
+		Workers: prometheus.NewDesc(
+			namespace+"workers",
+			"Number of running workers by pool",
+			[]string{"pool"}, nil,
+		),
+		HTTPConns: prometheus.NewDesc(
+			namespace+"http_connections",
+			"Number of open http connections",
+			nil, nil,
+		),
+		ApnsConns: prometheus.NewDesc(
+			namespace+"apns_connections",
+			"Number of APNs connections by state",
+			[]string{"state"}, nil,
+		),
+		CircuitBreaker: prometheus.NewDesc(
+			namespace+"circuit_breaker_state",
+			"State of push provider circuit breaker, 0 is closed, 1 is open and 2 is half-open",
+			[]string{"provider"}, nil,
+		),
 	}
 }
 
@@ -61,7 +366,18 @@ func (c Metrics) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.IosError
 	ch <- c.AndroidSuccess
 	ch <- c.AndroidError
+	ch <- c.WebSuccess
+	ch <- c.WebError
+	ch <- c.HuaweiSuccess
+	ch <- c.HuaweiError
+	ch <- c.SNSSuccess
+	ch <- c.SNSError
 	ch <- c.QueueUsage
+	ch <- c.QueueDepth
+	ch <- c.Workers
+	ch <- c.HTTPConns
+	ch <- c.ApnsConns
+	ch <- c.CircuitBreaker
 }
 
 // Collect returns the metrics with values
@@ -91,9 +407,86 @@ func (c Metrics) Collect(ch chan<- prometheus.Metric) {
 		prometheus.GaugeValue,
 		float64(StatStorage.GetAndroidError()),
 	)
+	ch <- prometheus.MustNewConstMetric(
+		c.WebSuccess,
+		prometheus.GaugeValue,
+		float64(StatStorage.GetWebSuccess()),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.WebError,
+		prometheus.GaugeValue,
+		float64(StatStorage.GetWebError()),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.HuaweiSuccess,
+		prometheus.GaugeValue,
+		float64(StatStorage.GetHuaweiSuccess()),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.HuaweiError,
+		prometheus.GaugeValue,
+		float64(StatStorage.GetHuaweiError()),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.SNSSuccess,
+		prometheus.GaugeValue,
+		float64(StatStorage.GetSNSSuccess()),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.SNSError,
+		prometheus.GaugeValue,
+		float64(StatStorage.GetSNSError()),
+	)
 	ch <- prometheus.MustNewConstMetric(
 		c.QueueUsage,
 		prometheus.GaugeValue,
-		float64(len(QueueNotification)),
+		float64(queueUsage()),
 	)
+	ch <- prometheus.MustNewConstMetric(
+		c.QueueDepth,
+		prometheus.GaugeValue,
+		float64(queueUsage()),
+	)
+
+	pools := map[string]*workerPool{"common": commonWorkers, "ios": iosWorkers, "android": androidWorkers}
+	for name, pool := range pools {
+		if pool == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			c.Workers,
+			prometheus.GaugeValue,
+			float64(pool.size()),
+			name,
+		)
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		c.HTTPConns,
+		prometheus.GaugeValue,
+		float64(atomic.LoadInt64(&httpConnections)),
+	)
+
+	active, unhealthy := apnsConnStats()
+	ch <- prometheus.MustNewConstMetric(
+		c.ApnsConns,
+		prometheus.GaugeValue,
+		float64(active),
+		"active",
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.ApnsConns,
+		prometheus.GaugeValue,
+		float64(unhealthy),
+		"unhealthy",
+	)
+
+	for _, breaker := range breakers {
+		ch <- prometheus.MustNewConstMetric(
+			c.CircuitBreaker,
+			prometheus.GaugeValue,
+			float64(breaker.current()),
+			breaker.name,
+		)
+	}
 }
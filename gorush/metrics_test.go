@@ -0,0 +1,98 @@
+package gorush
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gorush/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sideshow/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureReason(t *testing.T) {
+	assert.Equal(t, "Unregistered", failureReason(PlatFormIos, errors.New(apns2.ReasonUnregistered)))
+	assert.Equal(t, "other", failureReason(PlatFormIos, errors.New("token 1234 is invalid")))
+	assert.Equal(t, "NotRegistered", failureReason(PlatFormAndroid, fcm.ErrNotRegistered))
+	assert.Equal(t, "Unavailable", failureReason(PlatFormAndroid, fcm.ErrUnavailable))
+	// APNs reason of android error isn't trusted.
+	assert.Equal(t, "other", failureReason(PlatFormAndroid, errors.New(apns2.ReasonUnregistered)))
+	assert.Equal(t, "SubscriptionExpired", failureReason(PlatFormWeb, errWebSubscriptionExpired))
+	assert.Equal(t, "http_4xx", failureReason(PlatFormWeb, &webStatusError{code: 400}))
+	assert.Equal(t, "http_5xx", failureReason(PlatFormWeb, &webStatusError{code: 503}))
+	assert.Equal(t, "provider_unavailable", failureReason(PlatFormWeb, errProviderUnavailable))
+	assert.Equal(t, "connection_error", failureReason(PlatFormIos, &url.Error{Op: "Post", URL: "https://api.push.apple.com", Err: errors.New("EOF")}))
+	assert.Equal(t, "other", failureReason(PlatFormIos, nil))
+}
+
+func TestPushResultCounter(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+
+	sent := testutil.ToFloat64(pushSentCounter.WithLabelValues("android", "success"))
+	failed := testutil.ToFloat64(pushSentCounter.WithLabelValues("android", "failure"))
+	notRegistered := testutil.ToFloat64(pushFailedCounter.WithLabelValues("android", "NotRegistered"))
+	other := testutil.ToFloat64(pushFailedCounter.WithLabelValues("android", "other"))
+	iosSent := testutil.ToFloat64(pushSentCounter.WithLabelValues("ios", "success"))
+
+	req := PushNotification{Platform: PlatFormAndroid, Message: "Welcome"}
+	LogPush(SucceededPush, "aaaaa", req, nil)
+	LogPush(SucceededPush, "bbbbb", req, nil)
+	LogPush(FailedPush, "ccccc", req, fcm.ErrNotRegistered)
+	LogPush(FailedPush, "ddddd", req, errors.New("unexpected error"))
+
+	assert.Equal(t, sent+2, testutil.ToFloat64(pushSentCounter.WithLabelValues("android", "success")))
+	assert.Equal(t, failed+2, testutil.ToFloat64(pushSentCounter.WithLabelValues("android", "failure")))
+	assert.Equal(t, notRegistered+1, testutil.ToFloat64(pushFailedCounter.WithLabelValues("android", "NotRegistered")))
+	assert.Equal(t, other+1, testutil.ToFloat64(pushFailedCounter.WithLabelValues("android", "other")))
+	assert.Equal(t, iosSent, testutil.ToFloat64(pushSentCounter.WithLabelValues("ios", "success")))
+}
+
+func TestQueueThroughputCounter(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	// no worker consumes the queue until it is resized.
+	InitWorkers(0, 10)
+	defer InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+
+	enqueued := testutil.ToFloat64(enqueuedCounter.WithLabelValues("android"))
+	dequeued := testutil.ToFloat64(dequeuedCounter.WithLabelValues("android"))
+	iosEnqueued := testutil.ToFloat64(enqueuedCounter.WithLabelValues("ios"))
+
+	assert.True(t, tryEnqueue(PushNotification{Platform: PlatFormAndroid}, QueueNotification))
+	assert.True(t, tryEnqueue(PushNotification{Platform: PlatFormAndroid}, QueueNotification))
+	assert.Equal(t, enqueued+2, testutil.ToFloat64(enqueuedCounter.WithLabelValues("android")))
+	assert.Equal(t, dequeued, testutil.ToFloat64(dequeuedCounter.WithLabelValues("android")))
+
+	// android is disabled, so worker only takes the notifications.
+	commonWorkers.resize(1)
+	assert.True(t, waitDrain(time.Second))
+	assert.Equal(t, dequeued+2, testutil.ToFloat64(dequeuedCounter.WithLabelValues("android")))
+	assert.Equal(t, iosEnqueued, testutil.ToFloat64(enqueuedCounter.WithLabelValues("ios")))
+}
+
+func TestTokensPerNotification(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	InitWorkers(0, 10)
+	defer InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+
+	var before dto.Metric
+	assert.NoError(t, tokensPerNotification.WithLabelValues("android").(prometheus.Histogram).Write(&before))
+
+	queueNotification(RequestPush{
+		Notifications: []PushNotification{
+			{Platform: PlatFormAndroid, Tokens: []string{"aaaaa"}, Message: "Welcome"},
+			{Platform: PlatFormAndroid, Tokens: []string{"bbbbb", "ccccc", "ddddd"}, Message: "Welcome"},
+		},
+	})
+
+	var m dto.Metric
+	assert.NoError(t, tokensPerNotification.WithLabelValues("android").(prometheus.Histogram).Write(&m))
+	assert.Equal(t, before.GetHistogram().GetSampleCount()+2, m.GetHistogram().GetSampleCount())
+	assert.Equal(t, before.GetHistogram().GetSampleSum()+4, m.GetHistogram().GetSampleSum())
+	// the single token notification is in the first bucket.
+	assert.Equal(t, before.GetHistogram().GetBucket()[0].GetCumulativeCount()+1, m.GetHistogram().GetBucket()[0].GetCumulativeCount())
+}
@@ -0,0 +1,126 @@
+package gorush
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// NDJSONContentType is content type of newline-delimited JSON push request.
+const NDJSONContentType = "application/x-ndjson"
+
+// ndjsonMaxLineSize is the max bytes of one notification line.
+const ndjsonMaxLineSize = 4 * 1024 * 1024
+
+// lineError return the failed log of malformed line.
+func lineError(line int, err error, requestID string) LogPushEntry {
+	return LogPushEntry{
+		Type:      FailedPush,
+		Line:      line,
+		Error:     err.Error(),
+		RequestID: requestID,
+	}
+}
+
+// queueNDJSON read one notification per line and queue it while reading,
+// so the whole request is never kept in memory. Malformed lines are added
+// to log with line number and skipped. The notification is bound to app
+// profile of sender authenticated by client certificate. The logs of each
+// notification are sent to results instead if it isn't nil.
+func queueNDJSON(ctx context.Context, r io.Reader, sender *clientSender, requestID, traceParent string, results chan<- notificationResult) (int, []LogPushEntry) {
+	var count, line int
+	wg := sync.WaitGroup{}
+	log := []LogPushEntry{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), ndjsonMaxLineSize)
+
+	for scanner.Scan() {
+		line++
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var notification PushNotification
+		if err := json.Unmarshal([]byte(data), &notification); err != nil {
+			appendLog(&log, lineError(line, err, requestID))
+			continue
+		}
+		notification.requestID = requestID
+		notification.traceParent = traceParent
+		if PushConf.Core.Sync {
+			notification.ctx = ctx
+		}
+
+		notifications, err := expandNotification(notification)
+		if err != nil {
+			appendLog(&log, lineError(line, err, requestID))
+			continue
+		}
+
+		for i := range notifications {
+			notification := &notifications[i]
+			if err := sender.check(notification); err != nil {
+				appendLog(&log, lineError(line, err, requestID))
+				continue
+			}
+
+			if err := checkNotification(*notification); err != nil {
+				appendLog(&log, lineError(line, err, requestID))
+				continue
+			}
+
+			if !platformEnabled(notification.Platform) {
+				continue
+			}
+
+			// lines are not kept, so only tokens of one line are deduplicated.
+			if PushConf.Core.Dedup && !newTokenDedup().apply(notification, &log) {
+				continue
+			}
+
+			if PushConf.Core.DryRun {
+				c, l := dryRunNotification([]*PushNotification{notification})
+				count += c
+				if results != nil {
+					results <- newNotificationResult(notification, line, c, l)
+				} else {
+					appendLog(&log, l...)
+				}
+				continue
+			}
+
+			if results != nil {
+				count += enqueueResult(notification, line, &wg, results)
+				continue
+			}
+			count += enqueueNotification(notification, &wg, &log)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		// the rest of body can't be read, e.g. line is too long.
+		appendLog(&log, lineError(line+1, fmt.Errorf("read request body error: %v", err), requestID))
+	}
+
+	if !PushConf.Core.DryRun {
+		StatStorage.AddTotalCount(int64(count))
+	}
+
+	if results != nil {
+		wg.Wait()
+		return count, log
+	}
+
+	if PushConf.Core.Sync && !waitNotifications(ctx, &wg) {
+		// the log is still written by workers of timed out request.
+		return count, nil
+	}
+
+	return count, log
+}
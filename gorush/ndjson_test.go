@@ -0,0 +1,99 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushNDJSON(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+	PushConf.Android.Enabled = true
+	// no worker consumes the queue.
+	InitWorkers(0, 10)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	body := strings.Join([]string{
+		`{"tokens":["aaaaa","bbbbb"],"platform":2,"message":"Welcome"}`,
+		`{"tokens":["ccccc"],"platform":2,`,
+		``,
+		`{"tokens":["ddddd"],"platform":1,"message":"Welcome","collapse_id":"` + strings.Repeat("a", 65) + `"}`,
+		`{"tokens":["eeeee"],"platform":1,"message":"iOS is disabled"}`,
+		`{"tokens":["fffff"],"platform":2,"message":"Welcome"}`,
+	}, "\n")
+
+	r := gofight.New()
+	r.POST("/api/push").
+		SetHeader(gofight.H{"Content-Type": NDJSONContentType}).
+		SetBody(body).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			var res struct {
+				Counts struct {
+					Total int `json:"total"`
+				} `json:"counts"`
+				Logs []LogPushEntry `json:"logs"`
+			}
+			assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &res))
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, 3, res.Counts.Total)
+			assert.Equal(t, 2, len(res.Logs))
+			assert.Equal(t, 2, res.Logs[0].Line)
+			assert.Equal(t, FailedPush, res.Logs[0].Type)
+			assert.Equal(t, 4, res.Logs[1].Line)
+			assert.Equal(t, "the collapse_id must not exceed 64 bytes", res.Logs[1].Error)
+		})
+
+	assert.Equal(t, 2, len(QueueNotification))
+	notification := <-QueueNotification
+	assert.Equal(t, []string{"aaaaa", "bbbbb"}, notification.Tokens)
+	notification = <-QueueNotification
+	assert.Equal(t, []string{"fffff"}, notification.Tokens)
+}
+
+func TestPushNDJSONDryRun(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	PushConf.Core.DryRun = true
+	InitWorkers(0, 10)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	count, logs := queueNDJSON(context.Background(), strings.NewReader(`{"tokens":["aaaaa"],"platform":2,"message":"Welcome"}`), nil, "", "", nil)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 1, len(logs))
+	assert.Equal(t, DryRunPush, logs[0].Type)
+	assert.Equal(t, 0, len(QueueNotification))
+}
+
+func TestPushNDJSONLineTooLong(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	InitWorkers(0, 10)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	body := `{"tokens":["aaaaa"],"platform":2,"message":"Welcome"}` + "\n" +
+		`{"tokens":["bbbbb"],"platform":2,"message":"` + strings.Repeat("a", ndjsonMaxLineSize) + `"}`
+
+	count, logs := queueNDJSON(context.Background(), strings.NewReader(body), nil, "", "", nil)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 1, len(logs))
+	assert.Equal(t, 2, logs[0].Line)
+	assert.Contains(t, logs[0].Error, "token too long")
+}
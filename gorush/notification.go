@@ -1,16 +1,37 @@
 package gorush
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	"net/http"
+	"fmt"
 	"net/url"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/SherClockHolmes/webpush-go"
 	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gorush/config"
+	"github.com/mitchellh/mapstructure"
 )
 
+var errMaxCapacity = errors.New("max capacity reached")
+
+// errExpiredInQueue is the error of notification past deadline_at in queue.
+var errExpiredInQueue = errors.New("notification is expired in queue")
+
+// errCredentialNotSaved is the error of notification with request
+// credentials which would be saved to storage, the credentials aren't kept
+// so it would be sent by the credentials of server.
+var errCredentialNotSaved = errors.New("notification with request credentials can't be saved to storage")
+
+// ErrShuttingDown is returned for notifications sent while server shuts down.
+var ErrShuttingDown = errors.New("server is shutting down")
+
 // D provide string array
 type D map[string]interface{}
 
@@ -26,8 +47,26 @@ const (
 	// the target device. It is an error to use this priority for a push
 	// notification that contains only the content-available key.
 	ApnsPriorityHigh = 10
+
+	// ApnsCollapseIDMaxLength is max bytes of apns-collapse-id header.
+	ApnsCollapseIDMaxLength = 64
 )
 
+// androidColorPattern is the #RRGGBB color of Android notification.
+var androidColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// fcmAnalyticsLabelPattern is the analytics label of FCM message.
+var fcmAnalyticsLabelPattern = regexp.MustCompile(`^[a-zA-Z0-9-_.~%]{1,50}$`)
+
+// apnsIDPattern is the canonical 8-4-4-4-12 UUID form of apns-id header.
+var apnsIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ApnsPushTypes is the values of apns-push-type header accepted by APNs.
+var ApnsPushTypes = []string{"alert", "background", "voip", "complication", "fileprovider", "mdm"}
+
+// ApnsInterruptionLevels is the values of aps interruption-level of iOS 15.
+var ApnsInterruptionLevels = []string{"passive", "active", "time-sensitive", "critical"}
+
 // Alert is APNs payload
 type Alert struct {
 	Action          string   `json:"action,omitempty"`
@@ -42,57 +81,129 @@ type Alert struct {
 	TitleLocKey     string   `json:"title-loc-key,omitempty"`
 	SummaryArg      string   `json:"summary-arg,omitempty"`
 	SummaryArgCount int      `json:"summary-arg-count,omitempty"`
+	// Text is the alert sent as string, it is used as message of
+	// notification instead of the dictionary.
+	Text string `json:"-"`
+}
+
+// UnmarshalJSON accept the alert as string or dictionary, APNs supports both
+// of them.
+func (a *Alert) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*a = Alert{Text: text}
+		return nil
+	}
+
+	type alert Alert
+	return json.Unmarshal(data, (*alert)(a))
+}
+
+// MarshalJSON keep the string alert as string, e.g. when notification is
+// saved to queue or storage.
+func (a Alert) MarshalJSON() ([]byte, error) {
+	if a.Text != "" {
+		return json.Marshal(a.Text)
+	}
+
+	type alert Alert
+	return json.Marshal(alert(a))
+}
+
+// AndroidNotification is the options of FCM android.notification, they
+// override the same fields of notification and the empty ones are omitted.
+type AndroidNotification struct {
+	ChannelID   string `json:"channel_id,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Color       string `json:"color,omitempty"`
+	Tag         string `json:"tag,omitempty"`
+	ClickAction string `json:"click_action,omitempty"`
+	Sound       string `json:"sound,omitempty"`
 }
 
 // RequestPush support multiple notification request.
 type RequestPush struct {
-	Notifications []PushNotification `json:"notifications" binding:"required"`
+	Notifications []PushNotification  `json:"notifications" binding:"required"`
+	DryRun        bool                `json:"dry_run,omitempty"`
+	Credentials   *RequestCredentials `json:"credentials,omitempty"`
+	jobID         string
+	requestID     string
+	traceParent   string
+	ctx           context.Context
+	results       chan<- notificationResult
 }
 
 // PushNotification is single notification request
 type PushNotification struct {
 	// Common
-	Tokens           []string    `json:"tokens" binding:"required"`
-	Platform         int         `json:"platform" binding:"required"`
-	Message          string      `json:"message,omitempty"`
-	Title            string      `json:"title,omitempty"`
-	Priority         string      `json:"priority,omitempty"`
-	ContentAvailable bool        `json:"content_available,omitempty"`
-	MutableContent   bool        `json:"mutable_content,omitempty"`
-	Sound            interface{} `json:"sound,omitempty"`
-	Data             D           `json:"data,omitempty"`
-	Retry            int         `json:"retry,omitempty"`
+	ID               string                            `json:"notif_id,omitempty"`
+	Tokens           []string                          `json:"tokens" binding:"required"`
+	IosTokens        []string                          `json:"ios_tokens,omitempty"`
+	Platform         int                               `json:"platform" binding:"required"`
+	Message          string                            `json:"message,omitempty"`
+	Title            string                            `json:"title,omitempty"`
+	Priority         string                            `json:"priority,omitempty"`
+	Expiration       int64                             `json:"expiration,omitempty"`
+	ContentAvailable bool                              `json:"content_available,omitempty"`
+	MutableContent   bool                              `json:"mutable_content,omitempty"`
+	Sound            interface{}                       `json:"sound,omitempty"`
+	Data             D                                 `json:"data,omitempty"`
+	Retry            int                               `json:"retry,omitempty"`
+	SendAt           int64                             `json:"send_at,omitempty"`
+	DeadlineAt       int64                             `json:"deadline_at,omitempty"`
+	Template         *Template                         `json:"template,omitempty"`
+	TokenData        map[string]map[string]interface{} `json:"token_data,omitempty"`
+	CallbackURL      string                            `json:"callback_url,omitempty"`
 	wg               *sync.WaitGroup
 	log              *[]LogPushEntry
+	jobID            string
+	requestID        string
+	traceParent      string
+	credential       string
+	ctx              context.Context
+	index            int
+	callback         *notificationCallback
 
 	// Android
-	APIKey                string           `json:"api_key,omitempty"`
-	To                    string           `json:"to,omitempty"`
-	CollapseKey           string           `json:"collapse_key,omitempty"`
-	DelayWhileIdle        bool             `json:"delay_while_idle,omitempty"`
-	TimeToLive            *uint            `json:"time_to_live,omitempty"`
-	RestrictedPackageName string           `json:"restricted_package_name,omitempty"`
-	DryRun                bool             `json:"dry_run,omitempty"`
-	Condition             string           `json:"condition,omitempty"`
-	Notification          fcm.Notification `json:"notification,omitempty"`
+	APIKey                string               `json:"api_key,omitempty"`
+	To                    string               `json:"to,omitempty"`
+	CollapseKey           string               `json:"collapse_key,omitempty"`
+	DelayWhileIdle        bool                 `json:"delay_while_idle,omitempty"`
+	TimeToLive            *uint                `json:"time_to_live,omitempty"`
+	RestrictedPackageName string               `json:"restricted_package_name,omitempty"`
+	DryRun                bool                 `json:"dry_run,omitempty"`
+	Condition             string               `json:"condition,omitempty"`
+	DirectBootOK          bool                 `json:"direct_boot_ok,omitempty"`
+	AnalyticsLabel        string               `json:"analytics_label,omitempty"`
+	Notification          fcm.Notification     `json:"notification,omitempty"`
+	Android               *AndroidNotification `json:"android,omitempty"`
 
 	// iOS
-	Expiration  int64    `json:"expiration,omitempty"`
-	ApnsID      string   `json:"apns_id,omitempty"`
-	CollapseID  string   `json:"collapse_id,omitempty"`
-	Topic       string   `json:"topic,omitempty"`
-	Badge       *int     `json:"badge,omitempty"`
-	Category    string   `json:"category,omitempty"`
-	ThreadID    string   `json:"thread-id,omitempty"`
-	URLArgs     []string `json:"url-args,omitempty"`
-	Alert       Alert    `json:"alert,omitempty"`
-	Production  bool     `json:"production,omitempty"`
-	Development bool     `json:"development,omitempty"`
-	SoundName   string   `json:"name,omitempty"`
-	SoundVolume float32  `json:"volume,omitempty"`
+	ApnsID     string   `json:"apns_id,omitempty"`
+	CollapseID string   `json:"collapse_id,omitempty"`
+	Topic      string   `json:"topic,omitempty"`
+	PushType   string   `json:"push_type,omitempty"`
+	App        string   `json:"app,omitempty"`
+	Badge      *int     `json:"badge,omitempty"`
+	Category   string   `json:"category,omitempty"`
+	Image      string   `json:"image,omitempty"`
+	ThreadID   string   `json:"thread-id,omitempty"`
+	URLArgs    []string `json:"url-args,omitempty"`
+	// InterruptionLevel and RelevanceScore are used by Focus and notification
+	// summary of iOS 15.
+	InterruptionLevel string   `json:"interruption-level,omitempty"`
+	RelevanceScore    *float64 `json:"relevance-score,omitempty"`
+	Alert             Alert    `json:"alert,omitempty"`
+	Production        *bool    `json:"production,omitempty"`
+	Development       bool     `json:"development,omitempty"`
+	SoundName         string   `json:"name,omitempty"`
+	SoundVolume       float32  `json:"volume,omitempty"`
 
 	// Custom Fields in APS
 	Legacy bool `json:"legacy,omitempty"`
+
+	// Web
+	Subscription *webpush.Subscription `json:"subscription,omitempty"`
 }
 
 // WaitDone decrements the WaitGroup counter.
@@ -109,92 +220,737 @@ func (p *PushNotification) AddWaitCount() {
 	}
 }
 
-// AddLog record fail log of notification
+// requestContext return the context of request waiting for the result in
+// sync mode, background if the notification isn't tied to request.
+func (p *PushNotification) requestContext() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+
+	return p.ctx
+}
+
+// canceled reports whether the request waiting for the result is timed out,
+// the rest of recipients are not sent then.
+func (p *PushNotification) canceled(recipients []string) bool {
+	if p.ctx == nil || p.ctx.Err() == nil {
+		return false
+	}
+
+	p.errorLog().Errorf("request is canceled: %s, %d notifications are not sent", p.ctx.Err(), len(recipients))
+
+	return true
+}
+
+// expiredInQueue reports whether the notification is picked up by worker
+// after its deadline_at.
+func (p *PushNotification) expiredInQueue() bool {
+	return p.DeadlineAt > 0 && time.Now().Unix() >= p.DeadlineAt
+}
+
+// checkDeadlineAt validate deadline_at is later than now and send_at.
+func checkDeadlineAt(req PushNotification) error {
+	if req.DeadlineAt == 0 {
+		return nil
+	}
+
+	if req.DeadlineAt < 0 || req.DeadlineAt <= time.Now().Unix() {
+		return errors.New("the deadline_at must be later than now")
+	}
+
+	if req.SendAt > 0 && req.DeadlineAt <= req.SendAt {
+		return errors.New("the deadline_at must be later than send_at")
+	}
+
+	return nil
+}
+
+// isProduction reports whether notification is sent to APNs production, the
+// default of app profile is used if notification doesn't override it.
+func (p *PushNotification) isProduction(def bool) bool {
+	if p.Production != nil {
+		return *p.Production
+	}
+
+	if p.Development {
+		return false
+	}
+
+	return def
+}
+
+// logLock guard the push log of request, which is appended by workers in
+// sync mode while the handler is still adding dropped and queued tokens.
+var logLock sync.Mutex
+
+// appendLog add entries to push log of request.
+func appendLog(log *[]LogPushEntry, entries ...LogPushEntry) {
+	logLock.Lock()
+	*log = append(*log, entries...)
+	logLock.Unlock()
+}
+
+// AddLog record push log of notification in sync mode
 func (p *PushNotification) AddLog(log LogPushEntry) {
 	if p.log != nil {
-		*p.log = append(*p.log, log)
+		appendLog(p.log, log)
 	}
 }
 
 // IsTopic check if message format is topic for FCM
 // ref: https://firebase.google.com/docs/cloud-messaging/send-message#topic-http-post-request
 func (p *PushNotification) IsTopic() bool {
-	return (p.Platform == PlatFormAndroid && p.To != "" && strings.HasPrefix(p.To, "/topics/")) ||
+	return (p.Platform == PlatFormAndroid && (p.Topic != "" || strings.HasPrefix(p.To, "/topics/"))) ||
 		p.Condition != ""
 }
 
+// fcmTopic return the FCM topic destination of android notification.
+func (p *PushNotification) fcmTopic() string {
+	if p.Platform != PlatFormAndroid || p.Topic == "" {
+		return ""
+	}
+
+	return "/topics/" + strings.TrimPrefix(p.Topic, "/topics/")
+}
+
+// recipients return tokens, topic and web subscription endpoint of notification.
+func (p *PushNotification) recipients() []string {
+	recipients := append([]string{}, p.Tokens...)
+	if p.To != "" {
+		recipients = append(recipients, p.To)
+	}
+	// topic and condition message is one delivery whatever audience size is.
+	if topic := p.fcmTopic(); topic != "" {
+		recipients = append(recipients, topic)
+	}
+	if p.Platform == PlatFormAndroid && p.Condition != "" {
+		recipients = append(recipients, p.Condition)
+	}
+	if p.Platform == PlatFormWeb && p.Subscription != nil {
+		recipients = append(recipients, p.Subscription.Endpoint)
+	}
+
+	return recipients
+}
+
+// expandNotification split the notification of all platforms into iOS
+// notification of ios_tokens and Android notification of tokens, to, or
+// condition. Topic is the APNs topic, so it is only kept for iOS. Both of them
+// have the same notif_id, generated if it is empty, so results can be
+// aggregated by it.
+func expandNotification(req PushNotification) ([]PushNotification, error) {
+	if req.Platform != PlatFormAll {
+		return []PushNotification{req}, nil
+	}
+
+	if req.ID == "" {
+		req.ID = newRequestID()
+	}
+
+	var notifications []PushNotification
+	if len(req.IosTokens) > 0 {
+		ios := req
+		ios.Platform = PlatFormIos
+		ios.Tokens = req.IosTokens
+		ios.IosTokens = nil
+		ios.To, ios.Condition = "", ""
+		notifications = append(notifications, ios)
+	}
+
+	if len(req.Tokens) > 0 || req.To != "" || req.Condition != "" {
+		android := req
+		android.Platform = PlatFormAndroid
+		android.IosTokens = nil
+		android.Topic = ""
+		notifications = append(notifications, android)
+	}
+
+	if len(notifications) == 0 {
+		return nil, errors.New("the message must specify at least one of tokens or ios_tokens")
+	}
+
+	return notifications, nil
+}
+
 // CheckMessage for check request message
 func CheckMessage(req PushNotification) error {
 	var msg string
 
-	// ignore send topic mesaage from FCM
-	if !req.IsTopic() && len(req.Tokens) == 0 && len(req.To) == 0 {
-		msg = "the message must specify at least one registration ID"
-		LogAccess.Debug(msg)
-		return errors.New(msg)
+	if err := checkNotification(req); err != nil {
+		req.accessLog().Debug(err.Error())
+		return err
 	}
 
-	if len(req.Tokens) == PlatFormIos && len(req.Tokens[0]) == 0 {
-		msg = "the token must not be empty"
-		LogAccess.Debug(msg)
-		return errors.New(msg)
+	if req.Platform == PlatFormWeb || req.Platform == PlatFormHuawei || req.Platform == PlatFormSNS {
+		return nil
 	}
 
-	if req.Platform == PlatFormAndroid && len(req.Tokens) > 1000 {
-		msg = "the message may specify at most 1000 registration IDs"
-		LogAccess.Debug(msg)
-		return errors.New(msg)
+	if err := checkFCMTarget(req); err != nil {
+		req.accessLog().Debug(err.Error())
+		return err
 	}
 
 	// ref: https://firebase.google.com/docs/cloud-messaging/http-server-ref
 	if req.Platform == PlatFormAndroid && req.TimeToLive != nil && (*req.TimeToLive < uint(0) || uint(2419200) < *req.TimeToLive) {
 		msg = "the message's TimeToLive field must be an integer " +
 			"between 0 and 2419200 (4 weeks)"
-		LogAccess.Debug(msg)
+		req.accessLog().Debug(msg)
 		return errors.New(msg)
 	}
 
 	return nil
 }
 
-// SetProxy only working for FCM server.
-func SetProxy(proxy string) error {
+// notificationChecks validate the fields of single notification which are
+// rejected before it is queued, field is the name reported to client.
+var notificationChecks = []struct {
+	field string
+	check func(req PushNotification) error
+}{
+	{"platform", checkPlatform},
+	{"tokens", checkMaxTokens},
+	{"tokens", checkRecipients},
+	{"collapse_id", checkCollapseID},
+	{"apns_id", checkApnsID},
+	{"app", checkApp},
+	{"topic", checkIosTopic},
+	{"push_type", checkPushType},
+	{"priority", checkPriority},
+	{"badge", checkBadge},
+	{"sound", checkSound},
+	{"interruption-level", checkInterruptionLevel},
+	{"relevance-score", checkRelevanceScore},
+	{"message", checkIosAlert},
+	{"image", checkImage},
+	{"android.color", checkAndroidColor},
+	{"analytics_label", checkAnalyticsLabel},
+	{"expiration", checkExpiration},
+	{"send_at", checkSendAt},
+	{"deadline_at", checkDeadlineAt},
+	{"callback_url", checkCallbackURL},
+	{"template", checkTemplate},
+	{"data", checkFCMData},
+	{"data", checkIosData},
+	{"data", checkPayloadSize},
+}
+
+// checkNotification return the first error of notification checks.
+func checkNotification(req PushNotification) error {
+	for _, c := range notificationChecks {
+		if err := c.check(req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkMaxTokens validate the number of tokens is within
+// core.max_tokens_per_notification.
+func checkMaxTokens(req PushNotification) error {
+	if PushConf.Core.MaxTokens > 0 && int64(len(req.Tokens)) > PushConf.Core.MaxTokens {
+		return fmt.Errorf("Number of tokens(%d) over limit(%d)", len(req.Tokens), PushConf.Core.MaxTokens)
+	}
+
+	return nil
+}
+
+// checkRecipients validate the notification has device token, topic or
+// web subscription to send.
+func checkRecipients(req PushNotification) error {
+	if req.Platform == PlatFormWeb {
+		if req.Subscription == nil || req.Subscription.Endpoint == "" ||
+			req.Subscription.Keys.Auth == "" || req.Subscription.Keys.P256dh == "" {
+			return errors.New("the web push message must specify subscription endpoint and keys")
+		}
+
+		return nil
+	}
+
+	// Push Kit message is only sent to tokens.
+	if req.Platform == PlatFormHuawei {
+		if len(req.Tokens) == 0 {
+			return errors.New("the huawei message must specify at least one token")
+		}
+
+		return nil
+	}
+
+	// SNS message is published to each endpoint ARN of tokens.
+	if req.Platform == PlatFormSNS {
+		if len(req.Tokens) == 0 {
+			return errors.New("the sns message must specify at least one endpoint ARN")
+		}
+
+		return nil
+	}
+
+	// ignore send topic mesaage from FCM
+	if !req.IsTopic() && len(req.Tokens) == 0 && len(req.To) == 0 {
+		return errors.New("the message must specify at least one registration ID")
+	}
+
+	if len(req.Tokens) == PlatFormIos && len(req.Tokens[0]) == 0 {
+		return errors.New("the token must not be empty")
+	}
+
+	return nil
+}
+
+// checkPlatform validate the platform is supported.
+func checkPlatform(req PushNotification) error {
+	switch req.Platform {
+	case PlatFormIos, PlatFormAndroid, PlatFormWeb, PlatFormHuawei, PlatFormSNS:
+		return nil
+	}
+
+	return errors.New("the platform must be 1 (iOS), 2 (Android), 3 (Web), 5 (Huawei) or 6 (SNS)")
+}
+
+// checkSound validate the iOS sound is a name or a sound dictionary with
+// volume between 0.0 and 1.0, critical alert dictionary is used to bypass
+// Do Not Disturb.
+func checkSound(req PushNotification) error {
+	if req.Platform != PlatFormIos {
+		return nil
+	}
+
+	volumes := []float32{req.SoundVolume}
+	switch sound := req.Sound.(type) {
+	case nil, string:
+	case map[string]interface{}:
+		result := Sound{}
+		if err := mapstructure.Decode(sound, &result); err != nil {
+			return fmt.Errorf("the sound is invalid: %v", err)
+		}
+		volumes = append(volumes, result.Volume)
+	case Sound:
+		volumes = append(volumes, sound.Volume)
+	default:
+		return errors.New("the sound must be a string or an object")
+	}
+
+	for _, volume := range volumes {
+		if volume < 0 || volume > 1 {
+			return errors.New("the sound volume must be between 0.0 and 1.0")
+		}
+	}
+
+	return nil
+}
+
+// checkPushType validate the apns-push-type is supported by APNs.
+func checkPushType(req PushNotification) error {
+	if req.Platform != PlatFormIos || req.PushType == "" {
+		return nil
+	}
+
+	for _, pushType := range ApnsPushTypes {
+		if req.PushType == pushType {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the push_type must be one of %s", strings.Join(ApnsPushTypes, ", "))
+}
+
+// checkInterruptionLevel validate the iOS interruption-level if it is set.
+func checkInterruptionLevel(req PushNotification) error {
+	if req.Platform != PlatFormIos || req.InterruptionLevel == "" {
+		return nil
+	}
+
+	for _, level := range ApnsInterruptionLevels {
+		if req.InterruptionLevel == level {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the interruption-level must be one of %s", strings.Join(ApnsInterruptionLevels, ", "))
+}
+
+// checkRelevanceScore validate the iOS relevance-score is between 0 and 1.
+func checkRelevanceScore(req PushNotification) error {
+	if req.Platform == PlatFormIos && req.RelevanceScore != nil && (*req.RelevanceScore < 0 || *req.RelevanceScore > 1) {
+		return errors.New("the relevance-score must be between 0.0 and 1.0")
+	}
+
+	return nil
+}
+
+// checkPriority validate the priority is high or normal if it is set.
+func checkPriority(req PushNotification) error {
+	switch req.Priority {
+	case "", "high", "normal":
+		return nil
+	}
+
+	return errors.New("the priority must be high or normal")
+}
+
+// checkBadge validate the badge, omitted keeps the badge of app icon, zero
+// clears it and positive value sets it.
+func checkBadge(req PushNotification) error {
+	if req.Badge != nil && *req.Badge < 0 {
+		return errors.New("the badge must not be negative, omit it to keep the badge")
+	}
+
+	return nil
+}
+
+// checkExpiration validate the expiration is not in the past, zero means the
+// notification never expires.
+func checkExpiration(req PushNotification) error {
+	if req.Expiration < 0 || (req.Expiration > 0 && req.Expiration < time.Now().Unix()) {
+		return errors.New("the expiration must not be in the past")
+	}
+
+	return nil
+}
+
+// checkCollapseID validate the apns-collapse-id under Apple's limit.
+func checkCollapseID(req PushNotification) error {
+	if req.Platform == PlatFormIos && len(req.CollapseID) > ApnsCollapseIDMaxLength {
+		return fmt.Errorf("the collapse_id must not exceed %d bytes", ApnsCollapseIDMaxLength)
+	}
+
+	return nil
+}
+
+// checkApnsID validate the client-supplied apns-id is UUID, APNs generates
+// one if it is empty.
+func checkApnsID(req PushNotification) error {
+	if req.Platform == PlatFormIos && req.ApnsID != "" && !apnsIDPattern.MatchString(req.ApnsID) {
+		return errors.New("the apns_id must be a UUID, e.g. 123e4567-e89b-12d3-a456-426655440000")
+	}
+
+	return nil
+}
+
+// checkFCMTarget validate android notification is sent to only one of tokens,
+// topic or condition, and the topic and condition syntax.
+func checkFCMTarget(req PushNotification) error {
+	if req.Platform != PlatFormAndroid {
+		return nil
+	}
+
+	var targets int
+	if len(req.Tokens) > 0 {
+		targets++
+	}
+	if req.Topic != "" || strings.HasPrefix(req.To, "/topics/") {
+		targets++
+	}
+	if req.Condition != "" {
+		targets++
+	}
+
+	if targets > 1 || (req.Topic != "" && req.To != "") {
+		return errors.New("the message must specify only one of tokens, topic or condition")
+	}
+
+	if req.Topic != "" {
+		if err := checkFCMTopic(strings.TrimPrefix(req.Topic, "/topics/")); err != nil {
+			return err
+		}
+	}
+
+	if req.Condition != "" {
+		return checkFCMCondition(req.Condition)
+	}
+
+	return nil
+}
+
+// checkApp validate the app profile of notification is configured.
+func checkApp(req PushNotification) error {
+	if req.App == "" {
+		return nil
+	}
 
-	proxyURL, err := url.ParseRequestURI(proxy)
+	switch req.Platform {
+	case PlatFormIos:
+		if _, ok := iosApp(req.App); !ok {
+			return fmt.Errorf("the iOS app profile %s is not found", req.App)
+		}
+	case PlatFormAndroid:
+		// api key of notification is prior to the app.
+		if _, ok := androidApp(req.App); !ok && req.APIKey == "" {
+			return fmt.Errorf("the Android app %s is not found", req.App)
+		}
+	}
+
+	return nil
+}
+
+// checkIosTopic validate the topic of iOS notification is bundle ID of app
+// profile, or the bundle ID with suffix of push type like .voip. Topic of
+// extension like watch app, e.g. com.example.app.watchkitapp.complication,
+// is under the bundle ID too.
+func checkIosTopic(req PushNotification) error {
+	bundleID := iosAppTopic(req)
+	if req.Platform != PlatFormIos || req.Topic == "" || bundleID == "" || req.Topic == bundleID {
+		return nil
+	}
+
+	if strings.HasPrefix(req.Topic, bundleID+".") {
+		for _, suffix := range iosTopicSuffixes {
+			if strings.HasSuffix(req.Topic, suffix) {
+				return nil
+			}
+		}
+	}
 
+	return fmt.Errorf("the topic must be %s or under it with suffix of %s", bundleID, strings.Join(iosTopicSuffixes, ", "))
+}
+
+// checkFCMData validate the data values of FCM data message are strings,
+// which app receives as they are.
+func checkFCMData(req PushNotification) error {
+	if len(req.Data) == 0 || !isFCMDataMessage(req) {
+		return nil
+	}
+
+	keys := make([]string, 0, len(req.Data))
+	for k := range req.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if _, ok := req.Data[k].(string); !ok {
+			return fmt.Errorf("the value of data %s must be string for data message", k)
+		}
+	}
+
+	return nil
+}
+
+// payloadSizeLimit return the max payload bytes of notification, zero is unlimited.
+func payloadSizeLimit(req PushNotification) int {
+	switch req.Platform {
+	case PlatFormIos:
+		if iosPushType(req) == "voip" {
+			return PushConf.Ios.MaxVoIPPayloadSize
+		}
+		return PushConf.Ios.MaxPayloadSize
+	case PlatFormAndroid:
+		return PushConf.Android.MaxPayloadSize
+	}
+
+	return 0
+}
+
+// checkIosData reject the data key aps, the custom keys of data are merged
+// into the top level of APNs payload beside aps dictionary. Legacy
+// notification sends data as the whole payload, so its aps is allowed.
+func checkIosData(req PushNotification) error {
+	if req.Platform != PlatFormIos || req.Legacy {
+		return nil
+	}
+
+	if _, ok := req.Data["aps"]; ok {
+		return errors.New("the data key aps is reserved for APNs, set legacy to send the whole payload")
+	}
+
+	return nil
+}
+
+// checkPayloadSize reject the notification before it is queued if provider
+// would reject it for the payload size.
+func checkPayloadSize(req PushNotification) error {
+	limit := payloadSizeLimit(req)
+	if limit <= 0 {
+		return nil
+	}
+
+	size, err := GetPayloadSize(req)
 	if err != nil {
 		return err
 	}
 
-	http.DefaultTransport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
-	LogAccess.Debug("Set http proxy as " + proxy)
+	if size > limit {
+		return fmt.Errorf("the payload size %d bytes exceeds the limit of %d bytes", size, limit)
+	}
 
 	return nil
 }
 
+// checkImage validate the image of iOS notification is http or https URL.
+func checkImage(req PushNotification) error {
+	if req.Platform != PlatFormIos || req.Image == "" {
+		return nil
+	}
+
+	u, err := url.Parse(req.Image)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("the image must be an http or https URL")
+	}
+
+	return nil
+}
+
+// checkAndroidColor validate the color of Android notification is #RRGGBB.
+func checkAndroidColor(req PushNotification) error {
+	if req.Platform != PlatFormAndroid || req.Android == nil || req.Android.Color == "" {
+		return nil
+	}
+
+	if !androidColorPattern.MatchString(req.Android.Color) {
+		return errors.New("the android color must be in #RRGGBB format")
+	}
+
+	return nil
+}
+
+// checkAnalyticsLabel validate the analytics label of FCM message, it is at
+// most 50 letters, digits and - _ . ~ %.
+func checkAnalyticsLabel(req PushNotification) error {
+	if req.Platform != PlatFormAndroid || req.AnalyticsLabel == "" {
+		return nil
+	}
+
+	if !fcmAnalyticsLabelPattern.MatchString(req.AnalyticsLabel) {
+		return errors.New("the analytics_label must match " + fcmAnalyticsLabelPattern.String())
+	}
+
+	return nil
+}
+
+// GetPayloadSize return the byte size of payload which would be sent to provider.
+// The limit of APNs applies to the aps payload and the limit of FCM applies
+// to the data and notification, so device tokens are not counted.
+func GetPayloadSize(req PushNotification) (int, error) {
+	var payload interface{}
+
+	switch req.Platform {
+	case PlatFormIos:
+		if req.Legacy {
+			payload = GetLegacyIOSNotification(req).Payload
+		} else {
+			payload = GetIOSNotification(req).Payload
+		}
+	case PlatFormAndroid:
+		message := GetAndroidNotification(req)
+		payload = struct {
+			Data         map[string]interface{} `json:"data,omitempty"`
+			Notification *fcm.Notification      `json:"notification,omitempty"`
+		}{message.Data, message.Notification}
+	case PlatFormWeb:
+		payload = GetWebNotification(req)
+	case PlatFormHuawei:
+		payload = newHMSMessage(req)
+	case PlatFormSNS:
+		payload = newSNSMessage(req)
+	default:
+		return 0, errors.New("unsupported platform")
+	}
+
+	content, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(content), nil
+}
+
 // CheckPushConf provide check your yml config.
 func CheckPushConf() error {
-	if !PushConf.Ios.Enabled && !PushConf.Android.Enabled {
-		return errors.New("Please enable iOS or Android config in yml config")
+	if !PushConf.Ios.Enabled && !PushConf.Android.Enabled && !PushConf.Web.Enabled && !PushConf.Huawei.Enabled && !PushConf.SNS.Enabled {
+		return errors.New("Please enable iOS, Android, Web, Huawei or SNS config in yml config")
 	}
 
 	if PushConf.Ios.Enabled {
-		if PushConf.Ios.KeyPath == "" && PushConf.Ios.KeyBase64 == "" {
-			return errors.New("Missing iOS certificate key")
+		if err := checkIosKey(iosDefaultApp()); err != nil {
+			return err
 		}
 
-		// check certificate file exist
-		if PushConf.Ios.KeyPath != "" {
-			if _, err := os.Stat(PushConf.Ios.KeyPath); os.IsNotExist(err) {
-				return errors.New("certificate file does not exist")
+		for name, app := range PushConf.Ios.Apps {
+			if err := checkIosKey(app); err != nil {
+				return fmt.Errorf("iOS app %s: %s", name, err)
 			}
 		}
 	}
 
 	if PushConf.Android.Enabled {
-		if PushConf.Android.APIKey == "" {
+		if err := checkAndroidKey(androidDefaultApp()); err != nil {
+			return err
+		}
+
+		for name, app := range PushConf.Android.Apps {
+			if err := checkAndroidKey(app); err != nil {
+				return fmt.Errorf("Android app %s: %s", name, err)
+			}
+		}
+	}
+
+	if PushConf.Web.Enabled {
+		if PushConf.Web.VAPIDPublicKey == "" || PushConf.Web.VAPIDPrivateKey == "" {
+			return errors.New("Missing Web VAPID key")
+		}
+
+		if PushConf.Web.Subject == "" {
+			return errors.New("Missing Web VAPID subject")
+		}
+	}
+
+	if PushConf.Huawei.Enabled {
+		if PushConf.Huawei.AppID == "" || PushConf.Huawei.AppSecret == "" {
+			return errors.New("Missing Huawei app ID or app secret")
+		}
+	}
+
+	if PushConf.SNS.Enabled {
+		if snsRegion() == "" {
+			return errors.New("Missing SNS region")
+		}
+
+		if (PushConf.SNS.AccessKeyID == "") != (PushConf.SNS.SecretAccessKey == "") {
+			return errors.New("Missing SNS access key ID or secret access key")
+		}
+	}
+
+	return nil
+}
+
+// checkAndroidKey validate the api key or credential of Firebase project.
+func checkAndroidKey(app config.SectionAndroidApp) error {
+	switch app.APIVersion {
+	case "legacy":
+		if app.APIKey == "" {
 			return errors.New("Missing Android API Key")
 		}
+	case "v1":
+		if app.Credential == "" && app.CredentialJSON == "" {
+			return errors.New("Missing Android credential")
+		}
+	default:
+		return errors.New("Android api_version must be v1 or legacy")
+	}
+
+	return nil
+}
+
+// checkIosKey validate the APNs key of app profile.
+func checkIosKey(app config.SectionIosApp) error {
+	if app.KeyPath == "" && app.KeyBase64 == "" {
+		return errors.New("Missing iOS certificate key")
+	}
+
+	// check certificate file exist
+	if app.KeyPath != "" {
+		if _, err := os.Stat(app.KeyPath); os.IsNotExist(err) {
+			return errors.New("certificate file does not exist")
+		}
+	}
+
+	// token-based authentication needs both key id and team id.
+	if iosKeyExt(app) == ".p8" {
+		if app.KeyID == "" || app.TeamID == "" {
+			return errors.New("Missing iOS key_id or team_id for p8 token authentication")
+		}
+	} else if app.KeyID != "" || app.TeamID != "" {
+		return errors.New("iOS key_id and team_id require p8 token authentication key")
 	}
 
 	return nil
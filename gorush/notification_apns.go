@@ -4,10 +4,15 @@ import (
 	"crypto/ecdsa"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/appleboy/gorush/config"
+
 	"github.com/mitchellh/mapstructure"
 	"github.com/sideshow/apns2"
 	"github.com/sideshow/apns2/certificate"
@@ -22,87 +27,201 @@ type Sound struct {
 	Volume   float32 `json:"volume,omitempty"`
 }
 
+// iosDefaultApp return the app profile of top level iOS config.
+func iosDefaultApp() config.SectionIosApp {
+	return config.SectionIosApp{
+		KeyPath:    PushConf.Ios.KeyPath,
+		KeyBase64:  PushConf.Ios.KeyBase64,
+		KeyType:    PushConf.Ios.KeyType,
+		Password:   PushConf.Ios.Password,
+		Production: PushConf.Ios.Production,
+		KeyID:      PushConf.Ios.KeyID,
+		TeamID:     PushConf.Ios.TeamID,
+		Topic:      PushConf.Ios.Topic,
+	}
+}
+
+// iosApp return the named app profile, the name is case insensitive.
+func iosApp(name string) (config.SectionIosApp, bool) {
+	app, ok := PushConf.Ios.Apps[strings.ToLower(name)]
+	return app, ok
+}
+
+// iosKeyExt return the extension of iOS key which decides the authentication type.
+func iosKeyExt(app config.SectionIosApp) string {
+	if app.KeyPath != "" {
+		return filepath.Ext(app.KeyPath)
+	}
+
+	return "." + app.KeyType
+}
+
 // InitAPNSClient use for initialize APNs Client.
 func InitAPNSClient() error {
 	if PushConf.Ios.Enabled {
-		var err error
-		var authKey *ecdsa.PrivateKey
-		var certificateKey tls.Certificate
-		var ext string
-
-		if PushConf.Ios.KeyPath != "" {
-			ext = filepath.Ext(PushConf.Ios.KeyPath)
-
-			switch ext {
-			case ".p12":
-				certificateKey, err = certificate.FromP12File(PushConf.Ios.KeyPath, PushConf.Ios.Password)
-			case ".pem":
-				certificateKey, err = certificate.FromPemFile(PushConf.Ios.KeyPath, PushConf.Ios.Password)
-			case ".p8":
-				authKey, err = token.AuthKeyFromFile(PushConf.Ios.KeyPath)
-			default:
-				err = errors.New("wrong certificate key extension")
-			}
-
-			if err != nil {
-				LogError.Error("Cert Error:", err.Error())
+		client, err := newApnsClient(iosDefaultApp())
+		if err != nil {
+			return err
+		}
 
+		clients := make(map[string]*apns2.Client, len(PushConf.Ios.Apps))
+		for name, app := range PushConf.Ios.Apps {
+			if clients[name], err = newApnsClient(app); err != nil {
 				return err
 			}
-		} else if PushConf.Ios.KeyBase64 != "" {
-			ext = "." + PushConf.Ios.KeyType
-			key, err := base64.StdEncoding.DecodeString(PushConf.Ios.KeyBase64)
-			if err != nil {
-				LogError.Error("base64 decode error:", err.Error())
+		}
 
-				return err
-			}
-			switch ext {
-			case ".p12":
-				certificateKey, err = certificate.FromP12Bytes(key, PushConf.Ios.Password)
-			case ".pem":
-				certificateKey, err = certificate.FromPemBytes(key, PushConf.Ios.Password)
-			case ".p8":
-				authKey, err = token.AuthKeyFromBytes(key)
-			default:
-				err = errors.New("wrong certificate key type")
-			}
+		closeApnsPools()
 
-			if err != nil {
-				LogError.Error("Cert Error:", err.Error())
+		size := PushConf.Ios.ConnPoolSize
+		interval := time.Duration(PushConf.Ios.HealthCheckInterval) * time.Second
 
-				return err
-			}
+		ApnsPool = newApnsPool(client, size, interval)
+		ApnsClient = ApnsPool.clients[0]
+		ApnsPools = make(map[string]*ApnsClientPool, len(clients))
+		ApnsOtherPools = map[string]*ApnsClientPool{
+			"": newApnsPool(apnsOtherHost(client), size, interval),
 		}
-
-		if ext == ".p8" && PushConf.Ios.KeyID != "" && PushConf.Ios.TeamID != "" {
-			token := &token.Token{
-				AuthKey: authKey,
-				// KeyID from developer account (Certificates, Identifiers & Profiles -> Keys)
-				KeyID: PushConf.Ios.KeyID,
-				// TeamID from developer account (View Account -> Membership)
-				TeamID: PushConf.Ios.TeamID,
-			}
-			if PushConf.Ios.Production {
-				ApnsClient = apns2.NewTokenClient(token).Production()
-			} else {
-				ApnsClient = apns2.NewTokenClient(token).Development()
-			}
-		} else {
-			if PushConf.Ios.Production {
-				ApnsClient = apns2.NewClient(certificateKey).Production()
-			} else {
-				ApnsClient = apns2.NewClient(certificateKey).Development()
-			}
+		for name, client := range clients {
+			ApnsPools[name] = newApnsPool(client, size, interval)
+			ApnsOtherPools[name] = newApnsPool(apnsOtherHost(client), size, interval)
 		}
 	}
 
 	return nil
 }
 
+// apnsOtherHost return the client with same credential which sends to the
+// other APNs host, production if the client is development and vice versa.
+func apnsOtherHost(client *apns2.Client) *apns2.Client {
+	other := *client
+	if client.Host == apns2.HostProduction {
+		other.Host = apns2.HostDevelopment
+	} else {
+		other.Host = apns2.HostProduction
+	}
+
+	return &other
+}
+
+// closeApnsPools close the connections of previous initialized pools.
+func closeApnsPools() {
+	if ApnsPool != nil {
+		ApnsPool.Close()
+	}
+
+	for _, pool := range ApnsPools {
+		pool.Close()
+	}
+
+	for _, pool := range ApnsOtherPools {
+		pool.Close()
+	}
+}
+
+// newApnsClient create APNs client with the key of app profile.
+func newApnsClient(app config.SectionIosApp) (*apns2.Client, error) {
+	var err error
+	var authKey *ecdsa.PrivateKey
+	var certificateKey tls.Certificate
+	var ext string
+
+	if app.KeyPath != "" {
+		ext = filepath.Ext(app.KeyPath)
+
+		switch ext {
+		case ".p12":
+			certificateKey, err = certificate.FromP12File(app.KeyPath, app.Password)
+		case ".pem":
+			certificateKey, err = certificate.FromPemFile(app.KeyPath, app.Password)
+		case ".p8":
+			authKey, err = token.AuthKeyFromFile(app.KeyPath)
+		default:
+			err = errors.New("wrong certificate key extension")
+		}
+
+		if err != nil {
+			LogError.Error("Cert Error:", err.Error())
+
+			return nil, err
+		}
+	} else if app.KeyBase64 != "" {
+		ext = "." + app.KeyType
+		key, err := base64.StdEncoding.DecodeString(app.KeyBase64)
+		if err != nil {
+			LogError.Error("base64 decode error:", err.Error())
+
+			return nil, err
+		}
+		switch ext {
+		case ".p12":
+			certificateKey, err = certificate.FromP12Bytes(key, app.Password)
+		case ".pem":
+			certificateKey, err = certificate.FromPemBytes(key, app.Password)
+		case ".p8":
+			authKey, err = token.AuthKeyFromBytes(key)
+		default:
+			err = errors.New("wrong certificate key type")
+		}
+
+		if err != nil {
+			LogError.Error("Cert Error:", err.Error())
+
+			return nil, err
+		}
+	}
+
+	if ext == ".p8" && app.KeyID != "" && app.TeamID != "" {
+		// the signed JWT is cached in token and only regenerated
+		// before Apple's one hour expiry (token.TokenTimeout).
+		token := &token.Token{
+			AuthKey: authKey,
+			// KeyID from developer account (Certificates, Identifiers & Profiles -> Keys)
+			KeyID: app.KeyID,
+			// TeamID from developer account (View Account -> Membership)
+			TeamID: app.TeamID,
+		}
+		if app.Production {
+			return apns2.NewTokenClient(token).Production(), nil
+		}
+
+		return apns2.NewTokenClient(token).Development(), nil
+	}
+
+	if app.Production {
+		return apns2.NewClient(certificateKey).Production(), nil
+	}
+
+	return apns2.NewClient(certificateKey).Development(), nil
+}
+
+// iosMessage return the message of notification, the string alert is the
+// message if message is empty.
+func iosMessage(req PushNotification) string {
+	if req.Message != "" {
+		return req.Message
+	}
+
+	return req.Alert.Text
+}
+
+// hasAlertDictionary reports whether aps alert is dictionary instead of message string.
+func hasAlertDictionary(req PushNotification) bool {
+	a := req.Alert
+	return req.Title != "" || a.Title != "" || a.Subtitle != "" || a.Body != "" ||
+		a.TitleLocKey != "" || len(a.TitleLocArgs) > 0 || a.LocKey != "" || len(a.LocArgs) > 0 ||
+		a.Action != "" || a.ActionLocKey != "" || a.LaunchImage != "" ||
+		a.SummaryArg != "" || a.SummaryArgCount > 0
+}
+
 func iosAlertDictionary(payload *payload.Payload, req PushNotification) *payload.Payload {
 	// Alert dictionary
 
+	// message is the body of dictionary, otherwise the dictionary replaces it.
+	if message := iosMessage(req); len(message) > 0 && hasAlertDictionary(req) {
+		payload.AlertBody(message)
+	}
+
 	if len(req.Title) > 0 {
 		payload.AlertTitle(req.Title)
 	}
@@ -164,13 +283,131 @@ func iosAlertDictionary(payload *payload.Payload, req PushNotification) *payload
 	return payload
 }
 
+// iosTopicSuffixes is the suffix of apns-topic for push types which are
+// sent to the app with different topic.
+var iosTopicSuffixes = []string{".voip", ".complication", ".pushkit.fileprovider", ".location-query", ".push-type.liveactivity"}
+
+// iosAppTopic return the bundle ID of app profile of notification.
+func iosAppTopic(req PushNotification) string {
+	if req.credential != "" {
+		clients, err := requestCredentialClients(req)
+		if err != nil {
+			return ""
+		}
+		return clients.iosApp.Topic
+	}
+
+	if req.App != "" {
+		app, _ := iosApp(req.App)
+		return app.Topic
+	}
+
+	return PushConf.Ios.Topic
+}
+
+// iosTopic return the apns-topic of notification, default as topic of app profile.
+func iosTopic(req PushNotification) string {
+	if req.Topic == "" {
+		return iosAppTopic(req)
+	}
+
+	return req.Topic
+}
+
+// iosPriority return the apns-priority of notification, zero omits the header
+// and APNs sends it immediately. Apple requires background notification to be
+// sent with low priority.
+func iosPriority(req PushNotification) int {
+	if req.Priority == "normal" || iosPushType(req) == "background" {
+		return apns2.PriorityLow
+	}
+
+	if req.Priority == "high" {
+		return apns2.PriorityHigh
+	}
+
+	return 0
+}
+
+// iosPushType return the apns-push-type of notification. It defaults to the
+// type of topic suffix, background for notification which only wakes up app
+// and alert for notification which has alert. Empty omits the header.
+func iosPushType(req PushNotification) string {
+	if req.PushType != "" {
+		return req.PushType
+	}
+
+	topic := iosTopic(req)
+	switch {
+	case strings.HasSuffix(topic, ".voip"):
+		return "voip"
+	case strings.HasSuffix(topic, ".complication"):
+		return "complication"
+	case req.Legacy:
+		// legacy payload is taken from data.
+		return ""
+	case hasIOSAlert(req):
+		return "alert"
+	case req.ContentAvailable && req.Badge == nil && req.Sound == nil && req.SoundName == "":
+		return "background"
+	}
+
+	return ""
+}
+
+// checkIosAlert validate the iOS notification has something to deliver: the
+// title or body of alert, content-available, badge or sound. Either title or
+// body is enough. The data is the payload of voip, complication and legacy
+// notification, and template renders the alert, so they aren't checked.
+func checkIosAlert(req PushNotification) error {
+	if req.Platform != PlatFormIos || req.Legacy || req.Template != nil {
+		return nil
+	}
+
+	if t := iosPushType(req); t != "" && t != "alert" && t != "background" {
+		return nil
+	}
+
+	if hasIOSAlert(req) || req.ContentAvailable || req.Badge != nil || req.Sound != nil || req.SoundName != "" {
+		return nil
+	}
+
+	return errors.New("the ios message must specify title, message, content_available, badge or sound")
+}
+
+// hasIOSAlert check the notification displays alert.
+func hasIOSAlert(req PushNotification) bool {
+	return iosMessage(req) != "" ||
+		req.Title != "" ||
+		req.Alert.Title != "" ||
+		req.Alert.Subtitle != "" ||
+		req.Alert.Body != "" ||
+		req.Alert.LocKey != "" ||
+		req.Alert.TitleLocKey != ""
+}
+
+// apnsError return the error of APNs response, the Unregistered error has the
+// time the token became invalid.
+func apnsError(res *apns2.Response) error {
+	if res.Reason == apns2.ReasonUnregistered && !res.Timestamp.IsZero() {
+		return &unregisteredError{reason: res.Reason, at: res.Timestamp.Time}
+	}
+
+	return errors.New(res.Reason)
+}
+
+// isInvalidAPNsReason reports whether the APNs error means token is no longer valid.
+func isInvalidAPNsReason(reason string) bool {
+	return reason == apns2.ReasonUnregistered || reason == apns2.ReasonBadDeviceToken
+}
+
 // GetIOSNotification use for define iOS notification.
 // The iOS Notification Payload
 // ref: https://developer.apple.com/library/content/documentation/NetworkingInternet/Conceptual/RemoteNotificationsPG/PayloadKeyReference.html#//apple_ref/doc/uid/TP40008194-CH17-SW1
 func GetIOSNotification(req PushNotification) *apns2.Notification {
 	notification := &apns2.Notification{
 		ApnsID:     req.ApnsID,
-		Topic:      req.Topic,
+		Topic:      iosTopic(req),
 		CollapseID: req.CollapseID,
 	}
 
@@ -178,15 +415,13 @@ func GetIOSNotification(req PushNotification) *apns2.Notification {
 		notification.Expiration = time.Unix(req.Expiration, 0)
 	}
 
-	if len(req.Priority) > 0 && req.Priority == "normal" {
-		notification.Priority = apns2.PriorityLow
-	}
+	notification.Priority = iosPriority(req)
 
 	payload := payload.NewPayload()
 
 	// add alert object if message length > 0
-	if len(req.Message) > 0 {
-		payload.Alert(req.Message)
+	if message := iosMessage(req); len(message) > 0 {
+		payload.Alert(message)
 	}
 
 	// zero value for clear the badge on the app icon.
@@ -194,7 +429,8 @@ func GetIOSNotification(req PushNotification) *apns2.Notification {
 		payload.Badge(*req.Badge)
 	}
 
-	if req.MutableContent {
+	// the extension downloads image before the notification is displayed.
+	if req.MutableContent || req.Image != "" {
 		payload.MutableContent()
 	}
 
@@ -235,19 +471,67 @@ func GetIOSNotification(req PushNotification) *apns2.Notification {
 		payload.Custom(k, v)
 	}
 
+	if len(req.Image) > 0 {
+		payload.Custom(PushConf.Ios.ImageKey, req.Image)
+	}
+
 	payload = iosAlertDictionary(payload, req)
 
 	notification.Payload = payload
 
+	// the payload builder doesn't support the aps keys of iOS 15.
+	fields := make(map[string]interface{})
+	if req.InterruptionLevel != "" {
+		fields["interruption-level"] = req.InterruptionLevel
+	}
+	if req.RelevanceScore != nil {
+		fields["relevance-score"] = *req.RelevanceScore
+	}
+	if len(fields) > 0 {
+		notification.Payload = &apsPayload{Payload: payload, fields: fields}
+	}
+
 	return notification
 }
 
+// apsPayload add the fields to aps dictionary of payload.
+type apsPayload struct {
+	*payload.Payload
+	fields map[string]interface{}
+}
+
+// MarshalJSON merge the fields into aps of marshaled payload.
+func (p *apsPayload) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(p.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var content map[string]json.RawMessage
+	var aps map[string]interface{}
+	if err := json.Unmarshal(b, &content); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content["aps"], &aps); err != nil {
+		return nil, err
+	}
+
+	for k, v := range p.fields {
+		aps[k] = v
+	}
+	if content["aps"], err = json.Marshal(aps); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(content)
+}
+
 // GetLegacyIOSNotification prepares legacy IOS notification aps
 // it simply copies custom payload defined in data section and constructs copies to payload JSON
 func GetLegacyIOSNotification(req PushNotification) *apns2.Notification {
 	notification := &apns2.Notification{
 		ApnsID:     req.ApnsID,
-		Topic:      req.Topic,
+		Topic:      iosTopic(req),
 		CollapseID: req.CollapseID,
 	}
 
@@ -255,9 +539,7 @@ func GetLegacyIOSNotification(req PushNotification) *apns2.Notification {
 		notification.Expiration = time.Unix(req.Expiration, 0)
 	}
 
-	if len(req.Priority) > 0 && req.Priority == "normal" {
-		notification.Priority = apns2.PriorityLow
-	}
+	notification.Priority = iosPriority(req)
 
 	payload := make(map[string]interface{})
 
@@ -270,31 +552,66 @@ func GetLegacyIOSNotification(req PushNotification) *apns2.Notification {
 	return notification
 }
 
-func getApnsClient(req PushNotification) (client *apns2.Client) {
-	if req.Production {
-		client = ApnsClient.Production()
-	} else if req.Development {
-		client = ApnsClient.Development()
-	} else {
-		if PushConf.Ios.Production {
-			client = ApnsClient.Production()
-		} else {
-			client = ApnsClient.Development()
-		}
+// getApnsLogEntry return the push log entry with apns-id, status code and
+// reason returned by APNs.
+func getApnsLogEntry(status, token string, req PushNotification, errPush error, res *apns2.Response) LogPushEntry {
+	entry := getLogPushEntry(status, token, req, errPush)
+	entry.ApnsID = res.ApnsID
+	entry.StatusCode = res.StatusCode
+	entry.Reason = res.Reason
+
+	return entry
+}
+
+// getApnsClient pick the client of app profile, the top level iOS
+// config is used if notification doesn't specify app. The pool of the
+// other APNs host is used if notification overrides production.
+func getApnsClient(req PushNotification) *apns2.Client {
+	name := strings.ToLower(req.App)
+	pool := ApnsPool
+	production := PushConf.Ios.Production
+
+	if req.App != "" {
+		app, _ := iosApp(req.App)
+		pool = ApnsPools[name]
+		production = app.Production
+	}
+
+	host := apns2.HostDevelopment
+	if req.isProduction(production) {
+		host = apns2.HostProduction
 	}
-	return
+
+	client := pool.Client()
+	if client.Host != host {
+		client = ApnsOtherPools[name].Client()
+	}
+
+	return client
+}
+
+// iosClient return the client of request credentials or app profile.
+func iosClient(req PushNotification) (*apns2.Client, error) {
+	if req.credential != "" {
+		return credentialApnsClient(req)
+	}
+
+	return getApnsClient(req), nil
 }
 
 // PushToIOS provide send notification to APNs server.
 func PushToIOS(req PushNotification) bool {
-	LogAccess.Debug("Start push notification for iOS")
+	req.accessLog().Debug("Start push notification for iOS")
 	if PushConf.Core.Sync {
 		defer req.WaitDone()
 	}
 
+	start := time.Now()
+
 	var (
 		retryCount = 0
 		maxRetry   = PushConf.Ios.MaxRetry
+		lastErr    error
 	)
 
 	if req.Retry > 0 && req.Retry < maxRetry {
@@ -313,23 +630,54 @@ Retry:
 	} else {
 		notification = GetIOSNotification(req)
 	}
+	pushType := iosPushType(req)
+
+	breaker := breakers[PlatFormIos]
+	for i, token := range req.Tokens {
+		if req.canceled(req.Tokens[i:]) {
+			return true
+		}
 
-	client := getApnsClient(req)
+		if !breaker.allow() {
+			failUnavailable(req, req.Tokens[i:], retryCount)
+			isError = true
+			break
+		}
 
-	for _, token := range req.Tokens {
 		notification.DeviceToken = token
+		client, err := iosClient(req)
+		if err != nil {
+			// the credential error is never resent.
+			LogPush(FailedPush, token, req, err)
+			addPushResult(FailedPush, req)
+			if PushConf.Core.Sync {
+				req.AddLog(getLogPushEntry(FailedPush, token, req, err))
+			}
+			StatStorage.AddIosError(1)
+			isError = true
+			continue
+		}
 
 		// send ios notification
-		res, err := client.Push(notification)
+		res, err := client.PushWithContext(withApnsPushType(req.requestContext(), pushType), notification)
+		if err != nil && req.canceled(req.Tokens[i:]) {
+			// the request is timed out, it isn't the failure of provider.
+			return true
+		}
+		observePushDuration(req, start, err != nil || res.StatusCode != 200)
+		breaker.record(err != nil || res.StatusCode >= http.StatusInternalServerError)
 
 		if err != nil {
 			// apns server error
 			LogPush(FailedPush, token, req, err)
+			addFeedback(FailedPush, token, req, err, "")
+			addPushResult(FailedPush, req)
 			if PushConf.Core.Sync {
 				req.AddLog(getLogPushEntry(FailedPush, token, req, err))
 			}
 			StatStorage.AddIosError(1)
 			newTokens = append(newTokens, token)
+			lastErr = err
 			isError = true
 			continue
 		}
@@ -337,18 +685,39 @@ Retry:
 		if res.StatusCode != 200 {
 			// error message:
 			// ref: https://github.com/sideshow/apns2/blob/master/response.go#L14-L65
-			LogPush(FailedPush, token, req, errors.New(res.Reason))
+			if res.Reason == "" {
+				// the reason is missing in the body of some server errors.
+				res.Reason = http.StatusText(res.StatusCode)
+			}
+			errPush := apnsError(res)
+			entry := getApnsLogEntry(FailedPush, token, req, errPush, res)
+			logPush(req, entry, errPush)
+			addFeedback(FailedPush, token, req, errPush, res.ApnsID)
+			addPushResult(FailedPush, req)
 			if PushConf.Core.Sync {
-				req.AddLog(getLogPushEntry(FailedPush, token, req, errors.New(res.Reason)))
+				req.AddLog(entry)
 			}
 			StatStorage.AddIosError(1)
-			newTokens = append(newTokens, token)
 			isError = true
+			if isInvalidAPNsReason(res.Reason) {
+				// the dead token is never resent.
+				invalidateToken(token, req, errPush)
+				continue
+			}
+			newTokens = append(newTokens, token)
+			lastErr = errPush
 			continue
 		}
 
 		if res.Sent() {
-			LogPush(SucceededPush, token, req, nil)
+			entry := getApnsLogEntry(SucceededPush, token, req, nil, res)
+			logPush(req, entry, nil)
+			addFeedback(SucceededPush, token, req, nil, res.ApnsID)
+			addPushResult(SucceededPush, req)
+			if PushConf.Core.Sync {
+				// the apns-id of sent notification is reported to trace it.
+				req.AddLog(entry)
+			}
 			StatStorage.AddIosSuccess(1)
 		}
 	}
@@ -361,5 +730,9 @@ Retry:
 		goto Retry
 	}
 
+	if len(newTokens) > 0 {
+		addDeadLetter(req, newTokens, lastErr, retryCount+1)
+	}
+
 	return isError
 }
@@ -1,9 +1,14 @@
 package gorush
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,7 +33,7 @@ func TestDisabledAndroidIosConf(t *testing.T) {
 	err := CheckPushConf()
 
 	assert.Error(t, err)
-	assert.Equal(t, "Please enable iOS or Android config in yml config", err.Error())
+	assert.Equal(t, "Please enable iOS, Android, Web, Huawei or SNS config in yml config", err.Error())
 }
 
 func TestMissingIOSCertificate(t *testing.T) {
@@ -502,6 +507,161 @@ func TestIOSAlertNotificationStructure(t *testing.T) {
 	assert.Contains(t, locArgs, "b")
 }
 
+func TestIOSTitleOrBodyOnly(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	req := PushNotification{
+		Tokens:   []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
+		Platform: PlatFormIos,
+		Title:    "Glance",
+	}
+
+	assert.NoError(t, CheckMessage(req))
+	dump, _ := json.Marshal(GetIOSNotification(req).Payload)
+	assert.JSONEq(t, `{"aps":{"alert":{"title":"Glance"}}}`, string(dump))
+	assert.Equal(t, "alert", iosPushType(req))
+
+	req.Title, req.Message = "", "Welcome"
+	assert.NoError(t, CheckMessage(req))
+	dump, _ = json.Marshal(GetIOSNotification(req).Payload)
+	assert.JSONEq(t, `{"aps":{"alert":"Welcome"}}`, string(dump))
+
+	// nothing is displayed or delivered to app.
+	req.Message = ""
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the ios message must specify title, message, content_available, badge or sound", err.Error())
+
+	badge := 0
+	req.Badge = &badge
+	assert.NoError(t, CheckMessage(req))
+
+	req.Badge = nil
+	req.ContentAvailable = true
+	assert.NoError(t, CheckMessage(req))
+
+	// the data is the payload of voip notification.
+	req.ContentAvailable = false
+	req.Topic = "com.example.app.voip"
+	assert.NoError(t, CheckMessage(req))
+}
+
+func TestIOSInterruptionLevelAndRelevanceScore(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	req := PushNotification{
+		Tokens:   []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
+		Platform: PlatFormIos,
+		Message:  "Welcome",
+		Data:     D{"key": "value"},
+	}
+
+	// the payload isn't changed if they are unset.
+	dump, _ := json.Marshal(GetIOSNotification(req).Payload)
+	assert.JSONEq(t, `{"aps":{"alert":"Welcome"},"key":"value"}`, string(dump))
+
+	score := 0.8
+	req.InterruptionLevel = "time-sensitive"
+	req.RelevanceScore = &score
+	assert.NoError(t, CheckMessage(req))
+	dump, _ = json.Marshal(GetIOSNotification(req).Payload)
+	assert.JSONEq(t, `{"aps":{"alert":"Welcome","interruption-level":"time-sensitive","relevance-score":0.8},"key":"value"}`, string(dump))
+
+	req.InterruptionLevel = "urgent"
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the interruption-level must be one of passive, active, time-sensitive, critical", err.Error())
+
+	req.InterruptionLevel = ""
+	score = 1.5
+	err = CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the relevance-score must be between 0.0 and 1.0", err.Error())
+}
+
+func TestIOSCustomTopLevelKeys(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	req := PushNotification{
+		Tokens:   []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
+		Platform: PlatFormIos,
+		Message:  "Welcome",
+		Data: D{
+			"deep_link":   "app://campaign/1",
+			"campaign_id": 1,
+		},
+	}
+
+	assert.NoError(t, CheckMessage(req))
+	dump, _ := json.Marshal(GetIOSNotification(req).Payload)
+	assert.JSONEq(t, `{"aps":{"alert":"Welcome"},"deep_link":"app://campaign/1","campaign_id":1}`, string(dump))
+
+	// aps of data would clobber the aps dictionary.
+	req.Data["aps"] = D{"badge": 1}
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the data key aps is reserved for APNs, set legacy to send the whole payload", err.Error())
+
+	req.Legacy = true
+	assert.NoError(t, CheckMessage(req))
+
+	// the size of merged payload is validated.
+	req.Legacy = false
+	delete(req.Data, "aps")
+	req.Data["deep_link"] = strings.Repeat("a", PushConf.Ios.MaxPayloadSize)
+	err = CheckMessage(req)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the limit of 4096 bytes")
+}
+func TestIOSAlertStringOrDictionary(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+
+	var req PushNotification
+	assert.NoError(t, json.Unmarshal([]byte(`{"tokens":["aaaaa"],"platform":1,"alert":"Hello World"}`), &req))
+	assert.Equal(t, "Hello World", req.Alert.Text)
+	assert.NoError(t, CheckMessage(req))
+
+	// the string alert is sent as string.
+	data, err := json.Marshal(GetIOSNotification(req).Payload)
+	assert.NoError(t, err)
+	alert, err := jsonparser.GetString(data, "aps", "alert")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello World", alert)
+
+	// the string alert is kept in queue or storage.
+	saved, err := json.Marshal(req)
+	assert.NoError(t, err)
+	assert.Contains(t, string(saved), `"alert":"Hello World"`)
+	var restored PushNotification
+	assert.NoError(t, json.Unmarshal(saved, &restored))
+	assert.Equal(t, "Hello World", restored.Alert.Text)
+
+	// message is used instead of string alert.
+	req.Message = "Welcome"
+	data, _ = json.Marshal(GetIOSNotification(req).Payload)
+	alert, _ = jsonparser.GetString(data, "aps", "alert")
+	assert.Equal(t, "Welcome", alert)
+
+	req = PushNotification{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"tokens":["aaaaa"],"platform":1,"alert":{"title":"Game Request","body":"Bob wants to play poker"}}`), &req))
+	assert.Equal(t, "", req.Alert.Text)
+	assert.Equal(t, "Game Request", req.Alert.Title)
+	assert.NoError(t, CheckMessage(req))
+
+	data, _ = json.Marshal(GetIOSNotification(req).Payload)
+	title, _ := jsonparser.GetString(data, "aps", "alert", "title")
+	body, _ := jsonparser.GetString(data, "aps", "alert", "body")
+	assert.Equal(t, "Game Request", title)
+	assert.Equal(t, "Bob wants to play poker", body)
+
+	saved, _ = json.Marshal(req)
+	assert.Contains(t, string(saved), `"alert":{"body":"Bob wants to play poker","title":"Game Request"}`)
+
+	// the string alert without other fields is valid, empty one isn't.
+	assert.Error(t, json.Unmarshal([]byte(`{"alert":1}`), &req))
+	req = PushNotification{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"tokens":["aaaaa"],"platform":1,"alert":""}`), &req))
+	assert.Error(t, CheckMessage(req))
+}
+
+
 func TestDisabledIosNotifications(t *testing.T) {
 	PushConf, _ = config.LoadConf("")
 
@@ -511,6 +671,7 @@ func TestDisabledIosNotifications(t *testing.T) {
 	assert.Nil(t, err)
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 
 	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
@@ -693,17 +854,22 @@ func TestApnsHostFromRequest(t *testing.T) {
 	err = InitAppStatus()
 	assert.Nil(t, err)
 
+	production := true
 	req := PushNotification{
-		Production: true,
+		Production: &production,
 	}
 	client := getApnsClient(req)
 	assert.Equal(t, apns2.HostProduction, client.Host)
+	assert.Equal(t, ApnsOtherPools[""].clients[0], client)
+	// the client of configured host isn't changed.
+	assert.Equal(t, apns2.HostDevelopment, ApnsClient.Host)
 
 	req = PushNotification{
 		Development: true,
 	}
 	client = getApnsClient(req)
 	assert.Equal(t, apns2.HostDevelopment, client.Host)
+	assert.Equal(t, ApnsClient, client)
 
 	req = PushNotification{}
 	PushConf.Ios.Production = true
@@ -713,4 +879,359 @@ func TestApnsHostFromRequest(t *testing.T) {
 	PushConf.Ios.Production = false
 	client = getApnsClient(req)
 	assert.Equal(t, apns2.HostDevelopment, client.Host)
+
+	// sandbox is overridden for production config.
+	PushConf.Ios.Production = true
+	production = false
+	req = PushNotification{
+		Production: &production,
+	}
+	client = getApnsClient(req)
+	assert.Equal(t, apns2.HostDevelopment, client.Host)
+}
+
+func TestApnsClientFromAppProfile(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = false
+
+	PushConf.Ios.Enabled = true
+	PushConf.Ios.KeyPath = "../certificate/certificate-valid.pem"
+	PushConf.Ios.Apps = map[string]config.SectionIosApp{
+		"example": {
+			KeyPath:    "../certificate/authkey-valid.p8",
+			Production: true,
+			KeyID:      "ABC123DEFG",
+			TeamID:     "DEF123GHIJ",
+			Topic:      "com.example.app",
+		},
+	}
+	assert.NoError(t, CheckPushConf())
+	err := InitAPNSClient()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ApnsPools))
+
+	req := PushNotification{
+		App: "Example",
+	}
+	client := getApnsClient(req)
+	assert.Equal(t, ApnsPools["example"].clients[0], client)
+	assert.Equal(t, apns2.HostProduction, client.Host)
+	assert.Equal(t, "com.example.app", GetIOSNotification(req).Topic)
+
+	req.Topic = "com.example.app.voip"
+	assert.Equal(t, "com.example.app.voip", GetIOSNotification(req).Topic)
+
+	// QA build of app is sent to sandbox.
+	production := false
+	req.Production = &production
+	client = getApnsClient(req)
+	assert.Equal(t, ApnsOtherPools["example"].clients[0], client)
+	assert.Equal(t, apns2.HostDevelopment, client.Host)
+
+	// top level config is used without app.
+	client = getApnsClient(PushNotification{})
+	assert.Equal(t, ApnsClient, client)
+	assert.Equal(t, apns2.HostDevelopment, client.Host)
+
+	// key of app profile is validated.
+	PushConf.Ios.Apps["example"] = config.SectionIosApp{
+		KeyPath: "../certificate/authkey-valid.p8",
+	}
+	err = CheckPushConf()
+	assert.Error(t, err)
+	assert.Equal(t, "iOS app example: Missing iOS key_id or team_id for p8 token authentication", err.Error())
+}
+
+func TestIOSPriority(t *testing.T) {
+	req := PushNotification{
+		Message:  "Welcome",
+		Priority: "high",
+	}
+
+	assert.Equal(t, apns2.PriorityHigh, GetIOSNotification(req).Priority)
+
+	req.Priority = "normal"
+	assert.Equal(t, apns2.PriorityLow, GetIOSNotification(req).Priority)
+	assert.Equal(t, apns2.PriorityLow, GetLegacyIOSNotification(req).Priority)
+
+	// header is omitted.
+	req.Priority = ""
+	assert.Equal(t, 0, GetIOSNotification(req).Priority)
+
+	// background notification must be sent with low priority.
+	req = PushNotification{
+		Priority:         "high",
+		ContentAvailable: true,
+	}
+	assert.Equal(t, apns2.PriorityLow, GetIOSNotification(req).Priority)
+
+	req.Badge = new(int)
+	assert.Equal(t, apns2.PriorityHigh, GetIOSNotification(req).Priority)
+}
+
+func TestIOSBadge(t *testing.T) {
+	// omitted badge keeps the badge of app icon.
+	req := PushNotification{ContentAvailable: true}
+	data, _ := json.Marshal(GetIOSNotification(req).Payload)
+	_, _, _, err := jsonparser.Get(data, "aps", "badge")
+	assert.Equal(t, jsonparser.KeyPathNotFoundError, err)
+
+	// zero badge clears it.
+	req.Badge = new(int)
+	data, _ = json.Marshal(GetIOSNotification(req).Payload)
+	badge, err := jsonparser.GetInt(data, "aps", "badge")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), badge)
+}
+
+func TestIOSBackgroundNotification(t *testing.T) {
+	req := PushNotification{
+		Tokens:           []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
+		Platform:         PlatFormIos,
+		ContentAvailable: true,
+		MutableContent:   true,
+	}
+
+	// background notification has no alert.
+	assert.NoError(t, CheckMessage(req))
+	assert.Equal(t, "background", iosPushType(req))
+
+	notification := GetIOSNotification(req)
+	dump, _ := json.Marshal(notification.Payload)
+	contentAvailable, _ := jsonparser.GetInt(dump, "aps", "content-available")
+	mutableContent, _ := jsonparser.GetInt(dump, "aps", "mutable-content")
+	assert.Equal(t, int64(1), contentAvailable)
+	assert.Equal(t, int64(1), mutableContent)
+
+	req.Message = "Welcome"
+	assert.Equal(t, "alert", iosPushType(req))
+
+	// legacy payload is taken from data.
+	req.Message = ""
+	req.Legacy = true
+	assert.Empty(t, iosPushType(req))
+}
+
+func TestIOSPushType(t *testing.T) {
+	req := PushNotification{
+		Tokens:   []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
+		Platform: PlatFormIos,
+		Topic:    "com.example.app.voip",
+		Message:  "Welcome",
+	}
+
+	assert.Equal(t, "voip", iosPushType(req))
+
+	req.Topic = "com.example.app.watchkitapp.complication"
+	assert.Equal(t, "complication", iosPushType(req))
+
+	req.Topic = "com.example.app"
+	req.PushType = "mdm"
+	assert.NoError(t, CheckMessage(req))
+	assert.Equal(t, "mdm", iosPushType(req))
+
+	// background push type is sent with low priority.
+	req.PushType = "background"
+	assert.Equal(t, apns2.PriorityLow, GetIOSNotification(req).Priority)
+
+	req.PushType = "unknown"
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the push_type must be one of alert, background, voip, complication, fileprovider, mdm", err.Error())
+
+	// no alert and nothing to wake up app.
+	req = PushNotification{Badge: new(int)}
+	assert.Empty(t, iosPushType(req))
+}
+
+func TestIOSTopic(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Ios.Topic = "com.example.app"
+	PushConf.Ios.Apps = map[string]config.SectionIosApp{
+		"billing": {Topic: "com.example.billing"},
+	}
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+	}()
+
+	req := PushNotification{
+		Tokens:   []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
+		Platform: PlatFormIos,
+		Message:  "Welcome",
+	}
+
+	// topic of app profile is the default.
+	assert.Equal(t, "com.example.app", iosTopic(req))
+	assert.Equal(t, "com.example.app", GetIOSNotification(req).Topic)
+	req.App = "billing"
+	assert.Equal(t, "com.example.billing", iosTopic(req))
+
+	// topic of notification overrides apns-topic of the send.
+	req.App = ""
+	for _, topic := range []string{"com.example.app", "com.example.app.voip", "com.example.app.watchkitapp.complication"} {
+		req.Topic = topic
+		assert.NoError(t, checkIosTopic(req))
+		assert.Equal(t, topic, GetIOSNotification(req).Topic)
+	}
+
+	req.Topic = "com.example.billing.voip"
+	assert.EqualError(t, checkIosTopic(req), "the topic must be com.example.app or under it with suffix of .voip, .complication, .pushkit.fileprovider, .location-query, .push-type.liveactivity")
+	req.App = "billing"
+	assert.NoError(t, checkIosTopic(req))
+
+	req.Topic = "com.example.app.voip"
+	assert.Error(t, CheckMessage(req))
+
+	// any topic is allowed if bundle ID isn't set.
+	PushConf.Ios.Topic = ""
+	req.App = ""
+	req.Topic = "com.other.app"
+	assert.NoError(t, checkIosTopic(req))
+}
+
+func TestIOSAlertWithoutLocalization(t *testing.T) {
+	req := PushNotification{
+		Message: "Welcome",
+		Alert: Alert{
+			Title:    "Hello",
+			Subtitle: "World",
+		},
+	}
+
+	notification := GetIOSNotification(req)
+	dump, _ := json.Marshal(notification.Payload)
+
+	assert.JSONEq(t, `{"aps":{"alert":{"title":"Hello","subtitle":"World","body":"Welcome"}}}`, string(dump))
+
+	// alert is message string without dictionary fields.
+	notification = GetIOSNotification(PushNotification{Message: "Welcome"})
+	dump, _ = json.Marshal(notification.Payload)
+
+	assert.JSONEq(t, `{"aps":{"alert":"Welcome"}}`, string(dump))
+}
+
+func TestIOSImageNotification(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Ios.ImageKey = "image_url"
+
+	req := PushNotification{
+		Tokens:   []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
+		Platform: PlatFormIos,
+		Message:  "Welcome",
+		Category: "marketing",
+		Image:    "https://example.com/banner.png",
+		Data:     D{"campaign": "spring"},
+	}
+
+	notification := GetIOSNotification(req)
+	dump, _ := json.Marshal(notification.Payload)
+	mutableContent, _ := jsonparser.GetInt(dump, "aps", "mutable-content")
+	category, _ := jsonparser.GetString(dump, "aps", "category")
+	image, _ := jsonparser.GetString(dump, "image_url")
+	campaign, _ := jsonparser.GetString(dump, "campaign")
+	assert.Equal(t, int64(1), mutableContent)
+	assert.Equal(t, "marketing", category)
+	assert.Equal(t, "https://example.com/banner.png", image)
+	assert.Equal(t, "spring", campaign)
+
+	req.Image = ""
+	dump, _ = json.Marshal(GetIOSNotification(req).Payload)
+	_, _, _, err := jsonparser.Get(dump, "aps", "mutable-content")
+	assert.Error(t, err)
+}
+
+func TestCheckApnsID(t *testing.T) {
+	req := PushNotification{Platform: PlatFormIos}
+	assert.NoError(t, checkApnsID(req))
+
+	req.ApnsID = "123e4567-e89b-12d3-a456-426655440000"
+	assert.NoError(t, checkApnsID(req))
+
+	req.ApnsID = "123e4567e89b12d3a456426655440000"
+	assert.Error(t, checkApnsID(req))
+
+	// apns_id is ignored by FCM.
+	req.Platform = PlatFormAndroid
+	assert.NoError(t, checkApnsID(req))
+}
+
+func TestPushToIOSApnsID(t *testing.T) {
+	_, _, cleanup := testApnsServer(t)
+	defer cleanup()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.Sync = true
+	PushConf.Log.HideToken = false
+	ApnsPool = newApnsPool(apns2.NewClient(tls.Certificate{}), 1, 0)
+	defer func() {
+		ApnsPool.Close()
+		ApnsPool = nil
+	}()
+
+	var logs []LogPushEntry
+	req := PushNotification{
+		Platform: PlatFormIos,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+		log:      &logs,
+	}
+	assert.False(t, PushToIOS(req))
+
+	// the apns-id generated by APNs.
+	assert.Equal(t, 1, len(logs))
+	assert.Equal(t, SucceededPush, logs[0].Type)
+	assert.Equal(t, "aaaaa", logs[0].Token)
+	assert.Equal(t, "apns-id", logs[0].ApnsID)
+
+	// the apns-id of client is echoed.
+	logs = nil
+	req.ApnsID = "123e4567-e89b-12d3-a456-426655440000"
+	assert.False(t, PushToIOS(req))
+	assert.Equal(t, 1, len(logs))
+	assert.Equal(t, req.ApnsID, logs[0].ApnsID)
+}
+
+func TestPushToIOSResponseReason(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("apns-id", "apns-id")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"reason":"` + apns2.ReasonTopicDisallowed + `"}`))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	dial := dialTLS
+	dialTLS = func(dialer *net.Dialer, network, addr string, cfg *tls.Config) (*tls.Conn, error) {
+		cfg.InsecureSkipVerify = true
+		return tls.DialWithDialer(dialer, network, server.Listener.Addr().String(), cfg)
+	}
+	defer func() {
+		dialTLS = dial
+	}()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.Sync = true
+	PushConf.Log.HideToken = false
+	ApnsPool = newApnsPool(apns2.NewClient(tls.Certificate{}), 1, 0)
+	defer func() {
+		ApnsPool.Close()
+		ApnsPool = nil
+	}()
+
+	var logs []LogPushEntry
+	req := PushNotification{
+		Platform: PlatFormIos,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+		log:      &logs,
+	}
+	assert.True(t, PushToIOS(req))
+
+	assert.Equal(t, 1, len(logs))
+	assert.Equal(t, FailedPush, logs[0].Type)
+	assert.Equal(t, http.StatusBadRequest, logs[0].StatusCode)
+	assert.Equal(t, apns2.ReasonTopicDisallowed, logs[0].Reason)
+	assert.Equal(t, apns2.ReasonTopicDisallowed, logs[0].Error)
+	assert.Equal(t, "apns-id", logs[0].ApnsID)
 }
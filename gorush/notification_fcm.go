@@ -3,10 +3,20 @@ package gorush
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gorush/config"
 )
 
+// fcmMaxTimeToLive is the maximum time_to_live of FCM message, four weeks.
+const fcmMaxTimeToLive = 2419200
+
+// fcmMulticastSize is the max number of registration tokens of one request.
+const fcmMulticastSize = 500
+
 // InitFCMClient use for initialize FCM Client.
 func InitFCMClient(key string) (*fcm.Client, error) {
 	var err error
@@ -27,6 +37,144 @@ func InitFCMClient(key string) (*fcm.Client, error) {
 	return FCMClient, nil
 }
 
+// InitFCM initialize the FCM client of android api version and the
+// clients of named Firebase projects.
+func InitFCM() error {
+	if PushConf.Android.Enabled {
+		clients := make(map[string]FCMSender, len(PushConf.Android.Apps))
+		for name, app := range PushConf.Android.Apps {
+			client, err := newFCMSender(app)
+			if err != nil {
+				return fmt.Errorf("Android app %s: %s", name, err)
+			}
+			clients[name] = client
+		}
+		FCMClients = clients
+	}
+
+	if PushConf.Android.APIVersion == "legacy" {
+		_, err := InitFCMClient(PushConf.Android.APIKey)
+		return err
+	}
+
+	if PushConf.Android.Enabled {
+		_, err := InitFCMv1Client()
+		return err
+	}
+
+	return nil
+}
+
+// androidDefaultApp return the Firebase project of top level android config.
+func androidDefaultApp() config.SectionAndroidApp {
+	return config.SectionAndroidApp{
+		APIVersion:     PushConf.Android.APIVersion,
+		APIKey:         PushConf.Android.APIKey,
+		Credential:     PushConf.Android.Credential,
+		CredentialJSON: PushConf.Android.CredentialJSON,
+	}
+}
+
+// androidApp return the named Firebase project, the name is case insensitive.
+func androidApp(name string) (config.SectionAndroidApp, bool) {
+	app, ok := PushConf.Android.Apps[strings.ToLower(name)]
+	return app, ok
+}
+
+// newFCMSender create FCM client of the Firebase project.
+func newFCMSender(app config.SectionAndroidApp) (FCMSender, error) {
+	if app.APIVersion == "legacy" {
+		if app.APIKey == "" {
+			return nil, errors.New("Missing Android API Key")
+		}
+		client, err := fcm.NewClient(app.APIKey)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	data, err := fcmCredential(app)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newFCMv1Client(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// FCMSender send message to FCM, it is implemented by legacy and HTTP v1 client.
+type FCMSender interface {
+	Send(msg *fcm.Message) (*fcm.Response, error)
+}
+
+// sendFCM send message with direct_boot_ok and analytics_label of
+// notification, they are only supported by HTTP v1 API.
+func sendFCM(client FCMSender, msg *fcm.Message, req PushNotification) (*fcm.Response, error) {
+	if v1, ok := client.(*FCMv1Client); ok {
+		return v1.SendWithOptions(msg, FCMv1Options{
+			DirectBootOK:   req.DirectBootOK,
+			AnalyticsLabel: req.AnalyticsLabel,
+		})
+	}
+
+	return client.Send(msg)
+}
+
+// getFCMClient return the FCM client of android config or the named Firebase
+// project, the api key of notification is only supported by legacy API.
+func getFCMClient(key, app string) (FCMSender, error) {
+	if key == "" && app != "" {
+		client, ok := FCMClients[strings.ToLower(app)]
+		if !ok {
+			return nil, fmt.Errorf("the Android app %s is not initialized", app)
+		}
+		return client, nil
+	}
+
+	if key == "" && PushConf.Android.APIVersion != "legacy" {
+		return InitFCMv1Client()
+	}
+
+	if key == "" {
+		key = PushConf.Android.APIKey
+	}
+
+	client, err := InitFCMClient(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// androidClient return the client of request credentials or android config.
+func androidClient(req PushNotification) (FCMSender, error) {
+	if req.credential != "" {
+		return credentialFCMClient(req)
+	}
+
+	return getFCMClient(req.APIKey, req.App)
+}
+
+// fcmTimeToLive convert the expiration timestamp to time_to_live seconds
+// within FCM limit.
+func fcmTimeToLive(expiration int64) uint {
+	ttl := expiration - time.Now().Unix()
+	if ttl < 0 {
+		return 0
+	}
+	if ttl > fcmMaxTimeToLive {
+		return fcmMaxTimeToLive
+	}
+
+	return uint(ttl)
+}
+
 // GetAndroidNotification use for define Android notification.
 // HTTP Connection Server Reference for Android
 // https://firebase.google.com/docs/cloud-messaging/http-server-ref
@@ -43,12 +191,21 @@ func GetAndroidNotification(req PushNotification) *fcm.Message {
 		DryRun:                req.DryRun,
 	}
 
+	if topic := req.fcmTopic(); topic != "" {
+		notification.To = topic
+	}
+
 	if len(req.Tokens) > 0 {
 		notification.RegistrationIDs = req.Tokens
 	}
 
-	if len(req.Priority) > 0 && req.Priority == "high" {
-		notification.Priority = "high"
+	if req.Priority == "high" || req.Priority == "normal" {
+		notification.Priority = req.Priority
+	}
+
+	if req.TimeToLive == nil && req.Expiration > 0 {
+		ttl := fcmTimeToLive(req.Expiration)
+		notification.TimeToLive = &ttl
 	}
 
 	// Add another field
@@ -59,81 +216,171 @@ func GetAndroidNotification(req PushNotification) *fcm.Message {
 		}
 	}
 
-	notification.Notification = &req.Notification
+	n := req.Notification
 
 	// Set request message if body is empty
 	if len(req.Message) > 0 {
-		notification.Notification.Body = req.Message
+		n.Body = req.Message
 	}
 
 	if len(req.Title) > 0 {
-		notification.Notification.Title = req.Title
+		n.Title = req.Title
 	}
 
 	if v, ok := req.Sound.(string); ok && len(v) > 0 {
-		notification.Notification.Sound = v
+		n.Sound = v
+	}
+
+	if a := req.Android; a != nil {
+		setAndroidNotification(&n, *a)
 	}
 
+	// data message is handled by app in background and never displayed,
+	// it is sent with normal priority as FCM default if priority is omitted.
+	if n == (fcm.Notification{}) {
+		if notification.Priority == "" {
+			notification.Priority = "normal"
+		}
+		return notification
+	}
+	notification.Notification = &n
+
 	return notification
 }
 
-// PushToAndroid provide send notification to Android server.
+// isFCMDataMessage reports whether the android notification is data message
+// without notification payload.
+func isFCMDataMessage(req PushNotification) bool {
+	return req.Platform == PlatFormAndroid && req.Template == nil && GetAndroidNotification(req).Notification == nil
+}
+
+// setAndroidNotification override the notification by the non-empty fields
+// of android notification options.
+func setAndroidNotification(n *fcm.Notification, a AndroidNotification) {
+	for _, f := range []struct {
+		field *string
+		value string
+	}{
+		{&n.ChannelID, a.ChannelID},
+		{&n.Icon, a.Icon},
+		{&n.Color, a.Color},
+		{&n.Tag, a.Tag},
+		{&n.ClickAction, a.ClickAction},
+		{&n.Sound, a.Sound},
+	} {
+		if f.value != "" {
+			*f.field = f.value
+		}
+	}
+}
+
+// PushToAndroid provide send notification to Android server. The tokens are
+// sent in batches of at most fcmMulticastSize tokens, one multicast request
+// for each batch.
 func PushToAndroid(req PushNotification) bool {
-	LogAccess.Debug("Start push notification for Android")
+	req.accessLog().Debug("Start push notification for Android")
 	if PushConf.Core.Sync {
 		defer req.WaitDone()
 	}
 
+	// check message
+	if err := CheckMessage(req); err != nil {
+		req.errorLog().Error("request error: " + err.Error())
+		return false
+	}
+
+	if len(req.Tokens) <= fcmMulticastSize {
+		return pushToAndroid(req)
+	}
+
+	isError := false
+	for tokens := req.Tokens; len(tokens) > 0; {
+		n := fcmMulticastSize
+		if len(tokens) < n {
+			n = len(tokens)
+		}
+
+		batch := req
+		batch.Tokens = tokens[:n:n]
+		tokens = tokens[n:]
+
+		if pushToAndroid(batch) {
+			isError = true
+		}
+	}
+
+	return isError
+}
+
+// pushToAndroid send the multicast request of notification and retry the
+// failed tokens.
+func pushToAndroid(req PushNotification) bool {
+	start := time.Now()
+
 	var (
-		client     *fcm.Client
+		client     FCMSender
+		err        error
 		retryCount = 0
 		maxRetry   = PushConf.Android.MaxRetry
+		attempt    = 0
+		sends      = 0
+		lastErr    error
 	)
 
 	if req.Retry > 0 && req.Retry < maxRetry {
 		maxRetry = req.Retry
 	}
 
-	// check message
-	err := CheckMessage(req)
-
-	if err != nil {
-		LogError.Error("request error: " + err.Error())
-		return false
-	}
-
 Retry:
 	var isError = false
+	var retryErr error
+	var retryTopic string
+	var topicErr error
 
-	notification := GetAndroidNotification(req)
-
-	if req.APIKey != "" {
-		client, err = InitFCMClient(req.APIKey)
-	} else {
-		client, err = InitFCMClient(PushConf.Android.APIKey)
+	if req.canceled(req.recipients()) {
+		return true
 	}
 
+	notification := GetAndroidNotification(req)
+
+	client, err = androidClient(req)
 	if err != nil {
 		// FCM server error
-		LogError.Error("FCM server error: " + err.Error())
+		req.errorLog().Error("FCM server error: " + err.Error())
 		return false
 	}
 
-	res, err := client.Send(notification)
+	breaker := breakers[PlatFormAndroid]
+	if !breaker.allow() {
+		failUnavailable(req, req.recipients(), sends)
+		observePushDuration(req, start, true)
+		return true
+	}
+
+	sends++
+	res, err := sendFCM(client, notification, req)
+	breaker.record(err != nil)
 	if err != nil {
+		if isTransientFCMError(err) && attempt < PushConf.Android.Retry.MaxAttempts && waitFCMRetry(req, attempt, err) {
+			attempt++
+			goto Retry
+		}
+
 		// Send Message error
-		LogError.Error("FCM server send message error: " + err.Error())
+		observePushDuration(req, start, true)
+		req.errorLog().Error("FCM server send message error: " + err.Error())
+		addDeadLetter(req, req.Tokens, err, sends)
 		return false
 	}
 
 	if !req.IsTopic() {
-		LogAccess.Debug(fmt.Sprintf("Android Success count: %d, Failure count: %d", res.Success, res.Failure))
+		req.accessLog().Debug(fmt.Sprintf("Android Success count: %d, Failure count: %d", res.Success, res.Failure))
 	}
 
 	StatStorage.AddAndroidSuccess(int64(res.Success))
 	StatStorage.AddAndroidError(int64(res.Failure))
 
-	var newTokens []string
+	var newTokens, retryTokens []string
 	// result from Send messages to specific devices
 	for k, result := range res.Results {
 		to := ""
@@ -145,36 +392,49 @@ Retry:
 
 		if result.Error != nil {
 			isError = true
-			newTokens = append(newTokens, to)
-			LogPush(FailedPush, to, req, result.Error)
-			if PushConf.Core.Sync {
-				req.AddLog(getLogPushEntry(FailedPush, to, req, result.Error))
+			// transient error is resent with backoff, log it after the last attempt.
+			if isTransientFCMError(result.Error) && attempt < PushConf.Android.Retry.MaxAttempts {
+				retryErr = result.Error
+				retryTokens = append(retryTokens, to)
+				continue
+			}
+
+			if isInvalidTokenError(result.Error) {
+				invalidateToken(to, req, result.Error)
+			} else {
+				newTokens = append(newTokens, to)
+				lastErr = result.Error
 			}
+			logAndroidFailure(to, req, result.Error, result.MessageID)
 			continue
 		}
 
 		LogPush(SucceededPush, to, req, nil)
+		addFeedback(SucceededPush, to, req, nil, result.MessageID)
+		addPushResult(SucceededPush, req)
 	}
 
 	// result from Send messages to topics
 	if req.IsTopic() {
-		to := ""
-		if req.To != "" {
-			to = req.To
-		} else {
-			to = req.Condition
+		to := notification.To
+		if to == "" {
+			to = notification.Condition
 		}
-		LogAccess.Debug("Send Topic Message: ", to)
+		req.accessLog().Debug("Send Topic Message: ", to)
 		// Success
-		if res.MessageID != 0 {
+		if res.Error == nil {
 			LogPush(SucceededPush, to, req, nil)
+			addFeedback(SucceededPush, to, req, nil, strconv.FormatInt(res.MessageID, 10))
+			addPushResult(SucceededPush, req)
+		} else if isTransientFCMError(res.Error) && attempt < PushConf.Android.Retry.MaxAttempts {
+			isError = true
+			retryErr = res.Error
+			retryTopic = to
 		} else {
 			isError = true
 			// failure
-			LogPush(FailedPush, to, req, res.Error)
-			if PushConf.Core.Sync {
-				req.AddLog(getLogPushEntry(FailedPush, to, req, res.Error))
-			}
+			logAndroidFailure(to, req, res.Error, "")
+			topicErr = res.Error
 		}
 	}
 
@@ -184,6 +444,7 @@ Retry:
 		for _, id := range res.FailedRegistrationIDs {
 			newTokens = append(newTokens, id)
 		}
+		lastErr = errors.New("device group: partial success or all fails")
 
 		LogPush(FailedPush, notification.To, req, errors.New("device group: partial success or all fails"))
 		if PushConf.Core.Sync {
@@ -191,6 +452,32 @@ Retry:
 		}
 	}
 
+	observePushDuration(req, start, isError)
+
+	if retryErr != nil {
+		if waitFCMRetry(req, attempt, retryErr) {
+			attempt++
+			if retryCount < maxRetry {
+				// resend fail token together
+				retryCount++
+				retryTokens = append(retryTokens, newTokens...)
+			}
+			req.Tokens = retryTokens
+			goto Retry
+		}
+
+		// worker is stopped, give up the transient error.
+		for _, to := range retryTokens {
+			logAndroidFailure(to, req, retryErr, "")
+		}
+		if retryTopic != "" {
+			logAndroidFailure(retryTopic, req, retryErr, "")
+		}
+		if len(retryTokens) > 0 || retryTopic != "" {
+			addDeadLetter(req, retryTokens, retryErr, sends)
+		}
+	}
+
 	if isError && retryCount < maxRetry {
 		retryCount++
 
@@ -199,5 +486,89 @@ Retry:
 		goto Retry
 	}
 
+	if len(newTokens) > 0 {
+		addDeadLetter(req, newTokens, lastErr, sends)
+	}
+	if topicErr != nil {
+		addDeadLetter(req, nil, topicErr, sends)
+	}
+
 	return isError
 }
+
+// logAndroidFailure record fail push result of token.
+func logAndroidFailure(to string, req PushNotification, errPush error, messageID string) {
+	LogPush(FailedPush, to, req, errPush)
+	addFeedback(FailedPush, to, req, errPush, messageID)
+	addPushResult(FailedPush, req)
+	if PushConf.Core.Sync {
+		req.AddLog(getLogPushEntry(FailedPush, to, req, errPush))
+	}
+}
+
+// isTransientFCMError reports whether the FCM error is temporary and worth to retry,
+// such as Unavailable or HTTP 5xx.
+func isTransientFCMError(err error) bool {
+	if e, ok := err.(interface{ Temporary() bool }); ok {
+		return e.Temporary()
+	}
+
+	return false
+}
+
+// isInvalidTokenError reports whether the FCM error means token is no longer valid,
+// the token of mismatched sender id is registered by other Firebase project.
+func isInvalidTokenError(err error) bool {
+	return err == fcm.ErrInvalidRegistration || err == fcm.ErrNotRegistered || err == fcm.ErrMismatchSenderID
+}
+
+// fcmErrorType return the label of transient FCM error.
+func fcmErrorType(err error) string {
+	if e, ok := err.(interface{ Timeout() bool }); ok && e.Timeout() {
+		return "Unavailable"
+	}
+
+	return "InternalServerError"
+}
+
+// fcmBackoff return the delay before next attempt, doubled on every attempt
+// and limited by max delay.
+func fcmBackoff(attempt int) time.Duration {
+	delay := time.Duration(PushConf.Android.Retry.BaseDelay) * time.Millisecond
+	maxDelay := time.Duration(PushConf.Android.Retry.MaxDelay) * time.Millisecond
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return delay
+}
+
+// waitFCMRetry count the retry attempt and wait for backoff delay,
+// return false if workers are stopped before next attempt. The timed out
+// request stops waiting and is canceled at next attempt.
+func waitFCMRetry(req PushNotification, attempt int, err error) bool {
+	select {
+	case <-workerCtx.Done():
+		return false
+	default:
+	}
+
+	fcmRetryCounter.WithLabelValues(fcmErrorType(err)).Inc()
+	req.accessLog().Debug(fmt.Sprintf("Retry FCM request after %s, error: %s", fcmBackoff(attempt), err.Error()))
+
+	timer := time.NewTimer(fcmBackoff(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-req.requestContext().Done():
+		return true
+	case <-workerCtx.Done():
+		return false
+	}
+}
@@ -1,12 +1,23 @@
 package gorush
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/appleboy/go-fcm"
 	"github.com/appleboy/gorush/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,6 +38,7 @@ func TestMissingAndroidAPIKey(t *testing.T) {
 	PushConf, _ = config.LoadConf("")
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = ""
 
 	err := CheckPushConf()
@@ -34,6 +46,22 @@ func TestMissingAndroidAPIKey(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, "Missing Android API Key", err.Error())
 }
+func TestMissingAndroidAppKey(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	PushConf.Android.Apps = map[string]config.SectionAndroidApp{
+		"example": {APIVersion: "v1"},
+	}
+
+	err := CheckPushConf()
+
+	assert.Error(t, err)
+	assert.Equal(t, "Android app example: Missing Android credential", err.Error())
+}
+
 func TestMissingKeyForInitFCMClient(t *testing.T) {
 	client, err := InitFCMClient("")
 
@@ -46,6 +74,7 @@ func TestPushToAndroidWrongToken(t *testing.T) {
 	PushConf, _ = config.LoadConf("")
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 
 	req := PushNotification{
@@ -63,6 +92,7 @@ func TestPushToAndroidRightTokenForJSONLog(t *testing.T) {
 	PushConf, _ = config.LoadConf("")
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 	// log for json
 	PushConf.Log.Format = "json"
@@ -83,6 +113,7 @@ func TestPushToAndroidRightTokenForStringLog(t *testing.T) {
 	PushConf, _ = config.LoadConf("")
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 
 	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
@@ -101,6 +132,7 @@ func TestOverwriteAndroidAPIKey(t *testing.T) {
 	PushConf, _ = config.LoadConf("")
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 
 	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
@@ -160,15 +192,18 @@ func TestFCMMessage(t *testing.T) {
 	err = CheckMessage(req)
 	assert.NoError(t, err)
 
-	// the message may specify at most 1000 registration IDs
+	// tokens are sent in batches, so the number isn't limited.
 	req = PushNotification{
 		Message:  "Test",
 		Platform: PlatFormAndroid,
-		Tokens:   make([]string, 1001),
+		Tokens:   []string{"aaaaa"},
+	}
+	for len(req.Tokens) <= 1000 {
+		req.Tokens = append(req.Tokens, "aaaaa")
 	}
 
 	err = CheckMessage(req)
-	assert.Error(t, err)
+	assert.NoError(t, err)
 
 	// the message's TimeToLive field must be an integer
 	// between 0 and 2419200 (4 weeks)
@@ -200,6 +235,7 @@ func TestCheckAndroidMessage(t *testing.T) {
 	PushConf, _ = config.LoadConf("")
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 
 	timeToLive := uint(2419201)
@@ -267,5 +303,420 @@ func TestAndroidNotificationStructure(t *testing.T) {
 	notification = GetAndroidNotification(req)
 
 	assert.Equal(t, test, notification.To)
-	assert.Equal(t, "", notification.Notification.Body)
+	// empty notification payload is omitted.
+	assert.Nil(t, notification.Notification)
+}
+
+func TestAndroidDataMessage(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	req := PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormAndroid,
+		Data: D{
+			"sync": "contacts",
+		},
+	}
+
+	notification := GetAndroidNotification(req)
+	assert.Nil(t, notification.Notification)
+	assert.Equal(t, "normal", notification.Priority)
+	assert.Equal(t, "contacts", notification.Data["sync"])
+	assert.True(t, isFCMDataMessage(req))
+	assert.NoError(t, CheckMessage(req))
+
+	data, err := json.Marshal(notification)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), `"notification"`)
+
+	req.Priority = "high"
+	assert.Equal(t, "high", GetAndroidNotification(req).Priority)
+
+	// FCM requires string values of data message.
+	req.Data = D{"sync": "contacts", "count": 2}
+	assert.EqualError(t, CheckMessage(req), "the value of data count must be string for data message")
+
+	// data of notification message is converted by FCM v1 client.
+	req.Message = "Welcome"
+	req.Priority = ""
+	assert.False(t, isFCMDataMessage(req))
+	assert.NoError(t, CheckMessage(req))
+	assert.Equal(t, "", GetAndroidNotification(req).Priority)
+}
+
+func TestFCMErrorClassification(t *testing.T) {
+	assert.True(t, isTransientFCMError(fcm.ErrUnavailable))
+	assert.True(t, isTransientFCMError(fcm.ErrInternalServerError))
+	assert.False(t, isTransientFCMError(fcm.ErrInvalidRegistration))
+	assert.False(t, isTransientFCMError(errors.New("400 error: 400 Bad Request")))
+	assert.False(t, isTransientFCMError(nil))
+
+	assert.True(t, isInvalidTokenError(fcm.ErrInvalidRegistration))
+	assert.True(t, isInvalidTokenError(fcm.ErrNotRegistered))
+	assert.False(t, isInvalidTokenError(fcm.ErrUnavailable))
+
+	assert.Equal(t, "Unavailable", fcmErrorType(fcm.ErrUnavailable))
+	assert.Equal(t, "InternalServerError", fcmErrorType(fcm.ErrInternalServerError))
+}
+
+func TestFCMBackoff(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Retry.BaseDelay = 100
+	PushConf.Android.Retry.MaxDelay = 500
+
+	assert.Equal(t, 100*time.Millisecond, fcmBackoff(0))
+	assert.Equal(t, 200*time.Millisecond, fcmBackoff(1))
+	assert.Equal(t, 400*time.Millisecond, fcmBackoff(2))
+	assert.Equal(t, 500*time.Millisecond, fcmBackoff(3))
+	assert.Equal(t, 500*time.Millisecond, fcmBackoff(30))
+}
+
+func TestWaitFCMRetryCancel(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Retry.BaseDelay = 60000
+	PushConf.Android.Retry.MaxDelay = 60000
+	InitWorkers(0, 1)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		StopWorkers()
+	}()
+
+	start := time.Now()
+	assert.False(t, waitFCMRetry(PushNotification{}, 0, fcm.ErrUnavailable))
+	assert.True(t, time.Since(start) < time.Second)
+	assert.False(t, waitFCMRetry(PushNotification{}, 0, fcm.ErrUnavailable))
+
+	// restore default workers
+	PushConf, _ = config.LoadConf("")
+	InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+}
+
+func pushDurationCount(t *testing.T, platform, outcome string) uint64 {
+	var m dto.Metric
+	assert.NoError(t, pushDuration.WithLabelValues(platform, outcome).(prometheus.Histogram).Write(&m))
+
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestPushToAndroidRetryTransientError(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch n {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			_, _ = w.Write([]byte(`{"success":1,"failure":2,"results":[{"message_id":"1"},{"error":"Unavailable"},{"error":"NotRegistered"}]}`))
+		default:
+			_, _ = w.Write([]byte(`{"success":1,"failure":0,"results":[{"message_id":"2"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	PushConf.Android.Retry.MaxAttempts = 3
+	PushConf.Android.Retry.BaseDelay = 1
+	PushConf.Android.Retry.MaxDelay = 1
+	FCMClient, _ = fcm.NewClient(PushConf.Android.APIKey, fcm.WithEndpoint(server.URL))
+	defer func() {
+		FCMClient = nil
+	}()
+
+	unavailable := testutil.ToFloat64(fcmRetryCounter.WithLabelValues("Unavailable"))
+	serverError := testutil.ToFloat64(fcmRetryCounter.WithLabelValues("InternalServerError"))
+	success := pushDurationCount(t, "android", "success")
+	failure := pushDurationCount(t, "android", "failure")
+
+	req := PushNotification{
+		Tokens:   []string{"aaaaa", "bbbbb", "ccccc"},
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+	}
+
+	// the unregistered token is never resent, last attempt succeeds.
+	isError := PushToAndroid(req)
+	assert.False(t, isError)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	assert.Equal(t, unavailable+1, testutil.ToFloat64(fcmRetryCounter.WithLabelValues("Unavailable")))
+	assert.Equal(t, serverError+1, testutil.ToFloat64(fcmRetryCounter.WithLabelValues("InternalServerError")))
+	// the response of partial failure and the last success response.
+	assert.Equal(t, success+1, pushDurationCount(t, "android", "success"))
+	assert.Equal(t, failure+1, pushDurationCount(t, "android", "failure"))
+}
+
+func TestPushToAndroidApp(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write([]byte(`{"success":1,"failure":0,"results":[{"message_id":"1"}]}`))
+	}))
+	defer server.Close()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	PushConf.Android.Apps = map[string]config.SectionAndroidApp{
+		"example": {APIVersion: "legacy", APIKey: "example-api-key"},
+	}
+	assert.NoError(t, InitFCM())
+	assert.Equal(t, 1, len(FCMClients))
+	defer func() {
+		FCMClient = nil
+		FCMClients = nil
+	}()
+
+	// the client of app is used instead of top level config.
+	FCMClients["example"], _ = fcm.NewClient("example-api-key",
+		fcm.WithEndpoint(server.URL),
+		fcm.WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+	)
+
+	req := PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormAndroid,
+		App:      "Example",
+		Message:  "Welcome",
+	}
+
+	isError := PushToAndroid(req)
+	assert.False(t, isError)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	_, err := getFCMClient("", "unknown")
+	assert.Error(t, err)
+	assert.Equal(t, "the Android app unknown is not initialized", err.Error())
+}
+
+func TestFCMTopicAndCondition(t *testing.T) {
+	// topic is sent with /topics/ prefix.
+	req := PushNotification{
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+		Topic:    "news",
+	}
+
+	assert.NoError(t, CheckMessage(req))
+	assert.True(t, req.IsTopic())
+	assert.Equal(t, "/topics/news", GetAndroidNotification(req).To)
+	assert.Equal(t, []string{"/topics/news"}, req.recipients())
+
+	req.Topic = "/topics/news"
+	assert.Equal(t, "/topics/news", GetAndroidNotification(req).To)
+
+	// condition is one delivery.
+	req = PushNotification{
+		Platform:  PlatFormAndroid,
+		Message:   "Welcome",
+		Condition: "'dogs' in topics && !('cats' in topics)",
+	}
+
+	assert.NoError(t, CheckMessage(req))
+	assert.Equal(t, "", GetAndroidNotification(req).To)
+	assert.Equal(t, 1, len(req.recipients()))
+
+	// tokens, topic and condition are mutually exclusive.
+	targets := []PushNotification{
+		{Tokens: []string{"aaaaa"}, Topic: "news"},
+		{Tokens: []string{"aaaaa"}, Condition: "'dogs' in topics"},
+		{Topic: "news", Condition: "'dogs' in topics"},
+		{To: "/topics/news", Condition: "'dogs' in topics"},
+		{Topic: "news", To: "aUniqueKey"},
+	}
+
+	for _, req := range targets {
+		req.Platform = PlatFormAndroid
+		req.Message = "Welcome"
+
+		err := CheckMessage(req)
+		if assert.Error(t, err) {
+			assert.Equal(t, "the message must specify only one of tokens, topic or condition", err.Error())
+		}
+	}
+
+	// invalid topic name and condition syntax.
+	assert.Error(t, CheckMessage(PushNotification{
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+		Topic:    "foo-bar@@@##",
+	}))
+	assert.Error(t, CheckMessage(PushNotification{
+		Platform:  PlatFormAndroid,
+		Message:   "Welcome",
+		Condition: "('dogs' in topics || 'cats' in topics",
+	}))
+
+	// iOS topic is apns-topic header.
+	req = PushNotification{
+		Platform: PlatFormIos,
+		Message:  "Welcome",
+		Tokens:   []string{"aaaaa"},
+		Topic:    "com.example.app",
+	}
+
+	assert.NoError(t, CheckMessage(req))
+	assert.False(t, req.IsTopic())
+	assert.Equal(t, []string{"aaaaa"}, req.recipients())
+}
+
+func TestAndroidPriorityAndExpiration(t *testing.T) {
+	req := PushNotification{
+		Tokens:     []string{"a"},
+		Priority:   "normal",
+		Expiration: time.Now().Add(time.Hour).Unix(),
+	}
+
+	notification := GetAndroidNotification(req)
+	assert.Equal(t, "normal", notification.Priority)
+	assert.InDelta(t, 3600, float64(*notification.TimeToLive), 2)
+
+	// time_to_live takes precedence over expiration.
+	timeToLive := uint(100)
+	req.TimeToLive = &timeToLive
+	notification = GetAndroidNotification(req)
+	assert.Equal(t, uint(100), *notification.TimeToLive)
+
+	// FCM keeps message up to four weeks.
+	req.TimeToLive = nil
+	req.Expiration = time.Now().Add(60 * 24 * time.Hour).Unix()
+	notification = GetAndroidNotification(req)
+	assert.Equal(t, uint(fcmMaxTimeToLive), *notification.TimeToLive)
+
+	// never expires.
+	req.Expiration = 0
+	notification = GetAndroidNotification(req)
+	assert.Nil(t, notification.TimeToLive)
+}
+
+func TestPushToAndroidMulticast(t *testing.T) {
+	var batches []int
+	var lock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg fcm.Message
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+
+		lock.Lock()
+		batches = append(batches, len(msg.RegistrationIDs))
+		lock.Unlock()
+
+		// the token "invalid" is rejected in every batch.
+		var success, failure int
+		var results []map[string]string
+		for _, token := range msg.RegistrationIDs {
+			if token == "invalid" {
+				failure++
+				results = append(results, map[string]string{"error": "NotRegistered"})
+				continue
+			}
+			success++
+			results = append(results, map[string]string{"message_id": "1"})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": success,
+			"failure": failure,
+			"results": results,
+		})
+	}))
+	defer server.Close()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	PushConf.Log.HideToken = false
+	FCMClient, _ = fcm.NewClient(PushConf.Android.APIKey,
+		fcm.WithEndpoint(server.URL),
+		fcm.WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+	)
+	invalidTokens = newInvalidTokenStore(10)
+	defer func() {
+		FCMClient = nil
+		invalidTokens = nil
+	}()
+
+	var logs []LogPushEntry
+	req := PushNotification{
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+		log:      &logs,
+	}
+	for i := 0; i < 1200; i++ {
+		token := fmt.Sprintf("token-%d", i)
+		if i == 10 || i == 1100 {
+			token = "invalid"
+		}
+		req.Tokens = append(req.Tokens, token)
+	}
+
+	PushConf.Core.Sync = true
+	isError := PushToAndroid(req)
+	assert.True(t, isError)
+	assert.Equal(t, []int{500, 500, 200}, batches)
+
+	// failures of all batches are reported with the reason of token.
+	assert.Equal(t, 2, len(logs))
+	for _, log := range logs {
+		assert.Equal(t, "invalid", log.Token)
+		assert.Equal(t, fcm.ErrNotRegistered.Error(), log.Error)
+	}
+
+	total, tokens := invalidTokens.list(0, 10)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, fcm.ErrNotRegistered.Error(), tokens[0].Reason)
+}
+
+func TestAndroidNotificationOptions(t *testing.T) {
+	req := PushNotification{
+		Tokens:   []string{"a"},
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+		Sound:    "default",
+		Notification: fcm.Notification{
+			Icon: "icon",
+			Tag:  "tag",
+		},
+		Android: &AndroidNotification{
+			ChannelID:   "news",
+			Color:       "#112244",
+			Tag:         "breaking",
+			ClickAction: "OPEN_NEWS",
+			Sound:       "chime",
+		},
+	}
+
+	notification := GetAndroidNotification(req)
+	assert.Equal(t, "news", notification.Notification.ChannelID)
+	assert.Equal(t, "icon", notification.Notification.Icon)
+	assert.Equal(t, "#112244", notification.Notification.Color)
+	assert.Equal(t, "breaking", notification.Notification.Tag)
+	assert.Equal(t, "OPEN_NEWS", notification.Notification.ClickAction)
+	assert.Equal(t, "chime", notification.Notification.Sound)
+
+	message := newFCMv1Message(notification)
+	assert.Equal(t, &fcmV1AndroidNotification{
+		Icon:        "icon",
+		Color:       "#112244",
+		Sound:       "chime",
+		Tag:         "breaking",
+		ClickAction: "OPEN_NEWS",
+		ChannelID:   "news",
+	}, message.Android.Notification)
+
+	// empty options don't override the defaults of app.
+	data, _ := json.Marshal(newFCMv1Message(GetAndroidNotification(PushNotification{
+		Tokens:   []string{"a"},
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+		Android:  &AndroidNotification{ChannelID: "news"},
+	})))
+	assert.JSONEq(t, `{"notification":{"body":"Welcome"},"android":{"notification":{"channel_id":"news"}}}`, string(data))
+
+	assert.NoError(t, checkAndroidColor(req))
+	req.Android.Color = "#1124"
+	assert.EqualError(t, checkAndroidColor(req), "the android color must be in #RRGGBB format")
+	req.Android.Color = "blue"
+	assert.Error(t, checkAndroidColor(req))
 }
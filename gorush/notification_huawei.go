@@ -0,0 +1,452 @@
+package gorush
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// hmsMulticastSize is the max number of tokens of one Push Kit message.
+	hmsMulticastSize = 1000
+	// hmsTimeout is the timeout of Push Kit and token requests.
+	hmsTimeout = 30 * time.Second
+	// hmsTokenExpiryDelta refresh the access token before it expires.
+	hmsTokenExpiryDelta = time.Minute
+	// hmsClickActionOpenApp open the app when notification is tapped.
+	hmsClickActionOpenApp = 3
+)
+
+// result code of Push Kit API.
+const (
+	hmsCodeSuccess        = "80000000"
+	hmsCodePartialSuccess = "80100000"
+	hmsCodeTokenExpired   = "80200003"
+	hmsCodeInvalidTokens  = "80300007"
+)
+
+var (
+	// hmsTokenEndpoint is the OAuth2 token URL of Huawei account.
+	hmsTokenEndpoint = "https://oauth-login.cloud.huawei.com/oauth2/v3/token"
+	// hmsEndpoint is the base URL of Push Kit API.
+	hmsEndpoint = "https://push-api.cloud.huawei.com"
+)
+
+var errHMSInvalidToken = errors.New("huawei push token is invalid")
+
+// hmsError is the error code returned by Push Kit, the server error is
+// temporary.
+type hmsError struct {
+	code      string
+	msg       string
+	temporary bool
+}
+
+func (e *hmsError) Error() string   { return fmt.Sprintf("%s error: %s", e.code, e.msg) }
+func (e *hmsError) Temporary() bool { return e.temporary }
+
+// HMSClient send message with Huawei Push Kit API, the OAuth2 access token
+// of app is cached until it is about to expire.
+// https://developer.huawei.com/consumer/en/doc/development/HMSCore-References/https-send-api-0000001050986197
+type HMSClient struct {
+	sync.Mutex
+	appID     string
+	appSecret string
+	client    *http.Client
+	token     string
+	expiry    time.Time
+}
+
+// InitHMSClient use for initialize Push Kit client with the app of huawei
+// config.
+func InitHMSClient() (*HMSClient, error) {
+	if HMS != nil {
+		return HMS, nil
+	}
+
+	client, err := newHMSClient(PushConf.Huawei.AppID, PushConf.Huawei.AppSecret)
+	if err != nil {
+		return nil, err
+	}
+	HMS = client
+
+	return HMS, nil
+}
+
+// newHMSClient create Push Kit client with app ID and app secret.
+func newHMSClient(appID, appSecret string) (*HMSClient, error) {
+	if appID == "" || appSecret == "" {
+		return nil, errors.New("Missing Huawei app ID or app secret")
+	}
+
+	return &HMSClient{
+		appID:     appID,
+		appSecret: appSecret,
+		client:    &http.Client{Timeout: hmsTimeout},
+	}, nil
+}
+
+// accessToken return the cached access token, request new one by client
+// credentials if it expires.
+func (c *HMSClient) accessToken() (string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.token != "" && time.Now().Add(hmsTokenExpiryDelta).Before(c.expiry) {
+		return c.token, nil
+	}
+
+	res, err := c.client.PostForm(hmsTokenEndpoint, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.appID},
+		"client_secret": {c.appSecret},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return "", fmt.Errorf("%d error: oauth2 token: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	if token.AccessToken == "" {
+		return "", errors.New("oauth2 token: empty access token")
+	}
+
+	c.token = token.AccessToken
+	c.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	return c.token, nil
+}
+
+// resetToken drop the cached access token, it is rejected by Push Kit.
+func (c *HMSClient) resetToken() {
+	c.Lock()
+	c.token = ""
+	c.Unlock()
+}
+
+type hmsRequest struct {
+	ValidateOnly bool       `json:"validate_only,omitempty"`
+	Message      hmsMessage `json:"message"`
+}
+
+type hmsMessage struct {
+	Data         string           `json:"data,omitempty"`
+	Notification *hmsNotification `json:"notification,omitempty"`
+	Android      *hmsAndroid      `json:"android,omitempty"`
+	Token        []string         `json:"token,omitempty"`
+}
+
+type hmsNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type hmsAndroid struct {
+	Urgency      string                  `json:"urgency,omitempty"`
+	TTL          string                  `json:"ttl,omitempty"`
+	Notification *hmsAndroidNotification `json:"notification,omitempty"`
+}
+
+type hmsAndroidNotification struct {
+	Title       string         `json:"title,omitempty"`
+	Body        string         `json:"body,omitempty"`
+	Icon        string         `json:"icon,omitempty"`
+	Color       string         `json:"color,omitempty"`
+	Sound       string         `json:"sound,omitempty"`
+	Tag         string         `json:"tag,omitempty"`
+	ChannelID   string         `json:"channel_id,omitempty"`
+	ClickAction hmsClickAction `json:"click_action"`
+}
+
+type hmsClickAction struct {
+	Type   int    `json:"type"`
+	Action string `json:"action,omitempty"`
+}
+
+type hmsResponse struct {
+	Code      string `json:"code"`
+	Msg       string `json:"msg"`
+	RequestID string `json:"requestId"`
+}
+
+// newHMSMessage use for define Push Kit message, the tokens are set by
+// caller. Message without title and body is a data message.
+func newHMSMessage(req PushNotification) hmsMessage {
+	message := hmsMessage{
+		Android: &hmsAndroid{},
+	}
+
+	switch req.Priority {
+	case "high":
+		message.Android.Urgency = "HIGH"
+	case "normal":
+		message.Android.Urgency = "NORMAL"
+	}
+
+	if req.TimeToLive != nil {
+		message.Android.TTL = fmt.Sprintf("%ds", *req.TimeToLive)
+	} else if req.Expiration > 0 {
+		message.Android.TTL = fmt.Sprintf("%ds", fcmTimeToLive(req.Expiration))
+	}
+
+	// the data of Push Kit is a string, sent as JSON object.
+	if len(req.Data) > 0 {
+		data, _ := json.Marshal(req.Data)
+		message.Data = string(data)
+	}
+
+	if req.Title == "" && req.Message == "" {
+		return message
+	}
+
+	message.Notification = &hmsNotification{
+		Title: req.Title,
+		Body:  req.Message,
+	}
+	notification := &hmsAndroidNotification{
+		Title:       req.Title,
+		Body:        req.Message,
+		ClickAction: hmsClickAction{Type: hmsClickActionOpenApp},
+	}
+	if n := req.Android; n != nil {
+		notification.Icon = n.Icon
+		notification.Color = n.Color
+		notification.Sound = n.Sound
+		notification.Tag = n.Tag
+		notification.ChannelID = n.ChannelID
+		if n.ClickAction != "" {
+			// open the activity of intent action.
+			notification.ClickAction = hmsClickAction{Type: 1, Action: n.ClickAction}
+		}
+	}
+	message.Android.Notification = notification
+
+	return message
+}
+
+// send post the message to tokens, return the error of each token. The
+// error of request means all tokens are failed.
+func (c *HMSClient) send(tokens []string, message hmsMessage, validateOnly bool) ([]error, error) {
+	token, err := c.accessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	message.Token = tokens
+	data, err := json.Marshal(hmsRequest{
+		ValidateOnly: validateOnly,
+		Message:      message,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/%s/messages:send", hmsEndpoint, c.appID)
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var body hmsResponse
+	_ = json.NewDecoder(res.Body).Decode(&body)
+
+	results := make([]error, len(tokens))
+	switch {
+	case body.Code == hmsCodeSuccess:
+		return results, nil
+	case body.Code == hmsCodePartialSuccess:
+		// msg is the JSON of illegal tokens.
+		var partial struct {
+			IllegalTokens []string `json:"illegal_tokens"`
+		}
+		_ = json.Unmarshal([]byte(body.Msg), &partial)
+		illegal := make(map[string]bool, len(partial.IllegalTokens))
+		for _, t := range partial.IllegalTokens {
+			illegal[t] = true
+		}
+		for i, t := range tokens {
+			if illegal[t] {
+				results[i] = errHMSInvalidToken
+			}
+		}
+		return results, nil
+	case body.Code == hmsCodeInvalidTokens:
+		for i := range results {
+			results[i] = errHMSInvalidToken
+		}
+		return results, nil
+	case body.Code == hmsCodeTokenExpired || res.StatusCode == http.StatusUnauthorized:
+		c.resetToken()
+	}
+
+	if body.Code == "" {
+		body.Code = fmt.Sprintf("%d", res.StatusCode)
+		body.Msg = res.Status
+	}
+
+	return nil, &hmsError{
+		code: body.Code,
+		msg:  body.Msg,
+		// 81000001 is the internal error of Push Kit.
+		temporary: res.StatusCode >= http.StatusInternalServerError || strings.HasPrefix(body.Code, "81"),
+	}
+}
+
+// isHMSServiceError reports whether Push Kit is failed, e.g. connection
+// error or server error, instead of rejecting the message.
+func isHMSServiceError(err error) bool {
+	switch e := err.(type) {
+	case *url.Error:
+		return true
+	case *hmsError:
+		return e.temporary
+	}
+
+	return false
+}
+
+// PushToHuawei provide send notification to Huawei Push Kit, the tokens are
+// sent in batches of at most hmsMulticastSize tokens.
+func PushToHuawei(req PushNotification) bool {
+	req.accessLog().Debug("Start push notification for Huawei")
+	if PushConf.Core.Sync {
+		defer req.WaitDone()
+	}
+
+	// check message
+	if err := CheckMessage(req); err != nil {
+		req.errorLog().Error("request error: " + err.Error())
+		return false
+	}
+
+	isError := false
+	for tokens := req.Tokens; len(tokens) > 0; {
+		n := hmsMulticastSize
+		if len(tokens) < n {
+			n = len(tokens)
+		}
+
+		batch := req
+		batch.Tokens = tokens[:n:n]
+		tokens = tokens[n:]
+
+		if pushToHuawei(batch) {
+			isError = true
+		}
+	}
+
+	return isError
+}
+
+// pushToHuawei send the message to tokens and retry the failed tokens.
+func pushToHuawei(req PushNotification) bool {
+	start := time.Now()
+
+	var (
+		retryCount = 0
+		maxRetry   = PushConf.Huawei.MaxRetry
+		sends      = 0
+		lastErr    error
+	)
+
+	if req.Retry > 0 && req.Retry < maxRetry {
+		maxRetry = req.Retry
+	}
+
+	client, err := InitHMSClient()
+	if err != nil {
+		req.errorLog().Error("Huawei client error: " + err.Error())
+		return false
+	}
+
+	message := newHMSMessage(req)
+	breaker := breakers[PlatFormHuawei]
+
+Retry:
+	if req.canceled(req.Tokens) {
+		return true
+	}
+
+	if !breaker.allow() {
+		failUnavailable(req, req.Tokens, sends)
+		observePushDuration(req, start, true)
+		return true
+	}
+
+	sends++
+	results, err := client.send(req.Tokens, message, req.DryRun)
+	breaker.record(isHMSServiceError(err))
+	if err != nil {
+		req.errorLog().Error("Huawei server send message error: " + err.Error())
+	}
+
+	isError := false
+	var newTokens []string
+	for i, token := range req.Tokens {
+		errPush := err
+		if errPush == nil {
+			errPush = results[i]
+		}
+
+		if errPush == nil {
+			LogPush(SucceededPush, token, req, nil)
+			addFeedback(SucceededPush, token, req, nil, "")
+			addPushResult(SucceededPush, req)
+			StatStorage.AddHuaweiSuccess(1)
+			continue
+		}
+
+		isError = true
+		if errPush == errHMSInvalidToken {
+			invalidateToken(token, req, errPush)
+		} else {
+			newTokens = append(newTokens, token)
+			lastErr = errPush
+		}
+		failToken(token, req, errPush)
+		addFeedback(FailedPush, token, req, errPush, "")
+	}
+
+	observePushDuration(req, start, isError)
+
+	if len(newTokens) > 0 && retryCount < maxRetry {
+		retryCount++
+
+		// resend fail token
+		req.Tokens = newTokens
+		goto Retry
+	}
+
+	if len(newTokens) > 0 {
+		addDeadLetter(req, newTokens, lastErr, sends)
+	}
+
+	return isError
+}
@@ -0,0 +1,155 @@
+package gorush
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/appleboy/gorush/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// testHMSServer start Push Kit and OAuth2 token server, the result of
+// message is returned by handler, tokens counts the access token requests.
+func testHMSServer(t *testing.T, handler func(message hmsMessage) (int, string)) (tokens *int32, cleanup func()) {
+	tokens = new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+			assert.Equal(t, "100001", r.FormValue("client_id"))
+			assert.Equal(t, "secret", r.FormValue("client_secret"))
+			atomic.AddInt32(tokens, 1)
+			_, _ = w.Write([]byte(`{"access_token":"access-token","expires_in":3600,"token_type":"Bearer"}`))
+			return
+		}
+
+		assert.Equal(t, "/v1/100001/messages:send", r.URL.Path)
+		assert.Equal(t, "Bearer access-token", r.Header.Get("Authorization"))
+
+		var req hmsRequest
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &req))
+
+		code, res := handler(req.Message)
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(res))
+	}))
+
+	tokenEndpoint, endpoint := hmsTokenEndpoint, hmsEndpoint
+	hmsTokenEndpoint, hmsEndpoint = server.URL+"/token", server.URL
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = false
+	PushConf.Huawei.Enabled = true
+	PushConf.Huawei.AppID = "100001"
+	PushConf.Huawei.AppSecret = "secret"
+	HMS = nil
+	StatStorage = memory.New()
+
+	return tokens, func() {
+		hmsTokenEndpoint, hmsEndpoint = tokenEndpoint, endpoint
+		HMS = nil
+		server.Close()
+		PushConf, _ = config.LoadConf("")
+	}
+}
+
+func TestNewHMSMessage(t *testing.T) {
+	ttl := uint(60)
+	message := newHMSMessage(PushNotification{
+		Platform:   PlatFormHuawei,
+		Title:      "Hello",
+		Message:    "Welcome",
+		Priority:   "high",
+		TimeToLive: &ttl,
+		Data:       D{"key": "value"},
+		Android:    &AndroidNotification{ChannelID: "news"},
+	})
+
+	assert.Equal(t, "Welcome", message.Notification.Body)
+	assert.Equal(t, "HIGH", message.Android.Urgency)
+	assert.Equal(t, "60s", message.Android.TTL)
+	assert.Equal(t, `{"key":"value"}`, message.Data)
+	assert.Equal(t, "news", message.Android.Notification.ChannelID)
+	assert.Equal(t, hmsClickActionOpenApp, message.Android.Notification.ClickAction.Type)
+
+	// data message.
+	message = newHMSMessage(PushNotification{Platform: PlatFormHuawei, Data: D{"key": "value"}})
+	assert.Nil(t, message.Notification)
+	assert.Nil(t, message.Android.Notification)
+}
+
+func TestPushToHuawei(t *testing.T) {
+	tokens, cleanup := testHMSServer(t, func(message hmsMessage) (int, string) {
+		assert.Equal(t, []string{"aaaaa", "bbbbb"}, message.Token)
+		return http.StatusOK, `{"code":"80100000","msg":"{\"success\":1,\"failure\":1,\"illegal_tokens\":[\"bbbbb\"]}","requestId":"1"}`
+	})
+	defer cleanup()
+	assert.NoError(t, CheckPushConf())
+
+	isError := PushToHuawei(PushNotification{
+		Platform: PlatFormHuawei,
+		Tokens:   []string{"aaaaa", "bbbbb"},
+		Message:  "Welcome",
+	})
+	assert.True(t, isError)
+	assert.Equal(t, int64(1), StatStorage.GetHuaweiSuccess())
+	assert.Equal(t, int64(1), StatStorage.GetHuaweiError())
+
+	// the access token is cached.
+	PushToHuawei(PushNotification{
+		Platform: PlatFormHuawei,
+		Tokens:   []string{"aaaaa", "bbbbb"},
+		Message:  "Welcome",
+	})
+	assert.Equal(t, int32(1), atomic.LoadInt32(tokens))
+}
+
+func TestPushToHuaweiRetry(t *testing.T) {
+	var sends int32
+	tokens, cleanup := testHMSServer(t, func(message hmsMessage) (int, string) {
+		switch atomic.AddInt32(&sends, 1) {
+		case 1:
+			return http.StatusUnauthorized, `{"code":"80200003","msg":"OAuth token expired."}`
+		case 2:
+			return http.StatusInternalServerError, `{"code":"81000001","msg":"Internal error."}`
+		}
+		return http.StatusOK, `{"code":"80000000","msg":"Success"}`
+	})
+	defer cleanup()
+	PushConf.Huawei.MaxRetry = 2
+
+	isError := PushToHuawei(PushNotification{
+		Platform: PlatFormHuawei,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+	})
+	assert.False(t, isError)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&sends))
+	assert.Equal(t, int64(1), StatStorage.GetHuaweiSuccess())
+	assert.Equal(t, int64(2), StatStorage.GetHuaweiError())
+	// the expired access token is requested again.
+	assert.Equal(t, int32(2), atomic.LoadInt32(tokens))
+}
+
+func TestCheckHuaweiMessage(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = false
+	PushConf.Huawei.Enabled = true
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+	}()
+
+	err := CheckPushConf()
+	assert.Error(t, err)
+	assert.Equal(t, "Missing Huawei app ID or app secret", err.Error())
+
+	err = CheckMessage(PushNotification{Platform: PlatFormHuawei, Topic: "news", Message: "Welcome"})
+	assert.Error(t, err)
+	assert.Equal(t, "the huawei message must specify at least one token", err.Error())
+
+	assert.NoError(t, CheckMessage(PushNotification{Platform: PlatFormHuawei, Tokens: []string{"aaaaa"}, Message: "Welcome"}))
+}
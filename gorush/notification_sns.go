@@ -0,0 +1,365 @@
+package gorush
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// snsTimeout is the timeout of SNS Publish requests.
+	snsTimeout = 30 * time.Second
+	// snsConcurrency is the number of endpoints published at the same time.
+	snsConcurrency = 10
+	// snsCredentialsExpiryDelta refresh the role credentials before they expire.
+	snsCredentialsExpiryDelta = 5 * time.Minute
+	// snsAPIVersion is the version of SNS query API.
+	snsAPIVersion = "2010-03-31"
+)
+
+// snsEndpointARN is the ARN of SNS platform endpoint.
+var snsEndpointARN = regexp.MustCompile(`^arn:aws[a-z-]*:sns:[a-z0-9-]+:[0-9]{12}:endpoint/[^/]+/[^/]+/[^/]+$`)
+
+// snsError is the error code returned by SNS, the server error and throttling
+// are temporary.
+type snsError struct {
+	code      string
+	msg       string
+	temporary bool
+}
+
+func (e *snsError) Error() string   { return fmt.Sprintf("%s error: %s", e.code, e.msg) }
+func (e *snsError) Temporary() bool { return e.temporary }
+
+// SNSClient publish message to SNS platform endpoints, the credentials of
+// role are cached until they are about to expire.
+// https://docs.aws.amazon.com/sns/latest/api/API_Publish.html
+type SNSClient struct {
+	sync.Mutex
+	region   string
+	endpoint string
+	static   awsCredentials
+	creds    awsCredentials
+	expiry   time.Time
+	client   *http.Client
+}
+
+// snsRegion return the region of sns config, AWS_REGION or
+// AWS_DEFAULT_REGION environment variable if empty.
+func snsRegion() string {
+	if PushConf.SNS.Region != "" {
+		return PushConf.SNS.Region
+	}
+
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// InitSNSClient use for initialize SNS client with the region and access key
+// of sns config, the default provider chain of AWS is used if access key is
+// empty. The endpoint can be changed by AWS_ENDPOINT_URL_SNS.
+func InitSNSClient() (*SNSClient, error) {
+	if SNS != nil {
+		return SNS, nil
+	}
+
+	region := snsRegion()
+	if region == "" {
+		return nil, errors.New("Missing SNS region")
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_SNS")
+	if endpoint == "" {
+		endpoint = "https://sns." + region + ".amazonaws.com"
+	}
+
+	SNS = &SNSClient{
+		region:   region,
+		endpoint: strings.TrimRight(endpoint, "/") + "/",
+		static: awsCredentials{
+			accessKeyID:     PushConf.SNS.AccessKeyID,
+			secretAccessKey: PushConf.SNS.SecretAccessKey,
+			sessionToken:    PushConf.SNS.SessionToken,
+		},
+		client: &http.Client{Timeout: snsTimeout},
+	}
+
+	return SNS, nil
+}
+
+// credentials return the access key of config, or the cached credentials of
+// provider chain which are loaded again before they expire.
+func (c *SNSClient) credentials() (awsCredentials, error) {
+	if c.static.accessKeyID != "" {
+		return c.static, nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.creds.accessKeyID != "" && (c.expiry.IsZero() || time.Now().Add(snsCredentialsExpiryDelta).Before(c.expiry)) {
+		return c.creds, nil
+	}
+
+	creds, expiry, err := loadAWSCredentials()
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	c.creds, c.expiry = creds, expiry
+
+	return c.creds, nil
+}
+
+// resetCredentials drop the cached credentials, they are rejected by SNS.
+func (c *SNSClient) resetCredentials() {
+	c.Lock()
+	c.creds = awsCredentials{}
+	c.Unlock()
+}
+
+// newSNSMessage use for define the message of MessageStructure json, the
+// payload of APNs and FCM is the same as iOS and Android notification, and
+// SNS picks the one of endpoint platform.
+func newSNSMessage(req PushNotification) map[string]string {
+	ios := req
+	ios.Platform = PlatFormIos
+	apns, _ := json.Marshal(GetIOSNotification(ios).Payload)
+
+	// the tokens are endpoint ARNs, the message of endpoint has no target.
+	android := req
+	android.Platform = PlatFormAndroid
+	android.Tokens, android.To, android.Topic, android.Condition = nil, "", "", ""
+	gcm, _ := json.Marshal(GetAndroidNotification(android))
+
+	message := req.Message
+	if message == "" {
+		message = req.Title
+	}
+
+	return map[string]string{
+		"default":      message,
+		"APNS":         string(apns),
+		"APNS_SANDBOX": string(apns),
+		"GCM":          string(gcm),
+	}
+}
+
+// publish send the message to endpoint ARN, return the message ID of SNS.
+func (c *SNSClient) publish(arn, message string) (string, error) {
+	creds, err := c.credentials()
+	if err != nil {
+		return "", err
+	}
+
+	body := []byte(url.Values{
+		"Action":           {"Publish"},
+		"Version":          {snsAPIVersion},
+		"TargetArn":        {arn},
+		"Message":          {message},
+		"MessageStructure": {"json"},
+	}.Encode())
+	req, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+	signAWSRequest(req, body, creds, c.region, "sns", time.Now())
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		var result struct {
+			MessageID string `xml:"PublishResult>MessageId"`
+		}
+		_ = xml.NewDecoder(res.Body).Decode(&result)
+		return result.MessageID, nil
+	}
+
+	var result struct {
+		Code    string `xml:"Error>Code"`
+		Message string `xml:"Error>Message"`
+	}
+	_ = xml.NewDecoder(res.Body).Decode(&result)
+	if result.Code == "" {
+		result.Code = fmt.Sprintf("%d", res.StatusCode)
+		result.Message = res.Status
+	}
+
+	switch result.Code {
+	case "ExpiredToken", "InvalidClientTokenId", "SignatureDoesNotMatch":
+		c.resetCredentials()
+	}
+
+	return "", &snsError{
+		code: result.Code,
+		msg:  result.Message,
+		temporary: res.StatusCode >= http.StatusInternalServerError ||
+			result.Code == "Throttling" || result.Code == "ThrottledException" || result.Code == "ExpiredToken",
+	}
+}
+
+// isInvalidSNSEndpoint reports whether the endpoint is disabled by the
+// push service or deleted, it is never resent.
+func isInvalidSNSEndpoint(err error) bool {
+	e, ok := err.(*snsError)
+	if !ok {
+		return false
+	}
+
+	switch e.code {
+	case "EndpointDisabled", "NotFound":
+		return true
+	case "InvalidParameter":
+		return strings.Contains(e.msg, "TargetArn")
+	}
+
+	return false
+}
+
+// isSNSServiceError reports whether SNS is failed, e.g. connection error or
+// server error, instead of rejecting the message.
+func isSNSServiceError(err error) bool {
+	switch e := err.(type) {
+	case *url.Error:
+		return true
+	case *snsError:
+		return e.temporary
+	}
+
+	return false
+}
+
+// PushToSNS provide send notification to SNS platform endpoints of tokens.
+func PushToSNS(req PushNotification) bool {
+	req.accessLog().Debug("Start push notification for SNS")
+	if PushConf.Core.Sync {
+		defer req.WaitDone()
+	}
+
+	// check message
+	if err := CheckMessage(req); err != nil {
+		req.errorLog().Error("request error: " + err.Error())
+		return false
+	}
+
+	return pushToSNS(req)
+}
+
+// pushToSNS publish the message to each endpoint and retry the failed
+// endpoints.
+func pushToSNS(req PushNotification) bool {
+	start := time.Now()
+
+	var (
+		retryCount = 0
+		maxRetry   = PushConf.SNS.MaxRetry
+		sends      = 0
+		lastErr    error
+	)
+
+	if req.Retry > 0 && req.Retry < maxRetry {
+		maxRetry = req.Retry
+	}
+
+	client, err := InitSNSClient()
+	if err != nil {
+		req.errorLog().Error("SNS client error: " + err.Error())
+		return false
+	}
+
+	data, err := json.Marshal(newSNSMessage(req))
+	if err != nil {
+		req.errorLog().Error("SNS message error: " + err.Error())
+		return false
+	}
+	message := string(data)
+	breaker := breakers[PlatFormSNS]
+
+Retry:
+	if req.canceled(req.Tokens) {
+		return true
+	}
+
+	if !breaker.allow() {
+		failUnavailable(req, req.Tokens, sends)
+		observePushDuration(req, start, true)
+		return true
+	}
+
+	sends++
+	messageIDs := make([]string, len(req.Tokens))
+	results := make([]error, len(req.Tokens))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, snsConcurrency)
+	for i := range req.Tokens {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			messageIDs[i], results[i] = client.publish(req.Tokens[i], message)
+			<-sem
+		}(i)
+	}
+	wg.Wait()
+
+	isError := false
+	var newTokens []string
+	for i, token := range req.Tokens {
+		errPush := results[i]
+		breaker.record(isSNSServiceError(errPush))
+
+		if errPush == nil {
+			LogPush(SucceededPush, token, req, nil)
+			addFeedback(SucceededPush, token, req, nil, messageIDs[i])
+			addPushResult(SucceededPush, req)
+			StatStorage.AddSNSSuccess(1)
+			continue
+		}
+
+		req.errorLog().Error("SNS server publish message error: " + errPush.Error())
+		isError = true
+		if isInvalidSNSEndpoint(errPush) {
+			invalidateToken(token, req, errPush)
+		} else {
+			newTokens = append(newTokens, token)
+			lastErr = errPush
+		}
+		failToken(token, req, errPush)
+		addFeedback(FailedPush, token, req, errPush, "")
+	}
+
+	observePushDuration(req, start, isError)
+
+	if len(newTokens) > 0 && retryCount < maxRetry {
+		retryCount++
+
+		// resend fail token
+		req.Tokens = newTokens
+		goto Retry
+	}
+
+	if len(newTokens) > 0 {
+		addDeadLetter(req, newTokens, lastErr, sends)
+	}
+
+	return isError
+}
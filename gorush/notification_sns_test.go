@@ -0,0 +1,165 @@
+package gorush
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/appleboy/gorush/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	snsIOSEndpoint     = "arn:aws:sns:us-east-1:123456789012:endpoint/APNS/app/11111111-1111-1111-1111-111111111111"
+	snsAndroidEndpoint = "arn:aws:sns:us-east-1:123456789012:endpoint/GCM/app/22222222-2222-2222-2222-222222222222"
+)
+
+// testSNSServer start SNS Publish server, the result of endpoint ARN is
+// returned by handler.
+func testSNSServer(t *testing.T, handler func(arn string, message map[string]string) (int, string)) func() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Publish", r.FormValue("Action"))
+		assert.Equal(t, "json", r.FormValue("MessageStructure"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access-key/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-east-1/sns/aws4_request")
+
+		var message map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(r.FormValue("Message")), &message))
+
+		code, res := handler(r.FormValue("TargetArn"), message)
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(res))
+	}))
+
+	os.Setenv("AWS_ENDPOINT_URL_SNS", server.URL)
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = false
+	PushConf.SNS.Enabled = true
+	PushConf.SNS.Region = "us-east-1"
+	PushConf.SNS.AccessKeyID = "access-key"
+	PushConf.SNS.SecretAccessKey = "secret-key"
+	SNS = nil
+	StatStorage = memory.New()
+
+	return func() {
+		os.Unsetenv("AWS_ENDPOINT_URL_SNS")
+		SNS = nil
+		server.Close()
+		PushConf, _ = config.LoadConf("")
+	}
+}
+
+func snsPublished(id string) string {
+	return `<PublishResponse><PublishResult><MessageId>` + id + `</MessageId></PublishResult></PublishResponse>`
+}
+
+func snsErrorResponse(code, message string) string {
+	return `<ErrorResponse><Error><Type>Sender</Type><Code>` + code + `</Code><Message>` + message + `</Message></Error></ErrorResponse>`
+}
+
+func TestNewSNSMessage(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	badge := 1
+	message := newSNSMessage(PushNotification{
+		Platform: PlatFormSNS,
+		Tokens:   []string{snsIOSEndpoint},
+		Title:    "Hello",
+		Message:  "Welcome",
+		Badge:    &badge,
+		Data:     D{"key": "value"},
+	})
+
+	assert.Equal(t, "Welcome", message["default"])
+	assert.Equal(t, message["APNS"], message["APNS_SANDBOX"])
+
+	var apns map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(message["APNS"]), &apns))
+	assert.Equal(t, "value", apns["key"])
+	assert.Equal(t, float64(1), apns["aps"].(map[string]interface{})["badge"])
+
+	var gcm map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(message["GCM"]), &gcm))
+	assert.Equal(t, "Welcome", gcm["notification"].(map[string]interface{})["body"])
+	assert.Equal(t, "value", gcm["data"].(map[string]interface{})["key"])
+	// the endpoint ARN isn't the registration ID of FCM.
+	assert.Nil(t, gcm["registration_ids"])
+}
+
+func TestPushToSNS(t *testing.T) {
+	cleanup := testSNSServer(t, func(arn string, message map[string]string) (int, string) {
+		if arn == snsAndroidEndpoint {
+			return http.StatusBadRequest, snsErrorResponse("EndpointDisabled", "Endpoint is disabled")
+		}
+		return http.StatusOK, snsPublished("message-id")
+	})
+	defer cleanup()
+	assert.NoError(t, CheckPushConf())
+
+	isError := PushToSNS(PushNotification{
+		Platform: PlatFormSNS,
+		Tokens:   []string{snsIOSEndpoint, snsAndroidEndpoint},
+		Message:  "Welcome",
+	})
+	assert.True(t, isError)
+	assert.Equal(t, int64(1), StatStorage.GetSNSSuccess())
+	assert.Equal(t, int64(1), StatStorage.GetSNSError())
+}
+
+func TestPushToSNSRetry(t *testing.T) {
+	var sends int32
+	cleanup := testSNSServer(t, func(arn string, message map[string]string) (int, string) {
+		if atomic.AddInt32(&sends, 1) == 1 {
+			return http.StatusBadRequest, snsErrorResponse("Throttling", "Rate exceeded")
+		}
+		return http.StatusOK, snsPublished("message-id")
+	})
+	defer cleanup()
+	PushConf.SNS.MaxRetry = 1
+
+	isError := PushToSNS(PushNotification{
+		Platform: PlatFormSNS,
+		Tokens:   []string{snsIOSEndpoint},
+		Message:  "Welcome",
+	})
+	assert.False(t, isError)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&sends))
+	assert.Equal(t, int64(1), StatStorage.GetSNSSuccess())
+	assert.Equal(t, int64(1), StatStorage.GetSNSError())
+}
+
+func TestSNSErrors(t *testing.T) {
+	assert.True(t, isInvalidSNSEndpoint(&snsError{code: "EndpointDisabled"}))
+	assert.True(t, isInvalidSNSEndpoint(&snsError{code: "InvalidParameter", msg: "Invalid parameter: TargetArn Reason: No endpoint found for the target arn specified"}))
+	assert.False(t, isInvalidSNSEndpoint(&snsError{code: "InvalidParameter", msg: "Invalid parameter: Message too long"}))
+	assert.True(t, isSNSServiceError(&snsError{code: "Throttling", temporary: true}))
+	assert.False(t, isSNSServiceError(&snsError{code: "EndpointDisabled"}))
+	assert.Equal(t, "EndpointDisabled", failureReason(PlatFormSNS, &snsError{code: "EndpointDisabled"}))
+}
+
+func TestCheckSNSMessage(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = false
+	PushConf.SNS.Enabled = true
+	PushConf.SNS.Region = "us-east-1"
+	PushConf.SNS.AccessKeyID = "access-key"
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+	}()
+
+	err := CheckPushConf()
+	assert.Error(t, err)
+	assert.Equal(t, "Missing SNS access key ID or secret access key", err.Error())
+
+	err = CheckMessage(PushNotification{Platform: PlatFormSNS, Message: "Welcome"})
+	assert.Error(t, err)
+	assert.Equal(t, "the sns message must specify at least one endpoint ARN", err.Error())
+
+	assert.NoError(t, CheckMessage(PushNotification{Platform: PlatFormSNS, Tokens: []string{snsIOSEndpoint}, Message: "Welcome"}))
+	assert.NoError(t, checkToken(PlatFormSNS, snsAndroidEndpoint))
+	assert.Error(t, checkToken(PlatFormSNS, "arn:aws:sns:us-east-1:123456789012:app/GCM/app"))
+}
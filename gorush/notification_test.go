@@ -2,7 +2,9 @@ package gorush
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/appleboy/gorush/config"
 	"github.com/stretchr/testify/assert"
@@ -12,6 +14,7 @@ func TestCorrectConf(t *testing.T) {
 	PushConf, _ = config.LoadConf("")
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = "xxxxx"
 
 	PushConf.Ios.Enabled = true
@@ -31,6 +34,7 @@ func TestSenMultipleNotifications(t *testing.T) {
 	assert.Nil(t, err)
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 
 	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
@@ -66,6 +70,7 @@ func TestDisabledAndroidNotifications(t *testing.T) {
 	assert.Nil(t, err)
 
 	PushConf.Android.Enabled = false
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 
 	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
@@ -101,6 +106,7 @@ func TestSyncModeForNotifications(t *testing.T) {
 	assert.Nil(t, err)
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 
 	// enable sync mode
@@ -134,6 +140,7 @@ func TestSyncModeForTopicNotification(t *testing.T) {
 	PushConf, _ = config.LoadConf("")
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 	PushConf.Log.HideToken = false
 
@@ -176,6 +183,7 @@ func TestSyncModeForDeviceGroupNotification(t *testing.T) {
 	PushConf, _ = config.LoadConf("")
 
 	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
 	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 	PushConf.Log.HideToken = false
 
@@ -199,6 +207,7 @@ func TestSyncModeForDeviceGroupNotification(t *testing.T) {
 }
 
 func TestSetProxyURL(t *testing.T) {
+	defer restoreProxy()()
 
 	err := SetProxy("87.236.233.92:8080")
 	assert.Error(t, err)
@@ -210,3 +219,275 @@ func TestSetProxyURL(t *testing.T) {
 	err = SetProxy("http://87.236.233.92:8080")
 	assert.NoError(t, err)
 }
+
+func TestIOSTokenAuthConf(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = false
+
+	PushConf.Ios.Enabled = true
+	PushConf.Ios.KeyPath = "../certificate/authkey-valid.p8"
+
+	err := CheckPushConf()
+	assert.Error(t, err)
+	assert.Equal(t, "Missing iOS key_id or team_id for p8 token authentication", err.Error())
+
+	PushConf.Ios.KeyID = "ABC123DEFG"
+	err = CheckPushConf()
+	assert.Error(t, err)
+
+	PushConf.Ios.TeamID = "DEF123GHIJ"
+	assert.NoError(t, CheckPushConf())
+
+	// key id and team id only work with p8 key
+	PushConf.Ios.KeyPath = "../certificate/certificate-valid.pem"
+	err = CheckPushConf()
+	assert.Error(t, err)
+	assert.Equal(t, "iOS key_id and team_id require p8 token authentication key", err.Error())
+
+	PushConf.Ios.KeyPath = ""
+	PushConf.Ios.KeyBase64 = authkeyValidP8
+	PushConf.Ios.KeyType = "p8"
+	assert.NoError(t, CheckPushConf())
+}
+
+func TestCheckCollapseID(t *testing.T) {
+	req := PushNotification{
+		Tokens:     []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
+		Platform:   PlatFormIos,
+		Message:    "Welcome",
+		CollapseID: strings.Repeat("a", ApnsCollapseIDMaxLength),
+	}
+
+	assert.NoError(t, CheckMessage(req))
+
+	req.CollapseID += "a"
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the collapse_id must not exceed 64 bytes", err.Error())
+
+	// collapse_id is only used by APNs.
+	req.Platform = PlatFormAndroid
+	assert.NoError(t, CheckMessage(req))
+}
+
+func TestCheckIosApp(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Ios.Apps = map[string]config.SectionIosApp{
+		"example": {Topic: "com.example.app"},
+	}
+
+	req := PushNotification{
+		Tokens:   []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
+		Platform: PlatFormIos,
+		Message:  "Welcome",
+		App:      "example",
+	}
+
+	assert.NoError(t, CheckMessage(req))
+
+	req.App = "unknown"
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the iOS app profile unknown is not found", err.Error())
+}
+
+func TestCheckAndroidApp(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Apps = map[string]config.SectionAndroidApp{
+		"example": {APIVersion: "legacy", APIKey: "EXAMPLE_API_KEY"},
+	}
+
+	req := PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormAndroid,
+		App:      "Example",
+	}
+
+	assert.NoError(t, CheckMessage(req))
+
+	req.App = "unknown"
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the Android app unknown is not found", err.Error())
+
+	// api key of notification is used instead.
+	req.APIKey = "FAKE_API_KEY"
+	assert.NoError(t, CheckMessage(req))
+}
+
+func TestCheckPriorityAndExpiration(t *testing.T) {
+	req := PushNotification{
+		Tokens:     []string{"aaaaa"},
+		Platform:   PlatFormAndroid,
+		Priority:   "high",
+		Expiration: time.Now().Add(time.Hour).Unix(),
+	}
+
+	assert.NoError(t, CheckMessage(req))
+
+	req.Priority = "urgent"
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the priority must be high or normal", err.Error())
+
+	req.Priority = "normal"
+	req.Expiration = time.Now().Add(-time.Hour).Unix()
+	err = CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the expiration must not be in the past", err.Error())
+
+	// never expires.
+	req.Expiration = 0
+	assert.NoError(t, CheckMessage(req))
+}
+
+func TestCheckBadge(t *testing.T) {
+	req := PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormIos,
+		Message:  "Welcome",
+	}
+	assert.NoError(t, CheckMessage(req))
+
+	req.Badge = new(int)
+	assert.NoError(t, CheckMessage(req))
+
+	badge := -1
+	req.Badge = &badge
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the badge must not be negative, omit it to keep the badge", err.Error())
+}
+
+func TestCheckPayloadSize(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+
+	req := PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+		Data:     D{"blob": strings.Repeat("a", 4000)},
+	}
+	assert.NoError(t, CheckMessage(req))
+
+	req.Data = D{"blob": strings.Repeat("a", 4096)}
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "the payload size 41"))
+	assert.True(t, strings.HasSuffix(err.Error(), "exceeds the limit of 4096 bytes"))
+
+	// device tokens are not counted.
+	req.Data = nil
+	req.Tokens = make([]string, 1000)
+	for i := range req.Tokens {
+		req.Tokens[i] = strings.Repeat("a", 152)
+	}
+	assert.NoError(t, CheckMessage(req))
+
+	// VoIP payload has larger limit.
+	req = PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormIos,
+		Message:  "Welcome",
+		Data:     D{"blob": strings.Repeat("a", 4500)},
+	}
+	assert.Error(t, CheckMessage(req))
+	req.PushType = "voip"
+	assert.NoError(t, CheckMessage(req))
+
+	PushConf.Ios.MaxVoIPPayloadSize = 0
+	req.Data = D{"blob": strings.Repeat("a", 6000)}
+	assert.NoError(t, CheckMessage(req))
+}
+
+func TestCheckSound(t *testing.T) {
+	req := PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormIos,
+		Message:  "Welcome",
+		Sound:    "default",
+	}
+	assert.NoError(t, CheckMessage(req))
+
+	// decoded from request body.
+	req.Sound = map[string]interface{}{"critical": 1, "name": "alarm.caf", "volume": 1.0}
+	assert.NoError(t, CheckMessage(req))
+
+	req.Sound = map[string]interface{}{"critical": 1, "name": "alarm.caf", "volume": 1.5}
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the sound volume must be between 0.0 and 1.0", err.Error())
+
+	req.Sound = Sound{Critical: 1, Volume: -0.5}
+	assert.Error(t, CheckMessage(req))
+
+	req.Sound = nil
+	req.SoundVolume = 2
+	assert.Error(t, CheckMessage(req))
+
+	req.SoundVolume = 0
+	req.Sound = 1
+	err = CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the sound must be a string or an object", err.Error())
+
+	req.Sound = map[string]interface{}{"volume": "loud"}
+	assert.Error(t, CheckMessage(req))
+}
+
+func TestCheckImage(t *testing.T) {
+	req := PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormIos,
+		Message:  "Welcome",
+		Image:    "https://example.com/banner.png",
+	}
+	assert.NoError(t, CheckMessage(req))
+
+	req.Image = "banner.png"
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the image must be an http or https URL", err.Error())
+
+	req.Image = "ftp://example.com/banner.png"
+	assert.Error(t, CheckMessage(req))
+
+	// image is only used by APNs.
+	req.Platform = PlatFormAndroid
+	assert.NoError(t, CheckMessage(req))
+}
+
+func TestExpandNotification(t *testing.T) {
+	notifications, err := expandNotification(PushNotification{Platform: PlatFormAndroid, Tokens: []string{"aaaaa"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, "", notifications[0].ID)
+
+	notifications, err = expandNotification(PushNotification{
+		Platform:  PlatFormAll,
+		Tokens:    []string{"aaaaa"},
+		IosTokens: []string{"bbbbb", "ccccc"},
+		Topic:     "com.example.app",
+		Message:   "Welcome",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(notifications))
+	assert.Equal(t, PlatFormIos, notifications[0].Platform)
+	assert.Equal(t, []string{"bbbbb", "ccccc"}, notifications[0].Tokens)
+	assert.Equal(t, "com.example.app", notifications[0].Topic)
+	assert.Equal(t, PlatFormAndroid, notifications[1].Platform)
+	assert.Equal(t, []string{"aaaaa"}, notifications[1].Tokens)
+	// topic is APNs topic, android notification isn't a topic message.
+	assert.Equal(t, "", notifications[1].Topic)
+	assert.False(t, notifications[1].IsTopic())
+	assert.NotEmpty(t, notifications[0].ID)
+	assert.Equal(t, notifications[0].ID, notifications[1].ID)
+
+	notifications, err = expandNotification(PushNotification{Platform: PlatFormAll, ID: "campaign-1", IosTokens: []string{"bbbbb"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, "campaign-1", notifications[0].ID)
+
+	_, err = expandNotification(PushNotification{Platform: PlatFormAll, Tokens: []string{}})
+	assert.EqualError(t, err, "the message must specify at least one of tokens or ios_tokens")
+}
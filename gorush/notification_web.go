@@ -0,0 +1,184 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/SherClockHolmes/webpush-go"
+)
+
+// webDefaultTTL is the default seconds of push service to keep the message, 4 weeks.
+const webDefaultTTL = 2419200
+
+var errWebSubscriptionExpired = errors.New("web push subscription is expired")
+
+// WebNotification is payload of web push notification received by service worker.
+type WebNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Data  D      `json:"data,omitempty"`
+}
+
+// GetWebNotification use for define web push notification.
+func GetWebNotification(req PushNotification) *WebNotification {
+	notification := &WebNotification{
+		Title: req.Title,
+		Body:  req.Message,
+	}
+
+	if len(req.Data) > 0 {
+		notification.Data = req.Data
+	}
+
+	return notification
+}
+
+// PushToWeb provide send notification to web push service.
+func PushToWeb(req PushNotification) bool {
+	req.accessLog().Debug("Start push notification for Web")
+	if PushConf.Core.Sync {
+		defer req.WaitDone()
+	}
+
+	var (
+		retryCount = 0
+		maxRetry   = PushConf.Web.MaxRetry
+	)
+
+	if req.Retry > 0 && req.Retry < maxRetry {
+		maxRetry = req.Retry
+	}
+
+	// check message
+	err := CheckMessage(req)
+
+	if err != nil {
+		req.errorLog().Error("request error: " + err.Error())
+		return false
+	}
+
+	payload, err := json.Marshal(GetWebNotification(req))
+	if err != nil {
+		req.errorLog().Error("web push payload error: " + err.Error())
+		return false
+	}
+
+	options := &webpush.Options{
+		Subscriber:      PushConf.Web.Subject,
+		VAPIDPublicKey:  PushConf.Web.VAPIDPublicKey,
+		VAPIDPrivateKey: PushConf.Web.VAPIDPrivateKey,
+		TTL:             webDefaultTTL,
+		Topic:           req.CollapseKey,
+	}
+
+	if WebClient != nil {
+		options.HTTPClient = WebClient
+	}
+
+	if req.TimeToLive != nil {
+		options.TTL = int(*req.TimeToLive)
+	}
+
+	if req.Priority == "high" {
+		options.Urgency = webpush.UrgencyHigh
+	}
+
+	endpoint := req.Subscription.Endpoint
+
+	breaker := breakers[PlatFormWeb]
+
+Retry:
+	if req.canceled([]string{endpoint}) {
+		return true
+	}
+
+	if !breaker.allow() {
+		failUnavailable(req, []string{endpoint}, retryCount)
+		return true
+	}
+
+	err = sendWebNotification(payload, req.Subscription, options)
+	breaker.record(isWebServiceError(err))
+
+	if err == errWebSubscriptionExpired {
+		// subscription is gone, never resend it.
+		req.accessLog().Info("Expired web subscription: " + endpoint)
+		addFeedback(ExpiredSubscriptionPush, endpoint, req, err, "")
+		recordInvalidToken(endpoint, req.Platform, err)
+	}
+
+	if err != nil {
+		LogPush(FailedPush, endpoint, req, err)
+		addFeedback(FailedPush, endpoint, req, err, "")
+		addPushResult(FailedPush, req)
+		if PushConf.Core.Sync {
+			req.AddLog(getLogPushEntry(FailedPush, endpoint, req, err))
+		}
+		StatStorage.AddWebError(1)
+
+		if err == errWebSubscriptionExpired {
+			return true
+		}
+
+		if retryCount < maxRetry {
+			retryCount++
+			goto Retry
+		}
+
+		addDeadLetter(req, nil, err, retryCount+1)
+		return true
+	}
+
+	LogPush(SucceededPush, endpoint, req, nil)
+	addFeedback(SucceededPush, endpoint, req, nil, "")
+	addPushResult(SucceededPush, req)
+	StatStorage.AddWebSuccess(1)
+
+	return false
+}
+
+// webStatusError is the error status code returned by web push service.
+type webStatusError struct {
+	code int
+	body string
+}
+
+func (e *webStatusError) Error() string {
+	return fmt.Sprintf("web push service returned %d status code: %s", e.code, e.body)
+}
+
+// isWebServiceError reports whether the web push service is failed, e.g.
+// connection error or HTTP 5xx, instead of rejecting the subscription.
+func isWebServiceError(err error) bool {
+	switch e := err.(type) {
+	case *url.Error:
+		return true
+	case *webStatusError:
+		return e.code >= http.StatusInternalServerError
+	}
+
+	return false
+}
+
+// sendWebNotification encrypt payload and post it to the subscription endpoint.
+func sendWebNotification(payload []byte, subscription *webpush.Subscription, options *webpush.Options) error {
+	res, err := webpush.SendNotification(payload, subscription, options)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return errWebSubscriptionExpired
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		body, _ := ioutil.ReadAll(res.Body)
+		return &webStatusError{code: res.StatusCode, body: string(body)}
+	}
+
+	return nil
+}
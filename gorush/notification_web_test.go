@@ -0,0 +1,178 @@
+package gorush
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SherClockHolmes/webpush-go"
+	"github.com/appleboy/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func testWebSubscription(t *testing.T, endpoint string) *webpush.Subscription {
+	_, x, y, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	auth := make([]byte, 16)
+	_, err = rand.Read(auth)
+	assert.NoError(t, err)
+
+	return &webpush.Subscription{
+		Endpoint: endpoint,
+		Keys: webpush.Keys{
+			P256dh: base64.RawURLEncoding.EncodeToString(elliptic.Marshal(elliptic.P256(), x, y)),
+			Auth:   base64.RawURLEncoding.EncodeToString(auth),
+		},
+	}
+}
+
+func testWebConf(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	privateKey, publicKey, err := webpush.GenerateVAPIDKeys()
+	assert.NoError(t, err)
+
+	PushConf.Web.Enabled = true
+	PushConf.Web.VAPIDPublicKey = publicKey
+	PushConf.Web.VAPIDPrivateKey = privateKey
+	PushConf.Web.Subject = "mailto:test@example.com"
+}
+
+func TestMissingWebConf(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = false
+	PushConf.Web.Enabled = true
+
+	err := CheckPushConf()
+	assert.Error(t, err)
+	assert.Equal(t, "Missing Web VAPID key", err.Error())
+
+	PushConf.Web.VAPIDPublicKey = "public"
+	PushConf.Web.VAPIDPrivateKey = "private"
+
+	err = CheckPushConf()
+	assert.Error(t, err)
+	assert.Equal(t, "Missing Web VAPID subject", err.Error())
+
+	PushConf.Web.Subject = "mailto:test@example.com"
+	assert.NoError(t, CheckPushConf())
+}
+
+func TestCheckWebMessage(t *testing.T) {
+	req := PushNotification{
+		Platform: PlatFormWeb,
+		Message:  "Welcome",
+	}
+
+	err := CheckMessage(req)
+	assert.Error(t, err)
+	assert.Equal(t, "the web push message must specify subscription endpoint and keys", err.Error())
+
+	req.Subscription = testWebSubscription(t, "https://push.example.com/abc")
+	assert.NoError(t, CheckMessage(req))
+	assert.Equal(t, []string{"https://push.example.com/abc"}, req.recipients())
+}
+
+func TestWebNotificationPayload(t *testing.T) {
+	req := PushNotification{
+		Platform: PlatFormWeb,
+		Title:    "Hello",
+		Message:  "Welcome",
+		Data: D{
+			"url": "https://example.com",
+		},
+	}
+
+	notification := GetWebNotification(req)
+	assert.Equal(t, "Hello", notification.Title)
+	assert.Equal(t, "Welcome", notification.Body)
+	assert.Equal(t, "https://example.com", notification.Data["url"])
+}
+
+func TestPushToWeb(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	testWebConf(t)
+	WebClient = server.Client()
+	defer func() {
+		WebClient = nil
+	}()
+
+	req := PushNotification{
+		Platform:     PlatFormWeb,
+		Message:      "Welcome",
+		Priority:     "high",
+		Subscription: testWebSubscription(t, server.URL),
+	}
+
+	success := StatStorage.GetWebSuccess()
+	isError := PushToWeb(req)
+	assert.False(t, isError)
+	assert.Equal(t, success+1, StatStorage.GetWebSuccess())
+	assert.Equal(t, "aes128gcm", header.Get("Content-Encoding"))
+	assert.Equal(t, "high", header.Get("Urgency"))
+	assert.Contains(t, header.Get("Authorization"), "vapid t=")
+}
+
+func TestPushToWebExpiredSubscription(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	testWebConf(t)
+	WebClient = server.Client()
+	defer func() {
+		WebClient = nil
+	}()
+	PushConf.Web.MaxRetry = 2
+
+	req := PushNotification{
+		Platform:     PlatFormWeb,
+		Message:      "Welcome",
+		Subscription: testWebSubscription(t, server.URL),
+	}
+
+	failure := StatStorage.GetWebError()
+	isError := PushToWeb(req)
+	assert.True(t, isError)
+	// expired subscription is never resent.
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, failure+1, StatStorage.GetWebError())
+}
+
+func TestPushToWebRetry(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	testWebConf(t)
+	WebClient = server.Client()
+	defer func() {
+		WebClient = nil
+	}()
+	PushConf.Web.MaxRetry = 2
+
+	req := PushNotification{
+		Platform:     PlatFormWeb,
+		Message:      "Welcome",
+		Subscription: testWebSubscription(t, server.URL),
+	}
+
+	isError := PushToWeb(req)
+	assert.True(t, isError)
+	assert.Equal(t, 3, requests)
+}
@@ -0,0 +1,210 @@
+package gorush
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// providerProxy return the proxy of outbound connection to push provider,
+// nil if the connection is direct.
+var providerProxy = httpproxy.FromEnvironment().ProxyFunc()
+
+// InitProxy set proxy of push providers with core.http_proxy, core.https_proxy
+// and core.no_proxy, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+// variables are used if they are empty.
+func InitProxy() error {
+	conf := httpproxy.FromEnvironment()
+	if PushConf.Core.HTTPProxy != "" {
+		conf.HTTPProxy = PushConf.Core.HTTPProxy
+		conf.HTTPSProxy = PushConf.Core.HTTPProxy
+	}
+	if PushConf.Core.HTTPSProxy != "" {
+		conf.HTTPSProxy = PushConf.Core.HTTPSProxy
+	}
+	if PushConf.Core.NoProxy != "" {
+		conf.NoProxy = PushConf.Core.NoProxy
+	}
+
+	for _, proxy := range []string{PushConf.Core.HTTPProxy, PushConf.Core.HTTPSProxy} {
+		if proxy == "" {
+			continue
+		}
+		if _, err := url.ParseRequestURI(proxy); err != nil {
+			return err
+		}
+	}
+
+	setProxy(conf)
+
+	return nil
+}
+
+// SetProxy set the proxy of all HTTP and HTTPS connections to push providers.
+func SetProxy(proxy string) error {
+	if _, err := url.ParseRequestURI(proxy); err != nil {
+		return err
+	}
+
+	conf := httpproxy.FromEnvironment()
+	conf.HTTPProxy = proxy
+	conf.HTTPSProxy = proxy
+	if PushConf.Core.NoProxy != "" {
+		conf.NoProxy = PushConf.Core.NoProxy
+	}
+
+	setProxy(conf)
+
+	return nil
+}
+
+// setProxy use the proxy for FCM and web push by http.DefaultTransport and
+// for APNs by CONNECT tunnel.
+func setProxy(conf *httpproxy.Config) {
+	proxyFunc := conf.ProxyFunc()
+	providerProxy = proxyFunc
+	http.DefaultTransport = &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		},
+	}
+
+	if conf.HTTPProxy == "" && conf.HTTPSProxy == "" {
+		LogAccess.Info("Connect push providers without proxy")
+		return
+	}
+
+	LogAccess.Infof("Connect push providers with http proxy %q, https proxy %q, no proxy %q",
+		redactProxy(conf.HTTPProxy), redactProxy(conf.HTTPSProxy), conf.NoProxy)
+}
+
+// redactProxy remove the password of proxy URL for log.
+func redactProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+
+	return u.String()
+}
+
+// dialTLS dial the direct TLS connection, it is replaced in tests.
+var dialTLS = tls.DialWithDialer
+
+// apnsDialer return the dialer of ios.dial_timeout and ios.keep_alive.
+func apnsDialer() *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(PushConf.Ios.DialTimeout) * time.Second,
+		KeepAlive: time.Duration(PushConf.Ios.KeepAlive) * time.Second,
+	}
+	// zero keep-alive of dialer is the default period of Go.
+	if dialer.KeepAlive <= 0 {
+		dialer.KeepAlive = -1
+	}
+
+	return dialer
+}
+
+// dialAPNs dial TLS connection to APNs, through the CONNECT tunnel of proxy
+// if the address isn't excluded by no_proxy.
+func dialAPNs(network, addr string, cfg *tls.Config) (net.Conn, error) {
+	proxyURL, err := providerProxy(&url.URL{Scheme: "https", Host: addr})
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := apnsDialer()
+	if proxyURL == nil {
+		return dialTLS(dialer, network, addr, cfg)
+	}
+
+	conn, err := dialTunnel(dialer, proxyURL, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	setDialDeadline(conn, dialer)
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
+
+// dialTunnel connect the proxy and open the tunnel to address by CONNECT.
+func dialTunnel(dialer *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+
+	var conn net.Conn
+	var err error
+	if proxyURL.Scheme == "https" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", proxyAddr, &tls.Config{ServerName: proxyURL.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", proxyAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+
+	setDialDeadline(conn, dialer)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// nothing is sent by APNs before TLS handshake, so the buffered reader
+	// doesn't take any byte after the response.
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	if res.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT %s: %s", addr, res.Status)
+	}
+
+	return conn, nil
+}
+
+// setDialDeadline limit the CONNECT and TLS handshake by the dial timeout.
+func setDialDeadline(conn net.Conn, dialer *net.Dialer) {
+	if dialer.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(dialer.Timeout))
+	}
+}
@@ -0,0 +1,93 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+)
+
+// Queue is the notification queue shared by all gorush instances.
+type Queue interface {
+	Push(notification PushNotification) error
+	Close() error
+}
+
+// queueMessage is the notification saved in shared queue, the format is same
+// for all queue engines. The id makes every message unique.
+type queueMessage struct {
+	ID           string           `json:"id"`
+	JobID        string           `json:"job_id,omitempty"`
+	RequestID    string           `json:"request_id,omitempty"`
+	TraceParent  string           `json:"trace_parent,omitempty"`
+	Notification PushNotification `json:"notification"`
+}
+
+// encodeQueueMessage serialize notification for shared queue.
+func encodeQueueMessage(notification PushNotification) ([]byte, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(queueMessage{
+		ID:           id,
+		JobID:        notification.jobID,
+		RequestID:    notification.requestID,
+		TraceParent:  notification.traceParent,
+		Notification: notification,
+	})
+}
+
+// decodeQueueMessage return the notification of shared queue message.
+func decodeQueueMessage(data []byte) (PushNotification, error) {
+	var msg queueMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return PushNotification{}, err
+	}
+
+	notification := msg.Notification
+	notification.jobID = msg.JobID
+	notification.requestID = msg.RequestID
+	notification.traceParent = msg.TraceParent
+
+	return notification, nil
+}
+
+// sendQueueMessage send notification taken from shared queue.
+func sendQueueMessage(data []byte) error {
+	notification, err := decodeQueueMessage(data)
+	if err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&inFlight, 1)
+	SendNotification(notification)
+	atomic.AddInt64(&inFlight, -1)
+
+	return nil
+}
+
+// InitQueue connect to shared queue and start consumers if queue engine is
+// redis or nats, notifications are queued to local worker queue otherwise.
+func InitQueue() error {
+	LogAccess.Debug("Init Queue Engine as ", PushConf.Queue.Engine)
+
+	var err error
+	switch PushConf.Queue.Engine {
+	case "", "local":
+		return nil
+	case "redis":
+		SharedQueue, err = initRedisQueue()
+	case "nats":
+		SharedQueue, err = initNATSQueue()
+	default:
+		LogError.Error("queue error: can't find queue engine")
+		return errors.New("can't find queue engine")
+	}
+
+	if err != nil {
+		LogError.Error("queue error: " + err.Error())
+	}
+
+	return err
+}
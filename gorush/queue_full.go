@@ -0,0 +1,176 @@
+package gorush
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// queue full policy of core.queue_full_policy.
+const (
+	// QueueFullBlock wait until the worker queue has capacity.
+	QueueFullBlock = "block"
+	// QueueFullReject drop the notification with max capacity error.
+	QueueFullReject = "reject"
+	// QueueFullOverflow save the notification to storage, which is resent
+	// when the worker queue has capacity.
+	QueueFullOverflow = "overflow"
+)
+
+// OverflowStorageKey is key name of notifications saved to storage when
+// worker queue is full.
+const OverflowStorageKey = "gorush-queue-overflow"
+
+// overflowInterval is how often the saved notifications are re-enqueued.
+const overflowInterval = time.Second
+
+// overflowLock guards the notifications saved to storage, which are written
+// by push requests and the reclaimer.
+var overflowLock sync.Mutex
+
+// overflowStop stop the reclaimer of last InitQueueFullPolicy.
+var overflowStop chan struct{}
+
+// InitQueueFullPolicy check core.queue_full_policy and start the reclaimer
+// of overflow policy.
+func InitQueueFullPolicy() error {
+	switch PushConf.Core.QueueFullPolicy {
+	case "", QueueFullBlock, QueueFullReject:
+	case QueueFullOverflow:
+		if overflowStop != nil {
+			close(overflowStop)
+		}
+		overflowStop = make(chan struct{})
+		go reclaimOverflow(overflowStop)
+	default:
+		return fmt.Errorf("unknown queue_full_policy %q, must be block, reject or overflow", PushConf.Core.QueueFullPolicy)
+	}
+
+	return nil
+}
+
+// queueFullPolicy return core.queue_full_policy, default as reject.
+func queueFullPolicy() string {
+	if PushConf.Core.QueueFullPolicy == "" {
+		return QueueFullReject
+	}
+
+	return PushConf.Core.QueueFullPolicy
+}
+
+// enqueueLocal add notification to worker queue by core.queue_full_policy.
+// Return the log type and error of recipients which aren't in worker queue,
+// empty type if the notification is queued.
+func enqueueLocal(notification PushNotification) (string, error) {
+	queue := queueForPlatform(notification.Platform)
+	if tryEnqueue(notification, queue) {
+		return "", nil
+	}
+
+	switch queueFullPolicy() {
+	case QueueFullBlock:
+		ctx := notification.requestContext()
+		select {
+		case queue <- notification:
+			countQueued(notification.Platform, 1)
+			enqueuedCounter.WithLabelValues(typeForPlatForm(notification.Platform)).Inc()
+			return "", nil
+		case <-ctx.Done():
+			return DroppedPush, ctx.Err()
+		}
+	case QueueFullOverflow:
+		if notification.credential != "" {
+			return DroppedPush, errCredentialNotSaved
+		}
+		if err := saveOverflow(notification); err != nil {
+			return DroppedPush, err
+		}
+		return OverflowPush, nil
+	}
+
+	return DroppedPush, errMaxCapacity
+}
+
+// saveOverflow append notification to storage for the reclaimer.
+func saveOverflow(notification PushNotification) error {
+	overflowLock.Lock()
+	defer overflowLock.Unlock()
+
+	var pending []json.RawMessage
+	if data := StatStorage.GetData(OverflowStorageKey); len(data) > 0 {
+		if err := json.Unmarshal(data, &pending); err != nil {
+			return err
+		}
+	}
+
+	data, err := encodeQueueMessage(notification)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(append(pending, json.RawMessage(data)))
+	if err != nil {
+		return err
+	}
+	StatStorage.SetData(OverflowStorageKey, data)
+
+	return nil
+}
+
+// restoreOverflow enqueue the saved notifications while worker queue has
+// capacity, the rest are kept in storage. Return the number of enqueued.
+func restoreOverflow() int {
+	overflowLock.Lock()
+	defer overflowLock.Unlock()
+
+	data := StatStorage.GetData(OverflowStorageKey)
+	if len(data) == 0 {
+		return 0
+	}
+
+	var pending []json.RawMessage
+	if err := json.Unmarshal(data, &pending); err != nil {
+		LogError.Error("restore overflow error: " + err.Error())
+		StatStorage.Del(OverflowStorageKey)
+		return 0
+	}
+
+	var count int
+	for len(pending) > 0 {
+		notification, err := decodeQueueMessage(pending[0])
+		if err != nil {
+			LogError.Error("restore overflow error: " + err.Error())
+		} else if !tryEnqueue(notification, queueForPlatform(notification.Platform)) {
+			break
+		} else {
+			count++
+		}
+		pending = pending[1:]
+	}
+
+	if len(pending) > 0 {
+		data, _ = json.Marshal(pending)
+		StatStorage.SetData(OverflowStorageKey, data)
+	} else {
+		StatStorage.Del(OverflowStorageKey)
+	}
+
+	return count
+}
+
+func reclaimOverflow(stop chan struct{}) {
+	ticker := time.NewTicker(overflowInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if count := restoreOverflow(); count > 0 {
+				LogAccess.Debug("restore ", count, " overflow notifications from storage")
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package gorush
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/appleboy/gorush/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueFullPolicy(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	StatStorage = memory.New()
+	// no worker consumes the queue.
+	InitWorkers(0, 1)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	wg := sync.WaitGroup{}
+	enqueue := func(token string) []LogPushEntry {
+		log := []LogPushEntry{}
+		enqueueNotification(&PushNotification{Tokens: []string{token}, Platform: PlatFormAndroid, Message: "Welcome"}, &wg, &log)
+		return log
+	}
+	assert.Equal(t, 0, len(enqueue("aaaaa")))
+
+	log := enqueue("bbbbb")
+	assert.Equal(t, 1, len(log))
+	assert.Equal(t, DroppedPush, log[0].Type)
+	assert.Equal(t, errMaxCapacity.Error(), log[0].Error)
+	assert.Equal(t, QueueFullReject, log[0].Outcome)
+
+	PushConf.Core.QueueFullPolicy = QueueFullOverflow
+	log = enqueue("ccccc")
+	assert.Equal(t, OverflowPush, log[0].Type)
+	assert.Equal(t, QueueFullOverflow, log[0].Outcome)
+	assert.Equal(t, OverflowPush, enqueue("ddddd")[0].Type)
+
+	// the saved notifications are enqueued while the queue has capacity.
+	assert.Equal(t, 0, restoreOverflow())
+	assert.Equal(t, "aaaaa", (<-QueueNotification).Tokens[0])
+	assert.Equal(t, 1, restoreOverflow())
+	assert.Equal(t, "ccccc", (<-QueueNotification).Tokens[0])
+	assert.Equal(t, 1, restoreOverflow())
+	assert.Equal(t, "ddddd", (<-QueueNotification).Tokens[0])
+	assert.Empty(t, StatStorage.GetData(OverflowStorageKey))
+
+	PushConf.Core.QueueFullPolicy = QueueFullBlock
+	assert.Equal(t, 0, len(enqueue("eeeee")))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-QueueNotification
+	}()
+	assert.Equal(t, 0, len(enqueue("fffff")))
+	assert.Equal(t, "fffff", (<-QueueNotification).Tokens[0])
+
+	// the blocked request gives up when timed out.
+	QueueNotification <- PushNotification{Platform: PlatFormAndroid}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	status, err := enqueueLocal(PushNotification{Tokens: []string{"ggggg"}, Platform: PlatFormAndroid, ctx: ctx})
+	assert.Equal(t, DroppedPush, status)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestOverflowRequestCredential(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.QueueFullPolicy = QueueFullOverflow
+	StatStorage = memory.New()
+	// no worker consumes the queue.
+	InitWorkers(0, 1)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+	QueueNotification <- PushNotification{Platform: PlatFormAndroid}
+
+	// the request credentials aren't saved, so it would be sent by the
+	// credentials of server when it is restored.
+	status, err := enqueueLocal(PushNotification{Tokens: []string{"aaaaa"}, Platform: PlatFormAndroid, credential: "tenant"})
+	assert.Equal(t, DroppedPush, status)
+	assert.Equal(t, errCredentialNotSaved, err)
+	assert.Empty(t, StatStorage.GetData(OverflowStorageKey))
+}
+
+func TestInitQueueFullPolicy(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+	}()
+
+	assert.NoError(t, InitQueueFullPolicy())
+	PushConf.Core.QueueFullPolicy = "drop"
+	assert.EqualError(t, InitQueueFullPolicy(), `unknown queue_full_policy "drop", must be block, reject or overflow`)
+}
@@ -0,0 +1,181 @@
+package gorush
+
+import (
+	"context"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsFetchTimeout is how long consumer waits for notification before
+// checking whether workers are stopped.
+const natsFetchTimeout = time.Second
+
+// NATSQueue is the notification queue on NATS JetStream subject shared by all
+// gorush instances. The durable pull consumer acks notification after it is
+// sent, so notification of crashed consumer is redelivered after ack wait.
+// Notification delivered more than max deliver times is moved to dead-letter
+// subject.
+type NATSQueue struct {
+	conn *nats.Conn
+	js   nats.JetStreamContext
+	conf config.SectionQueueNATS
+}
+
+// newNATSQueue connect to NATS server and create the stream if not exists.
+func newNATSQueue(conf config.SectionQueueNATS) (*NATSQueue, error) {
+	conn, err := nats.Connect(conf.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err := js.StreamInfo(conf.Stream); err != nil {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     conf.Stream,
+			Subjects: []string{conf.Subject, conf.DeadLetterSubject},
+		})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return &NATSQueue{
+		conn: conn,
+		js:   js,
+		conf: conf,
+	}, nil
+}
+
+// initNATSQueue connect to NATS queue and start consumers.
+func initNATSQueue() (Queue, error) {
+	queue, err := newNATSQueue(PushConf.Queue.NATS)
+	if err != nil {
+		return nil, err
+	}
+
+	LogAccess.Debug("nats queue consumer number is ", PushConf.Queue.NATS.ConsumerNum)
+	for i := int64(0); i < PushConf.Queue.NATS.ConsumerNum; i++ {
+		sub, err := queue.subscribe()
+		if err != nil {
+			queue.Close()
+			return nil, err
+		}
+		go queue.consume(workerCtx, sub)
+	}
+
+	return queue, nil
+}
+
+// subscribe bind to the durable pull consumer, it is created on first call.
+func (q *NATSQueue) subscribe() (*nats.Subscription, error) {
+	opts := []nats.SubOpt{
+		nats.BindStream(q.conf.Stream),
+		nats.AckExplicit(),
+		nats.AckWait(time.Duration(q.conf.AckWait) * time.Second),
+	}
+	if q.conf.MaxDeliver > 0 {
+		// one more delivery which moves notification to dead-letter subject.
+		opts = append(opts, nats.MaxDeliver(q.conf.MaxDeliver+1))
+	}
+
+	return q.js.PullSubscribe(q.conf.Subject, q.conf.Durable, opts...)
+}
+
+// Push publish notification to subject.
+func (q *NATSQueue) Push(notification PushNotification) error {
+	data, err := encodeQueueMessage(notification)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.js.Publish(q.conf.Subject, data)
+
+	return err
+}
+
+func (q *NATSQueue) consume(ctx context.Context, sub *nats.Subscription) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		msgs, err := sub.Fetch(1, nats.MaxWait(natsFetchTimeout))
+		if err == nats.ErrTimeout {
+			continue
+		}
+		if err != nil {
+			LogError.Error("nats queue error: " + err.Error())
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(natsFetchTimeout):
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			if ctx.Err() != nil {
+				// redeliver to other consumer now.
+				if err := msg.Nak(); err != nil {
+					LogError.Error("nats queue nak error: " + err.Error())
+				}
+				continue
+			}
+
+			q.handle(msg)
+		}
+	}
+}
+
+// handle send the notification of message and ack it, malformed message and
+// message reached max deliver are moved to dead-letter subject.
+func (q *NATSQueue) handle(msg *nats.Msg) {
+	if q.conf.MaxDeliver > 0 {
+		if meta, err := msg.Metadata(); err == nil && meta.NumDelivered > uint64(q.conf.MaxDeliver) {
+			LogError.Errorf("nats queue notification is delivered %d times", meta.NumDelivered-1)
+			q.deadLetter(msg)
+			return
+		}
+	}
+
+	if err := sendQueueMessage(msg.Data); err != nil {
+		LogError.Error("nats queue malformed notification: " + err.Error())
+		q.deadLetter(msg)
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		LogError.Error("nats queue ack error: " + err.Error())
+	}
+}
+
+// deadLetter publish message to dead-letter subject and ack it, the message
+// is redelivered if publish fails.
+func (q *NATSQueue) deadLetter(msg *nats.Msg) {
+	if _, err := q.js.Publish(q.conf.DeadLetterSubject, msg.Data); err != nil {
+		LogError.Error("nats queue dead letter error: " + err.Error())
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		LogError.Error("nats queue ack error: " + err.Error())
+	}
+}
+
+// Close the NATS connection.
+func (q *NATSQueue) Close() error {
+	q.conn.Close()
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package gorush
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestNATSQueue(t *testing.T) *NATSQueue {
+	PushConf, _ = config.LoadConf("")
+	conf := PushConf.Queue.NATS
+	conf.URL = "nats://nats:4222"
+	conf.Stream = "gorush-test"
+	conf.Subject = "gorush-test.notifications"
+	conf.DeadLetterSubject = "gorush-test.dead"
+	conf.Durable = "gorush-test"
+	conf.MaxDeliver = 2
+
+	conn, err := nats.Connect(conf.URL)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	js, _ := conn.JetStream()
+	_ = js.DeleteStream(conf.Stream)
+	conn.Close()
+
+	queue, err := newNATSQueue(conf)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return queue
+}
+
+func fetchNATSMessage(t *testing.T, sub *nats.Subscription) *nats.Msg {
+	msgs, err := sub.Fetch(1, nats.MaxWait(time.Second))
+	if !assert.NoError(t, err) || !assert.Equal(t, 1, len(msgs)) {
+		t.FailNow()
+	}
+
+	return msgs[0]
+}
+
+func TestNATSQueueConnectError(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Queue.Engine = "nats"
+	PushConf.Queue.NATS.URL = "nats://nats:4200"
+
+	assert.Error(t, InitQueue())
+	assert.Nil(t, SharedQueue)
+}
+
+func TestNATSQueuePushAndAck(t *testing.T) {
+	queue := newTestNATSQueue(t)
+	defer queue.Close()
+
+	sub, err := queue.subscribe()
+	assert.NoError(t, err)
+
+	// notification of unknown platform is not sent.
+	assert.NoError(t, queue.Push(PushNotification{
+		Tokens:  []string{"aaaaa"},
+		Message: "Welcome",
+		jobID:   "1234",
+	}))
+
+	msg := fetchNATSMessage(t, sub)
+	notification, err := decodeQueueMessage(msg.Data)
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", notification.jobID)
+	assert.Equal(t, []string{"aaaaa"}, notification.Tokens)
+
+	queue.handle(msg)
+
+	info, err := queue.js.ConsumerInfo(queue.conf.Stream, queue.conf.Durable)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, info.NumAckPending)
+	assert.Equal(t, uint64(0), info.NumPending)
+}
+
+func TestNATSQueueDeadLetter(t *testing.T) {
+	queue := newTestNATSQueue(t)
+	defer queue.Close()
+
+	sub, err := queue.subscribe()
+	assert.NoError(t, err)
+	dead, err := queue.js.PullSubscribe(queue.conf.DeadLetterSubject, "gorush-test-dead", nats.BindStream(queue.conf.Stream))
+	assert.NoError(t, err)
+
+	assert.NoError(t, queue.Push(PushNotification{Tokens: []string{"aaaaa"}}))
+
+	// consumer crashed twice.
+	for i := 0; i < queue.conf.MaxDeliver; i++ {
+		assert.NoError(t, fetchNATSMessage(t, sub).Nak())
+	}
+
+	msg := fetchNATSMessage(t, sub)
+	queue.handle(msg)
+
+	deadMsg := fetchNATSMessage(t, dead)
+	assert.Equal(t, msg.Data, deadMsg.Data)
+
+	// malformed message is moved to dead-letter subject.
+	_, err = queue.js.Publish(queue.conf.Subject, []byte("{"))
+	assert.NoError(t, err)
+	queue.handle(fetchNATSMessage(t, sub))
+	assert.Equal(t, []byte("{"), fetchNATSMessage(t, dead).Data)
+
+	info, err := queue.js.ConsumerInfo(queue.conf.Stream, queue.conf.Durable)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, info.NumAckPending)
+}
+
+func TestQueueNotificationToNATS(t *testing.T) {
+	queue := newTestNATSQueue(t)
+	PushConf.Android.Enabled = true
+	InitWorkers(0, 10)
+	SharedQueue = queue
+	defer func() {
+		SharedQueue = nil
+		queue.Close()
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	req := RequestPush{
+		Notifications: []PushNotification{
+			{Platform: PlatFormAndroid, Tokens: []string{"aaaaa", "bbbbb"}, Message: "Welcome"},
+		},
+	}
+
+	count, logs := queueNotification(req)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 0, len(logs))
+	assert.Equal(t, 0, len(QueueNotification))
+
+	info, err := queue.js.StreamInfo(queue.conf.Stream)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), info.State.Msgs)
+}
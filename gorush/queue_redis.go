@@ -0,0 +1,232 @@
+package gorush
+
+import (
+	"context"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+
+	"gopkg.in/redis.v5"
+)
+
+// redisQueuePopTimeout is how long consumer blocks on empty queue before
+// checking whether workers are stopped.
+const redisQueuePopTimeout = time.Second
+
+// redisRequeueInterval is the interval of checking expired in-flight notification.
+const redisRequeueInterval = time.Second
+
+// requeueScript track the notifications in processing list which have no
+// deadline yet (consumer crashed right after taking it), and move every
+// expired notification from processing list back to pending list. The
+// requeued notification is pushed to the tail, so it is taken first.
+var requeueScript = redis.NewScript(`
+local items = redis.call('LRANGE', KEYS[2], 0, -1)
+for _, item in ipairs(items) do
+	redis.call('ZADD', KEYS[3], 'NX', ARGV[2], item)
+end
+local expired = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', ARGV[1])
+for _, item in ipairs(expired) do
+	redis.call('ZREM', KEYS[3], item)
+	redis.call('LREM', KEYS[2], 1, item)
+	redis.call('RPUSH', KEYS[1], item)
+end
+return #expired
+`)
+
+// releaseScript move one notification from processing list back to pending list.
+var releaseScript = redis.NewScript(`
+redis.call('ZREM', KEYS[3], ARGV[1])
+if redis.call('LREM', KEYS[2], 1, ARGV[1]) > 0 then
+	redis.call('RPUSH', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// RedisQueue is the notification queue on redis list shared by all gorush
+// instances. Consumer moves notification to processing list by BRPOPLPUSH
+// and tracks its deadline in in-flight sorted set, notification which isn't
+// acked before visibility timeout is requeued, so it is delivered at least once.
+type RedisQueue struct {
+	client     *redis.Client
+	key        string
+	processing string
+	inflight   string
+	visibility time.Duration
+}
+
+// newRedisQueue connect to redis server of queue config.
+func newRedisQueue(conf config.SectionQueueRedis) (*RedisQueue, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     conf.Addr,
+		Password: conf.Password,
+		DB:       conf.DB,
+	})
+
+	if _, err := client.Ping().Result(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisQueue{
+		client:     client,
+		key:        conf.Key,
+		processing: conf.Key + ":processing",
+		inflight:   conf.Key + ":inflight",
+		visibility: time.Duration(conf.VisibilityTimeout) * time.Second,
+	}, nil
+}
+
+// initRedisQueue connect to redis queue and start consumers.
+func initRedisQueue() (Queue, error) {
+	queue, err := newRedisQueue(PushConf.Queue.Redis)
+	if err != nil {
+		return nil, err
+	}
+
+	LogAccess.Debug("redis queue consumer number is ", PushConf.Queue.Redis.ConsumerNum)
+	for i := int64(0); i < PushConf.Queue.Redis.ConsumerNum; i++ {
+		go queue.consume(workerCtx)
+	}
+	go queue.requeueLoop(workerCtx)
+
+	return queue, nil
+}
+
+// Push add notification to pending list.
+func (q *RedisQueue) Push(notification PushNotification) error {
+	data, err := encodeQueueMessage(notification)
+	if err != nil {
+		return err
+	}
+
+	return q.client.LPush(q.key, data).Err()
+}
+
+// pop take notification from pending list and start its visibility timeout,
+// return empty payload if no notification is available before timeout.
+func (q *RedisQueue) pop(timeout time.Duration) (string, error) {
+	payload, err := q.client.BRPopLPush(q.key, q.processing, timeout).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(q.visibility).UnixNano() / int64(time.Millisecond)
+	if err := q.client.ZAdd(q.inflight, redis.Z{Score: float64(deadline), Member: payload}).Err(); err != nil {
+		// the notification is tracked by next requeue.
+		LogError.Error("redis queue track error: " + err.Error())
+	}
+
+	return payload, nil
+}
+
+// ack remove the sent notification from processing list.
+func (q *RedisQueue) ack(payload string) error {
+	_, err := q.client.TxPipelined(func(pipe *redis.Pipeline) error {
+		pipe.LRem(q.processing, 1, payload)
+		pipe.ZRem(q.inflight, payload)
+		return nil
+	})
+
+	return err
+}
+
+// release put the notification taken by stopped consumer back to pending list.
+func (q *RedisQueue) release(payload string) error {
+	return releaseScript.Run(q.client, []string{q.key, q.processing, q.inflight}, payload).Err()
+}
+
+// requeue move expired in-flight notifications back to pending list, return
+// the number of requeued notifications.
+func (q *RedisQueue) requeue() (int64, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	deadline := now + int64(q.visibility/time.Millisecond)
+
+	val, err := requeueScript.Run(q.client, []string{q.key, q.processing, q.inflight}, now, deadline).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	count, _ := val.(int64)
+
+	return count, nil
+}
+
+// Len return the number of pending notifications.
+func (q *RedisQueue) Len() (int64, error) {
+	return q.client.LLen(q.key).Result()
+}
+
+func (q *RedisQueue) consume(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		payload, err := q.pop(redisQueuePopTimeout)
+		if err != nil {
+			LogError.Error("redis queue error: " + err.Error())
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(redisQueuePopTimeout):
+			}
+			continue
+		}
+
+		if payload == "" {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			if err := q.release(payload); err != nil {
+				LogError.Error("redis queue release error: " + err.Error())
+			}
+			return
+		}
+
+		q.handle(payload)
+	}
+}
+
+// handle send the notification of payload and ack it, malformed payload is dropped.
+func (q *RedisQueue) handle(payload string) {
+	if err := sendQueueMessage([]byte(payload)); err != nil {
+		LogError.Error("redis queue drop malformed notification: " + err.Error())
+	}
+
+	if err := q.ack(payload); err != nil {
+		LogError.Error("redis queue ack error: " + err.Error())
+	}
+}
+
+func (q *RedisQueue) requeueLoop(ctx context.Context) {
+	ticker := time.NewTicker(redisRequeueInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := q.requeue()
+			if err != nil {
+				LogError.Error("redis queue requeue error: " + err.Error())
+				continue
+			}
+			if count > 0 {
+				LogError.Errorf("redis queue requeue %d notifications after visibility timeout", count)
+			}
+		}
+	}
+}
+
+// Close the redis connection.
+func (q *RedisQueue) Close() error {
+	return q.client.Close()
+}
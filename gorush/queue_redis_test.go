@@ -0,0 +1,155 @@
+package gorush
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedisQueue(t *testing.T) *RedisQueue {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Queue.Redis.Addr = "redis:6379"
+	PushConf.Queue.Redis.Key = "gorush-queue-test"
+
+	queue, err := newRedisQueue(PushConf.Queue.Redis)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	queue.client.Del(queue.key, queue.processing, queue.inflight)
+
+	return queue
+}
+
+func TestRedisQueueConnectError(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Queue.Engine = "redis"
+	PushConf.Queue.Redis.Addr = "redis:6370"
+
+	assert.Error(t, InitQueue())
+	assert.Nil(t, SharedQueue)
+}
+
+func TestRedisQueuePushAndAck(t *testing.T) {
+	queue := newTestRedisQueue(t)
+	defer queue.Close()
+
+	assert.NoError(t, queue.Push(PushNotification{
+		Platform: PlatFormAndroid,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+		jobID:    "1234",
+	}))
+
+	count, _ := queue.Len()
+	assert.Equal(t, int64(1), count)
+
+	payload, err := queue.pop(redisQueuePopTimeout)
+	assert.NoError(t, err)
+
+	notification, err := decodeQueueMessage([]byte(payload))
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", notification.jobID)
+	assert.Equal(t, []string{"aaaaa"}, notification.Tokens)
+
+	count, _ = queue.Len()
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, int64(1), queue.client.LLen(queue.processing).Val())
+	assert.Equal(t, int64(1), queue.client.ZCard(queue.inflight).Val())
+
+	// not expired yet.
+	requeued, err := queue.requeue()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), requeued)
+
+	assert.NoError(t, queue.ack(payload))
+	assert.Equal(t, int64(0), queue.client.LLen(queue.processing).Val())
+	assert.Equal(t, int64(0), queue.client.ZCard(queue.inflight).Val())
+
+	// empty queue.
+	payload, err = queue.pop(redisQueuePopTimeout)
+	assert.NoError(t, err)
+	assert.Equal(t, "", payload)
+}
+
+func TestRedisQueueRequeue(t *testing.T) {
+	queue := newTestRedisQueue(t)
+	defer queue.Close()
+	queue.visibility = 0
+
+	assert.NoError(t, queue.Push(PushNotification{Platform: PlatFormAndroid, Tokens: []string{"aaaaa"}}))
+	payload, err := queue.pop(redisQueuePopTimeout)
+	assert.NoError(t, err)
+
+	// consumer crashed before tracking the deadline.
+	queue.client.LPush(queue.processing, "untracked")
+
+	requeued, err := queue.requeue()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), requeued)
+	assert.Equal(t, int64(0), queue.client.LLen(queue.processing).Val())
+	assert.Equal(t, int64(0), queue.client.ZCard(queue.inflight).Val())
+
+	count, _ := queue.Len()
+	assert.Equal(t, int64(2), count)
+
+	// requeued notification is taken again.
+	next, err := queue.pop(redisQueuePopTimeout)
+	assert.NoError(t, err)
+	assert.Contains(t, []string{payload, "untracked"}, next)
+}
+
+func TestRedisQueueRelease(t *testing.T) {
+	queue := newTestRedisQueue(t)
+	defer queue.Close()
+
+	assert.NoError(t, queue.Push(PushNotification{Platform: PlatFormAndroid, Tokens: []string{"aaaaa"}}))
+	payload, err := queue.pop(redisQueuePopTimeout)
+	assert.NoError(t, err)
+
+	assert.NoError(t, queue.release(payload))
+	assert.Equal(t, int64(0), queue.client.LLen(queue.processing).Val())
+	assert.Equal(t, int64(0), queue.client.ZCard(queue.inflight).Val())
+
+	count, _ := queue.Len()
+	assert.Equal(t, int64(1), count)
+}
+
+func TestQueueNotificationToRedis(t *testing.T) {
+	queue := newTestRedisQueue(t)
+	PushConf.Android.Enabled = true
+	InitWorkers(0, 10)
+	SharedQueue = queue
+	defer func() {
+		SharedQueue = nil
+		queue.Close()
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	req := RequestPush{
+		Notifications: []PushNotification{
+			{Platform: PlatFormAndroid, Tokens: []string{"aaaaa", "bbbbb"}, Message: "Welcome"},
+			{Platform: PlatFormAndroid, Tokens: []string{"ccccc"}, Message: "Welcome"},
+		},
+	}
+
+	count, logs := queueNotification(req)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 0, len(logs))
+	assert.Equal(t, 0, len(QueueNotification))
+
+	pending, _ := queue.Len()
+	assert.Equal(t, int64(2), pending)
+
+	// sync mode uses local queue.
+	PushConf.Core.Sync = true
+	notification := req.Notifications[0]
+	wg := sync.WaitGroup{}
+	enqueueNotification(&notification, &wg, &logs)
+	assert.Equal(t, 1, len(QueueNotification))
+	pending, _ = queue.Len()
+	assert.Equal(t, int64(2), pending)
+}
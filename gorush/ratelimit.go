@@ -0,0 +1,133 @@
+package gorush
+
+import (
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitShards is the number of shards of limiter map, each shard has own lock.
+const rateLimitShards = 32
+
+// rateLimitSweep is the interval to remove idle client buckets of shard.
+const rateLimitSweep = time.Minute
+
+// tokenBucket is the request tokens left of a client.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimitShard struct {
+	sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+// RateLimiter is token bucket limiter keyed by client.
+type RateLimiter struct {
+	rate   float64
+	burst  float64
+	shards [rateLimitShards]*rateLimitShard
+	now    func() time.Time
+}
+
+// NewRateLimiter create limiter allows rate requests per second with burst of each client.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+
+	l := &RateLimiter{
+		rate:  rate,
+		burst: float64(burst),
+		now:   time.Now,
+	}
+
+	for i := range l.shards {
+		l.shards[i] = &rateLimitShard{
+			buckets: make(map[string]*tokenBucket),
+		}
+	}
+
+	return l
+}
+
+func (l *RateLimiter) shard(key string) *rateLimitShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return l.shards[h.Sum32()%rateLimitShards]
+}
+
+// Allow take one token of client, return false and the duration to wait
+// for next token if client is over limit.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	now := l.now()
+	s := l.shard(key)
+
+	s.Lock()
+	defer s.Unlock()
+
+	if now.Sub(s.swept) > rateLimitSweep {
+		l.sweep(s, now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+// sweep remove buckets which are refilled, it is the same as a new client.
+func (l *RateLimiter) sweep(s *rateLimitShard, now time.Time) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(s.buckets, key)
+		}
+	}
+	s.swept = now
+}
+
+// rateLimitKey return basic auth username or client certificate name of
+// request, client IP if both are missing.
+func rateLimitKey(c *gin.Context) string {
+	if user := c.GetString(gin.AuthUserKey); user != "" {
+		return "user:" + user
+	}
+
+	if name := clientCertName(c); name != "" {
+		return "cert:" + name
+	}
+
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitMiddleware reject request over core.rate_limit with 429 status code.
+func RateLimitMiddleware(l *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ok, wait := l.Allow(rateLimitKey(c)); !ok {
+			rateLimitCounter.Inc()
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			abortWithError(c, http.StatusTooManyRequests, "Too many requests.")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,112 @@
+package gorush
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("a")
+		assert.True(t, ok)
+	}
+
+	ok, wait := l.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// other client has own bucket.
+	ok, _ = l.Allow("b")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("a")
+	assert.True(t, ok)
+	ok, _ = l.Allow("a")
+	assert.False(t, ok)
+
+	// refilled buckets are removed.
+	now = now.Add(2 * rateLimitSweep)
+	s := l.shard("b")
+	l.sweep(s, now)
+	_, ok = s.buckets["b"]
+	assert.False(t, ok)
+}
+
+func TestRateLimiterDefaultBurst(t *testing.T) {
+	assert.Equal(t, float64(1), NewRateLimiter(0.5, 0).burst)
+	assert.Equal(t, float64(5), NewRateLimiter(5, 0).burst)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	initTest()
+	PushConf.Core.RateLimit = 1
+	PushConf.Core.RateLimitBurst = 1
+
+	rejected := testutil.ToFloat64(rateLimitCounter)
+	r := gofight.New()
+	engine := routerEngine()
+
+	r.GET("/api/version").
+		Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	r.GET("/api/version").
+		Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusTooManyRequests, r.Code)
+			assert.Equal(t, "1", r.HeaderMap.Get("Retry-After"))
+		})
+
+	// health check is not limited.
+	r.GET(PushConf.API.HealthURI).
+		Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	assert.Equal(t, rejected+1, testutil.ToFloat64(rateLimitCounter))
+}
+
+func TestRateLimitByUsername(t *testing.T) {
+	initTest()
+	PushConf.Core.RateLimit = 1
+	PushConf.Core.RateLimitBurst = 1
+	PushConf.Auth.Enabled = true
+	PushConf.Auth.Username = "gorush"
+	PushConf.Auth.Password = "password"
+	defer func() {
+		PushConf.Auth.Enabled = false
+	}()
+
+	r := gofight.New()
+	engine := routerEngine()
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("gorush:password"))
+
+	r.GET("/api/version").
+		SetHeader(gofight.H{"Authorization": auth}).
+		Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	r.GET("/api/version").
+		SetHeader(gofight.H{"Authorization": auth}).
+		Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusTooManyRequests, r.Code)
+		})
+
+	// unauthorized request is rejected before rate limit.
+	gofight.New().GET("/api/version").
+		Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+}
@@ -0,0 +1,193 @@
+package gorush
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gorush/config"
+	"github.com/gin-gonic/gin"
+	"github.com/sideshow/apns2"
+)
+
+// readyCacheTTL is how long the result of provider probes is cached.
+const readyCacheTTL = 5 * time.Second
+
+// readyProbeTimeout is the timeout of provider probes, the slow provider is unhealthy.
+const readyProbeTimeout = 5 * time.Second
+
+// fcmProbeTopic is the topic of dry run message which checks FCM API key.
+const fcmProbeTopic = "/topics/gorush-ready-probe"
+
+var (
+	errAPNsNotInitialized = errors.New("APNs client is not initialized")
+	errProbeTimeout       = errors.New("probe timeout")
+)
+
+// ProviderStatus is the connectivity of push provider.
+type ProviderStatus struct {
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+func newProviderStatus(err error) ProviderStatus {
+	if err != nil {
+		return ProviderStatus{Error: err.Error()}
+	}
+
+	return ProviderStatus{Healthy: true}
+}
+
+// readyCache keeps the provider status, probes run once per ttl whatever the
+// number of readiness requests is.
+type readyCache struct {
+	sync.Mutex
+	probe     func() map[string]ProviderStatus
+	checkedAt time.Time
+	status    map[string]ProviderStatus
+}
+
+var providerReady = &readyCache{probe: probeProviders}
+
+// get return cached provider status, probe providers again if cache expired.
+func (c *readyCache) get() map[string]ProviderStatus {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.status == nil || time.Since(c.checkedAt) > readyCacheTTL {
+		c.status = c.probe()
+		c.checkedAt = time.Now()
+	}
+
+	return c.status
+}
+
+// probeProviders check connectivity of all enabled providers concurrently.
+func probeProviders() map[string]ProviderStatus {
+	return runProbes(providerProbes(func(pool *ApnsClientPool, app config.SectionIosApp) error {
+		return probeAPNs(pool, app.Production)
+	}))
+}
+
+// providerProbes return the probe of every enabled provider and app profile,
+// APNs pools are checked by probeIos.
+func providerProbes(probeIos func(pool *ApnsClientPool, app config.SectionIosApp) error) map[string]func() error {
+	probes := map[string]func() error{}
+
+	if PushConf.Ios.Enabled {
+		probes["ios"] = func() error {
+			return probeIos(ApnsPool, iosDefaultApp())
+		}
+		for name, app := range PushConf.Ios.Apps {
+			pool, app := ApnsPools[name], app
+			probes["ios:"+name] = func() error {
+				return probeIos(pool, app)
+			}
+		}
+	}
+
+	if PushConf.Android.Enabled {
+		probes["android"] = func() error {
+			return probeFCM("")
+		}
+		for name := range PushConf.Android.Apps {
+			app := name
+			probes["android:"+name] = func() error {
+				return probeFCM(app)
+			}
+		}
+	}
+
+	return probes
+}
+
+// runProbes run the probes concurrently, the probe not finished in
+// readyProbeTimeout is failed.
+func runProbes(probes map[string]func() error) map[string]ProviderStatus {
+	type result struct {
+		name string
+		err  error
+	}
+
+	// buffered, so the probe finished after timeout never blocks.
+	results := make(chan result, len(probes))
+	for name, probe := range probes {
+		go func(name string, probe func() error) {
+			results <- result{name, probe()}
+		}(name, probe)
+	}
+
+	status := make(map[string]ProviderStatus, len(probes))
+	timeout := time.After(readyProbeTimeout)
+	for len(status) < len(probes) {
+		select {
+		case r := <-results:
+			status[r.name] = newProviderStatus(r.err)
+		case <-timeout:
+			for name := range probes {
+				if _, ok := status[name]; !ok {
+					status[name] = newProviderStatus(errProbeTimeout)
+				}
+			}
+		}
+	}
+
+	return status
+}
+
+// probeAPNs do TLS handshake and HTTP/2 ping with APNs host.
+func probeAPNs(pool *ApnsClientPool, production bool) error {
+	if pool == nil {
+		return errAPNsNotInitialized
+	}
+
+	host := apns2.HostDevelopment
+	if production {
+		host = apns2.HostProduction
+	}
+
+	return pool.probe(host, readyProbeTimeout)
+}
+
+// probeFCM send dry run topic message to check FCM server and API key,
+// nothing is delivered to devices.
+func probeFCM(app string) error {
+	client, err := getFCMClient("", app)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Send(&fcm.Message{
+		To:     fcmProbeTopic,
+		DryRun: true,
+	})
+
+	return err
+}
+
+func readyHandler(c *gin.Context) {
+	if isShuttingDown() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "shutting down",
+		})
+		return
+	}
+
+	providers := providerReady.get()
+	code := http.StatusOK
+	status := "ok"
+	for _, provider := range providers {
+		if !provider.Healthy {
+			code = http.StatusServiceUnavailable
+			status = "unavailable"
+			break
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status":    status,
+		"providers": providers,
+	})
+}
@@ -0,0 +1,118 @@
+package gorush
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gorush/config"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/sideshow/apns2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadyCache(t *testing.T) {
+	var probes int
+	cache := &readyCache{probe: func() map[string]ProviderStatus {
+		probes++
+		return map[string]ProviderStatus{"android": {Healthy: true}}
+	}}
+
+	assert.True(t, cache.get()["android"].Healthy)
+	assert.True(t, cache.get()["android"].Healthy)
+	assert.Equal(t, 1, probes)
+
+	// probe again after cache expired.
+	cache.checkedAt = time.Now().Add(-readyCacheTTL - time.Second)
+	cache.get()
+	assert.Equal(t, 2, probes)
+}
+
+func TestReadyHandler(t *testing.T) {
+	initTest()
+
+	status := map[string]ProviderStatus{
+		"ios":     {Healthy: true},
+		"android": {Error: "401 error: 401 Unauthorized"},
+	}
+	ready := providerReady
+	providerReady = &readyCache{probe: func() map[string]ProviderStatus {
+		return status
+	}}
+	defer func() {
+		providerReady = ready
+	}()
+
+	r := gofight.New()
+	r.GET(PushConf.API.ReadyURI).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			var res struct {
+				Status    string                    `json:"status"`
+				Providers map[string]ProviderStatus `json:"providers"`
+			}
+			assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &res))
+
+			assert.Equal(t, http.StatusServiceUnavailable, r.Code)
+			assert.Equal(t, "unavailable", res.Status)
+			assert.Equal(t, status, res.Providers)
+		})
+
+	status["android"] = ProviderStatus{Healthy: true}
+	providerReady.checkedAt = time.Time{}
+	r.GET(PushConf.API.ReadyURI).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+}
+
+func TestProbeProviders(t *testing.T) {
+	_, _, cleanup := testApnsServer(t)
+	defer cleanup()
+
+	code := http.StatusOK
+	fcmServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(`{"message_id":1}`))
+	}))
+	defer fcmServer.Close()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Ios.Enabled = true
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	// http.DefaultTransport may be replaced by proxy test.
+	FCMClient, _ = fcm.NewClient(PushConf.Android.APIKey,
+		fcm.WithEndpoint(fcmServer.URL),
+		fcm.WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+	)
+	ApnsPool = newApnsPool(apns2.NewClient(tls.Certificate{}), 1, 0)
+	defer func() {
+		ApnsPool.Close()
+		ApnsPool = nil
+		FCMClient = nil
+	}()
+
+	status := probeProviders()
+	assert.Equal(t, map[string]ProviderStatus{
+		"ios":     {Healthy: true},
+		"android": {Healthy: true},
+	}, status)
+
+	// invalid API key.
+	code = http.StatusUnauthorized
+	status = probeProviders()
+	assert.True(t, status["ios"].Healthy)
+	assert.False(t, status["android"].Healthy)
+	assert.Contains(t, status["android"].Error, "401")
+
+	// app profile without pool.
+	PushConf.Ios.Apps = map[string]config.SectionIosApp{"example": {}}
+	status = probeProviders()
+	assert.Equal(t, errAPNsNotInitialized.Error(), status["ios:example"].Error)
+}
@@ -0,0 +1,177 @@
+package gorush
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfLoader load the config of reload, it is set by main with config file
+// and command line options.
+var ConfLoader func() (config.ConfYaml, error)
+
+// reloadLock make sure only one reload changes the clients and worker pools.
+var reloadLock sync.Mutex
+
+// keepStaticConf keep the config which can't be changed without restart,
+// return the keys of them changed in new config.
+func keepStaticConf(old config.ConfYaml, conf *config.ConfYaml) []string {
+	ignored := []string{}
+	keep := func(key string, oldValue, newValue interface{}) {
+		o := reflect.ValueOf(oldValue).Elem()
+		n := reflect.ValueOf(newValue).Elem()
+		if !reflect.DeepEqual(o.Interface(), n.Interface()) {
+			ignored = append(ignored, key)
+			n.Set(o)
+		}
+	}
+
+	keep("core.enabled", &old.Core.Enabled, &conf.Core.Enabled)
+	keep("core.address", &old.Core.Address, &conf.Core.Address)
+	keep("core.port", &old.Core.Port, &conf.Core.Port)
+	keep("core.queue_num", &old.Core.QueueNum, &conf.Core.QueueNum)
+	keep("core.mode", &old.Core.Mode, &conf.Core.Mode)
+	keep("core.ssl", &old.Core.SSL, &conf.Core.SSL)
+	keep("core.cert_path", &old.Core.CertPath, &conf.Core.CertPath)
+	keep("core.key_path", &old.Core.KeyPath, &conf.Core.KeyPath)
+	keep("core.cert_base64", &old.Core.CertBase64, &conf.Core.CertBase64)
+	keep("core.key_base64", &old.Core.KeyBase64, &conf.Core.KeyBase64)
+	keep("core.tls_min_version", &old.Core.TLSMinVersion, &conf.Core.TLSMinVersion)
+	keep("core.tls_cipher_suites", &old.Core.TLSCipherSuites, &conf.Core.TLSCipherSuites)
+	keep("core.client_ca", &old.Core.ClientCA, &conf.Core.ClientCA)
+	keep("core.client_senders", &old.Core.ClientSenders, &conf.Core.ClientSenders)
+	keep("core.allowed_ips", &old.Core.AllowedIPs, &conf.Core.AllowedIPs)
+	keep("core.denied_ips", &old.Core.DeniedIPs, &conf.Core.DeniedIPs)
+	keep("core.metric_allowed_ips", &old.Core.MetricAllowedIPs, &conf.Core.MetricAllowedIPs)
+	keep("core.health_allowed_ips", &old.Core.HealthAllowedIPs, &conf.Core.HealthAllowedIPs)
+	keep("core.trusted_proxies", &old.Core.TrustedProxies, &conf.Core.TrustedProxies)
+	keep("core.http_proxy", &old.Core.HTTPProxy, &conf.Core.HTTPProxy)
+	keep("core.https_proxy", &old.Core.HTTPSProxy, &conf.Core.HTTPSProxy)
+	keep("core.no_proxy", &old.Core.NoProxy, &conf.Core.NoProxy)
+	keep("core.feedback_url", &old.Core.FeedbackURL, &conf.Core.FeedbackURL)
+	keep("core.feedback_timeout", &old.Core.FeedbackTimeout, &conf.Core.FeedbackTimeout)
+	keep("core.feedback_concurrency", &old.Core.FeedbackNum, &conf.Core.FeedbackNum)
+	keep("core.feedback_queue_num", &old.Core.FeedbackQueueNum, &conf.Core.FeedbackQueueNum)
+	keep("core.callback_concurrency", &old.Core.CallbackNum, &conf.Core.CallbackNum)
+	keep("core.transform_script", &old.Core.TransformScript, &conf.Core.TransformScript)
+	keep("core.max_invalid_token", &old.Core.MaxInvalidToken, &conf.Core.MaxInvalidToken)
+	keep("core.request_timeout", &old.Core.RequestTimeout, &conf.Core.RequestTimeout)
+	keep("core.max_body_size", &old.Core.MaxBodySize, &conf.Core.MaxBodySize)
+	keep("core.max_connections", &old.Core.MaxConnections, &conf.Core.MaxConnections)
+	keep("core.dead_letter", &old.Core.DeadLetter, &conf.Core.DeadLetter)
+	keep("core.validate_on_start", &old.Core.ValidateOnStart, &conf.Core.ValidateOnStart)
+	keep("core.tracing", &old.Core.Tracing, &conf.Core.Tracing)
+	keep("core.queue_full_policy", &old.Core.QueueFullPolicy, &conf.Core.QueueFullPolicy)
+	keep("core.idempotency", &old.Core.Idempotency, &conf.Core.Idempotency)
+	keep("core.alert", &old.Core.Alert, &conf.Core.Alert)
+	keep("core.rate_limit", &old.Core.RateLimit, &conf.Core.RateLimit)
+	keep("core.rate_limit_burst", &old.Core.RateLimitBurst, &conf.Core.RateLimitBurst)
+	keep("core.http_compression", &old.Core.HTTPCompression, &conf.Core.HTTPCompression)
+	keep("core.h2c", &old.Core.H2C, &conf.Core.H2C)
+	keep("core.root_response", &old.Core.RootResponse, &conf.Core.RootResponse)
+	keep("core.pid", &old.Core.PID, &conf.Core.PID)
+	keep("core.auto_tls", &old.Core.AutoTLS, &conf.Core.AutoTLS)
+	keep("api", &old.API, &conf.API)
+	keep("log", &old.Log, &conf.Log)
+	keep("stat", &old.Stat, &conf.Stat)
+	keep("queue", &old.Queue, &conf.Queue)
+	keep("inbound", &old.Inbound, &conf.Inbound)
+	keep("grpc", &old.GRPC, &conf.GRPC)
+	keep("auth", &old.Auth, &conf.Auth)
+
+	// dedicated worker pool can be resized but not added or removed.
+	if (old.Core.IosWorkerNum > 0) != (conf.Core.IosWorkerNum > 0) {
+		keep("core.ios_worker_num", &old.Core.IosWorkerNum, &conf.Core.IosWorkerNum)
+	}
+	if (old.Core.AndroidWorkerNum > 0) != (conf.Core.AndroidWorkerNum > 0) {
+		keep("core.android_worker_num", &old.Core.AndroidWorkerNum, &conf.Core.AndroidWorkerNum)
+	}
+	// autoscale can be tuned but not enabled or disabled.
+	if (old.Core.MaxWorkers > 0) != (conf.Core.MaxWorkers > 0) {
+		keep("core.max_workers", &old.Core.MaxWorkers, &conf.Core.MaxWorkers)
+	}
+
+	return ignored
+}
+
+// initClients rebuild the provider clients of config, the previous clients
+// are kept if any of them can't be initialized.
+func initClients() error {
+	// Push Kit client is created again on next Huawei notification.
+	HMS = nil
+	// SNS client is created again on next SNS notification.
+	SNS = nil
+
+	fcmClient, fcmv1, fcmClients := FCMClient, FCMv1, FCMClients
+	FCMClient, FCMv1 = nil, nil
+	if err := InitFCM(); err != nil {
+		FCMClient, FCMv1, FCMClients = fcmClient, fcmv1, fcmClients
+		return err
+	}
+
+	// APNs pools are only replaced if all of them are created.
+	if err := InitAPNSClient(); err != nil {
+		FCMClient, FCMv1, FCMClients = fcmClient, fcmv1, fcmClients
+		return err
+	}
+
+	return nil
+}
+
+// ReloadConf load config again, rebuild the provider clients and resize
+// worker pools without dropping queued notifications. Return the keys of
+// config which are changed but can't be applied at runtime.
+func ReloadConf() ([]string, error) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	if ConfLoader == nil {
+		return nil, errors.New("config loader is not set")
+	}
+
+	conf, err := ConfLoader()
+	if err != nil {
+		return nil, err
+	}
+
+	old := PushConf
+	ignored := keepStaticConf(old, &conf)
+
+	PushConf = conf
+	if err := CheckPushConf(); err != nil {
+		PushConf = old
+		return nil, err
+	}
+
+	if err := initClients(); err != nil {
+		PushConf = old
+		return nil, err
+	}
+
+	resizeWorkers()
+
+	if len(ignored) > 0 {
+		LogAccess.Warnf("config %v can't be changed without restart", ignored)
+	}
+	LogAccess.Info("config is reloaded")
+
+	return ignored, nil
+}
+
+func reloadHandler(c *gin.Context) {
+	ignored, err := ReloadConf()
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+		"ignored": ignored,
+	})
+}
@@ -0,0 +1,141 @@
+package gorush
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/buger/jsonparser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepStaticConf(t *testing.T) {
+	old, _ := config.LoadConf("")
+	conf, _ := config.LoadConf("")
+
+	assert.Equal(t, []string{}, keepStaticConf(old, &conf))
+
+	conf.Core.Port = "9000"
+	conf.Core.WorkerNum = 8
+	conf.API.PushURI = "/api/v2/push"
+	conf.Core.IosWorkerNum = 2
+	ignored := keepStaticConf(old, &conf)
+	assert.Equal(t, []string{"core.port", "api", "core.ios_worker_num"}, ignored)
+	assert.Equal(t, old.Core.Port, conf.Core.Port)
+	assert.Equal(t, old.API.PushURI, conf.API.PushURI)
+	assert.Equal(t, old.Core.IosWorkerNum, conf.Core.IosWorkerNum)
+	assert.Equal(t, int64(8), conf.Core.WorkerNum)
+}
+
+func TestWorkerPoolResize(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	InitWorkers(2, 10)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+	queue := QueueNotification
+
+	commonWorkers.resize(4)
+	assert.Equal(t, 4, commonWorkers.size())
+
+	commonWorkers.resize(0)
+	assert.Equal(t, 0, commonWorkers.size())
+	time.Sleep(10 * time.Millisecond)
+
+	// queue is kept and nobody takes notification from it.
+	QueueNotification <- PushNotification{Platform: PlatFormAndroid}
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, len(QueueNotification))
+	assert.Equal(t, queue, QueueNotification)
+}
+
+// androidConf return the default config with fake key of FCM legacy API.
+func androidConf() config.ConfYaml {
+	conf, _ := config.LoadConf("")
+	conf.Android.APIVersion = "legacy"
+	conf.Android.APIKey = "fake-api-key"
+
+	return conf
+}
+
+func TestReloadConf(t *testing.T) {
+	PushConf = androidConf()
+	InitWorkers(2, 10)
+	defer func() {
+		ConfLoader = nil
+		FCMClient = nil
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	ConfLoader = nil
+	_, err := ReloadConf()
+	assert.Error(t, err)
+
+	ConfLoader = func() (config.ConfYaml, error) {
+		return config.ConfYaml{}, errors.New("file not found")
+	}
+	_, err = ReloadConf()
+	assert.Equal(t, "file not found", err.Error())
+
+	// invalid config keeps the current one.
+	ConfLoader = func() (config.ConfYaml, error) {
+		conf := androidConf()
+		conf.Android.APIKey = ""
+		conf.Core.WorkerNum = 8
+		return conf, nil
+	}
+	_, err = ReloadConf()
+	assert.Error(t, err)
+	assert.Equal(t, "fake-api-key", PushConf.Android.APIKey)
+	assert.Equal(t, 2, commonWorkers.size())
+
+	ConfLoader = func() (config.ConfYaml, error) {
+		conf := androidConf()
+		conf.Core.WorkerNum = 8
+		conf.Core.Port = "9000"
+		return conf, nil
+	}
+	ignored, err := ReloadConf()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"core.port"}, ignored)
+	assert.Equal(t, int64(8), PushConf.Core.WorkerNum)
+	assert.Equal(t, "8088", PushConf.Core.Port)
+	assert.Equal(t, 8, commonWorkers.size())
+}
+
+func TestReloadHandler(t *testing.T) {
+	initTest()
+	defer func() {
+		ConfLoader = nil
+		FCMClient = nil
+	}()
+	ConfLoader = func() (config.ConfYaml, error) {
+		conf := androidConf()
+		conf.Core.Mode = "test"
+		conf.Core.Address = "127.0.0.1"
+		return conf, nil
+	}
+
+	r := gofight.New()
+
+	r.POST("/api/reload").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := r.Body.Bytes()
+			value, _ := jsonparser.GetString(data, "ignored", "[0]")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, "core.address", value)
+		})
+
+	ConfLoader = nil
+	r.POST("/api/reload").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusInternalServerError, r.Code)
+		})
+}
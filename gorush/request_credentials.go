@@ -0,0 +1,166 @@
+package gorush
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/sideshow/apns2"
+)
+
+// credentialClientsMax is the max number of cached clients of request
+// credentials, the cache is cleared over it.
+const credentialClientsMax = 1000
+
+var errCredentialExpired = errors.New("the clients of request credentials are evicted from cache")
+
+// RequestCredentials is the APNs and FCM credentials of tenant carried by
+// push request, used instead of the credentials of config if
+// auth.allow_request_credentials is enabled.
+type RequestCredentials struct {
+	Ios     *IosCredential     `json:"ios,omitempty"`
+	Android *AndroidCredential `json:"android,omitempty"`
+}
+
+// IosCredential is the APNs token authentication of request.
+type IosCredential struct {
+	// KeyBase64 is the base64 of p8 key.
+	KeyBase64  string `json:"key_base64"`
+	KeyID      string `json:"key_id"`
+	TeamID     string `json:"team_id"`
+	Topic      string `json:"topic"`
+	Production bool   `json:"production,omitempty"`
+}
+
+// AndroidCredential is the FCM HTTP v1 service account of request.
+type AndroidCredential struct {
+	CredentialJSON string `json:"credential_json"`
+}
+
+// credentialClients is the clients built from request credentials.
+type credentialClients struct {
+	ios     *apns2.Client
+	iosApp  config.SectionIosApp
+	android FCMSender
+}
+
+var credentialCache = struct {
+	sync.Mutex
+	clients map[string]*credentialClients
+}{clients: map[string]*credentialClients{}}
+
+// fingerprint return the hash of credentials, which is the key of cache.
+func (c RequestCredentials) fingerprint() string {
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// loadRequestCredentials build the clients of request credentials, the
+// clients are cached by fingerprint of credentials so they are not rebuilt
+// per request. Return the fingerprint.
+func loadRequestCredentials(creds RequestCredentials) (string, error) {
+	if creds.Ios == nil && creds.Android == nil {
+		return "", errors.New("the credentials must have ios or android")
+	}
+
+	id := creds.fingerprint()
+
+	credentialCache.Lock()
+	_, ok := credentialCache.clients[id]
+	credentialCache.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	clients := &credentialClients{}
+	if creds.Ios != nil {
+		if creds.Ios.KeyBase64 == "" || creds.Ios.KeyID == "" || creds.Ios.TeamID == "" {
+			return "", errors.New("the ios credentials must have key_base64, key_id and team_id")
+		}
+
+		clients.iosApp = config.SectionIosApp{
+			KeyBase64:  creds.Ios.KeyBase64,
+			KeyType:    "p8",
+			KeyID:      creds.Ios.KeyID,
+			TeamID:     creds.Ios.TeamID,
+			Topic:      creds.Ios.Topic,
+			Production: creds.Ios.Production,
+		}
+		client, err := newApnsClient(clients.iosApp)
+		if err != nil {
+			return "", errors.New("invalid ios credentials: " + err.Error())
+		}
+		clients.ios = client
+	}
+
+	if creds.Android != nil {
+		client, err := newFCMSender(config.SectionAndroidApp{
+			APIVersion:     "v1",
+			CredentialJSON: creds.Android.CredentialJSON,
+		})
+		if err != nil {
+			return "", err
+		}
+		clients.android = client
+	}
+
+	credentialCache.Lock()
+	if len(credentialCache.clients) >= credentialClientsMax {
+		credentialCache.clients = map[string]*credentialClients{}
+	}
+	credentialCache.clients[id] = clients
+	credentialCache.Unlock()
+
+	return id, nil
+}
+
+// requestCredentialClients return the cached clients of notification which
+// carries request credentials.
+func requestCredentialClients(req PushNotification) (*credentialClients, error) {
+	credentialCache.Lock()
+	defer credentialCache.Unlock()
+
+	clients, ok := credentialCache.clients[req.credential]
+	if !ok {
+		return nil, errCredentialExpired
+	}
+
+	return clients, nil
+}
+
+// credentialApnsClient return the APNs client of request credentials.
+func credentialApnsClient(req PushNotification) (*apns2.Client, error) {
+	clients, err := requestCredentialClients(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if clients.ios == nil {
+		return nil, errors.New("the request credentials have no ios credentials")
+	}
+
+	if req.isProduction(clients.iosApp.Production) != clients.iosApp.Production {
+		return apnsOtherHost(clients.ios), nil
+	}
+
+	return clients.ios, nil
+}
+
+// credentialFCMClient return the FCM client of request credentials.
+func credentialFCMClient(req PushNotification) (FCMSender, error) {
+	clients, err := requestCredentialClients(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if clients.android == nil {
+		return nil, errors.New("the request credentials have no android credentials")
+	}
+
+	return clients.android, nil
+}
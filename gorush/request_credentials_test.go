@@ -0,0 +1,88 @@
+package gorush
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/appleboy/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestCredentialsNotAllowed(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+	PushConf.Ios.Enabled = true
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+	}()
+
+	r := gofight.New()
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{"tokens": []string{"aaaaa"}, "platform": PlatFormIos, "message": "Welcome"},
+			},
+			"credentials": gofight.D{
+				"ios": gofight.D{"key_base64": authkeyValidP8, "key_id": "ABCDE", "team_id": "TEAM"},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusForbidden, r.Code)
+		})
+
+	PushConf.Auth.AllowRequestCredentials = true
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{"tokens": []string{"aaaaa"}, "platform": PlatFormIos, "message": "Welcome"},
+			},
+			"credentials": gofight.D{
+				"ios": gofight.D{"key_base64": authkeyInvalidP8, "key_id": "ABCDE", "team_id": "TEAM"},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+}
+
+func TestLoadRequestCredentials(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+
+	_, err := loadRequestCredentials(RequestCredentials{})
+	assert.Error(t, err)
+	_, err = loadRequestCredentials(RequestCredentials{Ios: &IosCredential{KeyBase64: authkeyValidP8}})
+	assert.Error(t, err)
+	_, err = loadRequestCredentials(RequestCredentials{Android: &AndroidCredential{CredentialJSON: "{"}})
+	assert.Error(t, err)
+
+	creds := RequestCredentials{Ios: &IosCredential{
+		KeyBase64: authkeyValidP8,
+		KeyID:     "ABCDE",
+		TeamID:    "TEAM",
+		Topic:     "com.tenant.app",
+	}}
+	id, err := loadRequestCredentials(creds)
+	assert.NoError(t, err)
+	again, err := loadRequestCredentials(creds)
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	// the clients are cached by fingerprint of credentials.
+	req := PushNotification{Platform: PlatFormIos, credential: id}
+	client, err := iosClient(req)
+	assert.NoError(t, err)
+	cached, _ := iosClient(req)
+	assert.True(t, client == cached)
+	assert.Equal(t, "com.tenant.app", iosAppTopic(req))
+
+	_, err = androidClient(req)
+	assert.Error(t, err)
+
+	_, err = iosClient(PushNotification{Platform: PlatFormIos, credential: "unknown"})
+	assert.Equal(t, errCredentialExpired, err)
+
+	// the credentials are never scheduled since they are not saved.
+	req.SendAt = 1
+	assert.Error(t, checkSendAt(req))
+}
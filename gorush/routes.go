@@ -0,0 +1,71 @@
+package gorush
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Route names of api.disabled_routes
+const (
+	RoutePush          = "push"
+	RouteStat          = "stat"
+	RouteConfig        = "config"
+	RouteSys           = "sys"
+	RouteMetrics       = "metrics"
+	RouteHealth        = "health"
+	RouteReady         = "ready"
+	RouteInvalidTokens = "invalid_tokens"
+	RouteDeadLetter    = "dead_letter"
+	RouteScheduled     = "scheduled"
+	RouteReload        = "reload"
+	RouteAdmin         = "admin"
+)
+
+var routeNames = []string{
+	RoutePush,
+	RouteStat,
+	RouteConfig,
+	RouteSys,
+	RouteMetrics,
+	RouteHealth,
+	RouteReady,
+	RouteInvalidTokens,
+	RouteDeadLetter,
+	RouteScheduled,
+	RouteReload,
+	RouteAdmin,
+}
+
+// disabledRoutes return the set of comma separated names of api.disabled_routes.
+func disabledRoutes() map[string]bool {
+	disabled := make(map[string]bool)
+	for _, name := range strings.Split(PushConf.API.DisabledRoutes, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			disabled[name] = true
+		}
+	}
+
+	return disabled
+}
+
+// checkDisabledRoutes reject the unknown name of api.disabled_routes, so a
+// typo doesn't leave the route enabled.
+func checkDisabledRoutes() error {
+	for name := range disabledRoutes() {
+		if !isRouteName(name) {
+			return fmt.Errorf("api.disabled_routes: unknown route %q, must be one of %s", name, strings.Join(routeNames, ", "))
+		}
+	}
+
+	return nil
+}
+
+func isRouteName(name string) bool {
+	for _, n := range routeNames {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
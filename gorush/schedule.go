@@ -0,0 +1,252 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScheduledKey is key name of scheduled notifications saved in storage.
+const ScheduledKey = "gorush-scheduled"
+
+// scheduleInterval is how often the due notifications are enqueued.
+const scheduleInterval = time.Second
+
+// ScheduledNotification is the notification waiting for its send_at.
+type ScheduledNotification struct {
+	ID           string           `json:"id"`
+	SendAt       int64            `json:"send_at"`
+	Notification PushNotification `json:"notification"`
+	CreatedAt    int64            `json:"created_at"`
+}
+
+// scheduleLock guards the scheduled notifications saved to storage, which
+// are written by push requests, cancel API and the dispatcher.
+var scheduleLock sync.Mutex
+
+// scheduleStop stop the dispatcher of last InitSchedule.
+var scheduleStop chan struct{}
+
+// InitSchedule start the dispatcher of scheduled notifications.
+func InitSchedule() {
+	if scheduleStop != nil {
+		close(scheduleStop)
+	}
+	scheduleStop = make(chan struct{})
+	go dispatchSchedule(scheduleStop)
+}
+
+// checkSendAt validate send_at under core.schedule.max_delay.
+func checkSendAt(req PushNotification) error {
+	if req.SendAt == 0 {
+		return nil
+	}
+
+	if req.credential != "" {
+		return errors.New("the send_at is not allowed with request credentials")
+	}
+
+	maxDelay := PushConf.Core.Schedule.MaxDelay
+	if maxDelay <= 0 {
+		return errors.New("the send_at is not allowed, scheduling is disabled")
+	}
+
+	if req.SendAt < 0 || req.SendAt > time.Now().Unix()+maxDelay {
+		return fmt.Errorf("the send_at must not be more than %d seconds in the future", maxDelay)
+	}
+
+	return nil
+}
+
+// isScheduled reports whether notification is sent later by dispatcher.
+func isScheduled(req PushNotification) bool {
+	return req.SendAt > time.Now().Unix()
+}
+
+// loadScheduled return the saved notifications, the lock must be held.
+func loadScheduled() ([]ScheduledNotification, error) {
+	scheduled := []ScheduledNotification{}
+	data := StatStorage.GetData(ScheduledKey)
+	if len(data) == 0 {
+		return scheduled, nil
+	}
+
+	err := json.Unmarshal(data, &scheduled)
+
+	return scheduled, err
+}
+
+// saveScheduled save the notifications, the lock must be held.
+func saveScheduled(scheduled []ScheduledNotification) error {
+	if len(scheduled) == 0 {
+		StatStorage.Del(ScheduledKey)
+		return nil
+	}
+
+	data, err := json.Marshal(scheduled)
+	if err != nil {
+		return err
+	}
+	StatStorage.SetData(ScheduledKey, data)
+
+	return nil
+}
+
+// scheduleNotification save notification to storage until its send_at.
+func scheduleNotification(notification PushNotification) (string, error) {
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+
+	scheduled, err := loadScheduled()
+	if err != nil {
+		return "", err
+	}
+
+	scheduled = append(scheduled, ScheduledNotification{
+		ID:           id,
+		SendAt:       notification.SendAt,
+		Notification: notification,
+		CreatedAt:    time.Now().Unix(),
+	})
+
+	return id, saveScheduled(scheduled)
+}
+
+// listScheduled return the pending notifications, the earliest first.
+func listScheduled() ([]ScheduledNotification, error) {
+	scheduleLock.Lock()
+	scheduled, err := loadScheduled()
+	scheduleLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(scheduled, func(i, j int) bool {
+		return scheduled[i].SendAt < scheduled[j].SendAt
+	})
+
+	return scheduled, nil
+}
+
+// cancelScheduled remove the pending notification, false if not found.
+func cancelScheduled(id string) (bool, error) {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+
+	scheduled, err := loadScheduled()
+	if err != nil {
+		return false, err
+	}
+
+	for i := range scheduled {
+		if scheduled[i].ID == id {
+			return true, saveScheduled(append(scheduled[:i], scheduled[i+1:]...))
+		}
+	}
+
+	return false, nil
+}
+
+// enqueueScheduled enqueue the notifications which send_at arrives, the
+// notification dropped by full queue is kept for next time. Return the
+// number of enqueued.
+func enqueueScheduled(now int64) int {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+
+	scheduled, err := loadScheduled()
+	if err != nil {
+		LogError.Error("load scheduled notifications error: " + err.Error())
+		return 0
+	}
+
+	var count int
+	left := scheduled[:0:0]
+	for _, item := range scheduled {
+		if item.SendAt > now {
+			left = append(left, item)
+			continue
+		}
+
+		notification := item.Notification
+		notification.SendAt = 0
+		if SharedQueue != nil {
+			if err := SharedQueue.Push(notification); err != nil {
+				LogError.Error("queue error: " + err.Error())
+				left = append(left, item)
+				continue
+			}
+		} else if !tryEnqueue(notification, queueForPlatform(notification.Platform)) {
+			left = append(left, item)
+			continue
+		}
+		count++
+	}
+
+	if count > 0 {
+		if err := saveScheduled(left); err != nil {
+			LogError.Error("save scheduled notifications error: " + err.Error())
+		}
+	}
+
+	return count
+}
+
+func dispatchSchedule(stop chan struct{}) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if count := enqueueScheduled(time.Now().Unix()); count > 0 {
+				LogAccess.Debug("enqueue ", count, " scheduled notifications")
+			}
+		}
+	}
+}
+
+func scheduledHandler(c *gin.Context) {
+	scheduled, err := listScheduled()
+	if err != nil {
+		LogError.Error("list scheduled notifications error: " + err.Error())
+		abortWithError(c, http.StatusInternalServerError, "Failed to list scheduled notifications.")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   "ok",
+		"scheduled": scheduled,
+	})
+}
+
+func cancelScheduledHandler(c *gin.Context) {
+	found, err := cancelScheduled(c.Param("id"))
+	if err != nil {
+		LogError.Error("cancel scheduled notification error: " + err.Error())
+		abortWithError(c, http.StatusInternalServerError, "Failed to cancel scheduled notification.")
+		return
+	}
+
+	if !found {
+		abortWithError(c, http.StatusNotFound, "Scheduled notification not found.")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+	})
+}
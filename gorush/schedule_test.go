@@ -0,0 +1,116 @@
+package gorush
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/appleboy/gorush/config"
+	"github.com/appleboy/gorush/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSendAt(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	now := time.Now().Unix()
+
+	assert.NoError(t, checkSendAt(PushNotification{}))
+	assert.NoError(t, checkSendAt(PushNotification{SendAt: now + 3600}))
+	assert.EqualError(t, checkSendAt(PushNotification{SendAt: now + 2592000 + 60}), "the send_at must not be more than 2592000 seconds in the future")
+
+	PushConf.Core.Schedule.MaxDelay = 0
+	assert.EqualError(t, checkSendAt(PushNotification{SendAt: now + 3600}), "the send_at is not allowed, scheduling is disabled")
+	PushConf, _ = config.LoadConf("")
+}
+
+func TestScheduleNotification(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+	PushConf.Android.Enabled = true
+	StatStorage = memory.New()
+	// no worker consumes the queue.
+	InitWorkers(0, 1)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	sendAt := time.Now().Unix() + 3600
+	var id string
+	r := gofight.New()
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{"tokens": []string{"aaaaa"}, "platform": PlatFormAndroid, "message": "Later", "send_at": sendAt},
+				{"tokens": []string{"bbbbb"}, "platform": PlatFormAndroid, "message": "Later", "send_at": sendAt + 60},
+				{"tokens": []string{"ccccc"}, "platform": PlatFormAndroid, "message": "Now"},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			var res struct {
+				Counts map[string]interface{} `json:"counts"`
+				Logs   []LogPushEntry         `json:"logs"`
+			}
+			assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &res))
+			assert.Equal(t, float64(1), res.Counts["queued"])
+			assert.Equal(t, float64(2), res.Counts["scheduled"])
+			assert.Equal(t, ScheduledPush, res.Logs[0].Type)
+			id = res.Logs[0].ScheduleID
+		})
+	assert.Equal(t, []string{"ccccc"}, (<-QueueNotification).Tokens)
+
+	r.GET("/api/scheduled").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			var res struct {
+				Scheduled []ScheduledNotification `json:"scheduled"`
+			}
+			assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &res))
+			assert.Equal(t, 2, len(res.Scheduled))
+			assert.Equal(t, id, res.Scheduled[0].ID)
+			assert.Equal(t, sendAt, res.Scheduled[0].SendAt)
+		})
+
+	// nothing is due yet.
+	assert.Equal(t, 0, enqueueScheduled(sendAt-1))
+	assert.Equal(t, 1, enqueueScheduled(sendAt))
+	notification := <-QueueNotification
+	assert.Equal(t, []string{"aaaaa"}, notification.Tokens)
+	assert.Equal(t, int64(0), notification.SendAt)
+
+	scheduled, _ := listScheduled()
+	assert.Equal(t, 1, len(scheduled))
+	r.DELETE("/api/scheduled/"+scheduled[0].ID).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+	r.DELETE("/api/scheduled/"+scheduled[0].ID).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusNotFound, r.Code)
+		})
+	assert.Equal(t, 0, enqueueScheduled(sendAt+60))
+	assert.Empty(t, StatStorage.GetData(ScheduledKey))
+}
+
+func TestScheduleFullQueue(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	StatStorage = memory.New()
+	InitWorkers(0, 1)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	sendAt := time.Now().Unix() + 60
+	_, _ = scheduleNotification(PushNotification{Tokens: []string{"aaaaa"}, Platform: PlatFormAndroid, SendAt: sendAt})
+	_, _ = scheduleNotification(PushNotification{Tokens: []string{"bbbbb"}, Platform: PlatFormAndroid, SendAt: sendAt})
+
+	// the notification dropped by full queue is kept for next time.
+	assert.Equal(t, 1, enqueueScheduled(sendAt))
+	<-QueueNotification
+	assert.Equal(t, 1, enqueueScheduled(sendAt))
+	assert.Equal(t, []string{"bbbbb"}, (<-QueueNotification).Tokens)
+	assert.Equal(t, 0, enqueueScheduled(sendAt))
+}
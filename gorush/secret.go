@@ -0,0 +1,165 @@
+package gorush
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/appleboy/gorush/config"
+)
+
+// SecretResolver resolve the secret reference, e.g. vault://secret/apns/key,
+// to the secret bytes.
+type SecretResolver interface {
+	Resolve(ref *url.URL) ([]byte, error)
+}
+
+// SecretResolverFunc is the function of SecretResolver.
+type SecretResolverFunc func(ref *url.URL) ([]byte, error)
+
+// Resolve call the function.
+func (f SecretResolverFunc) Resolve(ref *url.URL) ([]byte, error) {
+	return f(ref)
+}
+
+// secretResolvers is the resolver of reference scheme.
+var secretResolvers = map[string]SecretResolver{
+	"file":   SecretResolverFunc(resolveFileSecret),
+	"vault":  SecretResolverFunc(resolveVaultSecret),
+	"aws-sm": SecretResolverFunc(resolveAWSSecret),
+}
+
+// RegisterSecretResolver add the resolver of reference scheme.
+func RegisterSecretResolver(scheme string, resolver SecretResolver) {
+	secretResolvers[scheme] = resolver
+}
+
+// isSecretRef reports whether the value is secret reference instead of plain
+// file path.
+func isSecretRef(value string) bool {
+	return strings.Contains(value, "://")
+}
+
+// resolveSecret resolve the secret reference by resolver of its scheme.
+func resolveSecret(ref string) ([]byte, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, ok := secretResolvers[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported secret scheme %q", u.Scheme)
+	}
+
+	return resolver.Resolve(u)
+}
+
+// resolveFileSecret read the file of file:///path/to/key reference.
+func resolveFileSecret(ref *url.URL) ([]byte, error) {
+	return ioutil.ReadFile(ref.Host + ref.Path)
+}
+
+// secretField return the field of JSON secret if fragment of reference is
+// set, e.g. aws-sm://gorush/apns#key, or the secret as it is.
+func secretField(ref *url.URL, data []byte) ([]byte, error) {
+	if ref.Fragment == "" {
+		return data, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("secret isn't JSON object of %s field", ref.Fragment)
+	}
+
+	return fieldValue(fields, ref.Fragment)
+}
+
+// fieldValue return the string value of field, or the JSON of other value,
+// e.g. the service account object of FCM credential.
+func fieldValue(fields map[string]interface{}, name string) ([]byte, error) {
+	value, ok := fields[name]
+	if !ok {
+		return nil, fmt.Errorf("secret field %s not found", name)
+	}
+
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+
+	return json.Marshal(value)
+}
+
+// ResolveSecrets replace the secret references of iOS key and Android
+// credential with the resolved secrets, so they are loaded as key_base64 and
+// credential_json. Plain file paths are kept and read by the loaders.
+func ResolveSecrets(conf *config.ConfYaml) error {
+	if err := resolveIosKey(&conf.Ios.KeyPath, &conf.Ios.KeyBase64, &conf.Ios.KeyType); err != nil {
+		return fmt.Errorf("resolve ios.key_path error: %v", err)
+	}
+
+	for name, app := range conf.Ios.Apps {
+		if err := resolveIosKey(&app.KeyPath, &app.KeyBase64, &app.KeyType); err != nil {
+			return fmt.Errorf("resolve ios.apps.%s.key_path error: %v", name, err)
+		}
+		conf.Ios.Apps[name] = app
+	}
+
+	if err := resolveCredential(&conf.Android.Credential, &conf.Android.CredentialJSON); err != nil {
+		return fmt.Errorf("resolve android.credential error: %v", err)
+	}
+
+	for name, app := range conf.Android.Apps {
+		if err := resolveCredential(&app.Credential, &app.CredentialJSON); err != nil {
+			return fmt.Errorf("resolve android.apps.%s.credential error: %v", name, err)
+		}
+		conf.Android.Apps[name] = app
+	}
+
+	return nil
+}
+
+// resolveIosKey resolve the key reference to base64 key, the key type is
+// taken from extension of reference if it has one.
+func resolveIosKey(keyPath, keyBase64, keyType *string) error {
+	if !isSecretRef(*keyPath) {
+		return nil
+	}
+
+	key, err := resolveSecret(*keyPath)
+	if err != nil {
+		return err
+	}
+
+	u, _ := url.Parse(*keyPath)
+	switch ext := path.Ext(u.Path); ext {
+	case ".p8", ".p12", ".pem":
+		*keyType = ext[1:]
+	}
+
+	*keyBase64 = base64.StdEncoding.EncodeToString(key)
+	*keyPath = ""
+
+	return nil
+}
+
+// resolveCredential resolve the credential reference to inline JSON.
+func resolveCredential(credential, credentialJSON *string) error {
+	if !isSecretRef(*credential) {
+		return nil
+	}
+
+	data, err := resolveSecret(*credential)
+	if err != nil {
+		return err
+	}
+
+	*credentialJSON = string(data)
+	*credential = ""
+
+	return nil
+}
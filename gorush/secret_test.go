@@ -0,0 +1,188 @@
+package gorush
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAWSRequest(t *testing.T) {
+	// get-vanilla of AWS Signature Version 4 test suite.
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	creds := awsCredentials{
+		accessKeyID:     "AKIDEXAMPLE",
+		secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	signAWSRequest(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestResolveVaultSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/apns/key":
+			_, _ = w.Write([]byte(`{"data":{"data":{"p8":"apns key"},"metadata":{"version":1}}}`))
+		case "/v1/secret/data/fcm":
+			_, _ = w.Write([]byte(`{"data":{"data":{"project_id":"gorush","credential":{"type":"service_account"}}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	os.Setenv("VAULT_ADDR", server.URL)
+	os.Setenv("VAULT_TOKEN", "vault-token")
+	defer func() {
+		os.Unsetenv("VAULT_ADDR")
+		os.Unsetenv("VAULT_TOKEN")
+	}()
+
+	data, err := resolveSecret("vault://secret/apns/key")
+	assert.NoError(t, err)
+	assert.Equal(t, "apns key", string(data))
+	data, err = resolveSecret("vault://secret/apns/key#p8")
+	assert.NoError(t, err)
+	assert.Equal(t, "apns key", string(data))
+	data, err = resolveSecret("vault://secret/fcm#credential")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"service_account"}`, string(data))
+
+	_, err = resolveSecret("vault://secret/fcm")
+	assert.EqualError(t, err, "vault secret has 2 fields, set the field as vault://secret/fcm#<field>")
+	_, err = resolveSecret("vault://secret/apns/key#p12")
+	assert.EqualError(t, err, "secret field p12 not found")
+	_, err = resolveSecret("vault://secret/missing")
+	assert.EqualError(t, err, "vault returned 404 status code")
+	_, err = resolveSecret("vault://secret")
+	assert.Error(t, err)
+
+	os.Setenv("VAULT_TOKEN", "expired")
+	_, err = resolveSecret("vault://secret/apns/key")
+	assert.EqualError(t, err, "vault returned 403 status code")
+}
+
+func TestResolveAWSSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			SecretID string `json:"SecretId"`
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &input)
+
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access-key/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/us-west-2/secretsmanager/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message":"The security token included in the request is invalid."}`))
+			return
+		}
+
+		switch input.SecretID {
+		case "gorush/fcm":
+			_, _ = w.Write([]byte(`{"Name":"gorush/fcm","SecretString":"{\"project_id\":\"gorush\"}"}`))
+		case "gorush/apns":
+			_, _ = w.Write([]byte(`{"Name":"gorush/apns","SecretBinary":"` + base64.StdEncoding.EncodeToString([]byte("apns key")) + `"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+		}
+	}))
+	defer server.Close()
+
+	os.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", server.URL)
+	os.Setenv("AWS_REGION", "us-west-2")
+	os.Setenv("AWS_ACCESS_KEY_ID", "access-key")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret-key")
+	defer func() {
+		os.Unsetenv("AWS_ENDPOINT_URL_SECRETS_MANAGER")
+		os.Unsetenv("AWS_REGION")
+		os.Unsetenv("AWS_ACCESS_KEY_ID")
+		os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	}()
+
+	data, err := resolveSecret("aws-sm://gorush/fcm")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"project_id":"gorush"}`, string(data))
+	data, err = resolveSecret("aws-sm://gorush/fcm#project_id")
+	assert.NoError(t, err)
+	assert.Equal(t, "gorush", string(data))
+	data, err = resolveSecret("aws-sm://gorush/apns")
+	assert.NoError(t, err)
+	assert.Equal(t, "apns key", string(data))
+
+	_, err = resolveSecret("aws-sm://gorush/missing")
+	assert.EqualError(t, err, "aws secrets manager returned 400 status code: Secrets Manager can't find the specified secret.")
+
+	os.Setenv("AWS_REGION", "us-east-1")
+	_, err = resolveSecret("aws-sm://gorush/fcm")
+	assert.EqualError(t, err, "aws secrets manager returned 403 status code: The security token included in the request is invalid.")
+
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	_, err = resolveSecret("aws-sm://gorush/fcm")
+	assert.EqualError(t, err, "missing AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY environment variable")
+}
+
+func TestResolveSecrets(t *testing.T) {
+	key, _ := ioutil.ReadFile("../certificate/authkey-valid.p8")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data": map[string]interface{}{
+					"key":        string(key),
+					"credential": `{"project_id":"gorush"}`,
+				},
+			},
+		})
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	os.Setenv("VAULT_ADDR", server.URL)
+	defer os.Unsetenv("VAULT_ADDR")
+
+	conf, _ := config.LoadConf("")
+	conf.Ios.KeyPath = "vault://secret/apns/key.p8#key"
+	conf.Ios.Apps = map[string]config.SectionIosApp{
+		"plain": {KeyPath: "../certificate/certificate-valid.pem"},
+		"file":  {KeyPath: "file://../certificate/certificate-valid.p12"},
+	}
+	conf.Android.Credential = "vault://secret/fcm#credential"
+	assert.NoError(t, ResolveSecrets(&conf))
+
+	assert.Equal(t, "", conf.Ios.KeyPath)
+	assert.Equal(t, "p8", conf.Ios.KeyType)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(key), conf.Ios.KeyBase64)
+	// plain file path is read by the loader.
+	assert.Equal(t, "../certificate/certificate-valid.pem", conf.Ios.Apps["plain"].KeyPath)
+	p12, _ := ioutil.ReadFile("../certificate/certificate-valid.p12")
+	assert.Equal(t, base64.StdEncoding.EncodeToString(p12), conf.Ios.Apps["file"].KeyBase64)
+	assert.Equal(t, "p12", conf.Ios.Apps["file"].KeyType)
+	assert.Equal(t, "", conf.Android.Credential)
+	assert.Equal(t, `{"project_id":"gorush"}`, conf.Android.CredentialJSON)
+
+	conf.Ios.KeyPath = "gcp://secret/apns"
+	assert.EqualError(t, ResolveSecrets(&conf), `resolve ios.key_path error: unsupported secret scheme "gcp"`)
+	conf.Ios.KeyPath = ""
+	conf.Android.Apps = map[string]config.SectionAndroidApp{
+		"app": {Credential: "file:///not/found.json"},
+	}
+	assert.EqualError(t, ResolveSecrets(&conf), "resolve android.apps.app.credential error: open /not/found.json: no such file or directory")
+}
@@ -0,0 +1,76 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// secretTimeout is the timeout of request to secrets manager.
+const secretTimeout = 10 * time.Second
+
+// resolveVaultSecret read the secret of vault://<mount>/<path>#<field>
+// reference from KV version 2 secrets engine of Vault. The address and token
+// are read from VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE environment
+// variables as Vault CLI does. The field can be omitted if the secret has only
+// one field.
+func resolveVaultSecret(ref *url.URL) ([]byte, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, errors.New("missing VAULT_ADDR environment variable")
+	}
+
+	secretPath := strings.Trim(ref.Path, "/")
+	if ref.Host == "" || secretPath == "" {
+		return nil, fmt.Errorf("invalid vault reference %s, must be vault://<mount>/<path>", ref.String())
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimRight(addr, "/")+"/v1/"+ref.Host+"/data/"+secretPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	client := &http.Client{Timeout: secretTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned %d status code", resp.StatusCode)
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("invalid vault response: %v", err)
+	}
+
+	fields := secret.Data.Data
+	if ref.Fragment != "" {
+		return fieldValue(fields, ref.Fragment)
+	}
+
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("vault secret has %d fields, set the field as vault://%s/%s#<field>", len(fields), ref.Host, secretPath)
+	}
+
+	var name string
+	for name = range fields {
+	}
+
+	return fieldValue(fields, name)
+}
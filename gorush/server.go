@@ -3,21 +3,31 @@ package gorush
 import (
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/appleboy/gorush/config"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
 )
 
 func init() {
 	// Support metrics
 	m := NewMetrics()
-	prometheus.MustRegister(m)
+	prometheus.MustRegister(m, fcmRetryCounter, rateLimitCounter, authFailureCounter, feedbackRequestCounter, expiredCounter, pushDuration, tokensPerNotification, pushSentCounter, pushFailedCounter, enqueuedCounter, dequeuedCounter)
 }
 
 func abortWithError(c *gin.Context, code int, message string) {
@@ -28,12 +38,16 @@ func abortWithError(c *gin.Context, code int, message string) {
 }
 
 func rootHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"text": "Welcome to notification server.",
-	})
+	c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(PushConf.Core.RootResponse))
 }
 
 func heartbeatHandler(c *gin.Context) {
+	// remove the draining server from load balancer.
+	if isShuttingDown() {
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+
 	c.AbortWithStatus(http.StatusOK)
 }
 
@@ -44,58 +58,310 @@ func versionHandler(c *gin.Context) {
 	})
 }
 
-func pushHandler(c *gin.Context) {
+// abortIfShuttingDown reject push request with 503 if server is shutting down.
+func abortIfShuttingDown(c *gin.Context) bool {
+	if !isShuttingDown() {
+		return false
+	}
+
+	msg := "Server is shutting down."
+	withRequestID(LogAccess, c.GetString(RequestIDKey)).Debug(msg)
+	abortWithError(c, http.StatusServiceUnavailable, msg)
+
+	return true
+}
+
+// queueRetryAfter is the seconds of Retry-After header when worker queue is overloaded.
+const queueRetryAfter = 5
+
+// abortIfOverloaded reject request with 503 if worker queue depth reaches
+// core.queue_high_water_mark, so client can back off instead of waiting.
+func abortIfOverloaded(c *gin.Context) bool {
+	mark := PushConf.Core.QueueHighWaterMark
+	if mark <= 0 || queueUsage() < mark {
+		return false
+	}
+
+	msg := fmt.Sprintf("Queue depth(%d) reached high water mark(%d)", queueUsage(), mark)
+	withRequestID(LogAccess, c.GetString(RequestIDKey)).Debug(msg)
+	c.Header("Retry-After", strconv.Itoa(queueRetryAfter))
+	abortWithError(c, http.StatusServiceUnavailable, msg)
+
+	return true
+}
+
+// bindPushRequest bind and validate push request, abort with error if invalid.
+func bindPushRequest(c *gin.Context) (RequestPush, bool) {
+	if abortIfShuttingDown(c) || abortIfOverloaded(c) {
+		return RequestPush{}, false
+	}
+
+	form, ok := bindNotifications(c)
+	if !ok {
+		return form, false
+	}
+
+	log := withRequestID(LogAccess, c.GetString(RequestIDKey))
+	sender := getClientSender(c)
+	var errs []FieldError
+	var notifications []PushNotification
+	key := c.GetString(IdempotencyKeyKey)
+
+	var credential string
+	if form.Credentials != nil {
+		if !PushConf.Auth.AllowRequestCredentials {
+			msg := "Request credentials are not allowed."
+			log.Debug(msg)
+			abortWithError(c, http.StatusForbidden, msg)
+			return form, false
+		}
+
+		id, err := loadRequestCredentials(*form.Credentials)
+		if err != nil {
+			log.Debug(err)
+			abortWithFieldErrors(c, err.Error(), []FieldError{{Field: "credentials", Reason: err.Error()}})
+			return form, false
+		}
+		credential = id
+	}
+
+	for i := range form.Notifications {
+		form.Notifications[i].credential = credential
+		if key != "" && form.Notifications[i].ID == "" {
+			form.Notifications[i].ID = idempotentID(key, i)
+		}
+
+		parts, err := expandNotification(form.Notifications[i])
+		if err != nil {
+			index := i
+			errs = append(errs, FieldError{Field: fmt.Sprintf("notifications[%d].tokens", i), Index: &index, Reason: err.Error()})
+			continue
+		}
+
+		var partErrs []FieldError
+		for j := range parts {
+			parts[j].index = i
+			if err := sender.check(&parts[j]); err != nil {
+				log.Debug(err)
+				abortWithError(c, http.StatusForbidden, err.Error())
+				return form, false
+			}
+
+			partErrs = appendFieldErrors(partErrs, notificationErrors(i, parts[j])...)
+		}
+		errs = append(errs, partErrs...)
+		notifications = append(notifications, parts...)
+	}
+	form.Notifications = notifications
+
+	if len(errs) > 0 {
+		log.Debug(errs[0].Error())
+		// message is the first error as before, all errors are listed.
+		abortWithFieldErrors(c, errs[0].Reason, errs)
+		return form, false
+	}
+	form.requestID = c.GetString(RequestIDKey)
+	form.traceParent = requestTraceParent(c)
+
+	return form, true
+}
+
+// bindNotifications bind push request and check the number of notifications,
+// abort with error if invalid.
+func bindNotifications(c *gin.Context) (RequestPush, bool) {
 	var form RequestPush
 	var msg string
+	log := withRequestID(LogAccess, c.GetString(RequestIDKey))
 
 	if err := c.ShouldBindWith(&form, binding.JSON); err != nil {
+		if abortIfTimedOut(c) {
+			return form, false
+		}
+
+		if bodyTooLarge(c) {
+			log.Debug(err)
+			abortWithBodyTooLarge(c, PushConf.Core.MaxBodySize)
+			return form, false
+		}
+
+		errs := bindErrors(err)
 		msg = "Missing notifications field."
-		LogAccess.Debug(err)
-		abortWithError(c, http.StatusBadRequest, msg)
-		return
+		// e.g. loc-args of alert is not array of strings.
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			msg = fmt.Sprintf("Invalid %s field, %s.", errs[0].Field, errs[0].Reason)
+		}
+		log.Debug(err)
+		abortWithFieldErrors(c, msg, errs)
+		return form, false
 	}
 
 	if len(form.Notifications) == 0 {
 		msg = "Notifications field is empty."
-		LogAccess.Debug(msg)
-		abortWithError(c, http.StatusBadRequest, msg)
-		return
+		log.Debug(msg)
+		abortWithFieldErrors(c, msg, []FieldError{{Field: "notifications", Reason: "must not be empty"}})
+		return form, false
 	}
 
 	if int64(len(form.Notifications)) > PushConf.Core.MaxNotification {
 		msg = fmt.Sprintf("Number of notifications(%d) over limit(%d)", len(form.Notifications), PushConf.Core.MaxNotification)
-		LogAccess.Debug(msg)
-		abortWithError(c, http.StatusBadRequest, msg)
+		log.Debug(msg)
+		abortWithFieldErrors(c, msg, []FieldError{{Field: "notifications", Reason: msg}})
+		return form, false
+	}
+
+	return form, true
+}
+
+// abortWithFieldErrors abort request with 400 and invalid fields.
+func abortWithFieldErrors(c *gin.Context, message string, errs []FieldError) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+		"code":    http.StatusBadRequest,
+		"message": message,
+		"errors":  errs,
+	})
+}
+
+func pushHandler(c *gin.Context) {
+	if acceptNDJSON(c) {
+		streamPushHandler(c)
 		return
 	}
 
-	counts, logs := queueNotification(form)
+	var counts int
+	var logs []LogPushEntry
 
-	c.JSON(http.StatusOK, gin.H{
+	if c.ContentType() == NDJSONContentType {
+		if abortIfShuttingDown(c) || abortIfOverloaded(c) {
+			return
+		}
+
+		counts, logs = queueNDJSON(requestContext(c), c.Request.Body, getClientSender(c), c.GetString(RequestIDKey), requestTraceParent(c), nil)
+		// the same as JSON body, though the lines before the limit are queued.
+		if bodyTooLarge(c) {
+			abortWithBodyTooLarge(c, PushConf.Core.MaxBodySize)
+			return
+		}
+	} else {
+		form, ok := bindPushRequest(c)
+		if !ok {
+			return
+		}
+
+		form.ctx = requestContext(c)
+		counts, logs = queueNotification(form)
+	}
+
+	if abortIfTimedOut(c) {
+		return
+	}
+
+	var summary pushSummary
+	summary.add(logs)
+	result := summary.result(c, counts)
+	if responseLogs(c) {
+		result["logs"] = logs
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// pushSummary count the tokens of push logs by log type.
+type pushSummary struct {
+	duplicates int
+	dropped    int
+	overflow   int
+	scheduled  int
+}
+
+func (s *pushSummary) add(logs []LogPushEntry) {
+	s.duplicates += countDuplicates(logs)
+	s.dropped += countDropped(logs)
+	s.overflow += countLogType(logs, OverflowPush)
+	s.scheduled += countLogType(logs, ScheduledPush)
+}
+
+// result return the response of push request without logs.
+func (s *pushSummary) result(c *gin.Context, counts int) gin.H {
+	result := gin.H{
+		"success": "ok",
+		"counts": gin.H{
+			"total":     counts,
+			"queued":    counts - s.dropped - s.overflow - s.scheduled,
+			"dropped":   s.dropped,
+			"overflow":  s.overflow,
+			"scheduled": s.scheduled,
+		},
+		"duplicates":   s.duplicates,
+		"queue_policy": queueFullPolicy(),
+	}
+	if PushConf.Core.ResponseFormat.RequestID {
+		result["request_id"] = c.GetString(RequestIDKey)
+	}
+
+	return result
+}
+
+// responseLogs reports whether push logs are included in response, the logs
+// query overrides core.response_format.logs.
+func responseLogs(c *gin.Context) bool {
+	if enabled, err := strconv.ParseBool(c.Query("logs")); err == nil {
+		return enabled
+	}
+
+	return PushConf.Core.ResponseFormat.Logs
+}
+
+func pushAsyncHandler(c *gin.Context) {
+	form, ok := bindPushRequest(c)
+	if !ok {
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		withRequestID(LogError, c.GetString(RequestIDKey)).Error("generate job id error: " + err.Error())
+		abortWithError(c, http.StatusInternalServerError, "Failed to create job.")
+		return
+	}
+
+	createJob(id)
+	go runJob(id, form)
+
+	c.JSON(http.StatusAccepted, gin.H{
 		"success": "ok",
-		"counts":  counts,
-		"logs":    logs,
+		"job_id":  id,
 	})
 }
 
+func pushStatusHandler(c *gin.Context) {
+	job, ok := getJob(c.Param("job_id"))
+	if !ok {
+		abortWithError(c, http.StatusNotFound, "Job not found.")
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
 func configHandler(c *gin.Context) {
-	c.YAML(http.StatusCreated, PushConf)
+	c.YAML(http.StatusCreated, config.Redact(PushConf))
 }
 
 func metricsHandler(c *gin.Context) {
 	promhttp.Handler().ServeHTTP(c.Writer, c.Request)
 }
 
-func autoTLSServer() *http.Server {
+func autoTLSServer(config *tls.Config) *http.Server {
 	m := autocert.Manager{
 		Prompt:     autocert.AcceptTOS,
 		HostPolicy: autocert.HostWhitelist(PushConf.Core.AutoTLS.Host),
 		Cache:      autocert.DirCache(PushConf.Core.AutoTLS.Folder),
 	}
+	config.GetCertificate = m.GetCertificate
 
 	return &http.Server{
 		Addr:      ":https",
-		TLSConfig: &tls.Config{GetCertificate: m.GetCertificate},
+		TLSConfig: config,
 		Handler:   routerEngine(),
 	}
 }
@@ -105,41 +371,140 @@ func routerEngine() *gin.Engine {
 	gin.SetMode(PushConf.Core.Mode)
 
 	r := gin.New()
+	// X-Forwarded-For is only trusted from core.trusted_proxies.
+	r.ForwardedByClientIP = false
+	if PushConf.Core.TrustedProxies != "" {
+		r.Use(TrustedProxyMiddleware())
+	}
 
-	r.Use(gin.Logger())
+	r.Use(RequestIDMiddleware())
+	if PushConf.Core.Tracing.Enabled {
+		r.Use(TracingMiddleware())
+	}
+	if PushConf.Core.RequestTimeout > 0 {
+		r.Use(RequestTimeoutMiddleware(time.Duration(PushConf.Core.RequestTimeout) * time.Second))
+	}
+	if PushConf.Log.Format == "json" {
+		r.Use(AccessLogMiddleware())
+	} else {
+		r.Use(gin.Logger())
+	}
 	r.Use(gin.Recovery())
 
-	r.Use(VersionMiddleware())
+	if !PushConf.API.HideVersion {
+		r.Use(VersionMiddleware())
+	}
 	r.Use(LogMiddleware())
 	r.Use(StatMiddleware())
 
+	if PushConf.Core.HTTPCompression {
+		r.Use(CompressionMiddleware())
+	}
+
 	var api *gin.RouterGroup
 	var metrics *gin.RouterGroup
 
-	// enable basic auth
-	if PushConf.Auth.Enabled {
-		basicAuth := gin.BasicAuth(gin.Accounts{
-			PushConf.Auth.Username: PushConf.Auth.Password,
-		})
-		api = r.Group("/api", basicAuth)
-		metrics = r.Group(PushConf.API.MetricURI, basicAuth)
-	} else {
-		api = r.Group("/api")
-		metrics = r.Group(PushConf.API.MetricURI)
-	}
-	api.GET(PushConf.API.StatGoURI, appStatusHandler)
-	api.GET(PushConf.API.StatAppURI, appStatusHandler)
-	api.GET(PushConf.API.ConfigURI, configHandler)
-	api.GET(PushConf.API.SysStatURI, sysStatsHandler)
-	api.POST(PushConf.API.PushURI, pushHandler)
-	metrics.GET("", metricsHandler)
-	api.GET("/version", versionHandler)
-	api.GET("/", rootHandler)
-	r.GET(PushConf.API.HealthURI, heartbeatHandler)
+	// the IP filter runs before auth, enable basic auth or jwt auth
+	apiHandlers := ipFilters(PushConf.Core.AllowedIPs)
+	metricHandlers := ipFilters(PushConf.Core.MetricAllowedIPs)
+	if PushConf.Auth.Enabled || PushConf.Auth.JWT.Enabled {
+		auth := AuthMiddleware()
+		apiHandlers = append(apiHandlers, auth)
+		if !PushConf.API.MetricsAuth.Enabled {
+			metricHandlers = append(metricHandlers, auth)
+		}
+	}
+	// metrics scraper has its own credentials of api.metrics_auth.
+	if PushConf.API.MetricsAuth.Enabled {
+		metricHandlers = append(metricHandlers, MetricsAuthMiddleware())
+	}
+	api = r.Group("/api", apiHandlers...)
+	metrics = r.Group(PushConf.API.MetricURI, metricHandlers...)
+
+	if PushConf.Core.ClientCA != "" && len(PushConf.Core.ClientSenders) > 0 {
+		api.Use(ClientCertMiddleware())
+	}
+
+	if PushConf.Core.MaxBodySize > 0 {
+		api.Use(BodyLimitMiddleware(PushConf.Core.MaxBodySize))
+	}
+
+	// rate limit is keyed by basic auth username, so it runs after auth.
+	if PushConf.Core.RateLimit > 0 {
+		api.Use(RateLimitMiddleware(NewRateLimiter(PushConf.Core.RateLimit, PushConf.Core.RateLimitBurst)))
+	}
+
+	if PushConf.Core.Idempotency.Enabled {
+		api.Use(IdempotencyMiddleware())
+	}
+
+	// routes of api.disabled_routes are not registered, so they are 404.
+	disabled := disabledRoutes()
+	if !disabled[RouteStat] {
+		api.GET(PushConf.API.StatGoURI, appStatusHandler)
+		api.GET(PushConf.API.StatAppURI, appStatusHandler)
+		api.GET(PushConf.API.StatAppURI+"/:app_id", appStatHandler)
+	}
+	if !disabled[RouteConfig] {
+		api.GET(PushConf.API.ConfigURI, configHandler)
+	}
+	if !disabled[RouteSys] {
+		api.GET(PushConf.API.SysStatURI, sysStatsHandler)
+	}
+	if !disabled[RoutePush] {
+		api.POST(PushConf.API.PushURI, pushHandler)
+		api.POST(PushConf.API.PushURI+"/async", pushAsyncHandler)
+		api.POST(PushConf.API.PushURI+"/validate", validatePushHandler)
+		api.GET(PushConf.API.PushURI+"/status/:job_id", pushStatusHandler)
+	}
+	if !disabled[RouteMetrics] {
+		metrics.GET("", metricsHandler)
+	}
+	if !disabled[RouteInvalidTokens] {
+		api.GET("/invalid-tokens", invalidTokensHandler)
+		api.DELETE("/invalid-tokens", clearInvalidTokensHandler)
+	}
+	if !disabled[RouteDeadLetter] {
+		api.POST("/dead-letter/replay", replayDeadLetterHandler)
+	}
+	if !disabled[RouteScheduled] {
+		api.GET("/scheduled", scheduledHandler)
+		api.DELETE("/scheduled/:id", cancelScheduledHandler)
+	}
+	if !disabled[RouteReload] {
+		api.POST("/reload", reloadHandler)
+	}
+	if !disabled[RouteAdmin] {
+		api.GET("/admin/status", adminStatusHandler)
+		api.POST("/admin/drain", drainHandler)
+	}
+	// version and root routes can be hidden from scanners fingerprinting server.
+	if !PushConf.API.HideVersion {
+		api.GET("/version", versionHandler)
+	}
+	if PushConf.Core.RootResponse != "" {
+		api.GET("/", rootHandler)
+	}
+	health := ipFilters(PushConf.Core.HealthAllowedIPs)
+	if !disabled[RouteHealth] {
+		r.GET(PushConf.API.HealthURI, append(health, heartbeatHandler)...)
+	}
+	if !disabled[RouteReady] {
+		r.GET(PushConf.API.ReadyURI, append(health, readyHandler)...)
+	}
 
 	return r
 }
 
+// serverHandler serve HTTP/2 without TLS as well if h2c is enabled.
+func serverHandler() http.Handler {
+	if PushConf.Core.H2C {
+		return h2c.NewHandler(routerEngine(), &http2.Server{})
+	}
+
+	return routerEngine()
+}
+
 // RunHTTPServer provide run http or https protocol.
 func RunHTTPServer() (err error) {
 	if !PushConf.Core.Enabled {
@@ -147,19 +512,39 @@ func RunHTTPServer() (err error) {
 		return nil
 	}
 
+	if PushConf.Core.H2C && (PushConf.Core.SSL || PushConf.Core.AutoTLS.Enabled) {
+		return errors.New("h2c can not be enabled with ssl or auto_tls")
+	}
+
+	if PushConf.Core.RootResponse != "" && !json.Valid([]byte(PushConf.Core.RootResponse)) {
+		return errors.New("core.root_response must be JSON")
+	}
+
+	if err = checkIPFilter(); err != nil {
+		return err
+	}
+
+	if err = checkDisabledRoutes(); err != nil {
+		return err
+	}
+
 	server := &http.Server{
 		Addr:    PushConf.Core.Address + ":" + PushConf.Core.Port,
-		Handler: routerEngine(),
+		Handler: serverHandler(),
 	}
 
 	LogAccess.Debug("HTTPD server is running on " + PushConf.Core.Port + " port.")
-	if PushConf.Core.AutoTLS.Enabled {
-		return startServer(autoTLSServer())
-	} else if PushConf.Core.SSL {
-		config := &tls.Config{
-			MinVersion: tls.VersionTLS10,
+	config := &tls.Config{}
+	if PushConf.Core.SSL || PushConf.Core.AutoTLS.Enabled {
+		if err = setTLSConfig(config); err != nil {
+			LogError.Error("tls config error: ", err)
+			return err
 		}
+	}
 
+	if PushConf.Core.AutoTLS.Enabled {
+		server = autoTLSServer(config)
+	} else if PushConf.Core.SSL {
 		if config.NextProtos == nil {
 			config.NextProtos = []string{"http/1.1"}
 		}
@@ -193,12 +578,75 @@ func RunHTTPServer() (err error) {
 		server.TLSConfig = config
 	}
 
+	if PushConf.Core.ClientCA != "" {
+		if server.TLSConfig == nil {
+			return errors.New("client_ca requires ssl or auto_tls enabled")
+		}
+
+		if err = setClientCA(server.TLSConfig); err != nil {
+			LogError.Error("Failed to load client CA file: ", err)
+			return err
+		}
+	}
+
 	return startServer(server)
 }
 
-func startServer(s *http.Server) error {
+// httpConnections is the number of open connections of http servers.
+var httpConnections int64
+
+// countConnState count the open connections by state of connection.
+func countConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&httpConnections, 1)
+	case http.StateHijacked, http.StateClosed:
+		atomic.AddInt64(&httpConnections, -1)
+	}
+}
+
+// listen the address of server, only core.max_connections connections are
+// accepted at the same time, the others wait in listen backlog.
+func listen(s *http.Server) (net.Listener, error) {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":http"
+		if s.TLSConfig != nil {
+			addr = ":https"
+		}
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if PushConf.Core.MaxConnections > 0 {
+		ln = netutil.LimitListener(ln, PushConf.Core.MaxConnections)
+	}
+
+	return ln, nil
+}
+
+func startServer(s *http.Server) (err error) {
+	addHTTPServer(s)
+	s.ConnState = countConnState
+
+	ln, err := listen(s)
+	if err != nil {
+		return err
+	}
+
 	if s.TLSConfig == nil {
-		return s.ListenAndServe()
+		err = s.Serve(ln)
+	} else {
+		err = s.ServeTLS(ln, "", "")
 	}
-	return s.ListenAndServeTLS("", "")
+
+	// server is stopped by graceful shutdown.
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
 }
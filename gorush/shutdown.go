@@ -0,0 +1,243 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueueStorageKey is key name of notifications saved to storage on shutdown.
+const QueueStorageKey = "gorush-queue-notifications"
+
+// DrainStatus is the progress of draining worker queues during shutdown.
+type DrainStatus struct {
+	StartedAt int64 `json:"started_at"`
+	Timeout   int64 `json:"timeout"`
+	Queued    int   `json:"queued"`
+	InFlight  int64 `json:"in_flight"`
+	Persisted int   `json:"persisted"`
+	Done      bool  `json:"done"`
+}
+
+var (
+	shutdownLock sync.RWMutex
+	drainStatus  *DrainStatus
+	httpServers  []*http.Server
+	// drainRequest receives the drain request of admin API.
+	drainRequest = make(chan struct{}, 1)
+)
+
+// DrainRequested return the channel which receives the drain request of
+// admin API, the server should call Shutdown then.
+func DrainRequested() <-chan struct{} {
+	return drainRequest
+}
+
+// addHTTPServer register the running http server which is stopped on shutdown.
+func addHTTPServer(s *http.Server) {
+	shutdownLock.Lock()
+	httpServers = append(httpServers, s)
+	shutdownLock.Unlock()
+}
+
+// isShuttingDown reports whether server stopped accepting push request.
+func isShuttingDown() bool {
+	shutdownLock.RLock()
+	defer shutdownLock.RUnlock()
+
+	return drainStatus != nil
+}
+
+// getDrainStatus return the drain progress, nil if server is not shutting down.
+func getDrainStatus() *DrainStatus {
+	shutdownLock.RLock()
+	defer shutdownLock.RUnlock()
+
+	if drainStatus == nil {
+		return nil
+	}
+
+	status := *drainStatus
+	if !status.Done {
+		status.Queued = queueUsage()
+		status.InFlight = atomic.LoadInt64(&inFlight)
+	}
+
+	return &status
+}
+
+// startDrain switch server to draining, return false if it is already
+// shutting down.
+func startDrain() bool {
+	shutdownLock.Lock()
+	defer shutdownLock.Unlock()
+
+	if drainStatus != nil {
+		return false
+	}
+
+	drainStatus = &DrainStatus{
+		StartedAt: time.Now().Unix(),
+		Timeout:   PushConf.Core.ShutdownTimeout,
+	}
+
+	return true
+}
+
+// Shutdown stop accepting push request and wait for workers draining the
+// queues until shutdown_timeout elapses, notifications still in queue are
+// saved to storage and restored on next start. The http server is stopped
+// at last, so the drain progress is available from sys stats API.
+func Shutdown() error {
+	timeout := time.Duration(PushConf.Core.ShutdownTimeout) * time.Second
+
+	// the drain is already started by admin API.
+	startDrain()
+
+	LogAccess.Info("Shutdown server, draining worker queues ...")
+
+	drained := waitDrain(timeout)
+	StopWorkers()
+	flushInvalidTokens()
+	flushDeadLetters()
+	flushTracing()
+
+	persisted := 0
+	if !drained {
+		persisted = persistQueue()
+		LogError.Errorf("shutdown timeout, %d notifications are saved to storage", persisted)
+	}
+
+	shutdownLock.Lock()
+	drainStatus.Queued = queueUsage()
+	drainStatus.InFlight = atomic.LoadInt64(&inFlight)
+	drainStatus.Persisted = persisted
+	drainStatus.Done = true
+	servers := httpServers
+	shutdownLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, s := range servers {
+		if err := s.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	if StatStorage != nil {
+		if err := StatStorage.Close(); err != nil {
+			LogError.Error("storage close error: " + err.Error())
+		}
+	}
+
+	LogAccess.Info("Server exited")
+
+	return nil
+}
+
+// waitDrain wait until all queues are empty and no notification is in flight,
+// return false if timeout elapses.
+func waitDrain(timeout time.Duration) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+
+	for {
+		if queueUsage() == 0 && atomic.LoadInt64(&inFlight) == 0 {
+			return true
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// persistQueue save notifications left in worker queues to storage.
+func persistQueue() int {
+	var pending []PushNotification
+
+	for _, queue := range []chan PushNotification{QueueNotification, QueueIosNotification, QueueAndroidNotification} {
+		if queue == nil {
+			continue
+		}
+
+	Loop:
+		for {
+			select {
+			case notification := <-queue:
+				countQueued(notification.Platform, -1)
+				if notification.credential != "" {
+					for _, token := range notification.recipients() {
+						LogPush(FailedPush, token, notification, errCredentialNotSaved)
+						notification.AddLog(getLogPushEntry(FailedPush, token, notification, errCredentialNotSaved))
+					}
+					notification.WaitDone()
+					continue
+				}
+				// release the sync mode request.
+				notification.WaitDone()
+				pending = append(pending, notification)
+			default:
+				break Loop
+			}
+		}
+	}
+
+	if len(pending) == 0 {
+		return 0
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		LogError.Error("save queue error: " + err.Error())
+		return 0
+	}
+
+	StatStorage.SetData(QueueStorageKey, data)
+
+	return len(pending)
+}
+
+// RestoreQueue enqueue notifications saved to storage by last shutdown.
+func RestoreQueue() int {
+	data := StatStorage.GetData(QueueStorageKey)
+	if len(data) == 0 {
+		return 0
+	}
+
+	var pending []PushNotification
+	if err := json.Unmarshal(data, &pending); err != nil {
+		LogError.Error("restore queue error: " + err.Error())
+		StatStorage.Del(QueueStorageKey)
+		return 0
+	}
+
+	var count int
+	var left []PushNotification
+	for _, notification := range pending {
+		if !tryEnqueue(notification, queueForPlatform(notification.Platform)) {
+			left = append(left, notification)
+			continue
+		}
+		count++
+	}
+
+	if len(left) > 0 {
+		// keep the notifications which can't be enqueued for next start.
+		data, _ = json.Marshal(left)
+		StatStorage.SetData(QueueStorageKey, data)
+	} else {
+		StatStorage.Del(QueueStorageKey)
+	}
+
+	LogAccess.Debug("restore ", count, " notifications from storage")
+
+	return count
+}
@@ -0,0 +1,194 @@
+package gorush
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/appleboy/gorush/storage/memory"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/buger/jsonparser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistAndRestoreQueue(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	// no worker consumes the queue.
+	InitWorkers(0, 2)
+
+	assert.Equal(t, 0, persistQueue())
+
+	QueueNotification <- PushNotification{Tokens: []string{"aaaaa"}, Platform: PlatFormIos, Message: "Welcome"}
+	QueueNotification <- PushNotification{Tokens: []string{"bbbbb"}, Platform: PlatFormAndroid, Message: "Welcome"}
+
+	assert.Equal(t, 2, persistQueue())
+	assert.Equal(t, 0, len(QueueNotification))
+	assert.NotEmpty(t, StatStorage.GetData(QueueStorageKey))
+
+	// only one notification can be restored, the other is kept in storage.
+	InitWorkers(0, 1)
+	assert.Equal(t, 1, RestoreQueue())
+	notification := <-QueueNotification
+	assert.Equal(t, "aaaaa", notification.Tokens[0])
+	assert.Equal(t, 1, RestoreQueue())
+	notification = <-QueueNotification
+	assert.Equal(t, "bbbbb", notification.Tokens[0])
+	assert.Equal(t, 0, RestoreQueue())
+	assert.Empty(t, StatStorage.GetData(QueueStorageKey))
+
+	// restore default workers
+	PushConf, _ = config.LoadConf("")
+	InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+}
+
+func TestPersistQueueRequestCredential(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.Sync = true
+	StatStorage = memory.New()
+	// no worker consumes the queue.
+	InitWorkers(0, 2)
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	var wg sync.WaitGroup
+	var log []LogPushEntry
+	notification := PushNotification{Tokens: []string{"aaaaa"}, Platform: PlatFormAndroid, Message: "Welcome", credential: "tenant", wg: &wg, log: &log}
+	notification.AddWaitCount()
+	QueueNotification <- notification
+	QueueNotification <- PushNotification{Tokens: []string{"bbbbb"}, Platform: PlatFormAndroid, Message: "Welcome"}
+
+	// the notification with request credentials is failed instead of saved.
+	assert.Equal(t, 1, persistQueue())
+	wg.Wait()
+	assert.Equal(t, 1, len(log))
+	assert.Equal(t, FailedPush, log[0].Type)
+	assert.Equal(t, errCredentialNotSaved.Error(), log[0].Error)
+
+	assert.Equal(t, 1, RestoreQueue())
+	assert.Equal(t, "bbbbb", (<-QueueNotification).Tokens[0])
+}
+
+func TestShutdown(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Core.ShutdownTimeout = 1
+	// no worker consumes the queue.
+	InitWorkers(0, 2)
+	httpServers = nil
+	defer func() {
+		drainStatus = nil
+		// restore default workers
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+		StatStorage.Del(QueueStorageKey)
+	}()
+
+	QueueNotification <- PushNotification{Tokens: []string{"aaaaa"}, Platform: PlatFormIos, Message: "Welcome"}
+
+	assert.Nil(t, getDrainStatus())
+	assert.NoError(t, Shutdown())
+	assert.True(t, isShuttingDown())
+
+	status := getDrainStatus()
+	assert.True(t, status.Done)
+	assert.Equal(t, 1, status.Persisted)
+	assert.Equal(t, 0, status.Queued)
+	assert.NotEmpty(t, StatStorage.GetData(QueueStorageKey))
+}
+
+func TestShutdownDrained(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	InitWorkers(0, 2)
+	httpServers = nil
+	defer func() {
+		drainStatus = nil
+		// restore default workers
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	assert.NoError(t, Shutdown())
+	assert.Equal(t, 0, getDrainStatus().Persisted)
+	assert.Empty(t, StatStorage.GetData(QueueStorageKey))
+}
+
+func TestRejectPushDuringShutdown(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+	drainStatus = &DrainStatus{Timeout: PushConf.Core.ShutdownTimeout}
+	defer func() {
+		drainStatus = nil
+	}()
+
+	r := gofight.New()
+
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"aaaaa"},
+					"platform": PlatFormAndroid,
+					"message":  "Welcome",
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusServiceUnavailable, r.Code)
+		})
+
+	r.GET("/api"+PushConf.API.SysStatURI).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			timeout, _ := jsonparser.GetInt(r.Body.Bytes(), "drain", "timeout")
+			_, err := jsonparser.GetInt(r.Body.Bytes(), "pid")
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, int64(30), timeout)
+		})
+}
+
+func TestDrainHandler(t *testing.T) {
+	initTest()
+	defer func() {
+		drainStatus = nil
+		select {
+		case <-drainRequest:
+		default:
+		}
+	}()
+
+	r := gofight.New()
+	var startedAt int64
+	r.POST("/api/admin/drain").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			done, _ := jsonparser.GetBoolean(r.Body.Bytes(), "drain", "done")
+			startedAt, _ = jsonparser.GetInt(r.Body.Bytes(), "drain", "started_at")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.False(t, done)
+			assert.NotZero(t, startedAt)
+		})
+	assert.Equal(t, 1, len(DrainRequested()))
+
+	r.GET(PushConf.API.HealthURI).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusServiceUnavailable, r.Code)
+		})
+	r.GET(PushConf.API.ReadyURI).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusServiceUnavailable, r.Code)
+		})
+
+	// the drain in progress is returned again.
+	r.POST("/api/admin/drain").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			again, _ := jsonparser.GetInt(r.Body.Bytes(), "drain", "started_at")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, startedAt, again)
+		})
+	assert.Equal(t, 1, len(DrainRequested()))
+}
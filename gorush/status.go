@@ -25,6 +25,9 @@ type StatusApp struct {
 	TotalCount int64         `json:"total_count"`
 	Ios        IosStatus     `json:"ios"`
 	Android    AndroidStatus `json:"android"`
+	Web        WebStatus     `json:"web"`
+	Huawei     HuaweiStatus  `json:"huawei"`
+	SNS        SNSStatus     `json:"sns"`
 }
 
 // AndroidStatus is android structure
@@ -33,6 +36,24 @@ type AndroidStatus struct {
 	PushError   int64 `json:"push_error"`
 }
 
+// WebStatus is web structure
+type WebStatus struct {
+	PushSuccess int64 `json:"push_success"`
+	PushError   int64 `json:"push_error"`
+}
+
+// HuaweiStatus is huawei structure
+type HuaweiStatus struct {
+	PushSuccess int64 `json:"push_success"`
+	PushError   int64 `json:"push_error"`
+}
+
+// SNSStatus is sns structure
+type SNSStatus struct {
+	PushSuccess int64 `json:"push_success"`
+	PushError   int64 `json:"push_error"`
+}
+
 // IosStatus is iOS structure
 type IosStatus struct {
 	PushSuccess int64 `json:"push_success"`
@@ -61,6 +82,14 @@ func InitAppStatus() error {
 	}
 
 	if err := StatStorage.Init(); err != nil {
+		if PushConf.Stat.Engine == "redis" {
+			// keep serving with counters of this instance only.
+			LogAccess.Warn("storage error: " + err.Error() + ", fallback to memory engine")
+			StatStorage = memory.New()
+
+			return StatStorage.Init()
+		}
+
 		LogError.Error("storage error: " + err.Error())
 
 		return err
@@ -73,26 +102,49 @@ func appStatusHandler(c *gin.Context) {
 	result := StatusApp{}
 
 	result.Version = GetVersion()
-	result.QueueMax = cap(QueueNotification)
-	result.QueueUsage = len(QueueNotification)
+	result.QueueMax = queueCapacity()
+	result.QueueUsage = queueUsage()
 	result.TotalCount = StatStorage.GetTotalCount()
 	result.Ios.PushSuccess = StatStorage.GetIosSuccess()
 	result.Ios.PushError = StatStorage.GetIosError()
 	result.Android.PushSuccess = StatStorage.GetAndroidSuccess()
 	result.Android.PushError = StatStorage.GetAndroidError()
+	result.Web.PushSuccess = StatStorage.GetWebSuccess()
+	result.Web.PushError = StatStorage.GetWebError()
+	result.Huawei.PushSuccess = StatStorage.GetHuaweiSuccess()
+	result.Huawei.PushError = StatStorage.GetHuaweiError()
+	result.SNS.PushSuccess = StatStorage.GetSNSSuccess()
+	result.SNS.PushError = StatStorage.GetSNSError()
 
 	c.JSON(http.StatusOK, result)
 }
 
+// SysStats is sys stats structure, contains drain progress during shutdown.
+type SysStats struct {
+	*stats.Data
+	Drain *DrainStatus `json:"drain,omitempty"`
+}
+
 func sysStatsHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, Stats.Data())
+	c.JSON(http.StatusOK, SysStats{
+		Data:  Stats.Data(),
+		Drain: getDrainStatus(),
+	})
 }
 
 // StatMiddleware response time, status code count, etc.
 func StatMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		beginning, recorder := Stats.Begin(c.Writer)
+		// keep the writer of connection, response size is the bytes sent
+		// to client after compression.
+		writer := c.Writer
+		beginning, _ := Stats.Begin(writer)
 		c.Next()
-		Stats.End(beginning, stats.WithRecorder(recorder))
+
+		size := writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		Stats.End(beginning, stats.WithStatusCode(writer.Status()), stats.WithSize(size))
 	}
 }
@@ -0,0 +1,148 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notificationResult is the push logs of one notification, it is written as
+// one line of streaming response when the notification is done.
+type notificationResult struct {
+	Index    *int           `json:"index,omitempty"`
+	Line     int            `json:"line,omitempty"`
+	ID       string         `json:"notif_id,omitempty"`
+	Platform int            `json:"platform"`
+	Counts   int            `json:"counts"`
+	Logs     []LogPushEntry `json:"logs,omitempty"`
+}
+
+// newNotificationResult return the result of notification, it is identified
+// by line number of NDJSON request or index of notifications.
+func newNotificationResult(notification *PushNotification, line, counts int, log []LogPushEntry) notificationResult {
+	result := notificationResult{
+		Line:     line,
+		ID:       notification.ID,
+		Platform: notification.Platform,
+		Counts:   counts,
+		Logs:     log,
+	}
+	if line == 0 {
+		index := notification.index
+		result.Index = &index
+	}
+
+	return result
+}
+
+// acceptNDJSON reports whether client accepts the streaming response.
+func acceptNDJSON(c *gin.Context) bool {
+	for _, accept := range strings.Split(c.GetHeader("Accept"), ",") {
+		if t, _, err := mime.ParseMediaType(accept); err == nil && t == NDJSONContentType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// enqueueResult add notification to worker queue, its logs are sent to
+// results when it is done, or at once if it isn't sync mode. The pending
+// result is added to wg. Return the count of recipients.
+func enqueueResult(notification *PushNotification, line int, wg *sync.WaitGroup, results chan<- notificationResult) int {
+	var log []LogPushEntry
+	done := &sync.WaitGroup{}
+	count := enqueueNotification(notification, done, &log)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if PushConf.Core.Sync && !waitNotifications(notification.ctx, done) {
+			// the log is still written by workers of timed out request.
+			return
+		}
+
+		results <- newNotificationResult(notification, line, count, log)
+	}()
+
+	return count
+}
+
+// dryRunResults send the dry run logs of each notification to results.
+func dryRunResults(notifications []*PushNotification, results chan<- notificationResult) int {
+	var count int
+	for _, notification := range notifications {
+		c, log := dryRunNotification([]*PushNotification{notification})
+		count += c
+		results <- newNotificationResult(notification, 0, c, log)
+	}
+
+	return count
+}
+
+// streamPushHandler write the result of each notification as one line of
+// NDJSON response as soon as it is done, the last line is the result of push
+// request with logs not belonging to any notification, e.g. duplicates.
+func streamPushHandler(c *gin.Context) {
+	var counts int
+	var logs []LogPushEntry
+	results := make(chan notificationResult)
+
+	if c.ContentType() == NDJSONContentType {
+		if abortIfShuttingDown(c) || abortIfOverloaded(c) {
+			return
+		}
+
+		ctx, body, sender := requestContext(c), c.Request.Body, getClientSender(c)
+		requestID, traceParent := c.GetString(RequestIDKey), requestTraceParent(c)
+		go func() {
+			counts, logs = queueNDJSON(ctx, body, sender, requestID, traceParent, results)
+			close(results)
+		}()
+	} else {
+		form, ok := bindPushRequest(c)
+		if !ok {
+			return
+		}
+
+		form.ctx = requestContext(c)
+		form.results = results
+		go func() {
+			counts, logs = queueNotification(form)
+			close(results)
+		}()
+	}
+
+	withLogs := responseLogs(c)
+	c.Header("Content-Type", NDJSONContentType)
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+
+	var summary pushSummary
+	for result := range results {
+		summary.add(result.Logs)
+		if !withLogs {
+			result.Logs = nil
+		}
+
+		// keep reading the results if client is gone, so workers aren't blocked.
+		_ = encoder.Encode(result)
+		c.Writer.Flush()
+	}
+
+	summary.add(logs)
+	result := summary.result(c, counts)
+	if withLogs && len(logs) > 0 {
+		result["logs"] = logs
+	}
+	if c.Request.Context().Err() == context.DeadlineExceeded {
+		result["error"] = "Request timeout exceeded."
+	}
+	_ = encoder.Encode(result)
+	c.Writer.Flush()
+}
@@ -0,0 +1,127 @@
+package gorush
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// streamLines decode each line of streaming response.
+func streamLines(t *testing.T, body string) []map[string]interface{} {
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func TestAcceptNDJSON(t *testing.T) {
+	c, _ := gin.CreateTestContext(nil)
+	c.Request, _ = http.NewRequest("POST", "/api/push", nil)
+	assert.False(t, acceptNDJSON(c))
+
+	c.Request.Header.Set("Accept", "application/json, */*")
+	assert.False(t, acceptNDJSON(c))
+
+	c.Request.Header.Set("Accept", "application/json, application/x-ndjson; q=0.9")
+	assert.True(t, acceptNDJSON(c))
+}
+
+func TestStreamPushHandler(t *testing.T) {
+	cleanup := testSNSServer(t, func(arn string, message map[string]string) (int, string) {
+		if arn == snsAndroidEndpoint {
+			return http.StatusBadRequest, snsErrorResponse("EndpointDisabled", "Endpoint is disabled")
+		}
+		return http.StatusOK, snsPublished("message-id")
+	})
+	defer cleanup()
+	PushConf.Core.Sync = true
+	PushConf.Core.ResponseFormat.Logs = true
+	PushConf.API.PushURI = "/push"
+	InitWorkers(2, 10)
+	defer InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+
+	r := gofight.New()
+	r.POST("/api/push").
+		SetHeader(gofight.H{"Accept": NDJSONContentType}).
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{"tokens": []string{snsIOSEndpoint}, "platform": PlatFormSNS, "message": "Welcome"},
+				{"tokens": []string{snsAndroidEndpoint}, "platform": PlatFormSNS, "message": "Welcome"},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, NDJSONContentType, r.HeaderMap.Get("Content-Type"))
+
+			lines := streamLines(t, r.Body.String())
+			assert.Equal(t, 3, len(lines))
+
+			// the results are written in the order they are done.
+			for _, line := range lines[:2] {
+				assert.Equal(t, float64(1), line["counts"])
+				if line["index"] == float64(1) {
+					logs := line["logs"].([]interface{})
+					assert.Equal(t, 1, len(logs))
+					assert.Equal(t, "EndpointDisabled error: Endpoint is disabled", logs[0].(map[string]interface{})["error"])
+				} else {
+					assert.Equal(t, float64(0), line["index"])
+					assert.Nil(t, line["logs"])
+				}
+			}
+
+			assert.Equal(t, "ok", lines[2]["success"])
+			assert.Equal(t, float64(2), lines[2]["counts"].(map[string]interface{})["total"])
+			assert.Nil(t, lines[2]["logs"])
+		})
+}
+
+func TestStreamPushNDJSON(t *testing.T) {
+	initTest()
+	PushConf.Core.DryRun = true
+	PushConf.Core.ResponseFormat.Logs = true
+	PushConf.API.PushURI = "/push"
+	defer func() {
+		PushConf, _ = config.LoadConf("")
+	}()
+
+	body := strings.Join([]string{
+		`{"tokens":["aaaaa","bbbbb"],"platform":2,"message":"Welcome"}`,
+		`{"tokens":["ccccc"],"platform":2,`,
+		`{"tokens":["ddddd"],"platform":2,"message":"Welcome"}`,
+	}, "\n")
+
+	r := gofight.New()
+	r.POST("/api/push").
+		SetHeader(gofight.H{"Content-Type": NDJSONContentType, "Accept": NDJSONContentType}).
+		SetBody(body).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+
+			lines := streamLines(t, r.Body.String())
+			assert.Equal(t, 3, len(lines))
+			assert.Equal(t, float64(1), lines[0]["line"])
+			assert.Equal(t, float64(2), lines[0]["counts"])
+			assert.Equal(t, 2, len(lines[0]["logs"].([]interface{})))
+			assert.Equal(t, float64(3), lines[1]["line"])
+			assert.Nil(t, lines[1]["index"])
+
+			// the malformed line is reported by result of request.
+			assert.Equal(t, float64(3), lines[2]["counts"].(map[string]interface{})["total"])
+			logs := lines[2]["logs"].([]interface{})
+			assert.Equal(t, 1, len(logs))
+			assert.Equal(t, float64(2), logs[0].(map[string]interface{})["line"])
+		})
+}
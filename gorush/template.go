@@ -0,0 +1,157 @@
+package gorush
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Template is the title and body of notification rendered with token_data
+// of each token by text/template.
+type Template struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+// noValue is printed by text/template for missing key of map.
+const noValue = "<no value>"
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Parse(text)
+}
+
+// checkTemplate validate the template of notification can be parsed.
+func checkTemplate(req PushNotification) error {
+	if req.Template == nil {
+		return nil
+	}
+
+	if _, err := parseTemplate("title", req.Template.Title); err != nil {
+		return fmt.Errorf("the template title is invalid: %v", err)
+	}
+
+	if _, err := parseTemplate("body", req.Template.Body); err != nil {
+		return fmt.Errorf("the template body is invalid: %v", err)
+	}
+
+	return nil
+}
+
+func renderTemplate(tmpl *template.Template, data map[string]interface{}) (string, error) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	// missing key renders empty.
+	return strings.Replace(buf.String(), noValue, "", -1), nil
+}
+
+// renderNotifications render title and body of notification for each token.
+// Tokens with the same rendered result are sent in one notification.
+func renderNotifications(req PushNotification) ([]PushNotification, error) {
+	title, err := parseTemplate("title", req.Template.Title)
+	if err != nil {
+		return nil, err
+	}
+	body, err := parseTemplate("body", req.Template.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	render := func(data map[string]interface{}) (PushNotification, error) {
+		n := req
+		n.Template = nil
+		n.TokenData = nil
+		n.Tokens = nil
+		// the wait group of request is done by caller once.
+		n.wg = nil
+
+		if n.Title, err = renderTemplate(title, data); err != nil {
+			return n, err
+		}
+		if n.Message, err = renderTemplate(body, data); err != nil {
+			return n, err
+		}
+
+		return n, nil
+	}
+
+	// topic and condition message has no token data.
+	if len(req.Tokens) == 0 {
+		n, err := render(nil)
+		if err != nil {
+			return nil, err
+		}
+		return []PushNotification{n}, nil
+	}
+
+	var notifications []PushNotification
+	index := make(map[[2]string]int)
+	for _, token := range req.Tokens {
+		n, err := render(req.TokenData[token])
+		if err != nil {
+			failToken(token, req, err)
+			continue
+		}
+
+		key := [2]string{n.Title, n.Message}
+		if i, ok := index[key]; ok {
+			notifications[i].Tokens = append(notifications[i].Tokens, token)
+			continue
+		}
+
+		n.Tokens = []string{token}
+		index[key] = len(notifications)
+		notifications = append(notifications, n)
+	}
+
+	return notifications, nil
+}
+
+// failToken record the token which fails before it is sent to provider.
+func failToken(token string, req PushNotification, err error) {
+	switch req.Platform {
+	case PlatFormIos:
+		StatStorage.AddIosError(1)
+	case PlatFormAndroid:
+		StatStorage.AddAndroidError(1)
+	case PlatFormWeb:
+		StatStorage.AddWebError(1)
+	case PlatFormHuawei:
+		StatStorage.AddHuaweiError(1)
+	case PlatFormSNS:
+		StatStorage.AddSNSError(1)
+	}
+
+	LogPush(FailedPush, token, req, err)
+	addPushResult(FailedPush, req)
+	if PushConf.Core.Sync {
+		req.AddLog(getLogPushEntry(FailedPush, token, req, err))
+	}
+}
+
+// sendTemplateNotification render the template and send notification of
+// each rendered result.
+func sendTemplateNotification(req PushNotification) {
+	if PushConf.Core.Sync {
+		defer req.WaitDone()
+	}
+
+	notifications, err := renderNotifications(req)
+	if err != nil {
+		for _, token := range req.recipients() {
+			failToken(token, req, err)
+		}
+		return
+	}
+
+	for _, notification := range notifications {
+		SendNotification(notification)
+	}
+}
@@ -0,0 +1,136 @@
+package gorush
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gorush/config"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckTemplate(t *testing.T) {
+	req := PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormAndroid,
+		Template: &Template{Title: "Hi {{.name}}", Body: "Your score is {{.score}}"},
+	}
+	assert.NoError(t, checkTemplate(req))
+
+	req.Template.Body = "Your score is {{.score"
+	err := checkTemplate(req)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "the template body is invalid")
+}
+
+func TestRenderNotifications(t *testing.T) {
+	req := PushNotification{
+		Tokens:   []string{"aaaaa", "bbbbb", "ccccc", "ddddd"},
+		Platform: PlatFormAndroid,
+		Template: &Template{Title: "Hi {{.name}}", Body: "Your score is {{.score}}"},
+		TokenData: map[string]map[string]interface{}{
+			"aaaaa": {"name": "Bob", "score": 10},
+			"bbbbb": {"name": "Alice", "score": 20},
+			"ccccc": {"name": "Bob", "score": 10},
+		},
+	}
+
+	notifications, err := renderNotifications(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(notifications))
+
+	// the same result is sent together.
+	assert.Equal(t, []string{"aaaaa", "ccccc"}, notifications[0].Tokens)
+	assert.Equal(t, "Hi Bob", notifications[0].Title)
+	assert.Equal(t, "Your score is 10", notifications[0].Message)
+	assert.Nil(t, notifications[0].Template)
+	assert.Nil(t, notifications[0].TokenData)
+
+	assert.Equal(t, []string{"bbbbb"}, notifications[1].Tokens)
+	assert.Equal(t, "Hi Alice", notifications[1].Title)
+
+	// missing key renders empty.
+	assert.Equal(t, []string{"ddddd"}, notifications[2].Tokens)
+	assert.Equal(t, "Hi ", notifications[2].Title)
+	assert.Equal(t, "Your score is ", notifications[2].Message)
+
+	// topic message is rendered without token data.
+	req = PushNotification{
+		Platform: PlatFormAndroid,
+		To:       "/topics/foo",
+		Template: &Template{Body: "Hello{{.name}}"},
+	}
+	notifications, err = renderNotifications(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, "Hello", notifications[0].Message)
+}
+
+func TestSendTemplateNotification(t *testing.T) {
+	var lock sync.Mutex
+	bodies := map[string]string{}
+	fcmServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message fcm.Message
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		lock.Lock()
+		bodies[message.RegistrationIDs[0]] = message.Notification.Body
+		lock.Unlock()
+		_, _ = w.Write([]byte(`{"success":1,"results":[{"message_id":"1"}]}`))
+	}))
+	defer fcmServer.Close()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	// http.DefaultTransport may be replaced by proxy test.
+	FCMClient, _ = fcm.NewClient(PushConf.Android.APIKey,
+		fcm.WithEndpoint(fcmServer.URL),
+		fcm.WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+	)
+	defer func() {
+		FCMClient = nil
+	}()
+
+	SendNotification(PushNotification{
+		Tokens:   []string{"aaaaa", "bbbbb"},
+		Platform: PlatFormAndroid,
+		Template: &Template{Body: "Your score is {{.score}}"},
+		TokenData: map[string]map[string]interface{}{
+			"aaaaa": {"score": 10},
+			"bbbbb": {"score": 20},
+		},
+	})
+
+	assert.Equal(t, map[string]string{
+		"aaaaa": "Your score is 10",
+		"bbbbb": "Your score is 20",
+	}, bodies)
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+
+	r := gofight.New()
+
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"aaaaa"},
+					"platform": PlatFormAndroid,
+					"template": gofight.D{"body": "Hi {{.name"},
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+			assert.Contains(t, r.Body.String(), "the template body is invalid")
+		})
+}
@@ -0,0 +1,114 @@
+package gorush
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestTimeoutMiddleware abort the request which isn't done in
+// core.request_timeout seconds with 503 status code, the context of request
+// is canceled, so the sync notifications of request are stopped.
+func RequestTimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		if c.Request.Body != nil {
+			c.Request.Body = &timeoutBody{ctx: ctx, body: c.Request.Body}
+		}
+
+		c.Next()
+		abortIfTimedOut(c)
+	}
+}
+
+// abortIfTimedOut reject the request with 503 if it is timed out, whatever
+// the handler has done.
+func abortIfTimedOut(c *gin.Context) bool {
+	if c.Request.Context().Err() != context.DeadlineExceeded {
+		return false
+	}
+
+	if !c.Writer.Written() {
+		msg := "Request timeout exceeded."
+		withRequestID(LogError, c.GetString(RequestIDKey)).Error(msg)
+		abortWithError(c, http.StatusServiceUnavailable, msg)
+	}
+
+	return true
+}
+
+// requestContext return the context of request for the sync notifications,
+// it is canceled only if core.request_timeout is set.
+func requestContext(c *gin.Context) context.Context {
+	if PushConf.Core.RequestTimeout > 0 {
+		return c.Request.Context()
+	}
+
+	return context.Background()
+}
+
+// waitNotifications wait for the sync notifications of request, false if the
+// context of request is done before all of them are sent.
+func waitNotifications(ctx context.Context, wg *sync.WaitGroup) bool {
+	if ctx == nil || ctx.Done() == nil {
+		wg.Wait()
+		return true
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// timeoutBody stop reading the body trickled by slow client when the request
+// is timed out, the handler doesn't wait for the pending read.
+type timeoutBody struct {
+	ctx  context.Context
+	body io.ReadCloser
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// the pending read keeps its own buffer, p may be used again by caller.
+	buf := make([]byte, len(p))
+	result := make(chan readResult, 1)
+	go func() {
+		n, err := b.body.Read(buf)
+		result <- readResult{n, err}
+	}()
+
+	select {
+	case r := <-result:
+		return copy(p, buf[:r.n]), r.err
+	case <-b.ctx.Done():
+		return 0, b.ctx.Err()
+	}
+}
+
+func (b *timeoutBody) Close() error {
+	return b.body.Close()
+}
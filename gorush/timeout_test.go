@@ -0,0 +1,128 @@
+package gorush
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/appleboy/go-fcm"
+	"github.com/appleboy/gorush/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func timeoutEngine(timeout time.Duration) *gin.Engine {
+	r := gin.New()
+	r.Use(RequestTimeoutMiddleware(timeout))
+	r.POST("/push", pushHandler)
+
+	return r
+}
+
+func TestRequestTimeoutSlowBody(t *testing.T) {
+	initTest()
+	PushConf.Core.RequestTimeout = 1
+
+	// the client sends part of body and never finishes it.
+	body, writer := io.Pipe()
+	defer writer.Close()
+	go func() {
+		_, _ = writer.Write([]byte(`{"notifications":[`))
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "/push", body)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	timeoutEngine(50*time.Millisecond).ServeHTTP(w, req)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"code":503,"message":"Request timeout exceeded."}`, w.Body.String())
+}
+
+func TestRequestTimeoutSyncPush(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte(`{"success":1,"results":[{"message_id":"1"}]}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	initTest()
+	PushConf.Core.Sync = true
+	PushConf.Core.RequestTimeout = 1
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	FCMClient, _ = fcm.NewClient(PushConf.Android.APIKey,
+		fcm.WithEndpoint(server.URL),
+		fcm.WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+	)
+	defer func() {
+		FCMClient = nil
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "/push", strings.NewReader(`{"notifications":[{"tokens":["aaaaa"],"platform":2,"message":"Welcome"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	timeoutEngine(50*time.Millisecond).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestWaitNotifications(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.False(t, waitNotifications(ctx, &wg))
+
+	wg.Done()
+	assert.True(t, waitNotifications(context.Background(), &wg))
+	assert.True(t, waitNotifications(nil, &wg))
+}
+
+func TestPushToAndroidCanceled(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write([]byte(`{"success":1,"results":[{"message_id":"1"}]}`))
+	}))
+	defer server.Close()
+
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	PushConf.Android.APIVersion = "legacy"
+	PushConf.Android.APIKey = "fake-api-key"
+	FCMClient, _ = fcm.NewClient(PushConf.Android.APIKey,
+		fcm.WithEndpoint(server.URL),
+		fcm.WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+	)
+	defer func() {
+		FCMClient = nil
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+		ctx:      ctx,
+	}
+	assert.False(t, PushToAndroid(req))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// the timed out request isn't sent any more.
+	cancel()
+	assert.True(t, PushToAndroid(req))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,49 @@
+package gorush
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	version, err := parseTLSVersion("")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), version)
+
+	version, err = parseTLSVersion("1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS10), version)
+
+	_, err = parseTLSVersion("1.4")
+	assert.EqualError(t, err, `unknown tls_min_version "1.4", must be 1.0, 1.1, 1.2 or 1.3`)
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	suites, err := parseCipherSuites("")
+	assert.NoError(t, err)
+	assert.Nil(t, suites)
+
+	suites, err = parseCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, suites)
+
+	_, err = parseCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_FAKE")
+	assert.EqualError(t, err, `unknown tls_cipher_suites "TLS_FAKE"`)
+}
+
+func TestSetTLSConfig(t *testing.T) {
+	initTest()
+	config := &tls.Config{}
+
+	assert.NoError(t, setTLSConfig(config))
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	assert.Nil(t, config.CipherSuites)
+
+	PushConf.Core.TLSMinVersion = "1.0"
+	PushConf.Core.TLSCipherSuites = "TLS_RSA_WITH_AES_128_GCM_SHA256"
+	assert.NoError(t, setTLSConfig(config))
+	assert.Equal(t, uint16(tls.VersionTLS10), config.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_RSA_WITH_AES_128_GCM_SHA256}, config.CipherSuites)
+}
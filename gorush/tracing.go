@@ -0,0 +1,397 @@
+package gorush
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// TraceParentHeader is header name of W3C trace context
+	TraceParentHeader = "traceparent"
+	// traceSpanKey is context key of request span
+	traceSpanKey = "trace_span"
+
+	// tracingBatchSize is the max number of spans in one export request.
+	tracingBatchSize = 512
+	// tracingInterval is how often the spans are exported.
+	tracingInterval = 5 * time.Second
+	// tracingTimeout is the timeout of export request.
+	tracingTimeout = 10 * time.Second
+
+	// span kind and status code of OTLP.
+	spanKindServer = 2
+	spanKindClient = 3
+	spanStatusOK   = 1
+	spanStatusErr  = 2
+)
+
+// tracer export the finished spans to OTLP/HTTP endpoint in JSON encoding,
+// it is nil if tracing is disabled so spans are never created.
+var tracer *spanExporter
+
+// span is the timed operation of trace.
+type span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      string
+}
+
+// traceParent return the W3C traceparent of span, which is parent of its
+// child spans.
+func (s *span) traceParent() string {
+	if s == nil {
+		return ""
+	}
+
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-01"
+}
+
+// setAttr set the attribute of span.
+func (s *span) setAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.attrs[key] = value
+}
+
+// finish end the span and queue it for export, err marks the span failed.
+func (s *span) finish(err string) {
+	if s == nil || tracer == nil {
+		return
+	}
+
+	s.end = time.Now()
+	s.err = err
+	tracer.add(s)
+}
+
+// parseTraceParent return trace id and parent span id of W3C traceparent,
+// false if it is invalid or the trace isn't sampled.
+func parseTraceParent(value string) (traceID [16]byte, spanID [8]byte, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, spanID, false
+	}
+
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == ([16]byte{}) {
+		return traceID, spanID, false
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil || spanID == ([8]byte{}) {
+		return traceID, spanID, false
+	}
+
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || flags&1 == 0 {
+		return traceID, spanID, false
+	}
+
+	return traceID, spanID, true
+}
+
+// startSpan start the span under parent traceparent, new trace is started if
+// parent is empty. Return nil if tracing is disabled or parent isn't sampled.
+func startSpan(parent, name string, kind int) *span {
+	if tracer == nil {
+		return nil
+	}
+
+	s := &span{
+		name:  name,
+		kind:  kind,
+		start: time.Now(),
+		attrs: map[string]interface{}{},
+	}
+
+	if parent != "" {
+		var ok bool
+		if s.traceID, s.parentID, ok = parseTraceParent(parent); !ok {
+			return nil
+		}
+	} else if _, err := rand.Read(s.traceID[:]); err != nil {
+		return nil
+	}
+
+	if _, err := rand.Read(s.spanID[:]); err != nil {
+		return nil
+	}
+
+	return s
+}
+
+// requestTraceParent return traceparent of request span, empty if request
+// isn't traced.
+func requestTraceParent(c *gin.Context) string {
+	s, _ := c.Get(traceSpanKey)
+	if s, ok := s.(*span); ok {
+		return s.traceParent()
+	}
+
+	return ""
+}
+
+// TracingMiddleware start the span of POST request under the traceparent of
+// header, so push latency is part of caller's trace.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+
+		// invalid traceparent starts new trace as W3C trace context.
+		parent := c.GetHeader(TraceParentHeader)
+		if _, _, ok := parseTraceParent(parent); !ok && parent != "" {
+			parent = ""
+		}
+
+		s := startSpan(parent, c.Request.Method+" "+c.Request.URL.Path, spanKindServer)
+		if s == nil {
+			c.Next()
+			return
+		}
+		c.Set(traceSpanKey, s)
+
+		c.Next()
+
+		s.setAttr("http.method", c.Request.Method)
+		s.setAttr("http.target", c.Request.URL.Path)
+		s.setAttr("http.status_code", c.Writer.Status())
+		s.setAttr("gorush.request_id", c.GetString(RequestIDKey))
+		var err string
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			err = http.StatusText(c.Writer.Status())
+		}
+		s.finish(err)
+	}
+}
+
+// startDeliverySpan start the span of sending notification to provider.
+func startDeliverySpan(req PushNotification) *span {
+	if req.traceParent == "" {
+		return nil
+	}
+
+	platform := typeForPlatForm(req.Platform)
+	s := startSpan(req.traceParent, "push "+platform, spanKindClient)
+	s.setAttr("gorush.platform", platform)
+	s.setAttr("gorush.token_count", len(req.recipients()))
+	if req.ID != "" {
+		s.setAttr("gorush.notif_id", req.ID)
+	}
+
+	return s
+}
+
+// finishDeliverySpan end the delivery span with outcome of push.
+func finishDeliverySpan(s *span, isError bool) {
+	if s == nil {
+		return
+	}
+
+	if isError {
+		s.setAttr("gorush.outcome", "failure")
+		s.finish("push failed")
+		return
+	}
+
+	s.setAttr("gorush.outcome", "success")
+	s.finish("")
+}
+
+// spanExporter batch the spans and post them to OTLP/HTTP endpoint.
+type spanExporter struct {
+	endpoint string
+	service  string
+	client   *http.Client
+	lock     sync.Mutex
+	spans    []*span
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// InitTracing start the span exporter if core.tracing is enabled.
+func InitTracing() {
+	if !PushConf.Core.Tracing.Enabled {
+		tracer = nil
+		return
+	}
+
+	tracer = newSpanExporter(PushConf.Core.Tracing.Endpoint, PushConf.Core.Tracing.ServiceName)
+	go tracer.run(tracingInterval)
+}
+
+func newSpanExporter(endpoint, service string) *spanExporter {
+	return &spanExporter{
+		endpoint: endpoint,
+		service:  service,
+		client:   &http.Client{Timeout: tracingTimeout},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// add queue the finished span, the span is dropped if too many spans are
+// waiting for export.
+func (e *spanExporter) add(s *span) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if len(e.spans) >= tracingBatchSize*10 {
+		return
+	}
+	e.spans = append(e.spans, s)
+}
+
+func (e *spanExporter) run(interval time.Duration) {
+	defer close(e.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.flush()
+		case <-e.stop:
+			e.flush()
+			return
+		}
+	}
+}
+
+// flush export all queued spans.
+func (e *spanExporter) flush() {
+	e.lock.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.lock.Unlock()
+
+	for len(spans) > 0 {
+		n := len(spans)
+		if n > tracingBatchSize {
+			n = tracingBatchSize
+		}
+		if err := e.export(spans[:n]); err != nil {
+			LogError.Error("export spans error: " + err.Error())
+		}
+		spans = spans[n:]
+	}
+}
+
+// close export the queued spans and stop the exporter.
+func (e *spanExporter) close() {
+	close(e.stop)
+	<-e.done
+}
+
+// flushTracing export the queued spans on shutdown.
+func flushTracing() {
+	if tracer != nil {
+		tracer.close()
+	}
+}
+
+func (e *spanExporter) export(spans []*span) error {
+	payload, err := json.Marshal(e.otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("collector returned %d status code", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// otlpRequest return the ExportTraceServiceRequest of OTLP JSON encoding.
+func (e *spanExporter) otlpRequest(spans []*span) map[string]interface{} {
+	list := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		item := map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+			"status":            map[string]interface{}{"code": spanStatusOK},
+		}
+		if s.parentID != ([8]byte{}) {
+			item["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != "" {
+			item["status"] = map[string]interface{}{"code": spanStatusErr, "message": s.err}
+		}
+		list = append(list, item)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{
+						"service.name":    e.service,
+						"service.version": GetVersion(),
+					}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "gorush"},
+						"spans": list,
+					},
+				},
+			},
+		},
+	}
+}
+
+// otlpAttributes convert the attributes to OTLP key values.
+func otlpAttributes(attrs map[string]interface{}) []map[string]interface{} {
+	list := make([]map[string]interface{}, 0, len(attrs))
+	for key, value := range attrs {
+		var v map[string]interface{}
+		switch value := value.(type) {
+		case int:
+			// int64 is string in OTLP JSON encoding.
+			v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+		case bool:
+			v = map[string]interface{}{"boolValue": value}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+		}
+		list = append(list, map[string]interface{}{"key": key, "value": v})
+	}
+
+	return list
+}
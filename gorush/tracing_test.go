@@ -0,0 +1,112 @@
+package gorush
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	traceID, spanID, ok := parseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	s := &span{traceID: traceID, spanID: spanID}
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", s.traceParent())
+
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, _, ok := parseTraceParent(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	tracer = nil
+	s := startSpan("", "POST /api/push", spanKindServer)
+	assert.Nil(t, s)
+	assert.Equal(t, "", s.traceParent())
+	s.setAttr("key", "value")
+	s.finish("")
+	assert.Nil(t, startDeliverySpan(PushNotification{Platform: PlatFormAndroid, traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}))
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	var lock sync.Mutex
+	var spans []map[string]interface{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []map[string]interface{} `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		assert.NoError(t, json.Unmarshal(body, &req))
+		lock.Lock()
+		spans = append(spans, req.ResourceSpans[0].ScopeSpans[0].Spans...)
+		lock.Unlock()
+	}))
+	defer collector.Close()
+
+	initTest()
+	PushConf.API.PushURI = "/push"
+	PushConf.Android.Enabled = true
+	PushConf.Core.Tracing.Enabled = true
+	PushConf.Core.Tracing.Endpoint = collector.URL
+	InitTracing()
+	InitWorkers(0, 10)
+	defer func() {
+		tracer = nil
+		PushConf, _ = config.LoadConf("")
+		InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+	}()
+
+	req, _ := http.NewRequest("POST", "/api/push", strings.NewReader(`{"notifications":[{"tokens":["aaaaa","bbbbb"],"platform":2,"message":"Welcome"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	routerEngine().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the notification carries the request span as parent of delivery span.
+	notification := <-QueueNotification
+	assert.True(t, strings.HasPrefix(notification.traceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+	delivery := startDeliverySpan(notification)
+	finishDeliverySpan(delivery, true)
+
+	flushTracing()
+	assert.Equal(t, 2, len(spans))
+	server, client := spans[0], spans[1]
+	assert.Equal(t, "POST /api/push", server["name"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", server["parentSpanId"])
+	assert.Equal(t, "push android", client["name"])
+	assert.Equal(t, server["traceId"], client["traceId"])
+	assert.Equal(t, server["spanId"], client["parentSpanId"])
+	assert.Equal(t, float64(spanStatusErr), client["status"].(map[string]interface{})["code"])
+
+	attrs := map[string]interface{}{}
+	for _, attr := range client["attributes"].([]interface{}) {
+		attr := attr.(map[string]interface{})
+		for _, v := range attr["value"].(map[string]interface{}) {
+			attrs[attr["key"].(string)] = v
+		}
+	}
+	assert.Equal(t, "android", attrs["gorush.platform"])
+	assert.Equal(t, "2", attrs["gorush.token_count"])
+	assert.Equal(t, "failure", attrs["gorush.outcome"])
+}
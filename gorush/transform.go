@@ -0,0 +1,249 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// transformFunc is the Lua function of core.transform_script called with
+// each notification.
+const transformFunc = "transform"
+
+// transformTimeout is the max duration of transform function, the script is
+// stopped after it.
+var transformTimeout = time.Second
+
+// transformProto is the compiled core.transform_script, nil if it isn't set.
+var transformProto *lua.FunctionProto
+
+// transformStates keep the Lua states loaded with script for reuse, a state
+// can't be used by workers at the same time.
+var transformStates *sync.Pool
+
+// transformLibs are the libraries opened for script, os and io are not
+// opened so the script can't touch the host.
+var transformLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.LoadLibName, lua.OpenPackage},
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// InitTransform compile core.transform_script, the script must define
+// transform(notification) function.
+func InitTransform() error {
+	transformProto, transformStates = nil, nil
+	path := PushConf.Core.TransformScript
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	chunk, err := parse.Parse(file, path)
+	if err != nil {
+		return err
+	}
+
+	proto, err := lua.Compile(chunk, path)
+	if err != nil {
+		return err
+	}
+
+	L, err := newTransformState(proto)
+	if err != nil {
+		return err
+	}
+
+	LogAccess.Debug("transform script is ", path)
+	transformProto = proto
+	transformStates = &sync.Pool{}
+	transformStates.Put(L)
+
+	return nil
+}
+
+// newTransformState run the script in new Lua state and check the transform
+// function is defined.
+func newTransformState(proto *lua.FunctionProto) (*lua.LState, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range transformLibs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		L.Close()
+		return nil, err
+	}
+
+	if L.GetGlobal(transformFunc).Type() != lua.LTFunction {
+		L.Close()
+		return nil, errors.New("transform script must define function transform(notification)")
+	}
+
+	return L, nil
+}
+
+// transformNotification call the transform function with notification as Lua
+// table, the function changes the table or returns a new one. The fields of
+// notification are replaced by the result, and it is validated again.
+func transformNotification(msg PushNotification) (PushNotification, error) {
+	if transformProto == nil {
+		return msg, nil
+	}
+
+	L, _ := transformStates.Get().(*lua.LState)
+	if L == nil {
+		var err error
+		if L, err = newTransformState(transformProto); err != nil {
+			return msg, err
+		}
+	}
+
+	result, err := callTransform(L, msg)
+	if err != nil {
+		// the state may be stopped by timeout, so it isn't reused.
+		L.Close()
+		return msg, fmt.Errorf("transform script error: %s", err)
+	}
+	transformStates.Put(L)
+
+	if err := checkNotification(result); err != nil {
+		return msg, fmt.Errorf("transformed notification is invalid: %s", err)
+	}
+
+	return result, nil
+}
+
+func callTransform(L *lua.LState, msg PushNotification) (PushNotification, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return msg, err
+	}
+
+	var input map[string]interface{}
+	if err := json.Unmarshal(payload, &input); err != nil {
+		return msg, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), transformTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+
+	table := toLuaValue(L, input)
+	if err := L.CallByParam(lua.P{
+		Fn:      L.GetGlobal(transformFunc),
+		NRet:    1,
+		Protect: true,
+	}, table); err != nil {
+		return msg, err
+	}
+
+	ret := L.Get(-1)
+	L.Pop(1)
+	if ret == lua.LNil {
+		ret = table
+	}
+	if _, ok := ret.(*lua.LTable); !ok {
+		return msg, fmt.Errorf("transform must return table, not %s", ret.Type())
+	}
+
+	if payload, err = json.Marshal(fromLuaValue(ret)); err != nil {
+		return msg, err
+	}
+
+	// the exported fields are replaced by the result, the unexported state
+	// of notification such as wait group and callback is kept.
+	result := msg
+	v := reflect.ValueOf(&result).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).PkgPath == "" {
+			v.Field(i).Set(reflect.Zero(v.Field(i).Type()))
+		}
+	}
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return msg, err
+	}
+
+	return result, nil
+}
+
+// toLuaValue convert the decoded JSON value to Lua value.
+func toLuaValue(L *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		table := L.NewTable()
+		for _, item := range v {
+			table.Append(toLuaValue(L, item))
+		}
+		return table
+	case map[string]interface{}:
+		table := L.NewTable()
+		for key, item := range v {
+			table.RawSetString(key, toLuaValue(L, item))
+		}
+		return table
+	}
+
+	return lua.LNil
+}
+
+// fromLuaValue convert the Lua value to JSON value, the table with sequence
+// keys is array and empty table is null, which is decoded as empty slice or
+// map.
+func fromLuaValue(value lua.LValue) interface{} {
+	switch v := value.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if n := v.MaxN(); n > 0 {
+			items := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				items = append(items, fromLuaValue(v.RawGetInt(i)))
+			}
+			return items
+		}
+
+		fields := map[string]interface{}{}
+		v.ForEach(func(key, item lua.LValue) {
+			fields[key.String()] = fromLuaValue(item)
+		})
+		if len(fields) == 0 {
+			return nil
+		}
+		return fields
+	}
+
+	return nil
+}
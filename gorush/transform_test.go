@@ -0,0 +1,203 @@
+package gorush
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gorush/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testTransformScript write the Lua script to temporary file and load it as
+// core.transform_script.
+func testTransformScript(t *testing.T, script string) func() {
+	file, err := ioutil.TempFile("", "transform-*.lua")
+	assert.NoError(t, err)
+	_, err = file.WriteString(script)
+	assert.NoError(t, err)
+	file.Close()
+
+	PushConf.Core.TransformScript = file.Name()
+	assert.NoError(t, InitTransform())
+
+	return func() {
+		os.Remove(file.Name())
+		PushConf.Core.TransformScript = ""
+		assert.NoError(t, InitTransform())
+	}
+}
+
+func TestInitTransform(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	assert.NoError(t, InitTransform())
+	assert.Nil(t, transformProto)
+
+	PushConf.Core.TransformScript = "not_found.lua"
+	assert.Error(t, InitTransform())
+
+	for script, message := range map[string]string{
+		"function transform(n": "syntax error",
+		"local x = 1":          "transform script must define function transform(notification)",
+		"error('boom')\nfunction transform(n) end": "boom",
+	} {
+		file, err := ioutil.TempFile("", "transform-*.lua")
+		assert.NoError(t, err)
+		_, _ = file.WriteString(script)
+		file.Close()
+
+		PushConf.Core.TransformScript = file.Name()
+		err = InitTransform()
+		os.Remove(file.Name())
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), message)
+		}
+		assert.Nil(t, transformProto)
+	}
+}
+
+func TestTransformNotification(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	cleanup := testTransformScript(t, `
+function transform(n)
+  n.data = n.data or {}
+  n.data.ab_group = "b"
+  if n.platform == 2 then
+    n.title = "[beta] " .. n.message
+  end
+  -- os and io are not opened.
+  n.data.sandboxed = os == nil and io == nil
+  table.insert(n.tokens, "extra")
+  n.priority = nil
+  return n
+end
+`)
+	defer cleanup()
+
+	wg := &sync.WaitGroup{}
+	notification, err := transformNotification(PushNotification{
+		ID:       "notif-1",
+		Platform: PlatFormAndroid,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+		Priority: "high",
+		wg:       wg,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "notif-1", notification.ID)
+	assert.Equal(t, "[beta] Welcome", notification.Title)
+	assert.Equal(t, []string{"aaaaa", "extra"}, notification.Tokens)
+	assert.Equal(t, "b", notification.Data["ab_group"])
+	assert.Equal(t, true, notification.Data["sandboxed"])
+	assert.Equal(t, "", notification.Priority)
+	// unexported state is kept.
+	assert.Equal(t, wg, notification.wg)
+
+	// the cached state is reused.
+	notification, err = transformNotification(PushNotification{
+		Platform: PlatFormIos,
+		Tokens:   []string{"bbbbb"},
+		Message:  "Welcome",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "", notification.Title)
+	assert.Equal(t, "b", notification.Data["ab_group"])
+}
+
+func TestTransformNotificationError(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	transformTimeout = 100 * time.Millisecond
+	defer func() {
+		transformTimeout = time.Second
+	}()
+	cleanup := testTransformScript(t, `
+function transform(n)
+  if n.message == "error" then
+    error("gating failed")
+  elseif n.message == "string" then
+    return "done"
+  elseif n.message == "invalid" then
+    n.platform = 9
+  elseif n.message == "loop" then
+    while true do end
+  end
+end
+`)
+	defer cleanup()
+
+	// the function may change the table in place.
+	notification, err := transformNotification(PushNotification{Platform: PlatFormAndroid, Tokens: []string{"aaaaa"}, Message: "ok"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", notification.Message)
+
+	for message, reason := range map[string]string{
+		"error":   "transform script error:",
+		"string":  "transform script error: transform must return table, not string",
+		"invalid": "transformed notification is invalid:",
+		"loop":    "transform script error:",
+	} {
+		_, err := transformNotification(PushNotification{Platform: PlatFormAndroid, Tokens: []string{"aaaaa"}, Message: message})
+		if assert.Error(t, err, message) {
+			assert.Contains(t, err.Error(), reason)
+		}
+	}
+
+	// new state is created after the state is stopped.
+	_, err = transformNotification(PushNotification{Platform: PlatFormAndroid, Tokens: []string{"aaaaa"}, Message: "ok"})
+	assert.NoError(t, err)
+}
+
+func TestSendTransformedNotification(t *testing.T) {
+	messages := make(chan string, 2)
+	cleanup := testSNSServer(t, func(arn string, message map[string]string) (int, string) {
+		messages <- message["default"]
+		return http.StatusOK, snsPublished("message-id")
+	})
+	defer cleanup()
+
+	PushConf.Core.Sync = true
+	cleanupScript := testTransformScript(t, `
+function transform(n)
+  if n.message == "blocked" then
+    error("the message is blocked")
+  end
+  n.message = n.message .. " (v2)"
+  return n
+end
+`)
+	defer cleanupScript()
+
+	var log []LogPushEntry
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	SendNotification(PushNotification{
+		Platform: PlatFormSNS,
+		Tokens:   []string{snsIOSEndpoint},
+		Message:  "Welcome",
+		wg:       wg,
+		log:      &log,
+	})
+	wg.Wait()
+	assert.Equal(t, "Welcome (v2)", <-messages)
+
+	// the notification failed by transform isn't sent.
+	log = nil
+	wg.Add(1)
+	SendNotification(PushNotification{
+		Platform: PlatFormSNS,
+		Tokens:   []string{snsIOSEndpoint, snsAndroidEndpoint},
+		Message:  "blocked",
+		wg:       wg,
+		log:      &log,
+	})
+	wg.Wait()
+	assert.Equal(t, 0, len(messages))
+	if assert.Equal(t, 2, len(log)) {
+		assert.Equal(t, FailedPush, log[0].Type)
+		assert.Contains(t, log[0].Error, "the message is blocked")
+	}
+}
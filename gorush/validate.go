@@ -0,0 +1,294 @@
+package gorush
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FieldError is the reason of one invalid field in push request.
+type FieldError struct {
+	// Field is the path of field, e.g. notifications[3].tokens
+	Field string `json:"field"`
+	// Index is the position of the notification, nil if the error is not of
+	// one notification.
+	Index  *int   `json:"index,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Reason
+	}
+
+	return e.Field + ": " + e.Reason
+}
+
+// arrayIndex is number segment of field path decoded by encoding/json.
+var arrayIndex = regexp.MustCompile(`\.(\d+)(\.|$)`)
+
+// fieldPath convert the dotted path of json error as notifications[0].alert.
+func fieldPath(field string) string {
+	for arrayIndex.MatchString(field) {
+		field = arrayIndex.ReplaceAllString(field, "[$1]$2")
+	}
+
+	return field
+}
+
+// bindErrors return the field errors of request body which can't be bound.
+func bindErrors(err error) []FieldError {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return []FieldError{{Reason: "invalid JSON: " + e.Error()}}
+	case *json.UnmarshalTypeError:
+		fe := FieldError{
+			Field:  fieldPath(e.Field),
+			Reason: fmt.Sprintf("the value must be %s", e.Type),
+		}
+		if strings.HasPrefix(fe.Field, "notifications[") {
+			var i int
+			if _, scanErr := fmt.Sscanf(fe.Field, "notifications[%d]", &i); scanErr == nil {
+				fe.Index = &i
+			}
+		}
+		return []FieldError{fe}
+	}
+
+	return []FieldError{{Field: "notifications", Reason: "required"}}
+}
+
+// appendFieldErrors append the errors which aren't in errs, the iOS and
+// Android notifications of all platforms may have the same error.
+func appendFieldErrors(errs []FieldError, others ...FieldError) []FieldError {
+	for _, other := range others {
+		duplicate := false
+		for _, err := range errs {
+			if err.Field == other.Field && err.Reason == other.Reason {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			errs = append(errs, other)
+		}
+	}
+
+	return errs
+}
+
+// notificationErrors return errors of all notification checks.
+func notificationErrors(index int, req PushNotification) []FieldError {
+	var errs []FieldError
+	for _, c := range notificationChecks {
+		if err := c.check(req); err != nil {
+			i := index
+			errs = append(errs, FieldError{
+				Field:  fmt.Sprintf("notifications[%d].%s", index, c.field),
+				Index:  &i,
+				Reason: err.Error(),
+			})
+		}
+	}
+
+	return errs
+}
+
+// NotificationReport is the validation result of one notification in push
+// request which is validated without sending.
+type NotificationReport struct {
+	Index    int    `json:"index"`
+	Platform string `json:"platform"`
+	Valid    bool   `json:"valid"`
+	// Recipients is the number of tokens, topic or web subscription.
+	Recipients    int      `json:"recipients"`
+	InvalidTokens []string `json:"invalid_tokens,omitempty"`
+	// PayloadSize is the bytes of payload sent to each recipient, the largest
+	// one if the title and body are rendered by template.
+	PayloadSize  int          `json:"payload_size"`
+	PayloadLimit int          `json:"payload_limit,omitempty"`
+	Errors       []FieldError `json:"errors,omitempty"`
+}
+
+// PlatformReport is the total of valid notifications of one platform.
+type PlatformReport struct {
+	Notifications int `json:"notifications"`
+	Recipients    int `json:"recipients"`
+	// PayloadSize is the estimated bytes sent to provider for all recipients.
+	PayloadSize int `json:"payload_size"`
+}
+
+// fcmToken is the characters of FCM registration token.
+var fcmToken = regexp.MustCompile(`^[A-Za-z0-9_:\-]+$`)
+
+// checkToken validate the format of device token, the token may be still
+// rejected by provider.
+func checkToken(platform int, token string) error {
+	if strings.TrimSpace(token) == "" {
+		return errors.New("the token must not be empty")
+	}
+
+	switch platform {
+	case PlatFormIos:
+		if _, err := hex.DecodeString(token); err != nil {
+			return errors.New("the token must be hexadecimal")
+		}
+	case PlatFormAndroid:
+		if !fcmToken.MatchString(token) {
+			return errors.New("the token has invalid characters")
+		}
+	case PlatFormSNS:
+		if !snsEndpointARN.MatchString(token) {
+			return errors.New("the token must be SNS endpoint ARN")
+		}
+	}
+
+	return nil
+}
+
+// validateNotification run the checks of push and worker for notification,
+// and compute the payload size without contacting provider.
+func validateNotification(index int, req PushNotification, sender *clientSender) NotificationReport {
+	report := NotificationReport{
+		Index:      index,
+		Platform:   typeForPlatForm(req.Platform),
+		Recipients: len(req.recipients()),
+	}
+	fieldError := func(field string, err error) FieldError {
+		i := index
+		return FieldError{
+			Field:  fmt.Sprintf("notifications[%d].%s", index, field),
+			Index:  &i,
+			Reason: err.Error(),
+		}
+	}
+
+	if err := sender.check(&req); err != nil {
+		report.Errors = append(report.Errors, fieldError("app", err))
+	}
+	report.Errors = append(report.Errors, notificationErrors(index, req)...)
+
+	if len(report.Errors) == 0 {
+		if !platformEnabled(req.Platform) {
+			report.Errors = append(report.Errors, fieldError("platform", fmt.Errorf("the %s platform is not enabled", report.Platform)))
+		} else if err := CheckMessage(req); err != nil {
+			report.Errors = append(report.Errors, fieldError("tokens", err))
+		}
+	}
+
+	if req.Platform == PlatFormIos || req.Platform == PlatFormAndroid {
+		for _, token := range req.Tokens {
+			if checkToken(req.Platform, token) != nil {
+				report.InvalidTokens = append(report.InvalidTokens, token)
+			}
+		}
+	}
+
+	if len(report.Errors) == 0 {
+		size, err := estimatePayloadSize(req)
+		if err != nil {
+			report.Errors = append(report.Errors, fieldError("data", err))
+		}
+		report.PayloadSize = size
+		report.PayloadLimit = payloadSizeLimit(req)
+		if report.PayloadLimit > 0 && size > report.PayloadLimit {
+			// the title and body rendered by template may be too large.
+			report.Errors = append(report.Errors, fieldError("data", fmt.Errorf("the payload size %d bytes exceeds the limit of %d bytes", size, report.PayloadLimit)))
+		}
+	}
+
+	report.Valid = len(report.Errors) == 0
+
+	return report
+}
+
+// estimatePayloadSize return the largest payload size of notification
+// rendered for each token.
+func estimatePayloadSize(req PushNotification) (int, error) {
+	if req.Template == nil {
+		return GetPayloadSize(req)
+	}
+
+	notifications, err := renderNotifications(req)
+	if err != nil {
+		return 0, err
+	}
+
+	var max int
+	for _, n := range notifications {
+		size, err := GetPayloadSize(n)
+		if err != nil {
+			return 0, err
+		}
+		if size > max {
+			max = size
+		}
+	}
+
+	return max, nil
+}
+
+// validatePushHandler validate the notifications of push request and report
+// the counts and payload sizes, nothing is sent.
+func validatePushHandler(c *gin.Context) {
+	form, ok := bindNotifications(c)
+	if !ok {
+		return
+	}
+
+	sender := getClientSender(c)
+	reports := make([]NotificationReport, 0, len(form.Notifications))
+	platforms := map[string]*PlatformReport{}
+	var valid, recipients, invalidTokens int
+	for i, notification := range form.Notifications {
+		notifications, err := expandNotification(notification)
+		if err != nil {
+			index := i
+			reports = append(reports, NotificationReport{
+				Index:    i,
+				Platform: "all",
+				Errors:   []FieldError{{Field: fmt.Sprintf("notifications[%d].tokens", i), Index: &index, Reason: err.Error()}},
+			})
+			continue
+		}
+
+		for _, notification := range notifications {
+			report := validateNotification(i, notification, sender)
+			reports = append(reports, report)
+			recipients += report.Recipients
+			invalidTokens += len(report.InvalidTokens)
+			if !report.Valid {
+				continue
+			}
+
+			valid++
+			platform, ok := platforms[report.Platform]
+			if !ok {
+				platform = &PlatformReport{}
+				platforms[report.Platform] = platform
+			}
+			platform.Notifications++
+			platform.Recipients += report.Recipients
+			platform.PayloadSize += report.PayloadSize * report.Recipients
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+		"counts": gin.H{
+			"notifications":  len(reports),
+			"valid":          valid,
+			"invalid":        len(reports) - valid,
+			"recipients":     recipients,
+			"invalid_tokens": invalidTokens,
+		},
+		"platforms":     platforms,
+		"notifications": reports,
+	})
+}
@@ -0,0 +1,182 @@
+package gorush
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldPath(t *testing.T) {
+	assert.Equal(t, "notifications", fieldPath("notifications"))
+	assert.Equal(t, "notifications[0].alert.loc-args[1]", fieldPath("notifications.0.alert.loc-args.1"))
+	assert.Equal(t, "notifications[2].tokens[0]", fieldPath("notifications.2.tokens.0"))
+}
+
+func TestBindErrors(t *testing.T) {
+	var form RequestPush
+
+	err := json.Unmarshal([]byte(`{"notifications":[`), &form)
+	errs := bindErrors(err)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, "", errs[0].Field)
+
+	err = json.Unmarshal([]byte(`{"notifications":[{"platform":"ios"}]}`), &form)
+	errs = bindErrors(err)
+	assert.Equal(t, 1, len(errs))
+	assert.Contains(t, errs[0].Field, "platform")
+	assert.Equal(t, "the value must be int", errs[0].Reason)
+}
+
+func TestPushFieldErrors(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+
+	r := gofight.New()
+
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"aaaaa"},
+					"platform": PlatFormAndroid,
+					"message":  "Welcome",
+				},
+				{
+					"platform": PlatFormAndroid,
+					"message":  "Welcome",
+					"priority": "urgent",
+				},
+				{
+					"tokens":   []string{"aaaaa"},
+					"platform": 7,
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			var res struct {
+				Message string       `json:"message"`
+				Errors  []FieldError `json:"errors"`
+			}
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+			assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &res))
+			assert.Equal(t, "the message must specify at least one registration ID", res.Message)
+			assert.Equal(t, 3, len(res.Errors))
+
+			assert.Equal(t, "notifications[1].tokens", res.Errors[0].Field)
+			assert.Equal(t, 1, *res.Errors[0].Index)
+			assert.Equal(t, "notifications[1].priority", res.Errors[1].Field)
+			assert.Equal(t, "the priority must be high or normal", res.Errors[1].Reason)
+			assert.Equal(t, "notifications[2].platform", res.Errors[2].Field)
+			assert.Equal(t, 2, *res.Errors[2].Index)
+		})
+
+	r.POST("/api/push").
+		SetBody(`{"notifications":[{"tokens":"aaaaa","platform":2}]}`).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+			assert.Contains(t, r.Body.String(), `"field":"notifications[0].tokens"`)
+			assert.Contains(t, r.Body.String(), `"index":0`)
+		})
+}
+
+func TestCheckToken(t *testing.T) {
+	assert.NoError(t, checkToken(PlatFormIos, "0a1b2c3d"))
+	assert.EqualError(t, checkToken(PlatFormIos, "xyz"), "the token must be hexadecimal")
+	assert.EqualError(t, checkToken(PlatFormIos, " "), "the token must not be empty")
+	assert.NoError(t, checkToken(PlatFormAndroid, "dXz:APA91b-Hk_3"))
+	assert.EqualError(t, checkToken(PlatFormAndroid, "aaa bbb"), "the token has invalid characters")
+}
+
+func TestValidatePushHandler(t *testing.T) {
+	initTest()
+	PushConf.API.PushURI = "/push"
+	PushConf.Ios.Enabled = true
+	PushConf.Android.Enabled = true
+	PushConf.Web.Enabled = false
+
+	gofight.New().POST("/api/push/validate").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"0a1b2c", "bad token"},
+					"platform": PlatFormAndroid,
+					"message":  "Welcome",
+				},
+				{
+					"tokens":   []string{"0a1b2c", "xyz"},
+					"platform": PlatFormIos,
+					"message":  "Welcome",
+					"priority": "urgent",
+				},
+				{
+					"tokens":     []string{"0a1b2c", "0d1e2f"},
+					"platform":   PlatFormIos,
+					"token_data": gofight.D{"0a1b2c": gofight.D{"name": "Bob"}},
+					"template":   gofight.D{"body": "Hi {{.name}}"},
+				},
+				{
+					"platform": PlatFormWeb,
+					"message":  "Welcome",
+					"subscription": gofight.D{
+						"endpoint": "https://example.com/push",
+						"keys":     gofight.D{"auth": "auth", "p256dh": "p256dh"},
+					},
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			var res struct {
+				Counts struct {
+					Notifications int `json:"notifications"`
+					Valid         int `json:"valid"`
+					Invalid       int `json:"invalid"`
+					Recipients    int `json:"recipients"`
+					InvalidTokens int `json:"invalid_tokens"`
+				} `json:"counts"`
+				Platforms     map[string]PlatformReport `json:"platforms"`
+				Notifications []NotificationReport      `json:"notifications"`
+			}
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.NoError(t, json.Unmarshal(r.Body.Bytes(), &res))
+
+			assert.Equal(t, 4, res.Counts.Notifications)
+			assert.Equal(t, 2, res.Counts.Valid)
+			assert.Equal(t, 2, res.Counts.Invalid)
+			assert.Equal(t, 7, res.Counts.Recipients)
+			assert.Equal(t, 2, res.Counts.InvalidTokens)
+
+			android := res.Notifications[0]
+			assert.True(t, android.Valid)
+			assert.Equal(t, "android", android.Platform)
+			assert.Equal(t, []string{"bad token"}, android.InvalidTokens)
+			assert.Equal(t, PushConf.Android.MaxPayloadSize, android.PayloadLimit)
+			assert.True(t, android.PayloadSize > 0)
+
+			ios := res.Notifications[1]
+			assert.False(t, ios.Valid)
+			assert.Equal(t, []string{"xyz"}, ios.InvalidTokens)
+			assert.Equal(t, "notifications[1].priority", ios.Errors[0].Field)
+
+			// the largest payload rendered by template.
+			size, _ := GetPayloadSize(PushNotification{Platform: PlatFormIos, Message: "Hi Bob"})
+			assert.True(t, res.Notifications[2].Valid)
+			assert.Equal(t, size, res.Notifications[2].PayloadSize)
+
+			web := res.Notifications[3]
+			assert.False(t, web.Valid)
+			assert.Equal(t, "the web platform is not enabled", web.Errors[0].Reason)
+
+			assert.Equal(t, 2, len(res.Platforms))
+			assert.Equal(t, PlatformReport{Notifications: 1, Recipients: 2, PayloadSize: 2 * android.PayloadSize}, res.Platforms["android"])
+			assert.Equal(t, 1, res.Platforms["ios"].Notifications)
+		})
+
+	gofight.New().POST("/api/push/validate").
+		SetJSON(gofight.D{"notifications": []gofight.D{}}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+}
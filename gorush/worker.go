@@ -1,35 +1,268 @@
 package gorush
 
 import (
+	"context"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// workerCtx is cancelled by StopWorkers to abort pending retry of workers.
+var workerCtx, workerCancel = context.WithCancel(context.Background())
+
+// inFlight is the number of notifications which workers are sending.
+var inFlight int64
+
+// queuedByPlatform is the number of notifications of each platform waiting in
+// worker queues.
+var queuedByPlatform = map[int]*int64{
+	PlatFormIos:     new(int64),
+	PlatFormAndroid: new(int64),
+	PlatFormWeb:     new(int64),
+	PlatFormHuawei:  new(int64),
+	PlatFormSNS:     new(int64),
+}
+
+// workerPool is the workers taking notification from one queue.
+type workerPool struct {
+	sync.Mutex
+	queue chan PushNotification
+	stops []context.CancelFunc
+	// busy is the number of workers sending notification.
+	busy int64
+}
+
+// worker pools of common, iOS and Android queue, nil if the queue is not used.
+var commonWorkers, iosWorkers, androidWorkers *workerPool
+
+func newWorkerPool(queue chan PushNotification, workerNum int64) *workerPool {
+	p := &workerPool{queue: queue}
+	p.resize(workerNum)
+
+	return p
+}
+
+// resize start or stop workers to the number, the queue is kept. Stopped
+// worker still finishes the notification it is sending.
+func (p *workerPool) resize(workerNum int64) {
+	p.Lock()
+	defer p.Unlock()
+
+	for int64(len(p.stops)) < workerNum {
+		ctx, cancel := context.WithCancel(workerCtx)
+		p.stops = append(p.stops, cancel)
+		go startWorker(ctx, p)
+	}
+
+	for int64(len(p.stops)) > workerNum {
+		last := len(p.stops) - 1
+		p.stops[last]()
+		p.stops = p.stops[:last]
+	}
+}
+
+// size return the number of running workers.
+func (p *workerPool) size() int {
+	if p == nil {
+		return 0
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	return len(p.stops)
+}
+
+// busyCount return the number of workers sending notification.
+func (p *workerPool) busyCount() int64 {
+	if p == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&p.busy)
+}
+
 // InitWorkers for initialize all workers.
 func InitWorkers(workerNum int64, queueNum int64) {
 	LogAccess.Debug("worker number is ", workerNum, ", queue number is ", queueNum)
+	workerCtx, workerCancel = context.WithCancel(context.Background())
 	QueueNotification = make(chan PushNotification, queueNum)
-	for i := int64(0); i < workerNum; i++ {
-		go startWorker()
+	for _, count := range queuedByPlatform {
+		atomic.StoreInt64(count, 0)
+	}
+	commonWorkers = newWorkerPool(QueueNotification, workerNum)
+
+	// dedicated worker pool for each platform, default shares the common pool.
+	QueueIosNotification, iosWorkers = nil, nil
+	if PushConf.Core.IosWorkerNum > 0 {
+		LogAccess.Debug("iOS worker number is ", PushConf.Core.IosWorkerNum)
+		QueueIosNotification = make(chan PushNotification, queueNum)
+		iosWorkers = newWorkerPool(QueueIosNotification, PushConf.Core.IosWorkerNum)
+	}
+
+	QueueAndroidNotification, androidWorkers = nil, nil
+	if PushConf.Core.AndroidWorkerNum > 0 {
+		LogAccess.Debug("Android worker number is ", PushConf.Core.AndroidWorkerNum)
+		QueueAndroidNotification = make(chan PushNotification, queueNum)
+		androidWorkers = newWorkerPool(QueueAndroidNotification, PushConf.Core.AndroidWorkerNum)
+	}
+}
+
+// resizeWorkers change the number of workers to the config, notifications
+// in queues are kept. Dedicated pool can't be added or removed at runtime.
+func resizeWorkers() {
+	LogAccess.Debug("resize worker number to ", PushConf.Core.WorkerNum)
+	commonWorkers.resize(PushConf.Core.WorkerNum)
+	if iosWorkers != nil {
+		iosWorkers.resize(PushConf.Core.IosWorkerNum)
+	}
+	if androidWorkers != nil {
+		androidWorkers.resize(PushConf.Core.AndroidWorkerNum)
 	}
 }
 
+// StopWorkers cancel the worker context, workers stop taking notification from
+// queues and pending retry backoff returns immediately.
+func StopWorkers() {
+	workerCancel()
+}
+
 // SendNotification is send message to iOS or Android
 func SendNotification(msg PushNotification) {
+	if msg.canceled(msg.recipients()) {
+		msg.WaitDone()
+		return
+	}
+
+	if msg.expiredInQueue() {
+		expireNotification(msg)
+		return
+	}
+
+	if startCallback(&msg) {
+		defer finishCallback(msg)
+	}
+
+	if msg.Template != nil {
+		sendTemplateNotification(msg)
+		return
+	}
+
+	// the transform runs after template, so it sees the rendered title and
+	// message of each token.
+	transformed, err := transformNotification(msg)
+	if err != nil {
+		for _, token := range msg.recipients() {
+			failToken(token, msg, err)
+		}
+		if PushConf.Core.Sync {
+			msg.WaitDone()
+		}
+		return
+	}
+	msg = transformed
+
+	span := startDeliverySpan(msg)
+	var isError bool
 	switch msg.Platform {
 	case PlatFormIos:
-		PushToIOS(msg)
+		isError = PushToIOS(msg)
 	case PlatFormAndroid:
-		PushToAndroid(msg)
+		isError = PushToAndroid(msg)
+	case PlatFormWeb:
+		isError = PushToWeb(msg)
+	case PlatFormHuawei:
+		isError = PushToHuawei(msg)
+	case PlatFormSNS:
+		isError = PushToSNS(msg)
+	}
+	finishDeliverySpan(span, isError)
+}
+
+// expireNotification skip the notification picked up after its deadline_at,
+// so the stale content isn't sent.
+func expireNotification(msg PushNotification) {
+	defer msg.WaitDone()
+
+	recipients := msg.recipients()
+	msg.errorLog().Warnf("notification is expired in queue at %s, %d notifications are not sent",
+		time.Unix(msg.DeadlineAt, 0).Format(time.RFC3339), len(recipients))
+	expiredCounter.WithLabelValues(typeForPlatForm(msg.Platform)).Add(float64(len(recipients)))
+
+	for _, token := range recipients {
+		addFeedback(ExpiredInQueuePush, token, msg, errExpiredInQueue, "")
+		if PushConf.Core.Sync {
+			msg.AddLog(getLogPushEntry(ExpiredInQueuePush, token, msg, errExpiredInQueue))
+		}
 	}
 }
 
-func startWorker() {
+func startWorker(ctx context.Context, p *workerPool) {
 	for {
-		notification := <-QueueNotification
-		SendNotification(notification)
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-p.queue:
+			countQueued(notification.Platform, -1)
+			dequeuedCounter.WithLabelValues(typeForPlatForm(notification.Platform)).Inc()
+			atomic.AddInt64(&inFlight, 1)
+			atomic.AddInt64(&p.busy, 1)
+			SendNotification(notification)
+			atomic.AddInt64(&p.busy, -1)
+			atomic.AddInt64(&inFlight, -1)
+		}
 	}
 }
 
+// queueForPlatform return the worker queue which handles the platform.
+func queueForPlatform(platform int) chan PushNotification {
+	switch platform {
+	case PlatFormIos:
+		if QueueIosNotification != nil {
+			return QueueIosNotification
+		}
+	case PlatFormAndroid:
+		if QueueAndroidNotification != nil {
+			return QueueAndroidNotification
+		}
+	}
+
+	return QueueNotification
+}
+
+// queueCapacity return max capacity of all worker queues.
+func queueCapacity() int {
+	return cap(QueueNotification) + cap(QueueIosNotification) + cap(QueueAndroidNotification)
+}
+
+// countQueued add delta to the number of queued notifications of platform.
+func countQueued(platform int, delta int64) {
+	if count, ok := queuedByPlatform[platform]; ok {
+		atomic.AddInt64(count, delta)
+	}
+}
+
+// queueDepth return the number of queued notifications of platform.
+func queueDepth(platform int) int64 {
+	count, ok := queuedByPlatform[platform]
+	if !ok {
+		return 0
+	}
+
+	// notification put into queue without tryEnqueue isn't counted.
+	if n := atomic.LoadInt64(count); n > 0 {
+		return n
+	}
+
+	return 0
+}
+
+// queueUsage return current length of all worker queues.
+func queueUsage() int {
+	return len(QueueNotification) + len(QueueIosNotification) + len(QueueAndroidNotification)
+}
+
 // queueNotification add notification to queue list.
 func queueNotification(req RequestPush) (int, []LogPushEntry) {
 	var count int
@@ -37,51 +270,235 @@ func queueNotification(req RequestPush) (int, []LogPushEntry) {
 	newNotification := []*PushNotification{}
 	for i := range req.Notifications {
 		notification := &req.Notifications[i]
-		switch notification.Platform {
-		case PlatFormIos:
-			if !PushConf.Ios.Enabled {
-				continue
-			}
-		case PlatFormAndroid:
-			if !PushConf.Android.Enabled {
-				continue
-			}
+		notification.jobID = req.jobID
+		notification.requestID = req.requestID
+		notification.traceParent = req.traceParent
+		if PushConf.Core.Sync {
+			notification.ctx = req.ctx
+		}
+		if !platformEnabled(notification.Platform) {
+			continue
 		}
 		newNotification = append(newNotification, notification)
 	}
 
-	log := make([]LogPushEntry, 0, count)
+	duplicates := []LogPushEntry{}
+	if PushConf.Core.Dedup {
+		newNotification, duplicates = dedupNotifications(newNotification)
+	}
+
+	if PushConf.Core.DryRun || req.DryRun {
+		if req.results != nil {
+			return dryRunResults(newNotification, req.results), duplicates
+		}
+		count, log := dryRunNotification(newNotification)
+		return count, append(log, duplicates...)
+	}
+
+	log := duplicates
 	for _, notification := range newNotification {
-		if PushConf.Core.Sync {
-			notification.wg = &wg
-			notification.log = &log
-			notification.AddWaitCount()
+		var recipients int
+		if req.results != nil {
+			recipients = enqueueResult(notification, 0, &wg, req.results)
+		} else {
+			recipients = enqueueNotification(notification, &wg, &log)
 		}
-		if !tryEnqueue(*notification, QueueNotification) {
-			LogError.Error("max capacity reached")
+		tokensPerNotification.WithLabelValues(typeForPlatForm(notification.Platform)).Observe(float64(recipients))
+		count += recipients
+	}
+
+	StatStorage.AddTotalCount(int64(count))
+
+	if req.results != nil {
+		// the results of timed out request are not sent, so it's not blocked.
+		wg.Wait()
+		return count, log
+	}
+
+	if PushConf.Core.Sync && !waitNotifications(req.ctx, &wg) {
+		// the log is still written by workers of timed out request.
+		return count, nil
+	}
+
+	return count, log
+}
+
+// QueueRequest validate notifications and add them to queue list the same as
+// push API, for the requests of other transport like gRPC. Return the count
+// and push logs, or FieldError of the first invalid notification.
+func QueueRequest(ctx context.Context, notifications []PushNotification) (int, []LogPushEntry, error) {
+	return queueRequest(ctx, RequestPush{Notifications: notifications})
+}
+
+// queueRequest validate and queue the notifications of push request.
+func queueRequest(ctx context.Context, form RequestPush) (int, []LogPushEntry, error) {
+	if isShuttingDown() {
+		return 0, nil, ErrShuttingDown
+	}
+
+	notifications := form.Notifications
+	if int64(len(notifications)) > PushConf.Core.MaxNotification {
+		msg := fmt.Sprintf("Number of notifications(%d) over limit(%d)", len(notifications), PushConf.Core.MaxNotification)
+		return 0, nil, FieldError{Field: "notifications", Reason: msg}
+	}
+
+	req := RequestPush{DryRun: form.DryRun, ctx: ctx, requestID: newRequestID()}
+	for i := range notifications {
+		parts, err := expandNotification(notifications[i])
+		if err != nil {
+			index := i
+			return 0, nil, FieldError{Field: fmt.Sprintf("notifications[%d].tokens", i), Index: &index, Reason: err.Error()}
 		}
-		count += len(notification.Tokens)
-		// Count topic message
-		if notification.To != "" {
-			count++
+
+		for j := range parts {
+			if errs := notificationErrors(i, parts[j]); len(errs) > 0 {
+				return 0, nil, errs[0]
+			}
 		}
+		req.Notifications = append(req.Notifications, parts...)
+	}
+
+	count, log := queueNotification(req)
+
+	return count, log, nil
+}
+
+// platformEnabled check if the platform of notification is enabled in config.
+func platformEnabled(platform int) bool {
+	switch platform {
+	case PlatFormIos:
+		return PushConf.Ios.Enabled
+	case PlatFormAndroid:
+		return PushConf.Android.Enabled
+	case PlatFormWeb:
+		return PushConf.Web.Enabled
+	case PlatFormHuawei:
+		return PushConf.Huawei.Enabled
+	case PlatFormSNS:
+		return PushConf.SNS.Enabled
+	}
+
+	return true
+}
+
+// enqueueNotification add notification to worker queue, tokens of dropped
+// notification are added to log. Return the count of recipients.
+func enqueueNotification(notification *PushNotification, wg *sync.WaitGroup, log *[]LogPushEntry) int {
+	if isScheduled(*notification) {
+		return scheduleRecipients(notification, log)
 	}
 
 	if PushConf.Core.Sync {
-		wg.Wait()
+		notification.wg = wg
+		notification.log = log
+		notification.AddWaitCount()
+	}
+	// sync mode waits for the result in this process, so uses local queue.
+	// The clients of request credentials are only cached in this process.
+	if SharedQueue != nil && !PushConf.Core.Sync && notification.credential == "" {
+		if err := SharedQueue.Push(*notification); err != nil {
+			notification.errorLog().Error("queue error: " + err.Error())
+			for _, token := range notification.recipients() {
+				appendLog(log, getLogPushEntry(DroppedPush, token, *notification, err))
+			}
+		}
+
+		return len(notification.recipients())
 	}
 
-	StatStorage.AddTotalCount(int64(count))
+	if status, err := enqueueLocal(*notification); status != "" {
+		if status == DroppedPush {
+			notification.errorLog().Error(err.Error())
+		}
+		notification.WaitDone()
+		// report dropped or overflow tokens back to client whatever sync mode is.
+		for _, token := range notification.recipients() {
+			entry := getLogPushEntry(status, token, *notification, err)
+			entry.Outcome = queueFullPolicy()
+			appendLog(log, entry)
+		}
+	}
+
+	// Count tokens, topic message and web subscription
+	return len(notification.recipients())
+}
+
+// scheduleRecipients save notification until its send_at, the tokens are
+// added to log with id of scheduled notification. Return the count of
+// recipients.
+func scheduleRecipients(notification *PushNotification, log *[]LogPushEntry) int {
+	status := ScheduledPush
+	id, err := scheduleNotification(*notification)
+	if err != nil {
+		notification.errorLog().Error("schedule error: " + err.Error())
+		status = DroppedPush
+	}
+
+	for _, token := range notification.recipients() {
+		entry := getLogPushEntry(status, token, *notification, err)
+		entry.ScheduleID = id
+		appendLog(log, entry)
+	}
+
+	return len(notification.recipients())
+}
+
+// dryRunNotification validate notifications and record what would have been
+// sent without contacting APNs or FCM.
+func dryRunNotification(notifications []*PushNotification) (int, []LogPushEntry) {
+	var count int
+	log := []LogPushEntry{}
+	for _, notification := range notifications {
+		tokens := notification.recipients()
+		count += len(tokens)
+
+		err := CheckMessage(*notification)
+		size := 0
+		if err == nil {
+			size, err = GetPayloadSize(*notification)
+		}
+
+		for _, token := range tokens {
+			if err != nil {
+				log = append(log, getLogPushEntry(FailedPush, token, *notification, err))
+				continue
+			}
+
+			entry := getLogPushEntry(DryRunPush, token, *notification, nil)
+			entry.Outcome = "dry_run"
+			entry.PayloadSize = size
+			log = append(log, entry)
+		}
+	}
 
 	return count, log
 }
 
+// countDropped return the number of dropped tokens in push logs.
+func countDropped(logs []LogPushEntry) int {
+	return countLogType(logs, DroppedPush)
+}
+
+// countLogType return the number of tokens of log type in push logs.
+func countLogType(logs []LogPushEntry, status string) int {
+	var count int
+	for _, log := range logs {
+		if log.Type == status {
+			count++
+		}
+	}
+
+	return count
+}
+
 // tryEnqueue tries to enqueue a job to the given job channel. Returns true if
 // the operation was successful, and false if enqueuing would not have been
 // possible without blocking. Job is not enqueued in the latter case.
 func tryEnqueue(job PushNotification, jobChan chan<- PushNotification) bool {
 	select {
 	case jobChan <- job:
+		countQueued(job.Platform, 1)
+		enqueuedCounter.WithLabelValues(typeForPlatForm(job.Platform)).Inc()
 		return true
 	default:
 		return false
@@ -1,8 +1,14 @@
 package gorush
 
 import (
+	"net/http"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/appleboy/gorush/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,3 +21,212 @@ func TestTryEnqueue(t *testing.T) {
 	assert.False(t, tryEnqueue(PushNotification{}, chn))
 	assert.Equal(t, 2, len(chn))
 }
+
+func TestQueueForPlatform(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	InitWorkers(0, 2)
+	assert.Nil(t, QueueIosNotification)
+	assert.Nil(t, QueueAndroidNotification)
+	assert.Equal(t, QueueNotification, queueForPlatform(PlatFormIos))
+	assert.Equal(t, QueueNotification, queueForPlatform(PlatFormAndroid))
+
+	PushConf.Core.IosWorkerNum = 1
+	PushConf.Core.AndroidWorkerNum = 1
+	InitWorkers(0, 2)
+	assert.Equal(t, QueueIosNotification, queueForPlatform(PlatFormIos))
+	assert.Equal(t, QueueAndroidNotification, queueForPlatform(PlatFormAndroid))
+	assert.Equal(t, 6, queueCapacity())
+
+	// restore default workers
+	PushConf, _ = config.LoadConf("")
+	InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+}
+
+func TestDroppedNotifications(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	// no worker consumes the queue.
+	InitWorkers(0, 1)
+
+	req := RequestPush{
+		Notifications: []PushNotification{
+			{
+				Tokens:   []string{"aaaaa"},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+			},
+			{
+				Tokens:   []string{"bbbbb", "ccccc"},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+			},
+		},
+	}
+
+	count, logs := queueNotification(req)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 2, len(logs))
+	assert.Equal(t, 2, countDropped(logs))
+
+	// restore default workers
+	PushConf, _ = config.LoadConf("")
+	InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+}
+
+func TestDryRunNotifications(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	PushConf.Ios.Enabled = true
+	// no worker consumes the queue, dry run never enqueue.
+	InitWorkers(0, 1)
+
+	req := RequestPush{
+		DryRun: true,
+		Notifications: []PushNotification{
+			{
+				Tokens:   []string{"aaaaa", "bbbbb"},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+			},
+			{
+				Tokens:   []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
+				Platform: PlatFormIos,
+				Message:  "Welcome",
+			},
+			{
+				Tokens:   []string{""},
+				Platform: PlatFormIos,
+				Message:  "Welcome",
+			},
+		},
+	}
+
+	count, logs := queueNotification(req)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, 4, len(logs))
+	assert.Equal(t, 0, len(QueueNotification))
+	for _, log := range logs[:3] {
+		assert.Equal(t, DryRunPush, log.Type)
+		assert.Equal(t, "dry_run", log.Outcome)
+		assert.True(t, log.PayloadSize > 0)
+	}
+	assert.Equal(t, FailedPush, logs[3].Type)
+	assert.Equal(t, "the token must not be empty", logs[3].Error)
+
+	// restore default workers
+	PushConf, _ = config.LoadConf("")
+	InitWorkers(PushConf.Core.WorkerNum, PushConf.Core.QueueNum)
+}
+
+func TestDedupNotifications(t *testing.T) {
+	PushConf, _ = config.LoadConf("")
+	PushConf.Android.Enabled = true
+	PushConf.Ios.Enabled = true
+	PushConf.Core.Dedup = true
+	PushConf.Log.HideToken = false
+
+	req := RequestPush{
+		DryRun: true,
+		Notifications: []PushNotification{
+			{
+				Tokens:   []string{"aaaaa", "bbbbb", "aaaaa"},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+			},
+			// same payload.
+			{
+				Tokens:   []string{"bbbbb"},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+			},
+			// different payload.
+			{
+				Tokens:   []string{"aaaaa"},
+				Platform: PlatFormAndroid,
+				Message:  "Goodbye",
+			},
+			// different platform.
+			{
+				Tokens:   []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
+				Platform: PlatFormIos,
+				Message:  "Welcome",
+			},
+		},
+	}
+
+	count, logs := queueNotification(req)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, 2, countDuplicates(logs))
+	assert.Equal(t, DuplicatePush, logs[len(logs)-1].Type)
+	assert.Equal(t, "bbbbb", logs[len(logs)-1].Token)
+	assert.Equal(t, []string{"aaaaa", "bbbbb"}, req.Notifications[0].Tokens)
+
+	// disabled.
+	PushConf.Core.Dedup = false
+	req.Notifications[0].Tokens = []string{"aaaaa", "aaaaa"}
+	req.Notifications[1].Tokens = []string{"bbbbb"}
+	count, logs = queueNotification(req)
+	assert.Equal(t, 5, count)
+	assert.Equal(t, 0, countDuplicates(logs))
+}
+
+func TestCheckDeadlineAt(t *testing.T) {
+	now := time.Now().Unix()
+	assert.NoError(t, checkDeadlineAt(PushNotification{}))
+	assert.NoError(t, checkDeadlineAt(PushNotification{DeadlineAt: now + 60}))
+	assert.NoError(t, checkDeadlineAt(PushNotification{DeadlineAt: now + 60, SendAt: now + 30}))
+
+	assert.EqualError(t, checkDeadlineAt(PushNotification{DeadlineAt: now - 1}), "the deadline_at must be later than now")
+	assert.EqualError(t, checkDeadlineAt(PushNotification{DeadlineAt: -1}), "the deadline_at must be later than now")
+	assert.EqualError(t, checkDeadlineAt(PushNotification{DeadlineAt: now + 60, SendAt: now + 60}), "the deadline_at must be later than send_at")
+}
+
+func TestExpiredInQueue(t *testing.T) {
+	sent := 0
+	cleanup := testSNSServer(t, func(arn string, message map[string]string) (int, string) {
+		sent++
+		return http.StatusOK, snsPublished("message-id")
+	})
+	defer cleanup()
+	PushConf.Core.Sync = true
+
+	expired := func() float64 {
+		return testutil.ToFloat64(expiredCounter.WithLabelValues("sns"))
+	}
+	before := expired()
+
+	var log []LogPushEntry
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	SendNotification(PushNotification{
+		Platform:   PlatFormSNS,
+		Tokens:     []string{snsIOSEndpoint, snsAndroidEndpoint},
+		Message:    "Goal! 1-0",
+		DeadlineAt: time.Now().Add(-time.Minute).Unix(),
+		wg:         wg,
+		log:        &log,
+	})
+	wg.Wait()
+
+	assert.Equal(t, 0, sent)
+	assert.Equal(t, before+2, expired())
+	if assert.Equal(t, 2, len(log)) {
+		assert.Equal(t, ExpiredInQueuePush, log[0].Type)
+		assert.Equal(t, "notification is expired in queue", log[0].Error)
+	}
+
+	// the notification before deadline is sent.
+	log = nil
+	wg.Add(1)
+	SendNotification(PushNotification{
+		Platform:   PlatFormSNS,
+		Tokens:     []string{snsIOSEndpoint},
+		Message:    "Goal! 1-0",
+		DeadlineAt: time.Now().Add(time.Minute).Unix(),
+		wg:         wg,
+		log:        &log,
+	})
+	wg.Wait()
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, before+2, expired())
+}
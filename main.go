@@ -6,8 +6,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
+	"syscall"
 
 	"github.com/appleboy/gorush/config"
 	"github.com/appleboy/gorush/gorush"
@@ -73,59 +75,76 @@ func main() {
 
 	var err error
 
-	// set default parameters.
-	gorush.PushConf, err = config.LoadConf(configFile)
-	if err != nil {
-		log.Printf("Load yaml config file error: '%v'", err)
+	// load config file and overwrite it with command line options, it is
+	// also used to reload config at runtime.
+	gorush.ConfLoader = func() (config.ConfYaml, error) {
+		conf, err := config.LoadConf(configFile)
+		if err != nil {
+			return conf, err
+		}
 
-		return
-	}
+		if opts.Ios.KeyPath != "" {
+			conf.Ios.KeyPath = opts.Ios.KeyPath
+		}
 
-	if opts.Ios.KeyPath != "" {
-		gorush.PushConf.Ios.KeyPath = opts.Ios.KeyPath
-	}
+		if opts.Ios.Password != "" {
+			conf.Ios.Password = opts.Ios.Password
+		}
 
-	if opts.Ios.Password != "" {
-		gorush.PushConf.Ios.Password = opts.Ios.Password
-	}
+		if opts.Android.APIKey != "" {
+			conf.Android.APIKey = opts.Android.APIKey
+			// api key is only supported by legacy API.
+			conf.Android.APIVersion = "legacy"
+		}
 
-	if opts.Android.APIKey != "" {
-		gorush.PushConf.Android.APIKey = opts.Android.APIKey
-	}
+		if opts.Stat.Engine != "" {
+			conf.Stat.Engine = opts.Stat.Engine
+		}
 
-	if opts.Stat.Engine != "" {
-		gorush.PushConf.Stat.Engine = opts.Stat.Engine
-	}
+		if opts.Stat.Redis.Addr != "" {
+			conf.Stat.Redis.Addr = opts.Stat.Redis.Addr
+		}
 
-	if opts.Stat.Redis.Addr != "" {
-		gorush.PushConf.Stat.Redis.Addr = opts.Stat.Redis.Addr
-	}
+		// overwrite server port and address
+		if opts.Core.Port != "" {
+			conf.Core.Port = opts.Core.Port
+		}
+		if opts.Core.Address != "" {
+			conf.Core.Address = opts.Core.Address
+		}
+
+		// key and credential can be references of secrets manager.
+		if err := gorush.ResolveSecrets(&conf); err != nil {
+			return conf, err
+		}
 
-	// overwrite server port and address
-	if opts.Core.Port != "" {
-		gorush.PushConf.Core.Port = opts.Core.Port
+		return conf, nil
 	}
-	if opts.Core.Address != "" {
-		gorush.PushConf.Core.Address = opts.Core.Address
+
+	// set default parameters.
+	gorush.PushConf, err = gorush.ConfLoader()
+	if err != nil {
+		log.Printf("Load yaml config file error: '%v'", err)
+
+		return
 	}
 
 	if err = gorush.InitLog(); err != nil {
 		log.Fatalf("Can't load log module, error: %v", err)
 	}
 
-	// set http proxy for GCM
+	// set proxy of push providers
 	if proxy != "" {
 		err = gorush.SetProxy(proxy)
+	} else {
+		err = gorush.InitProxy()
+	}
+	if err != nil {
+		gorush.LogError.Fatalf("Set Proxy error: %v", err)
+	}
 
-		if err != nil {
-			gorush.LogError.Fatalf("Set Proxy error: %v", err)
-		}
-	} else if gorush.PushConf.Core.HTTPProxy != "" {
-		err = gorush.SetProxy(gorush.PushConf.Core.HTTPProxy)
-
-		if err != nil {
-			gorush.LogError.Fatalf("Set Proxy error: %v", err)
-		}
+	if err = gorush.InitJWTAuth(); err != nil {
+		gorush.LogError.Fatalf("Init JWT auth error: %v", err)
 	}
 
 	if ping {
@@ -229,21 +248,71 @@ func main() {
 	}
 
 	gorush.InitWorkers(gorush.PushConf.Core.WorkerNum, gorush.PushConf.Core.QueueNum)
+	gorush.InitAutoscale()
+	if err = gorush.InitQueue(); err != nil {
+		gorush.LogError.Fatal(err)
+	}
+	if err = gorush.InitQueueFullPolicy(); err != nil {
+		gorush.LogError.Fatal(err)
+	}
+	gorush.InitSchedule()
+	gorush.InitJobSweeper()
+	if err = gorush.InitFeedback(); err != nil {
+		gorush.LogError.Fatal(err)
+	}
+	if err = gorush.InitTransform(); err != nil {
+		gorush.LogError.Fatal(err)
+	}
+	gorush.InitCallback()
+	gorush.InitTracing()
+	gorush.InitAlert()
+	gorush.InitInvalidTokens()
+	if err = gorush.InitDeadLetter(); err != nil {
+		gorush.LogError.Fatal(err)
+	}
+	gorush.RestoreQueue()
+	if err = gorush.InitInbound(); err != nil {
+		gorush.LogError.Fatal(err)
+	}
 
 	var g errgroup.Group
 
-	g.Go(gorush.InitAPNSClient)
+	if gorush.PushConf.Core.ValidateOnStart.Enabled {
+		// clients are initialized and checked before serving.
+		if err = gorush.ValidateOnStart(); err != nil {
+			gorush.LogError.Fatal(err)
+		}
+	} else {
+		g.Go(gorush.InitAPNSClient)
 
-	g.Go(func() error {
-		_, err := gorush.InitFCMClient(gorush.PushConf.Android.APIKey)
-		return err
-	})
+		g.Go(gorush.InitFCM)
+	}
 
 	g.Go(gorush.RunHTTPServer) // Run httpd server
 	g.Go(rpc.RunGRPCServer)    // Run gRPC internal server
 
-	if err = g.Wait(); err != nil {
-		gorush.LogError.Fatal(err)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- g.Wait()
+	}()
+
+	// graceful shutdown on SIGINT or SIGTERM
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err = <-serverErr:
+		if err != nil {
+			gorush.LogError.Fatal(err)
+		}
+	case <-quit:
+		if err = gorush.Shutdown(); err != nil {
+			gorush.LogError.Fatal(err)
+		}
+	case <-gorush.DrainRequested():
+		if err = gorush.Shutdown(); err != nil {
+			gorush.LogError.Fatal(err)
+		}
 	}
 }
 
@@ -268,7 +337,7 @@ Server Options:
     -t, --token <token>              Notification token
     -e, --engine <engine>            Storage engine (memory, redis ...)
     --title <title>                  Notification title
-    --proxy <proxy>                  Proxy URL (only for GCM)
+    --proxy <proxy>                  Proxy URL of APNs, FCM and web push
     --pid <pid path>                 Process identifier path
     --redis-addr <redis addr>        Redis addr (default: localhost:6379)
     --ping                           healthy check command for container
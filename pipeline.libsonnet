@@ -114,6 +114,11 @@
         name: 'redis',
         image: 'redis',
       },
+      {
+        name: 'nats',
+        image: 'nats:2.2',
+        command: ['-js'],
+      },
     ],
   },
 
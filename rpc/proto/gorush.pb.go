@@ -48,7 +48,7 @@ func (x HealthCheckResponse_ServingStatus) String() string {
 }
 
 func (HealthCheckResponse_ServingStatus) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_40935fa25e258221, []int{4, 0}
+	return fileDescriptor_40935fa25e258221, []int{5, 0}
 }
 
 type Alert struct {
@@ -177,6 +177,7 @@ type NotificationRequest struct {
 	ThreadID             string          `protobuf:"bytes,12,opt,name=threadID,proto3" json:"threadID,omitempty"`
 	MutableContent       bool            `protobuf:"varint,13,opt,name=mutableContent,proto3" json:"mutableContent,omitempty"`
 	Data                 *_struct.Struct `protobuf:"bytes,14,opt,name=data,proto3" json:"data,omitempty"`
+	ClearBadge           bool            `protobuf:"varint,15,opt,name=clearBadge,proto3" json:"clearBadge,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
 	XXX_unrecognized     []byte          `json:"-"`
 	XXX_sizecache        int32           `json:"-"`
@@ -305,19 +306,98 @@ func (m *NotificationRequest) GetData() *_struct.Struct {
 	return nil
 }
 
-type NotificationReply struct {
-	Success              bool     `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
-	Counts               int32    `protobuf:"varint,2,opt,name=counts,proto3" json:"counts,omitempty"`
+func (m *NotificationRequest) GetClearBadge() bool {
+	if m != nil {
+		return m.ClearBadge
+	}
+	return false
+}
+
+type PushResult struct {
+	Type                 string   `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Platform             string   `protobuf:"bytes,2,opt,name=platform,proto3" json:"platform,omitempty"`
+	Token                string   `protobuf:"bytes,3,opt,name=token,proto3" json:"token,omitempty"`
+	Message              string   `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	Error                string   `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
+func (m *PushResult) Reset()         { *m = PushResult{} }
+func (m *PushResult) String() string { return proto.CompactTextString(m) }
+func (*PushResult) ProtoMessage()    {}
+func (*PushResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_40935fa25e258221, []int{2}
+}
+
+func (m *PushResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PushResult.Unmarshal(m, b)
+}
+func (m *PushResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PushResult.Marshal(b, m, deterministic)
+}
+func (m *PushResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PushResult.Merge(m, src)
+}
+func (m *PushResult) XXX_Size() int {
+	return xxx_messageInfo_PushResult.Size(m)
+}
+func (m *PushResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_PushResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PushResult proto.InternalMessageInfo
+
+func (m *PushResult) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *PushResult) GetPlatform() string {
+	if m != nil {
+		return m.Platform
+	}
+	return ""
+}
+
+func (m *PushResult) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *PushResult) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *PushResult) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type NotificationReply struct {
+	Success              bool          `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Counts               int32         `protobuf:"varint,2,opt,name=counts,proto3" json:"counts,omitempty"`
+	Logs                 []*PushResult `protobuf:"bytes,3,rep,name=logs,proto3" json:"logs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
 func (m *NotificationReply) Reset()         { *m = NotificationReply{} }
 func (m *NotificationReply) String() string { return proto.CompactTextString(m) }
 func (*NotificationReply) ProtoMessage()    {}
 func (*NotificationReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_40935fa25e258221, []int{2}
+	return fileDescriptor_40935fa25e258221, []int{3}
 }
 
 func (m *NotificationReply) XXX_Unmarshal(b []byte) error {
@@ -352,6 +432,13 @@ func (m *NotificationReply) GetCounts() int32 {
 	return 0
 }
 
+func (m *NotificationReply) GetLogs() []*PushResult {
+	if m != nil {
+		return m.Logs
+	}
+	return nil
+}
+
 type HealthCheckRequest struct {
 	Service              string   `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -363,7 +450,7 @@ func (m *HealthCheckRequest) Reset()         { *m = HealthCheckRequest{} }
 func (m *HealthCheckRequest) String() string { return proto.CompactTextString(m) }
 func (*HealthCheckRequest) ProtoMessage()    {}
 func (*HealthCheckRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_40935fa25e258221, []int{3}
+	return fileDescriptor_40935fa25e258221, []int{4}
 }
 
 func (m *HealthCheckRequest) XXX_Unmarshal(b []byte) error {
@@ -402,7 +489,7 @@ func (m *HealthCheckResponse) Reset()         { *m = HealthCheckResponse{} }
 func (m *HealthCheckResponse) String() string { return proto.CompactTextString(m) }
 func (*HealthCheckResponse) ProtoMessage()    {}
 func (*HealthCheckResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_40935fa25e258221, []int{4}
+	return fileDescriptor_40935fa25e258221, []int{5}
 }
 
 func (m *HealthCheckResponse) XXX_Unmarshal(b []byte) error {
@@ -434,6 +521,7 @@ func init() {
 	proto.RegisterEnum("proto.HealthCheckResponse_ServingStatus", HealthCheckResponse_ServingStatus_name, HealthCheckResponse_ServingStatus_value)
 	proto.RegisterType((*Alert)(nil), "proto.Alert")
 	proto.RegisterType((*NotificationRequest)(nil), "proto.NotificationRequest")
+	proto.RegisterType((*PushResult)(nil), "proto.PushResult")
 	proto.RegisterType((*NotificationReply)(nil), "proto.NotificationReply")
 	proto.RegisterType((*HealthCheckRequest)(nil), "proto.HealthCheckRequest")
 	proto.RegisterType((*HealthCheckResponse)(nil), "proto.HealthCheckResponse")
@@ -442,45 +530,51 @@ func init() {
 func init() { proto.RegisterFile("gorush.proto", fileDescriptor_40935fa25e258221) }
 
 var fileDescriptor_40935fa25e258221 = []byte{
-	// 607 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x54, 0x4f, 0x6f, 0xd3, 0x4e,
-	0x10, 0xad, 0x9b, 0x38, 0x4d, 0x26, 0x69, 0x7f, 0xf9, 0x6d, 0x11, 0x2c, 0x11, 0x87, 0xc8, 0x07,
-	0x14, 0x81, 0xe4, 0x4a, 0xe5, 0xc6, 0xa1, 0xa2, 0x2a, 0x55, 0x5b, 0x15, 0xb9, 0x92, 0xc3, 0x9f,
-	0x23, 0x5a, 0xaf, 0xb7, 0x8e, 0xd5, 0x8d, 0xd7, 0x78, 0xd7, 0x95, 0xf2, 0x39, 0xf8, 0x08, 0xdc,
-	0xf8, 0x94, 0x68, 0x67, 0xed, 0x90, 0x40, 0x38, 0x65, 0xdf, 0x9b, 0x99, 0xb7, 0x6f, 0x67, 0x26,
-	0x86, 0x51, 0xa6, 0xaa, 0x5a, 0x2f, 0xc2, 0xb2, 0x52, 0x46, 0x11, 0x1f, 0x7f, 0x26, 0x2f, 0x32,
-	0xa5, 0x32, 0x29, 0x4e, 0x10, 0x25, 0xf5, 0xfd, 0x89, 0x36, 0x55, 0xcd, 0x8d, 0x4b, 0x0a, 0x7e,
-	0xec, 0x83, 0x7f, 0x2e, 0x45, 0x65, 0xc8, 0x13, 0xf0, 0x4d, 0x6e, 0xa4, 0xa0, 0xde, 0xd4, 0x9b,
-	0x0d, 0x62, 0x07, 0x08, 0x81, 0x6e, 0xa2, 0xd2, 0x15, 0xdd, 0x47, 0x12, 0xcf, 0x64, 0x02, 0x7d,
-	0x5d, 0x27, 0x2e, 0xb9, 0x83, 0xfc, 0x1a, 0x93, 0xa7, 0xd0, 0x63, 0xdc, 0xe4, 0xaa, 0xa0, 0x5d,
-	0x8c, 0x34, 0x88, 0x04, 0x30, 0x72, 0xa7, 0x0f, 0x8a, 0xdf, 0x8a, 0x15, 0xf5, 0x31, 0xba, 0xc5,
-	0x91, 0x29, 0x0c, 0x25, 0xab, 0x0b, 0xbe, 0xb8, 0x59, 0xb2, 0x4c, 0xd0, 0x1e, 0xa6, 0x6c, 0x52,
-	0x56, 0x5d, 0xba, 0xfa, 0x03, 0xa7, 0x2e, 0xd7, 0x95, 0x78, 0x7d, 0x23, 0xde, 0x77, 0x95, 0x1b,
-	0x14, 0xa1, 0x70, 0x20, 0x15, 0x3f, 0xaf, 0x32, 0x4d, 0x07, 0xd3, 0xce, 0x6c, 0x10, 0xb7, 0xd0,
-	0x3a, 0x6b, 0x13, 0x31, 0x0c, 0x18, 0xde, 0xe2, 0x82, 0x9f, 0x1d, 0x38, 0x8e, 0x94, 0xc9, 0xef,
-	0x73, 0xce, 0xac, 0xe1, 0x58, 0x7c, 0xab, 0x85, 0x36, 0xd6, 0x8f, 0x51, 0x0f, 0xa2, 0xd0, 0xd4,
-	0xc3, 0xaa, 0x06, 0xd9, 0x0e, 0x95, 0x92, 0x99, 0x7b, 0x55, 0x2d, 0xb1, 0x73, 0x7e, 0xbc, 0xc6,
-	0xd6, 0xc9, 0x52, 0x68, 0x6d, 0x5f, 0xe8, 0x9a, 0xd7, 0xc2, 0xdf, 0x13, 0xe8, 0x6e, 0x4e, 0xc0,
-	0xb2, 0xaa, 0xcc, 0x79, 0xd3, 0x32, 0x07, 0xc8, 0x18, 0x3a, 0x0f, 0x62, 0xd5, 0xf4, 0xc8, 0x1e,
-	0x6d, 0x5e, 0xc2, 0xd2, 0x4c, 0x60, 0x6b, 0xfc, 0xd8, 0x01, 0xeb, 0x84, 0x33, 0x23, 0x32, 0x55,
-	0xb5, 0x6d, 0x59, 0x63, 0x12, 0x80, 0xcf, 0xec, 0xe8, 0xe9, 0x60, 0xea, 0xcd, 0x86, 0xa7, 0x23,
-	0xb7, 0x12, 0x21, 0xae, 0x43, 0xec, 0x42, 0x56, 0x55, 0xab, 0xba, 0x48, 0x29, 0xb8, 0xdb, 0x11,
-	0x90, 0x57, 0x30, 0xe6, 0xaa, 0x30, 0xa2, 0x30, 0xe7, 0x8f, 0x2c, 0x97, 0x2c, 0x91, 0x82, 0x0e,
-	0xa7, 0xde, 0xac, 0x1f, 0xff, 0xc5, 0x5b, 0x07, 0x66, 0x51, 0x09, 0x96, 0xde, 0xbc, 0xa7, 0x23,
-	0xe7, 0xa0, 0xc5, 0xe4, 0x25, 0x1c, 0x2d, 0x6b, 0x63, 0xd3, 0x2e, 0x5c, 0x19, 0x3d, 0x44, 0x95,
-	0x3f, 0x58, 0xf2, 0x1a, 0xba, 0x29, 0x33, 0x8c, 0x1e, 0xa1, 0xd1, 0x67, 0xa1, 0x5b, 0xe9, 0xb0,
-	0x5d, 0xe9, 0x70, 0x8e, 0x2b, 0x1d, 0x63, 0x52, 0x70, 0x09, 0xff, 0x6f, 0xcf, 0xaa, 0x94, 0x38,
-	0x7f, 0x5d, 0x73, 0x2e, 0xb4, 0xc6, 0xfd, 0xee, 0xc7, 0x2d, 0xb4, 0x33, 0xe4, 0xaa, 0x2e, 0x8c,
-	0x6e, 0x26, 0xd5, 0xa0, 0x20, 0x04, 0x72, 0x2d, 0x98, 0x34, 0x8b, 0x8b, 0x85, 0xe0, 0x0f, 0xed,
-	0xc4, 0xad, 0x8e, 0xa8, 0x1e, 0x73, 0xde, 0xfe, 0x4f, 0x5a, 0x18, 0x7c, 0xf7, 0xe0, 0x78, 0xab,
-	0x40, 0x97, 0xaa, 0xd0, 0x82, 0xbc, 0x83, 0x9e, 0x36, 0xcc, 0xd4, 0xee, 0xe2, 0xa3, 0xd3, 0x59,
-	0xd3, 0xe6, 0x1d, 0xb9, 0xe1, 0xdc, 0x6a, 0x15, 0xd9, 0x1c, 0xf3, 0xe3, 0xa6, 0x2e, 0x78, 0x0b,
-	0x87, 0x5b, 0x01, 0x32, 0x84, 0x83, 0x4f, 0xd1, 0x6d, 0x74, 0xf7, 0x25, 0x1a, 0xef, 0x59, 0x30,
-	0xbf, 0x8c, 0x3f, 0xdf, 0x44, 0x57, 0x63, 0x8f, 0xfc, 0x07, 0xc3, 0xe8, 0xee, 0xe3, 0xd7, 0x96,
-	0xd8, 0x3f, 0xbd, 0x86, 0xde, 0x15, 0x7e, 0x14, 0xc8, 0x19, 0x74, 0xe7, 0xa2, 0x48, 0xc9, 0xa4,
-	0xb9, 0x7f, 0xc7, 0x3e, 0x4f, 0xe8, 0xce, 0x58, 0x29, 0x57, 0xc1, 0x9e, 0x55, 0x72, 0x96, 0xc9,
-	0x19, 0xf8, 0x68, 0x9b, 0x3c, 0xdf, 0xf5, 0x14, 0xa7, 0x34, 0xf9, 0xf7, 0x2b, 0x93, 0x1e, 0x86,
-	0xde, 0xfc, 0x0a, 0x00, 0x00, 0xff, 0xff, 0x46, 0xa4, 0x16, 0xe6, 0xaf, 0x04, 0x00, 0x00,
+	// 699 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x54, 0xdd, 0x6e, 0x12, 0x41,
+	0x14, 0xee, 0x16, 0x96, 0xc2, 0x81, 0xb6, 0x74, 0x6a, 0x74, 0x24, 0xc6, 0x90, 0x4d, 0x34, 0x44,
+	0x13, 0x9a, 0xe0, 0x9d, 0x17, 0x8d, 0xb5, 0x6a, 0xdb, 0xd4, 0x50, 0xb3, 0xf8, 0x73, 0x69, 0x86,
+	0x61, 0xba, 0x10, 0x86, 0x1d, 0xdc, 0x99, 0x6d, 0xc2, 0xad, 0x4f, 0x60, 0xe2, 0x23, 0xf8, 0x36,
+	0x3e, 0x95, 0x99, 0x33, 0x3b, 0x14, 0x2c, 0xde, 0x78, 0xc5, 0x7c, 0xe7, 0x6f, 0xbe, 0x39, 0xdf,
+	0xc7, 0x42, 0x23, 0x51, 0x59, 0xae, 0xc7, 0xdd, 0x79, 0xa6, 0x8c, 0x22, 0x21, 0xfe, 0xb4, 0x1e,
+	0x25, 0x4a, 0x25, 0x52, 0x1c, 0x21, 0x1a, 0xe6, 0xd7, 0x47, 0xda, 0x64, 0x39, 0x37, 0xae, 0x28,
+	0xfa, 0xb5, 0x0d, 0xe1, 0x89, 0x14, 0x99, 0x21, 0xf7, 0x20, 0x34, 0x13, 0x23, 0x05, 0x0d, 0xda,
+	0x41, 0xa7, 0x16, 0x3b, 0x40, 0x08, 0x94, 0x87, 0x6a, 0xb4, 0xa0, 0xdb, 0x18, 0xc4, 0x33, 0x69,
+	0x41, 0x55, 0xe7, 0x43, 0x57, 0x5c, 0xc2, 0xf8, 0x12, 0x93, 0xfb, 0x50, 0x61, 0xdc, 0x4c, 0x54,
+	0x4a, 0xcb, 0x98, 0x29, 0x10, 0x89, 0xa0, 0xe1, 0x4e, 0xef, 0x15, 0xbf, 0x14, 0x0b, 0x1a, 0x62,
+	0x76, 0x2d, 0x46, 0xda, 0x50, 0x97, 0x2c, 0x4f, 0xf9, 0xf8, 0x62, 0xc6, 0x12, 0x41, 0x2b, 0x58,
+	0xb2, 0x1a, 0xb2, 0xd3, 0xa5, 0xeb, 0xdf, 0x71, 0xd3, 0xe5, 0xb2, 0x13, 0xaf, 0x2f, 0x86, 0x57,
+	0x5d, 0xe7, 0x4a, 0x88, 0x50, 0xd8, 0x91, 0x8a, 0x9f, 0x64, 0x89, 0xa6, 0xb5, 0x76, 0xa9, 0x53,
+	0x8b, 0x3d, 0xb4, 0xcc, 0x7c, 0x21, 0xa6, 0x01, 0xd3, 0x6b, 0xb1, 0xe8, 0x77, 0x09, 0x0e, 0xfb,
+	0xca, 0x4c, 0xae, 0x27, 0x9c, 0x59, 0xc2, 0xb1, 0xf8, 0x96, 0x0b, 0x6d, 0x2c, 0x1f, 0xa3, 0xa6,
+	0x22, 0xd5, 0x34, 0xc0, 0xae, 0x02, 0xd9, 0x0d, 0xcd, 0x25, 0x33, 0xd7, 0x2a, 0x9b, 0xe1, 0xe6,
+	0xc2, 0x78, 0x89, 0x2d, 0x93, 0x99, 0xd0, 0x9a, 0x25, 0x7e, 0x79, 0x1e, 0xde, 0x2a, 0x50, 0x5e,
+	0x55, 0xc0, 0x46, 0xd5, 0x7c, 0xc2, 0x8b, 0x95, 0x39, 0x40, 0x9a, 0x50, 0x9a, 0x8a, 0x45, 0xb1,
+	0x23, 0x7b, 0xb4, 0x75, 0x43, 0x36, 0x4a, 0x04, 0xae, 0x26, 0x8c, 0x1d, 0xb0, 0x4c, 0x38, 0x33,
+	0x22, 0x51, 0x99, 0x5f, 0xcb, 0x12, 0x93, 0x08, 0x42, 0x66, 0xa5, 0xa7, 0xb5, 0x76, 0xd0, 0xa9,
+	0xf7, 0x1a, 0xce, 0x12, 0x5d, 0xb4, 0x43, 0xec, 0x52, 0x76, 0xaa, 0x56, 0x79, 0x3a, 0xa2, 0xe0,
+	0x6e, 0x47, 0x40, 0x9e, 0x41, 0x93, 0xab, 0xd4, 0x88, 0xd4, 0x9c, 0xdc, 0xb0, 0x89, 0x64, 0x43,
+	0x29, 0x68, 0xbd, 0x1d, 0x74, 0xaa, 0xf1, 0x9d, 0xb8, 0x65, 0x60, 0xc6, 0x99, 0x60, 0xa3, 0x8b,
+	0x37, 0xb4, 0xe1, 0x18, 0x78, 0x4c, 0x9e, 0xc2, 0xde, 0x2c, 0x37, 0xb6, 0xec, 0xd4, 0xb5, 0xd1,
+	0x5d, 0x9c, 0xf2, 0x57, 0x94, 0x3c, 0x87, 0xf2, 0x88, 0x19, 0x46, 0xf7, 0x90, 0xe8, 0x83, 0xae,
+	0xb3, 0x74, 0xd7, 0x5b, 0xba, 0x3b, 0x40, 0x4b, 0xc7, 0x58, 0x44, 0x1e, 0x03, 0x70, 0x29, 0x58,
+	0xf6, 0x1a, 0xb7, 0xb1, 0x8f, 0x03, 0x57, 0x22, 0xd1, 0xf7, 0x00, 0xe0, 0x43, 0xae, 0xc7, 0xb1,
+	0xd0, 0xb9, 0x34, 0xd6, 0xe1, 0x66, 0x31, 0xf7, 0xb6, 0xc7, 0xf3, 0x1d, 0xfd, 0x6a, 0x2b, 0xfa,
+	0xa1, 0x1e, 0x53, 0x91, 0x16, 0xea, 0x39, 0xb0, 0xaa, 0x6a, 0xf9, 0x8e, 0xaa, 0x22, 0xcb, 0x54,
+	0xe6, 0xf5, 0x43, 0x10, 0x49, 0x38, 0x58, 0x37, 0xd4, 0x5c, 0xa2, 0x49, 0x75, 0xce, 0xb9, 0xd0,
+	0x1a, 0xd9, 0x54, 0x63, 0x0f, 0xad, 0xd1, 0xb8, 0xca, 0x53, 0xa3, 0x0b, 0x3b, 0x15, 0x88, 0x3c,
+	0x81, 0xb2, 0x54, 0x89, 0xa6, 0xa5, 0x76, 0xa9, 0x53, 0xef, 0x1d, 0x14, 0x0a, 0xde, 0xbe, 0x2e,
+	0xc6, 0x74, 0xd4, 0x05, 0x72, 0x2e, 0x98, 0x34, 0xe3, 0xd3, 0xb1, 0xe0, 0x53, 0xef, 0x5e, 0x7b,
+	0x9d, 0xc8, 0x6e, 0x26, 0xdc, 0x3f, 0xde, 0xc3, 0xe8, 0x67, 0x00, 0x87, 0x6b, 0x0d, 0x7a, 0xae,
+	0x52, 0x2d, 0xc8, 0x2b, 0xa8, 0x68, 0xc3, 0x4c, 0xee, 0xf8, 0xed, 0xf5, 0x3a, 0xc5, 0x85, 0x1b,
+	0x6a, 0xbb, 0x03, 0x3b, 0x2b, 0x4d, 0x06, 0x58, 0x1f, 0x17, 0x7d, 0xd1, 0x4b, 0xd8, 0x5d, 0x4b,
+	0x90, 0x3a, 0xec, 0x7c, 0xea, 0x5f, 0xf6, 0xaf, 0xbe, 0xf4, 0x9b, 0x5b, 0x16, 0x0c, 0xde, 0xc6,
+	0x9f, 0x2f, 0xfa, 0x67, 0xcd, 0x80, 0xec, 0x43, 0xbd, 0x7f, 0xf5, 0xf1, 0xab, 0x0f, 0x6c, 0xf7,
+	0x7e, 0x04, 0x50, 0x39, 0xc3, 0x2f, 0x1c, 0x39, 0x86, 0xf2, 0x40, 0xa4, 0x23, 0xd2, 0x2a, 0x08,
+	0x6c, 0xf8, 0x73, 0xb6, 0xe8, 0xc6, 0xdc, 0x5c, 0x2e, 0xa2, 0x2d, 0xf2, 0x0e, 0xc0, 0xf6, 0x0f,
+	0x4c, 0x26, 0xd8, 0xec, 0x7f, 0xa7, 0x74, 0x82, 0xde, 0x39, 0x54, 0xdc, 0xdb, 0xc9, 0x31, 0x84,
+	0xf8, 0x7e, 0xf2, 0x70, 0xd3, 0x4e, 0xdc, 0xac, 0xd6, 0xbf, 0xd7, 0x35, 0xac, 0x60, 0xea, 0xc5,
+	0x9f, 0x01, 0x00, 0xb8, 0xe5, 0x29, 0x44, 0xc4, 0x05, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -496,6 +590,7 @@ const _ = grpc.SupportPackageIsVersion4
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type GorushClient interface {
 	Send(ctx context.Context, in *NotificationRequest, opts ...grpc.CallOption) (*NotificationReply, error)
+	SendStream(ctx context.Context, opts ...grpc.CallOption) (Gorush_SendStreamClient, error)
 }
 
 type gorushClient struct {
@@ -515,9 +610,44 @@ func (c *gorushClient) Send(ctx context.Context, in *NotificationRequest, opts .
 	return out, nil
 }
 
+func (c *gorushClient) SendStream(ctx context.Context, opts ...grpc.CallOption) (Gorush_SendStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Gorush_serviceDesc.Streams[0], "/proto.Gorush/SendStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gorushSendStreamClient{stream}
+	return x, nil
+}
+
+type Gorush_SendStreamClient interface {
+	Send(*NotificationRequest) error
+	CloseAndRecv() (*NotificationReply, error)
+	grpc.ClientStream
+}
+
+type gorushSendStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *gorushSendStreamClient) Send(m *NotificationRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *gorushSendStreamClient) CloseAndRecv() (*NotificationReply, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(NotificationReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // GorushServer is the server API for Gorush service.
 type GorushServer interface {
 	Send(context.Context, *NotificationRequest) (*NotificationReply, error)
+	SendStream(Gorush_SendStreamServer) error
 }
 
 func RegisterGorushServer(s *grpc.Server, srv GorushServer) {
@@ -542,6 +672,32 @@ func _Gorush_Send_Handler(srv interface{}, ctx context.Context, dec func(interfa
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Gorush_SendStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GorushServer).SendStream(&gorushSendStreamServer{stream})
+}
+
+type Gorush_SendStreamServer interface {
+	SendAndClose(*NotificationReply) error
+	Recv() (*NotificationRequest, error)
+	grpc.ServerStream
+}
+
+type gorushSendStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *gorushSendStreamServer) SendAndClose(m *NotificationReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *gorushSendStreamServer) Recv() (*NotificationRequest, error) {
+	m := new(NotificationRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _Gorush_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.Gorush",
 	HandlerType: (*GorushServer)(nil),
@@ -551,7 +707,13 @@ var _Gorush_serviceDesc = grpc.ServiceDesc{
 			Handler:    _Gorush_Send_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SendStream",
+			Handler:       _Gorush_SendStream_Handler,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "gorush.proto",
 }
 
@@ -1,15 +1,19 @@
 package rpc
 
 import (
+	"io"
 	"net"
 	"sync"
 
 	"github.com/appleboy/gorush/gorush"
 	"github.com/appleboy/gorush/rpc/proto"
 
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
@@ -46,8 +50,75 @@ func (s *Server) Check(ctx context.Context, in *proto.HealthCheckRequest) (*prot
 	return nil, status.Error(codes.NotFound, "unknown service")
 }
 
-// Send implements helloworld.GreeterServer
+// Send implements `service Gorush`, the notification is queued the same as
+// push API.
 func (s *Server) Send(ctx context.Context, in *proto.NotificationRequest) (*proto.NotificationReply, error) {
+	return queueNotifications(ctx, []gorush.PushNotification{notificationOf(in)})
+}
+
+// SendStream implements `service Gorush`, all notifications of the stream
+// are queued as one push request when client closes the stream. The stream
+// is aborted as soon as it is over core.max_notification, so it is never
+// buffered without limit.
+func (s *Server) SendStream(stream proto.Gorush_SendStreamServer) error {
+	var notifications []gorush.PushNotification
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if limit := gorush.PushConf.Core.MaxNotification; int64(len(notifications)) >= limit {
+			return status.Errorf(codes.ResourceExhausted, "Number of notifications over limit(%d)", limit)
+		}
+		notifications = append(notifications, notificationOf(in))
+	}
+
+	if len(notifications) == 0 {
+		return status.Error(codes.InvalidArgument, "notifications must not be empty")
+	}
+
+	reply, err := queueNotifications(stream.Context(), notifications)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(reply)
+}
+
+// queueNotifications queue notifications by the path of push API and reply
+// the count and push logs.
+func queueNotifications(ctx context.Context, notifications []gorush.PushNotification) (*proto.NotificationReply, error) {
+	counts, logs, err := gorush.QueueRequest(ctx, notifications)
+	if err != nil {
+		if _, ok := err.(gorush.FieldError); ok {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	reply := &proto.NotificationReply{
+		Success: true,
+		Counts:  int32(counts),
+	}
+	for _, log := range logs {
+		reply.Logs = append(reply.Logs, &proto.PushResult{
+			Type:     log.Type,
+			Platform: log.Platform,
+			Token:    log.Token,
+			Message:  log.Message,
+			Error:    log.Error,
+		})
+	}
+
+	return reply, nil
+}
+
+// notificationOf return the push notification of gRPC request.
+func notificationOf(in *proto.NotificationRequest) gorush.PushNotification {
 	var badge = int(in.Badge)
 	notification := gorush.PushNotification{
 		Platform:         int(in.Platform),
@@ -63,7 +134,8 @@ func (s *Server) Send(ctx context.Context, in *proto.NotificationRequest) (*prot
 		MutableContent:   in.MutableContent,
 	}
 
-	if badge > 0 {
+	// zero badge can't be told from unset in proto3, so clearBadge clears it.
+	if badge != 0 || in.ClearBadge {
 		notification.Badge = &badge
 	}
 
@@ -85,16 +157,37 @@ func (s *Server) Send(ctx context.Context, in *proto.NotificationRequest) (*prot
 	if in.Data != nil {
 		notification.Data = map[string]interface{}{}
 		for k, v := range in.Data.Fields {
-			notification.Data[k] = v
+			notification.Data[k] = valueOf(v)
 		}
 	}
 
-	go gorush.SendNotification(notification)
+	return notification
+}
 
-	return &proto.NotificationReply{
-		Success: true,
-		Counts:  int32(len(notification.Tokens)),
-	}, nil
+// valueOf return the JSON value of protobuf struct value.
+func valueOf(v *structpb.Value) interface{} {
+	switch kind := v.GetKind().(type) {
+	case *structpb.Value_NumberValue:
+		return kind.NumberValue
+	case *structpb.Value_StringValue:
+		return kind.StringValue
+	case *structpb.Value_BoolValue:
+		return kind.BoolValue
+	case *structpb.Value_StructValue:
+		fields := map[string]interface{}{}
+		for k, v := range kind.StructValue.GetFields() {
+			fields[k] = valueOf(v)
+		}
+		return fields
+	case *structpb.Value_ListValue:
+		values := []interface{}{}
+		for _, v := range kind.ListValue.GetValues() {
+			values = append(values, valueOf(v))
+		}
+		return values
+	}
+
+	return nil
 }
 
 // RunGRPCServer run gorush grpc server
@@ -113,6 +206,11 @@ func RunGRPCServer() error {
 	srv := NewServer()
 	proto.RegisterGorushServer(s, srv)
 	proto.RegisterHealthServer(s, srv)
+	// standard health service of gRPC health probes.
+	healthSrv := health.NewServer()
+	healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthSrv.SetServingStatus("proto.Gorush", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, healthSrv)
 	// Register reflection service on gRPC server.
 	reflection.Register(s)
 	gorush.LogAccess.Debug("gRPC server is running on " + gorush.PushConf.GRPC.Port + " port.")
@@ -1 +1,193 @@
 package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/appleboy/gorush/config"
+	"github.com/appleboy/gorush/gorush"
+	"github.com/appleboy/gorush/rpc/proto"
+
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func testGRPCClient(t *testing.T) (proto.GorushClient, *grpc.ClientConn, func()) {
+	gorush.PushConf, _ = config.LoadConf("")
+	gorush.PushConf.Android.Enabled = true
+	assert.NoError(t, gorush.InitLog())
+	assert.NoError(t, gorush.InitAppStatus())
+	// no worker consumes the queue.
+	gorush.InitWorkers(0, 10)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := grpc.NewServer()
+	proto.RegisterGorushServer(s, NewServer())
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+
+	return proto.NewGorushClient(conn), conn, func() {
+		conn.Close()
+		s.Stop()
+		gorush.PushConf, _ = config.LoadConf("")
+		gorush.InitWorkers(gorush.PushConf.Core.WorkerNum, gorush.PushConf.Core.QueueNum)
+	}
+}
+
+func TestSend(t *testing.T) {
+	client, _, cleanup := testGRPCClient(t)
+	defer cleanup()
+
+	reply, err := client.Send(context.Background(), &proto.NotificationRequest{
+		Platform: gorush.PlatFormAndroid,
+		Tokens:   []string{"aaaaa", "bbbbb"},
+		Message:  "Welcome",
+		Data: &structpb.Struct{
+			Fields: map[string]*structpb.Value{
+				"key1": {Kind: &structpb.Value_StringValue{StringValue: "welcome"}},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, reply.Success)
+	assert.Equal(t, int32(2), reply.Counts)
+
+	notification := <-gorush.QueueNotification
+	assert.Equal(t, []string{"aaaaa", "bbbbb"}, notification.Tokens)
+	assert.Equal(t, "welcome", notification.Data["key1"])
+
+	// invalid notification is rejected before queued.
+	_, err = client.Send(context.Background(), &proto.NotificationRequest{
+		Platform: 9,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, 0, len(gorush.QueueNotification))
+}
+
+func TestSendBadge(t *testing.T) {
+	client, _, cleanup := testGRPCClient(t)
+	defer cleanup()
+
+	for _, in := range []*proto.NotificationRequest{
+		{Badge: 0},
+		{ClearBadge: true},
+		{Badge: 5},
+	} {
+		in.Platform = gorush.PlatFormAndroid
+		in.Tokens = []string{"aaaaa"}
+		in.Message = "Welcome"
+		_, err := client.Send(context.Background(), in)
+		assert.NoError(t, err)
+	}
+
+	assert.Nil(t, (<-gorush.QueueNotification).Badge)
+	assert.Equal(t, 0, *(<-gorush.QueueNotification).Badge)
+	assert.Equal(t, 5, *(<-gorush.QueueNotification).Badge)
+
+	_, err := client.Send(context.Background(), &proto.NotificationRequest{
+		Platform: gorush.PlatFormAndroid,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+		Badge:    -1,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestSendStream(t *testing.T) {
+	client, _, cleanup := testGRPCClient(t)
+	defer cleanup()
+
+	stream, err := client.SendStream(context.Background())
+	assert.NoError(t, err)
+	for _, token := range []string{"aaaaa", "bbbbb", "ccccc"} {
+		assert.NoError(t, stream.Send(&proto.NotificationRequest{
+			Platform: gorush.PlatFormAndroid,
+			Tokens:   []string{token},
+			Message:  "Welcome",
+		}))
+	}
+	reply, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), reply.Counts)
+	assert.Equal(t, 3, len(gorush.QueueNotification))
+
+	stream, err = client.SendStream(context.Background())
+	assert.NoError(t, err)
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestSendStreamOverLimit(t *testing.T) {
+	client, _, cleanup := testGRPCClient(t)
+	defer cleanup()
+	gorush.PushConf.Core.MaxNotification = 2
+
+	stream, err := client.SendStream(context.Background())
+	assert.NoError(t, err)
+	// the server aborts the stream, so later sends may fail with EOF.
+	for _, token := range []string{"aaaaa", "bbbbb", "ccccc", "ddddd"} {
+		_ = stream.Send(&proto.NotificationRequest{
+			Platform: gorush.PlatFormAndroid,
+			Tokens:   []string{token},
+			Message:  "Welcome",
+		})
+	}
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, "Number of notifications over limit(2)", status.Convert(err).Message())
+	assert.Equal(t, 0, len(gorush.QueueNotification))
+}
+
+func TestSendDroppedLogs(t *testing.T) {
+	client, _, cleanup := testGRPCClient(t)
+	defer cleanup()
+	gorush.InitWorkers(0, 1)
+	gorush.QueueNotification <- gorush.PushNotification{Platform: gorush.PlatFormAndroid}
+
+	reply, err := client.Send(context.Background(), &proto.NotificationRequest{
+		Platform: gorush.PlatFormAndroid,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(reply.Logs))
+	assert.Equal(t, gorush.DroppedPush, reply.Logs[0].Type)
+	assert.Equal(t, "max capacity reached", reply.Logs[0].Error)
+}
+
+func TestHealthCheck(t *testing.T) {
+	gorush.PushConf, _ = config.LoadConf("")
+	gorush.PushConf.GRPC.Enabled = true
+	gorush.PushConf.GRPC.Port = "19001"
+	assert.NoError(t, gorush.InitLog())
+	go func() {
+		assert.NoError(t, RunGRPCServer())
+	}()
+	defer func() {
+		gorush.PushConf, _ = config.LoadConf("")
+	}()
+
+	conn, err := grpc.Dial("127.0.0.1:19001", grpc.WithInsecure(), grpc.WithBlock())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	ok, err := NewGrpcHealthClient(conn).Check(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	res, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: "proto.Gorush"})
+	assert.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+}
@@ -36,6 +36,11 @@ func (s *Storage) Init() error {
 	return nil
 }
 
+// Close the storage, the database is opened by every operation.
+func (s *Storage) Close() error {
+	return nil
+}
+
 // Reset Client storage.
 func (s *Storage) Reset() {
 	s.setBadger(storage.TotalCountKey, 0)
@@ -43,6 +48,12 @@ func (s *Storage) Reset() {
 	s.setBadger(storage.IosErrorKey, 0)
 	s.setBadger(storage.AndroidSuccessKey, 0)
 	s.setBadger(storage.AndroidErrorKey, 0)
+	s.setBadger(storage.WebSuccessKey, 0)
+	s.setBadger(storage.WebErrorKey, 0)
+	s.setBadger(storage.HuaweiSuccessKey, 0)
+	s.setBadger(storage.HuaweiErrorKey, 0)
+	s.setBadger(storage.SNSSuccessKey, 0)
+	s.setBadger(storage.SNSErrorKey, 0)
 }
 
 func (s *Storage) setBadger(key string, count int64) {
@@ -180,3 +191,190 @@ func (s *Storage) GetAndroidError() int64 {
 
 	return count
 }
+
+// AddWebSuccess record counts of success Web push notification.
+func (s *Storage) AddWebSuccess(count int64) {
+	total := s.GetWebSuccess() + count
+	s.setBadger(storage.WebSuccessKey, total)
+}
+
+// AddWebError record counts of error Web push notification.
+func (s *Storage) AddWebError(count int64) {
+	total := s.GetWebError() + count
+	s.setBadger(storage.WebErrorKey, total)
+}
+
+// GetWebSuccess show success counts of Web notification.
+func (s *Storage) GetWebSuccess() int64 {
+	var count int64
+	s.getBadger(storage.WebSuccessKey, &count)
+
+	return count
+}
+
+// GetWebError show error counts of Web notification.
+func (s *Storage) GetWebError() int64 {
+	var count int64
+	s.getBadger(storage.WebErrorKey, &count)
+
+	return count
+}
+
+// AddHuaweiSuccess record counts of success Huawei push notification.
+func (s *Storage) AddHuaweiSuccess(count int64) {
+	total := s.GetHuaweiSuccess() + count
+	s.setBadger(storage.HuaweiSuccessKey, total)
+}
+
+// AddHuaweiError record counts of error Huawei push notification.
+func (s *Storage) AddHuaweiError(count int64) {
+	total := s.GetHuaweiError() + count
+	s.setBadger(storage.HuaweiErrorKey, total)
+}
+
+// GetHuaweiSuccess show success counts of Huawei notification.
+func (s *Storage) GetHuaweiSuccess() int64 {
+	var count int64
+	s.getBadger(storage.HuaweiSuccessKey, &count)
+
+	return count
+}
+
+// GetHuaweiError show error counts of Huawei notification.
+func (s *Storage) GetHuaweiError() int64 {
+	var count int64
+	s.getBadger(storage.HuaweiErrorKey, &count)
+
+	return count
+}
+
+// AddSNSSuccess record counts of success SNS push notification.
+func (s *Storage) AddSNSSuccess(count int64) {
+	total := s.GetSNSSuccess() + count
+	s.setBadger(storage.SNSSuccessKey, total)
+}
+
+// AddSNSError record counts of error SNS push notification.
+func (s *Storage) AddSNSError(count int64) {
+	total := s.GetSNSError() + count
+	s.setBadger(storage.SNSErrorKey, total)
+}
+
+// GetSNSSuccess show success counts of SNS notification.
+func (s *Storage) GetSNSSuccess() int64 {
+	var count int64
+	s.getBadger(storage.SNSSuccessKey, &count)
+
+	return count
+}
+
+// GetSNSError show error counts of SNS notification.
+func (s *Storage) GetSNSError() int64 {
+	var count int64
+	s.getBadger(storage.SNSErrorKey, &count)
+
+	return count
+}
+
+// Add record count of the key.
+func (s *Storage) Add(key string, count int64) {
+	total := s.Get(key) + count
+	s.setBadger(key, total)
+}
+
+// Get show count of the key.
+func (s *Storage) Get(key string) int64 {
+	var count int64
+	s.getBadger(key, &count)
+
+	return count
+}
+
+// Set replace count of the key.
+func (s *Storage) Set(key string, count int64) {
+	s.setBadger(key, count)
+}
+
+// Del remove the key.
+func (s *Storage) Del(key string) {
+	db, err := badger.Open(s.opts)
+
+	if err != nil {
+		log.Println(s.name, "open error:", err.Error())
+		return
+	}
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println(s.name, "close error:", err.Error())
+		}
+	}()
+
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+
+	if err != nil {
+		log.Println(s.name, "delete error:", err.Error())
+	}
+}
+
+// SetData save raw data of the key.
+func (s *Storage) SetData(key string, data []byte) {
+	db, err := badger.Open(s.opts)
+
+	if err != nil {
+		log.Println(s.name, "open error:", err.Error())
+		return
+	}
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println(s.name, "close error:", err.Error())
+		}
+	}()
+
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), data)
+	})
+
+	if err != nil {
+		log.Println(s.name, "update error:", err.Error())
+	}
+}
+
+// GetData show raw data of the key.
+func (s *Storage) GetData(key string) []byte {
+	var data []byte
+	db, err := badger.Open(s.opts)
+
+	if err != nil {
+		log.Println(s.name, "open error:", err.Error())
+		return nil
+	}
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println(s.name, "close error:", err.Error())
+		}
+	}()
+
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+
+	if err != nil && err != badger.ErrKeyNotFound {
+		log.Println(s.name, "get error:", err.Error())
+	}
+
+	return data
+}
@@ -40,6 +40,43 @@ func TestBadgerEngine(t *testing.T) {
 	val = badger.GetAndroidError()
 	assert.Equal(t, int64(50), val)
 
+	badger.AddWebSuccess(60)
+	val = badger.GetWebSuccess()
+	assert.Equal(t, int64(60), val)
+
+	badger.AddWebError(70)
+	val = badger.GetWebError()
+	assert.Equal(t, int64(70), val)
+
+	badger.AddHuaweiSuccess(80)
+	val = badger.GetHuaweiSuccess()
+	assert.Equal(t, int64(80), val)
+
+	badger.AddHuaweiError(90)
+	val = badger.GetHuaweiError()
+	assert.Equal(t, int64(90), val)
+
+	badger.AddSNSSuccess(100)
+	val = badger.GetSNSSuccess()
+	assert.Equal(t, int64(100), val)
+
+	badger.AddSNSError(110)
+	val = badger.GetSNSError()
+	assert.Equal(t, int64(110), val)
+
+	badger.Set("gorush-test-key", 10)
+	badger.Add("gorush-test-key", 5)
+	val = badger.Get("gorush-test-key")
+	assert.Equal(t, int64(15), val)
+	badger.Del("gorush-test-key")
+	val = badger.Get("gorush-test-key")
+	assert.Equal(t, int64(0), val)
+
+	badger.SetData("gorush-test-data", []byte(`[{"platform":1}]`))
+	assert.Equal(t, []byte(`[{"platform":1}]`), badger.GetData("gorush-test-data"))
+	badger.Del("gorush-test-data")
+	assert.Empty(t, badger.GetData("gorush-test-data"))
+
 	// test reset db
 	badger.Reset()
 	val = badger.GetAndroidError()
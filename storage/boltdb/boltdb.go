@@ -26,6 +26,11 @@ func (s *Storage) Init() error {
 	return nil
 }
 
+// Close the storage, the database is opened by every operation.
+func (s *Storage) Close() error {
+	return nil
+}
+
 // Reset Client storage.
 func (s *Storage) Reset() {
 	s.setBoltDB(storage.TotalCountKey, 0)
@@ -33,6 +38,12 @@ func (s *Storage) Reset() {
 	s.setBoltDB(storage.IosErrorKey, 0)
 	s.setBoltDB(storage.AndroidSuccessKey, 0)
 	s.setBoltDB(storage.AndroidErrorKey, 0)
+	s.setBoltDB(storage.WebSuccessKey, 0)
+	s.setBoltDB(storage.WebErrorKey, 0)
+	s.setBoltDB(storage.HuaweiSuccessKey, 0)
+	s.setBoltDB(storage.HuaweiErrorKey, 0)
+	s.setBoltDB(storage.SNSSuccessKey, 0)
+	s.setBoltDB(storage.SNSErrorKey, 0)
 }
 
 func (s *Storage) setBoltDB(key string, count int64) {
@@ -134,3 +145,157 @@ func (s *Storage) GetAndroidError() int64 {
 
 	return count
 }
+
+// AddWebSuccess record counts of success Web push notification.
+func (s *Storage) AddWebSuccess(count int64) {
+	total := s.GetWebSuccess() + count
+	s.setBoltDB(storage.WebSuccessKey, total)
+}
+
+// AddWebError record counts of error Web push notification.
+func (s *Storage) AddWebError(count int64) {
+	total := s.GetWebError() + count
+	s.setBoltDB(storage.WebErrorKey, total)
+}
+
+// GetWebSuccess show success counts of Web notification.
+func (s *Storage) GetWebSuccess() int64 {
+	var count int64
+	s.getBoltDB(storage.WebSuccessKey, &count)
+
+	return count
+}
+
+// GetWebError show error counts of Web notification.
+func (s *Storage) GetWebError() int64 {
+	var count int64
+	s.getBoltDB(storage.WebErrorKey, &count)
+
+	return count
+}
+
+// AddHuaweiSuccess record counts of success Huawei push notification.
+func (s *Storage) AddHuaweiSuccess(count int64) {
+	total := s.GetHuaweiSuccess() + count
+	s.setBoltDB(storage.HuaweiSuccessKey, total)
+}
+
+// AddHuaweiError record counts of error Huawei push notification.
+func (s *Storage) AddHuaweiError(count int64) {
+	total := s.GetHuaweiError() + count
+	s.setBoltDB(storage.HuaweiErrorKey, total)
+}
+
+// GetHuaweiSuccess show success counts of Huawei notification.
+func (s *Storage) GetHuaweiSuccess() int64 {
+	var count int64
+	s.getBoltDB(storage.HuaweiSuccessKey, &count)
+
+	return count
+}
+
+// GetHuaweiError show error counts of Huawei notification.
+func (s *Storage) GetHuaweiError() int64 {
+	var count int64
+	s.getBoltDB(storage.HuaweiErrorKey, &count)
+
+	return count
+}
+
+// AddSNSSuccess record counts of success SNS push notification.
+func (s *Storage) AddSNSSuccess(count int64) {
+	total := s.GetSNSSuccess() + count
+	s.setBoltDB(storage.SNSSuccessKey, total)
+}
+
+// AddSNSError record counts of error SNS push notification.
+func (s *Storage) AddSNSError(count int64) {
+	total := s.GetSNSError() + count
+	s.setBoltDB(storage.SNSErrorKey, total)
+}
+
+// GetSNSSuccess show success counts of SNS notification.
+func (s *Storage) GetSNSSuccess() int64 {
+	var count int64
+	s.getBoltDB(storage.SNSSuccessKey, &count)
+
+	return count
+}
+
+// GetSNSError show error counts of SNS notification.
+func (s *Storage) GetSNSError() int64 {
+	var count int64
+	s.getBoltDB(storage.SNSErrorKey, &count)
+
+	return count
+}
+
+// Add record count of the key.
+func (s *Storage) Add(key string, count int64) {
+	total := s.Get(key) + count
+	s.setBoltDB(key, total)
+}
+
+// Get show count of the key.
+func (s *Storage) Get(key string) int64 {
+	var count int64
+	s.getBoltDB(key, &count)
+
+	return count
+}
+
+// Set replace count of the key.
+func (s *Storage) Set(key string, count int64) {
+	s.setBoltDB(key, count)
+}
+
+// Del remove the key.
+func (s *Storage) Del(key string) {
+	db, _ := storm.Open(s.config.Stat.BoltDB.Path)
+	err := db.Delete(s.config.Stat.BoltDB.Bucket, key)
+	if err != nil {
+		log.Println("BoltDB delete error:", err.Error())
+	}
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println("BoltDB error:", err.Error())
+		}
+	}()
+}
+
+// SetData save raw data of the key.
+func (s *Storage) SetData(key string, data []byte) {
+	db, _ := storm.Open(s.config.Stat.BoltDB.Path)
+	err := db.Set(s.config.Stat.BoltDB.Bucket, key, data)
+	if err != nil {
+		log.Println("BoltDB set error:", err.Error())
+	}
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println("BoltDB error:", err.Error())
+		}
+	}()
+}
+
+// GetData show raw data of the key.
+func (s *Storage) GetData(key string) []byte {
+	var data []byte
+	db, _ := storm.Open(s.config.Stat.BoltDB.Path)
+	err := db.Get(s.config.Stat.BoltDB.Bucket, key, &data)
+	if err != nil && err != storm.ErrNotFound {
+		log.Println("BoltDB get error:", err.Error())
+	}
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println("BoltDB error:", err.Error())
+		}
+	}()
+
+	return data
+}
@@ -40,8 +40,65 @@ func TestBoltDBEngine(t *testing.T) {
 	val = boltDB.GetAndroidError()
 	assert.Equal(t, int64(50), val)
 
+	boltDB.AddWebSuccess(60)
+	val = boltDB.GetWebSuccess()
+	assert.Equal(t, int64(60), val)
+
+	boltDB.AddWebError(70)
+	val = boltDB.GetWebError()
+	assert.Equal(t, int64(70), val)
+
+	boltDB.AddHuaweiSuccess(80)
+	val = boltDB.GetHuaweiSuccess()
+	assert.Equal(t, int64(80), val)
+
+	boltDB.AddHuaweiError(90)
+	val = boltDB.GetHuaweiError()
+	assert.Equal(t, int64(90), val)
+
+	boltDB.AddSNSSuccess(100)
+	val = boltDB.GetSNSSuccess()
+	assert.Equal(t, int64(100), val)
+
+	boltDB.AddSNSError(110)
+	val = boltDB.GetSNSError()
+	assert.Equal(t, int64(110), val)
+
+	boltDB.Set("gorush-test-key", 10)
+	boltDB.Add("gorush-test-key", 5)
+	val = boltDB.Get("gorush-test-key")
+	assert.Equal(t, int64(15), val)
+	boltDB.Del("gorush-test-key")
+	val = boltDB.Get("gorush-test-key")
+	assert.Equal(t, int64(0), val)
+
+	boltDB.SetData("gorush-test-data", []byte(`[{"platform":1}]`))
+	assert.Equal(t, []byte(`[{"platform":1}]`), boltDB.GetData("gorush-test-data"))
+	boltDB.Del("gorush-test-data")
+	assert.Empty(t, boltDB.GetData("gorush-test-data"))
+
 	// test reset db
 	boltDB.Reset()
 	val = boltDB.GetAndroidError()
 	assert.Equal(t, int64(0), val)
 }
+
+func TestBoltDBPersist(t *testing.T) {
+	config, _ := c.LoadConf("")
+
+	boltDB := New(config)
+	assert.Nil(t, boltDB.Init())
+	boltDB.Reset()
+	boltDB.AddIosSuccess(3)
+	boltDB.Add("gorush-test-key", 5)
+	assert.Nil(t, boltDB.Close())
+
+	// counts are kept after restart.
+	boltDB = New(config)
+	assert.Nil(t, boltDB.Init())
+	assert.Equal(t, int64(3), boltDB.GetIosSuccess())
+	assert.Equal(t, int64(5), boltDB.Get("gorush-test-key"))
+	boltDB.Del("gorush-test-key")
+	boltDB.Reset()
+	assert.Nil(t, boltDB.Close())
+}
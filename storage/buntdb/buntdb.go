@@ -28,6 +28,11 @@ func (s *Storage) Init() error {
 	return nil
 }
 
+// Close the storage, the database is opened by every operation.
+func (s *Storage) Close() error {
+	return nil
+}
+
 // Reset Client storage.
 func (s *Storage) Reset() {
 	s.setBuntDB(storage.TotalCountKey, 0)
@@ -35,6 +40,12 @@ func (s *Storage) Reset() {
 	s.setBuntDB(storage.IosErrorKey, 0)
 	s.setBuntDB(storage.AndroidSuccessKey, 0)
 	s.setBuntDB(storage.AndroidErrorKey, 0)
+	s.setBuntDB(storage.WebSuccessKey, 0)
+	s.setBuntDB(storage.WebErrorKey, 0)
+	s.setBuntDB(storage.HuaweiSuccessKey, 0)
+	s.setBuntDB(storage.HuaweiErrorKey, 0)
+	s.setBuntDB(storage.SNSSuccessKey, 0)
+	s.setBuntDB(storage.SNSErrorKey, 0)
 }
 
 func (s *Storage) setBuntDB(key string, count int64) {
@@ -149,3 +160,182 @@ func (s *Storage) GetAndroidError() int64 {
 
 	return count
 }
+
+// AddWebSuccess record counts of success Web push notification.
+func (s *Storage) AddWebSuccess(count int64) {
+	total := s.GetWebSuccess() + count
+	s.setBuntDB(storage.WebSuccessKey, total)
+}
+
+// AddWebError record counts of error Web push notification.
+func (s *Storage) AddWebError(count int64) {
+	total := s.GetWebError() + count
+	s.setBuntDB(storage.WebErrorKey, total)
+}
+
+// GetWebSuccess show success counts of Web notification.
+func (s *Storage) GetWebSuccess() int64 {
+	var count int64
+	s.getBuntDB(storage.WebSuccessKey, &count)
+
+	return count
+}
+
+// GetWebError show error counts of Web notification.
+func (s *Storage) GetWebError() int64 {
+	var count int64
+	s.getBuntDB(storage.WebErrorKey, &count)
+
+	return count
+}
+
+// AddHuaweiSuccess record counts of success Huawei push notification.
+func (s *Storage) AddHuaweiSuccess(count int64) {
+	total := s.GetHuaweiSuccess() + count
+	s.setBuntDB(storage.HuaweiSuccessKey, total)
+}
+
+// AddHuaweiError record counts of error Huawei push notification.
+func (s *Storage) AddHuaweiError(count int64) {
+	total := s.GetHuaweiError() + count
+	s.setBuntDB(storage.HuaweiErrorKey, total)
+}
+
+// GetHuaweiSuccess show success counts of Huawei notification.
+func (s *Storage) GetHuaweiSuccess() int64 {
+	var count int64
+	s.getBuntDB(storage.HuaweiSuccessKey, &count)
+
+	return count
+}
+
+// GetHuaweiError show error counts of Huawei notification.
+func (s *Storage) GetHuaweiError() int64 {
+	var count int64
+	s.getBuntDB(storage.HuaweiErrorKey, &count)
+
+	return count
+}
+
+// AddSNSSuccess record counts of success SNS push notification.
+func (s *Storage) AddSNSSuccess(count int64) {
+	total := s.GetSNSSuccess() + count
+	s.setBuntDB(storage.SNSSuccessKey, total)
+}
+
+// AddSNSError record counts of error SNS push notification.
+func (s *Storage) AddSNSError(count int64) {
+	total := s.GetSNSError() + count
+	s.setBuntDB(storage.SNSErrorKey, total)
+}
+
+// GetSNSSuccess show success counts of SNS notification.
+func (s *Storage) GetSNSSuccess() int64 {
+	var count int64
+	s.getBuntDB(storage.SNSSuccessKey, &count)
+
+	return count
+}
+
+// GetSNSError show error counts of SNS notification.
+func (s *Storage) GetSNSError() int64 {
+	var count int64
+	s.getBuntDB(storage.SNSErrorKey, &count)
+
+	return count
+}
+
+// Add record count of the key.
+func (s *Storage) Add(key string, count int64) {
+	total := s.Get(key) + count
+	s.setBuntDB(key, total)
+}
+
+// Get show count of the key.
+func (s *Storage) Get(key string) int64 {
+	var count int64
+	s.getBuntDB(key, &count)
+
+	return count
+}
+
+// Set replace count of the key.
+func (s *Storage) Set(key string, count int64) {
+	s.setBuntDB(key, count)
+}
+
+// Del remove the key.
+func (s *Storage) Del(key string) {
+	db, _ := buntdb.Open(s.config.Stat.BuntDB.Path)
+
+	err := db.Update(func(tx *buntdb.Tx) error {
+		if _, err := tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+			return err
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Println("BuntDB delete error:", err.Error())
+	}
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println("BuntDB error:", err.Error())
+		}
+	}()
+}
+
+// SetData save raw data of the key.
+func (s *Storage) SetData(key string, data []byte) {
+	db, _ := buntdb.Open(s.config.Stat.BuntDB.Path)
+
+	err := db.Update(func(tx *buntdb.Tx) error {
+		if _, _, err := tx.Set(key, string(data), nil); err != nil {
+			return err
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Println("BuntDB update error:", err.Error())
+	}
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println("BuntDB error:", err.Error())
+		}
+	}()
+}
+
+// GetData show raw data of the key.
+func (s *Storage) GetData(key string) []byte {
+	var data []byte
+	db, _ := buntdb.Open(s.config.Stat.BuntDB.Path)
+
+	err := db.View(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(key)
+		if err != nil && err != buntdb.ErrNotFound {
+			return err
+		}
+		if val != "" {
+			data = []byte(val)
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Println("BuntDB get error:", err.Error())
+	}
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println("BuntDB error:", err.Error())
+		}
+	}()
+
+	return data
+}
@@ -46,6 +46,43 @@ func TestBuntDBEngine(t *testing.T) {
 	val = buntDB.GetAndroidError()
 	assert.Equal(t, int64(50), val)
 
+	buntDB.AddWebSuccess(60)
+	val = buntDB.GetWebSuccess()
+	assert.Equal(t, int64(60), val)
+
+	buntDB.AddWebError(70)
+	val = buntDB.GetWebError()
+	assert.Equal(t, int64(70), val)
+
+	buntDB.AddHuaweiSuccess(80)
+	val = buntDB.GetHuaweiSuccess()
+	assert.Equal(t, int64(80), val)
+
+	buntDB.AddHuaweiError(90)
+	val = buntDB.GetHuaweiError()
+	assert.Equal(t, int64(90), val)
+
+	buntDB.AddSNSSuccess(100)
+	val = buntDB.GetSNSSuccess()
+	assert.Equal(t, int64(100), val)
+
+	buntDB.AddSNSError(110)
+	val = buntDB.GetSNSError()
+	assert.Equal(t, int64(110), val)
+
+	buntDB.Set("gorush-test-key", 10)
+	buntDB.Add("gorush-test-key", 5)
+	val = buntDB.Get("gorush-test-key")
+	assert.Equal(t, int64(15), val)
+	buntDB.Del("gorush-test-key")
+	val = buntDB.Get("gorush-test-key")
+	assert.Equal(t, int64(0), val)
+
+	buntDB.SetData("gorush-test-data", []byte(`[{"platform":1}]`))
+	assert.Equal(t, []byte(`[{"platform":1}]`), buntDB.GetData("gorush-test-data"))
+	buntDB.Del("gorush-test-data")
+	assert.Empty(t, buntDB.GetData("gorush-test-data"))
+
 	buntDB.Reset()
 	val = buntDB.GetAndroidError()
 	assert.Equal(t, int64(0), val)
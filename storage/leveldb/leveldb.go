@@ -59,6 +59,11 @@ func (s *Storage) Init() error {
 	return nil
 }
 
+// Close the storage, the database is opened by every operation.
+func (s *Storage) Close() error {
+	return nil
+}
+
 // Reset Client storage.
 func (s *Storage) Reset() {
 	setLevelDB(storage.TotalCountKey, 0)
@@ -66,6 +71,12 @@ func (s *Storage) Reset() {
 	setLevelDB(storage.IosErrorKey, 0)
 	setLevelDB(storage.AndroidSuccessKey, 0)
 	setLevelDB(storage.AndroidErrorKey, 0)
+	setLevelDB(storage.WebSuccessKey, 0)
+	setLevelDB(storage.WebErrorKey, 0)
+	setLevelDB(storage.HuaweiSuccessKey, 0)
+	setLevelDB(storage.HuaweiErrorKey, 0)
+	setLevelDB(storage.SNSSuccessKey, 0)
+	setLevelDB(storage.SNSErrorKey, 0)
 }
 
 // AddTotalCount record push notification count.
@@ -137,3 +148,150 @@ func (s *Storage) GetAndroidError() int64 {
 
 	return count
 }
+
+// AddWebSuccess record counts of success Web push notification.
+func (s *Storage) AddWebSuccess(count int64) {
+	total := s.GetWebSuccess() + count
+	setLevelDB(storage.WebSuccessKey, total)
+}
+
+// AddWebError record counts of error Web push notification.
+func (s *Storage) AddWebError(count int64) {
+	total := s.GetWebError() + count
+	setLevelDB(storage.WebErrorKey, total)
+}
+
+// GetWebSuccess show success counts of Web notification.
+func (s *Storage) GetWebSuccess() int64 {
+	var count int64
+	getLevelDB(storage.WebSuccessKey, &count)
+
+	return count
+}
+
+// GetWebError show error counts of Web notification.
+func (s *Storage) GetWebError() int64 {
+	var count int64
+	getLevelDB(storage.WebErrorKey, &count)
+
+	return count
+}
+
+// AddHuaweiSuccess record counts of success Huawei push notification.
+func (s *Storage) AddHuaweiSuccess(count int64) {
+	total := s.GetHuaweiSuccess() + count
+	setLevelDB(storage.HuaweiSuccessKey, total)
+}
+
+// AddHuaweiError record counts of error Huawei push notification.
+func (s *Storage) AddHuaweiError(count int64) {
+	total := s.GetHuaweiError() + count
+	setLevelDB(storage.HuaweiErrorKey, total)
+}
+
+// GetHuaweiSuccess show success counts of Huawei notification.
+func (s *Storage) GetHuaweiSuccess() int64 {
+	var count int64
+	getLevelDB(storage.HuaweiSuccessKey, &count)
+
+	return count
+}
+
+// GetHuaweiError show error counts of Huawei notification.
+func (s *Storage) GetHuaweiError() int64 {
+	var count int64
+	getLevelDB(storage.HuaweiErrorKey, &count)
+
+	return count
+}
+
+// AddSNSSuccess record counts of success SNS push notification.
+func (s *Storage) AddSNSSuccess(count int64) {
+	total := s.GetSNSSuccess() + count
+	setLevelDB(storage.SNSSuccessKey, total)
+}
+
+// AddSNSError record counts of error SNS push notification.
+func (s *Storage) AddSNSError(count int64) {
+	total := s.GetSNSError() + count
+	setLevelDB(storage.SNSErrorKey, total)
+}
+
+// GetSNSSuccess show success counts of SNS notification.
+func (s *Storage) GetSNSSuccess() int64 {
+	var count int64
+	getLevelDB(storage.SNSSuccessKey, &count)
+
+	return count
+}
+
+// GetSNSError show error counts of SNS notification.
+func (s *Storage) GetSNSError() int64 {
+	var count int64
+	getLevelDB(storage.SNSErrorKey, &count)
+
+	return count
+}
+
+// Add record count of the key.
+func (s *Storage) Add(key string, count int64) {
+	total := s.Get(key) + count
+	setLevelDB(key, total)
+}
+
+// Get show count of the key.
+func (s *Storage) Get(key string) int64 {
+	var count int64
+	getLevelDB(key, &count)
+
+	return count
+}
+
+// Set replace count of the key.
+func (s *Storage) Set(key string, count int64) {
+	setLevelDB(key, count)
+}
+
+// Del remove the key.
+func (s *Storage) Del(key string) {
+	db, _ := leveldb.OpenFile(dbPath, nil)
+
+	_ = db.Delete([]byte(key), nil)
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println("LevelDB error:", err.Error())
+		}
+	}()
+}
+
+// SetData save raw data of the key.
+func (s *Storage) SetData(key string, data []byte) {
+	db, _ := leveldb.OpenFile(dbPath, nil)
+
+	_ = db.Put([]byte(key), data, nil)
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println("LevelDB error:", err.Error())
+		}
+	}()
+}
+
+// GetData show raw data of the key.
+func (s *Storage) GetData(key string) []byte {
+	db, _ := leveldb.OpenFile(dbPath, nil)
+
+	data, _ := db.Get([]byte(key), nil)
+
+	defer func() {
+		err := db.Close()
+		if err != nil {
+			log.Println("LevelDB error:", err.Error())
+		}
+	}()
+
+	return data
+}
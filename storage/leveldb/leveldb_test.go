@@ -46,6 +46,43 @@ func TestLevelDBEngine(t *testing.T) {
 	val = levelDB.GetAndroidError()
 	assert.Equal(t, int64(50), val)
 
+	levelDB.AddWebSuccess(60)
+	val = levelDB.GetWebSuccess()
+	assert.Equal(t, int64(60), val)
+
+	levelDB.AddWebError(70)
+	val = levelDB.GetWebError()
+	assert.Equal(t, int64(70), val)
+
+	levelDB.AddHuaweiSuccess(80)
+	val = levelDB.GetHuaweiSuccess()
+	assert.Equal(t, int64(80), val)
+
+	levelDB.AddHuaweiError(90)
+	val = levelDB.GetHuaweiError()
+	assert.Equal(t, int64(90), val)
+
+	levelDB.AddSNSSuccess(100)
+	val = levelDB.GetSNSSuccess()
+	assert.Equal(t, int64(100), val)
+
+	levelDB.AddSNSError(110)
+	val = levelDB.GetSNSError()
+	assert.Equal(t, int64(110), val)
+
+	levelDB.Set("gorush-test-key", 10)
+	levelDB.Add("gorush-test-key", 5)
+	val = levelDB.Get("gorush-test-key")
+	assert.Equal(t, int64(15), val)
+	levelDB.Del("gorush-test-key")
+	val = levelDB.Get("gorush-test-key")
+	assert.Equal(t, int64(0), val)
+
+	levelDB.SetData("gorush-test-data", []byte(`[{"platform":1}]`))
+	assert.Equal(t, []byte(`[{"platform":1}]`), levelDB.GetData("gorush-test-data"))
+	levelDB.Del("gorush-test-data")
+	assert.Empty(t, levelDB.GetData("gorush-test-data"))
+
 	levelDB.Reset()
 	val = levelDB.GetAndroidError()
 	assert.Equal(t, int64(0), val)
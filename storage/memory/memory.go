@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"sync"
 	"sync/atomic"
 )
 
@@ -9,6 +10,9 @@ type statApp struct {
 	TotalCount int64         `json:"total_count"`
 	Ios        IosStatus     `json:"ios"`
 	Android    AndroidStatus `json:"android"`
+	Web        WebStatus     `json:"web"`
+	Huawei     HuaweiStatus  `json:"huawei"`
+	SNS        SNSStatus     `json:"sns"`
 }
 
 // AndroidStatus is android structure
@@ -17,6 +21,24 @@ type AndroidStatus struct {
 	PushError   int64 `json:"push_error"`
 }
 
+// WebStatus is web structure
+type WebStatus struct {
+	PushSuccess int64 `json:"push_success"`
+	PushError   int64 `json:"push_error"`
+}
+
+// HuaweiStatus is huawei structure
+type HuaweiStatus struct {
+	PushSuccess int64 `json:"push_success"`
+	PushError   int64 `json:"push_error"`
+}
+
+// SNSStatus is sns structure
+type SNSStatus struct {
+	PushSuccess int64 `json:"push_success"`
+	PushError   int64 `json:"push_error"`
+}
+
 // IosStatus is iOS structure
 type IosStatus struct {
 	PushSuccess int64 `json:"push_success"`
@@ -26,13 +48,18 @@ type IosStatus struct {
 // New func implements the storage interface for gorush (https://github.com/appleboy/gorush)
 func New() *Storage {
 	return &Storage{
-		stat: &statApp{},
+		stat:   &statApp{},
+		counts: make(map[string]*int64),
+		data:   make(map[string][]byte),
 	}
 }
 
 // Storage is interface structure
 type Storage struct {
-	stat *statApp
+	stat   *statApp
+	lock   sync.RWMutex
+	counts map[string]*int64
+	data   map[string][]byte
 }
 
 // Init client storage.
@@ -40,6 +67,11 @@ func (s *Storage) Init() error {
 	return nil
 }
 
+// Close the storage, nothing is kept open.
+func (s *Storage) Close() error {
+	return nil
+}
+
 // Reset Client storage.
 func (s *Storage) Reset() {
 	atomic.StoreInt64(&s.stat.TotalCount, 0)
@@ -47,6 +79,12 @@ func (s *Storage) Reset() {
 	atomic.StoreInt64(&s.stat.Ios.PushError, 0)
 	atomic.StoreInt64(&s.stat.Android.PushSuccess, 0)
 	atomic.StoreInt64(&s.stat.Android.PushError, 0)
+	atomic.StoreInt64(&s.stat.Web.PushSuccess, 0)
+	atomic.StoreInt64(&s.stat.Web.PushError, 0)
+	atomic.StoreInt64(&s.stat.Huawei.PushSuccess, 0)
+	atomic.StoreInt64(&s.stat.Huawei.PushError, 0)
+	atomic.StoreInt64(&s.stat.SNS.PushSuccess, 0)
+	atomic.StoreInt64(&s.stat.SNS.PushError, 0)
 }
 
 // AddTotalCount record push notification count.
@@ -108,3 +146,137 @@ func (s *Storage) GetAndroidError() int64 {
 
 	return count
 }
+
+// AddWebSuccess record counts of success Web push notification.
+func (s *Storage) AddWebSuccess(count int64) {
+	atomic.AddInt64(&s.stat.Web.PushSuccess, count)
+}
+
+// AddWebError record counts of error Web push notification.
+func (s *Storage) AddWebError(count int64) {
+	atomic.AddInt64(&s.stat.Web.PushError, count)
+}
+
+// GetWebSuccess show success counts of Web notification.
+func (s *Storage) GetWebSuccess() int64 {
+	count := atomic.LoadInt64(&s.stat.Web.PushSuccess)
+
+	return count
+}
+
+// GetWebError show error counts of Web notification.
+func (s *Storage) GetWebError() int64 {
+	count := atomic.LoadInt64(&s.stat.Web.PushError)
+
+	return count
+}
+
+// AddHuaweiSuccess record counts of success Huawei push notification.
+func (s *Storage) AddHuaweiSuccess(count int64) {
+	atomic.AddInt64(&s.stat.Huawei.PushSuccess, count)
+}
+
+// AddHuaweiError record counts of error Huawei push notification.
+func (s *Storage) AddHuaweiError(count int64) {
+	atomic.AddInt64(&s.stat.Huawei.PushError, count)
+}
+
+// GetHuaweiSuccess show success counts of Huawei notification.
+func (s *Storage) GetHuaweiSuccess() int64 {
+	count := atomic.LoadInt64(&s.stat.Huawei.PushSuccess)
+
+	return count
+}
+
+// GetHuaweiError show error counts of Huawei notification.
+func (s *Storage) GetHuaweiError() int64 {
+	count := atomic.LoadInt64(&s.stat.Huawei.PushError)
+
+	return count
+}
+
+// AddSNSSuccess record counts of success SNS push notification.
+func (s *Storage) AddSNSSuccess(count int64) {
+	atomic.AddInt64(&s.stat.SNS.PushSuccess, count)
+}
+
+// AddSNSError record counts of error SNS push notification.
+func (s *Storage) AddSNSError(count int64) {
+	atomic.AddInt64(&s.stat.SNS.PushError, count)
+}
+
+// GetSNSSuccess show success counts of SNS notification.
+func (s *Storage) GetSNSSuccess() int64 {
+	count := atomic.LoadInt64(&s.stat.SNS.PushSuccess)
+
+	return count
+}
+
+// GetSNSError show error counts of SNS notification.
+func (s *Storage) GetSNSError() int64 {
+	count := atomic.LoadInt64(&s.stat.SNS.PushError)
+
+	return count
+}
+
+func (s *Storage) counter(key string) *int64 {
+	s.lock.RLock()
+	count, ok := s.counts[key]
+	s.lock.RUnlock()
+	if ok {
+		return count
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if count, ok = s.counts[key]; !ok {
+		count = new(int64)
+		s.counts[key] = count
+	}
+
+	return count
+}
+
+// Add record count of the key.
+func (s *Storage) Add(key string, count int64) {
+	atomic.AddInt64(s.counter(key), count)
+}
+
+// Get show count of the key.
+func (s *Storage) Get(key string) int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if count, ok := s.counts[key]; ok {
+		return atomic.LoadInt64(count)
+	}
+
+	return 0
+}
+
+// Set replace count of the key.
+func (s *Storage) Set(key string, count int64) {
+	atomic.StoreInt64(s.counter(key), count)
+}
+
+// Del remove the key.
+func (s *Storage) Del(key string) {
+	s.lock.Lock()
+	delete(s.counts, key)
+	delete(s.data, key)
+	s.lock.Unlock()
+}
+
+// SetData save raw data of the key.
+func (s *Storage) SetData(key string, data []byte) {
+	s.lock.Lock()
+	s.data[key] = data
+	s.lock.Unlock()
+}
+
+// GetData show raw data of the key.
+func (s *Storage) GetData(key string) []byte {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.data[key]
+}
@@ -37,8 +37,47 @@ func TestMemoryEngine(t *testing.T) {
 	val = memory.GetAndroidError()
 	assert.Equal(t, int64(5), val)
 
+	memory.AddWebSuccess(6)
+	val = memory.GetWebSuccess()
+	assert.Equal(t, int64(6), val)
+
+	memory.AddWebError(7)
+	val = memory.GetWebError()
+	assert.Equal(t, int64(7), val)
+
+	memory.AddHuaweiSuccess(8)
+	val = memory.GetHuaweiSuccess()
+	assert.Equal(t, int64(8), val)
+
+	memory.AddHuaweiError(9)
+	val = memory.GetHuaweiError()
+	assert.Equal(t, int64(9), val)
+
+	memory.AddSNSSuccess(10)
+	val = memory.GetSNSSuccess()
+	assert.Equal(t, int64(10), val)
+
+	memory.AddSNSError(11)
+	val = memory.GetSNSError()
+	assert.Equal(t, int64(11), val)
+
+	memory.Set("gorush-test-key", 10)
+	memory.Add("gorush-test-key", 5)
+	val = memory.Get("gorush-test-key")
+	assert.Equal(t, int64(15), val)
+	memory.Del("gorush-test-key")
+	val = memory.Get("gorush-test-key")
+	assert.Equal(t, int64(0), val)
+
+	memory.SetData("gorush-test-data", []byte(`[{"platform":1}]`))
+	assert.Equal(t, []byte(`[{"platform":1}]`), memory.GetData("gorush-test-data"))
+	memory.Del("gorush-test-data")
+	assert.Empty(t, memory.GetData("gorush-test-data"))
+
 	// test reset db
 	memory.Reset()
 	val = memory.GetTotalCount()
 	assert.Equal(t, int64(0), val)
+
+	assert.Nil(t, memory.Close())
 }
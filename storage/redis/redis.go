@@ -36,6 +36,7 @@ func (s *Storage) Init() error {
 		Addr:     s.config.Stat.Redis.Addr,
 		Password: s.config.Stat.Redis.Password,
 		DB:       s.config.Stat.Redis.DB,
+		PoolSize: s.config.Stat.Redis.PoolSize,
 	})
 
 	_, err := redisClient.Ping().Result()
@@ -50,49 +51,65 @@ func (s *Storage) Init() error {
 	return nil
 }
 
+// key return the key with prefix, so replicas share counters of the same
+// prefix without colliding with other data in redis.
+func (s *Storage) key(key string) string {
+	return s.config.Stat.Redis.Prefix + key
+}
+
+// Close the redis client.
+func (s *Storage) Close() error {
+	if redisClient == nil {
+		return nil
+	}
+
+	return redisClient.Close()
+}
+
 // Reset Client storage.
 func (s *Storage) Reset() {
-	redisClient.Set(storage.TotalCountKey, strconv.Itoa(0), 0)
-	redisClient.Set(storage.IosSuccessKey, strconv.Itoa(0), 0)
-	redisClient.Set(storage.IosErrorKey, strconv.Itoa(0), 0)
-	redisClient.Set(storage.AndroidSuccessKey, strconv.Itoa(0), 0)
-	redisClient.Set(storage.AndroidErrorKey, strconv.Itoa(0), 0)
+	redisClient.Set(s.key(storage.TotalCountKey), strconv.Itoa(0), 0)
+	redisClient.Set(s.key(storage.IosSuccessKey), strconv.Itoa(0), 0)
+	redisClient.Set(s.key(storage.IosErrorKey), strconv.Itoa(0), 0)
+	redisClient.Set(s.key(storage.AndroidSuccessKey), strconv.Itoa(0), 0)
+	redisClient.Set(s.key(storage.AndroidErrorKey), strconv.Itoa(0), 0)
+	redisClient.Set(s.key(storage.WebSuccessKey), strconv.Itoa(0), 0)
+	redisClient.Set(s.key(storage.WebErrorKey), strconv.Itoa(0), 0)
+	redisClient.Set(s.key(storage.HuaweiSuccessKey), strconv.Itoa(0), 0)
+	redisClient.Set(s.key(storage.HuaweiErrorKey), strconv.Itoa(0), 0)
+	redisClient.Set(s.key(storage.SNSSuccessKey), strconv.Itoa(0), 0)
+	redisClient.Set(s.key(storage.SNSErrorKey), strconv.Itoa(0), 0)
 }
 
 // AddTotalCount record push notification count.
 func (s *Storage) AddTotalCount(count int64) {
-	total := s.GetTotalCount() + count
-	redisClient.Set(storage.TotalCountKey, strconv.Itoa(int(total)), 0)
+	redisClient.IncrBy(s.key(storage.TotalCountKey), count)
 }
 
 // AddIosSuccess record counts of success iOS push notification.
 func (s *Storage) AddIosSuccess(count int64) {
-	total := s.GetIosSuccess() + count
-	redisClient.Set(storage.IosSuccessKey, strconv.Itoa(int(total)), 0)
+	redisClient.IncrBy(s.key(storage.IosSuccessKey), count)
 }
 
 // AddIosError record counts of error iOS push notification.
 func (s *Storage) AddIosError(count int64) {
-	total := s.GetIosError() + count
-	redisClient.Set(storage.IosErrorKey, strconv.Itoa(int(total)), 0)
+	redisClient.IncrBy(s.key(storage.IosErrorKey), count)
 }
 
 // AddAndroidSuccess record counts of success Android push notification.
 func (s *Storage) AddAndroidSuccess(count int64) {
-	total := s.GetAndroidSuccess() + count
-	redisClient.Set(storage.AndroidSuccessKey, strconv.Itoa(int(total)), 0)
+	redisClient.IncrBy(s.key(storage.AndroidSuccessKey), count)
 }
 
 // AddAndroidError record counts of error Android push notification.
 func (s *Storage) AddAndroidError(count int64) {
-	total := s.GetAndroidError() + count
-	redisClient.Set(storage.AndroidErrorKey, strconv.Itoa(int(total)), 0)
+	redisClient.IncrBy(s.key(storage.AndroidErrorKey), count)
 }
 
 // GetTotalCount show counts of all notification.
 func (s *Storage) GetTotalCount() int64 {
 	var count int64
-	getInt64(storage.TotalCountKey, &count)
+	getInt64(s.key(storage.TotalCountKey), &count)
 
 	return count
 }
@@ -100,7 +117,7 @@ func (s *Storage) GetTotalCount() int64 {
 // GetIosSuccess show success counts of iOS notification.
 func (s *Storage) GetIosSuccess() int64 {
 	var count int64
-	getInt64(storage.IosSuccessKey, &count)
+	getInt64(s.key(storage.IosSuccessKey), &count)
 
 	return count
 }
@@ -108,7 +125,7 @@ func (s *Storage) GetIosSuccess() int64 {
 // GetIosError show error counts of iOS notification.
 func (s *Storage) GetIosError() int64 {
 	var count int64
-	getInt64(storage.IosErrorKey, &count)
+	getInt64(s.key(storage.IosErrorKey), &count)
 
 	return count
 }
@@ -116,7 +133,7 @@ func (s *Storage) GetIosError() int64 {
 // GetAndroidSuccess show success counts of Android notification.
 func (s *Storage) GetAndroidSuccess() int64 {
 	var count int64
-	getInt64(storage.AndroidSuccessKey, &count)
+	getInt64(s.key(storage.AndroidSuccessKey), &count)
 
 	return count
 }
@@ -124,7 +141,120 @@ func (s *Storage) GetAndroidSuccess() int64 {
 // GetAndroidError show error counts of Android notification.
 func (s *Storage) GetAndroidError() int64 {
 	var count int64
-	getInt64(storage.AndroidErrorKey, &count)
+	getInt64(s.key(storage.AndroidErrorKey), &count)
+
+	return count
+}
+
+// AddWebSuccess record counts of success Web push notification.
+func (s *Storage) AddWebSuccess(count int64) {
+	redisClient.IncrBy(s.key(storage.WebSuccessKey), count)
+}
+
+// AddWebError record counts of error Web push notification.
+func (s *Storage) AddWebError(count int64) {
+	redisClient.IncrBy(s.key(storage.WebErrorKey), count)
+}
+
+// GetWebSuccess show success counts of Web notification.
+func (s *Storage) GetWebSuccess() int64 {
+	var count int64
+	getInt64(s.key(storage.WebSuccessKey), &count)
+
+	return count
+}
+
+// GetWebError show error counts of Web notification.
+func (s *Storage) GetWebError() int64 {
+	var count int64
+	getInt64(s.key(storage.WebErrorKey), &count)
+
+	return count
+}
+
+// AddHuaweiSuccess record counts of success Huawei push notification.
+func (s *Storage) AddHuaweiSuccess(count int64) {
+	redisClient.IncrBy(s.key(storage.HuaweiSuccessKey), count)
+}
+
+// AddHuaweiError record counts of error Huawei push notification.
+func (s *Storage) AddHuaweiError(count int64) {
+	redisClient.IncrBy(s.key(storage.HuaweiErrorKey), count)
+}
+
+// GetHuaweiSuccess show success counts of Huawei notification.
+func (s *Storage) GetHuaweiSuccess() int64 {
+	var count int64
+	getInt64(s.key(storage.HuaweiSuccessKey), &count)
+
+	return count
+}
+
+// GetHuaweiError show error counts of Huawei notification.
+func (s *Storage) GetHuaweiError() int64 {
+	var count int64
+	getInt64(s.key(storage.HuaweiErrorKey), &count)
+
+	return count
+}
+
+// AddSNSSuccess record counts of success SNS push notification.
+func (s *Storage) AddSNSSuccess(count int64) {
+	redisClient.IncrBy(s.key(storage.SNSSuccessKey), count)
+}
+
+// AddSNSError record counts of error SNS push notification.
+func (s *Storage) AddSNSError(count int64) {
+	redisClient.IncrBy(s.key(storage.SNSErrorKey), count)
+}
+
+// GetSNSSuccess show success counts of SNS notification.
+func (s *Storage) GetSNSSuccess() int64 {
+	var count int64
+	getInt64(s.key(storage.SNSSuccessKey), &count)
+
+	return count
+}
+
+// GetSNSError show error counts of SNS notification.
+func (s *Storage) GetSNSError() int64 {
+	var count int64
+	getInt64(s.key(storage.SNSErrorKey), &count)
 
 	return count
 }
+
+// Add record count of the key.
+func (s *Storage) Add(key string, count int64) {
+	redisClient.IncrBy(s.key(key), count)
+}
+
+// Get show count of the key.
+func (s *Storage) Get(key string) int64 {
+	var count int64
+	getInt64(s.key(key), &count)
+
+	return count
+}
+
+// Set replace count of the key.
+func (s *Storage) Set(key string, count int64) {
+	redisClient.Set(s.key(key), strconv.FormatInt(count, 10), 0)
+}
+
+// Del remove the key.
+func (s *Storage) Del(key string) {
+	redisClient.Del(s.key(key))
+}
+
+// SetData save raw data of the key.
+func (s *Storage) SetData(key string, data []byte) {
+	redisClient.Set(s.key(key), data, 0)
+}
+
+// GetData show raw data of the key.
+func (s *Storage) GetData(key string) []byte {
+	data, _ := redisClient.Get(s.key(key)).Bytes()
+
+	return data
+}
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"sync"
 	"testing"
 
 	c "github.com/appleboy/gorush/config"
@@ -51,8 +52,87 @@ func TestRedisEngine(t *testing.T) {
 	val = redis.GetAndroidError()
 	assert.Equal(t, int64(50), val)
 
+	redis.AddWebSuccess(60)
+	val = redis.GetWebSuccess()
+	assert.Equal(t, int64(60), val)
+
+	redis.AddWebError(70)
+	val = redis.GetWebError()
+	assert.Equal(t, int64(70), val)
+
+	redis.AddHuaweiSuccess(80)
+	val = redis.GetHuaweiSuccess()
+	assert.Equal(t, int64(80), val)
+
+	redis.AddHuaweiError(90)
+	val = redis.GetHuaweiError()
+	assert.Equal(t, int64(90), val)
+
+	redis.AddSNSSuccess(100)
+	val = redis.GetSNSSuccess()
+	assert.Equal(t, int64(100), val)
+
+	redis.AddSNSError(110)
+	val = redis.GetSNSError()
+	assert.Equal(t, int64(110), val)
+
+	redis.Set("gorush-test-key", 10)
+	redis.Add("gorush-test-key", 5)
+	val = redis.Get("gorush-test-key")
+	assert.Equal(t, int64(15), val)
+	redis.Del("gorush-test-key")
+	val = redis.Get("gorush-test-key")
+	assert.Equal(t, int64(0), val)
+
+	redis.SetData("gorush-test-data", []byte(`[{"platform":1}]`))
+	assert.Equal(t, []byte(`[{"platform":1}]`), redis.GetData("gorush-test-data"))
+	redis.Del("gorush-test-data")
+	assert.Empty(t, redis.GetData("gorush-test-data"))
+
 	// test reset db
 	redis.Reset()
 	val = redis.GetAndroidError()
 	assert.Equal(t, int64(0), val)
+
+	assert.NoError(t, redis.Close())
+}
+
+func TestRedisSharedCounters(t *testing.T) {
+	config, _ := c.LoadConf("")
+	config.Stat.Redis.Addr = "redis:6379"
+	config.Stat.Redis.Prefix = "fleet:"
+	other := config
+	other.Stat.Redis.Prefix = "other:"
+
+	replicas := []*Storage{New(config), New(config)}
+	for _, replica := range replicas {
+		assert.NoError(t, replica.Init())
+	}
+	isolated := New(other)
+	assert.NoError(t, isolated.Init())
+	replicas[0].Reset()
+	isolated.Reset()
+
+	var wg sync.WaitGroup
+	for _, replica := range replicas {
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(s *Storage) {
+				defer wg.Done()
+				s.AddTotalCount(1)
+				s.AddIosSuccess(2)
+			}(replica)
+		}
+	}
+	wg.Wait()
+
+	// all replicas count to the same keys.
+	for _, replica := range replicas {
+		assert.Equal(t, int64(100), replica.GetTotalCount())
+		assert.Equal(t, int64(200), replica.GetIosSuccess())
+	}
+	assert.Equal(t, int64(0), isolated.GetTotalCount())
+
+	replicas[0].Reset()
+	assert.NoError(t, replicas[0].Close())
 }
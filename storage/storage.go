@@ -15,20 +15,57 @@ const (
 
 	// AndroidErrorKey is key name for android error count of storage
 	AndroidErrorKey = "gorush-android-error-count"
+
+	// WebSuccessKey is key name for web success count of storage
+	WebSuccessKey = "gorush-web-success-count"
+
+	// WebErrorKey is key name for web error count of storage
+	WebErrorKey = "gorush-web-error-count"
+
+	// HuaweiSuccessKey is key name for huawei success count of storage
+	HuaweiSuccessKey = "gorush-huawei-success-count"
+
+	// HuaweiErrorKey is key name for huawei error count of storage
+	HuaweiErrorKey = "gorush-huawei-error-count"
+
+	// SNSSuccessKey is key name for sns success count of storage
+	SNSSuccessKey = "gorush-sns-success-count"
+
+	// SNSErrorKey is key name for sns error count of storage
+	SNSErrorKey = "gorush-sns-error-count"
 )
 
 // Storage interface
 type Storage interface {
 	Init() error
+	Close() error
 	Reset()
 	AddTotalCount(int64)
 	AddIosSuccess(int64)
 	AddIosError(int64)
 	AddAndroidSuccess(int64)
 	AddAndroidError(int64)
+	AddWebSuccess(int64)
+	AddWebError(int64)
+	AddHuaweiSuccess(int64)
+	AddHuaweiError(int64)
+	AddSNSSuccess(int64)
+	AddSNSError(int64)
 	GetTotalCount() int64
 	GetIosSuccess() int64
 	GetIosError() int64
 	GetAndroidSuccess() int64
 	GetAndroidError() int64
+	GetWebSuccess() int64
+	GetWebError() int64
+	GetHuaweiSuccess() int64
+	GetHuaweiError() int64
+	GetSNSSuccess() int64
+	GetSNSError() int64
+	Add(string, int64)
+	Get(string) int64
+	Set(string, int64)
+	Del(string)
+	SetData(string, []byte)
+	GetData(string) []byte
 }